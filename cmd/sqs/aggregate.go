@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+const (
+	// maxMessageBytes is the largest message body SQS accepts.
+	maxMessageBytes = 262144
+
+	// aggregateVisibilityTimeout keeps pending messages hidden while an
+	// envelope fills up across several receives.
+	aggregateVisibilityTimeout = 60
+)
+
+// aggregator combines small source messages into envelope messages of the
+// form {"<envelope>": [<body>, ...]} for consumers that switched to batch
+// APIs. JSON bodies are embedded as values, anything else as strings.
+type aggregator struct {
+	size     int
+	envelope string
+
+	pending      []*types.Message
+	pendingBytes int
+}
+
+// add queues messages and sends every envelope that is full.
+func (a *aggregator) add(ctx context.Context, m *mover.Mover, opts mover.Options, messages []*types.Message) (mover.Result, error) {
+	var result mover.Result
+	var forward, dropped []*types.Message
+
+	for _, message := range messages {
+		if opts.Drop != nil && opts.Drop(message) {
+			dropped = append(dropped, message)
+		} else {
+			forward = append(forward, message)
+		}
+	}
+
+	if len(dropped) > 0 {
+		batch, err := m.Transfer(ctx, opts, dropped)
+		result.Dropped += batch.Dropped
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, message := range forward {
+		size := len(aws.ToString(message.Body)) + 1
+		if len(a.pending) > 0 && a.pendingBytes+size+len(a.envelope)+8 > maxMessageBytes {
+			batch, err := a.flush(ctx, m, opts)
+			result.Moved += batch.Moved
+			result.Sent += batch.Sent
+			if err != nil {
+				return result, err
+			}
+		}
+
+		a.pending = append(a.pending, message)
+		a.pendingBytes += size
+
+		if len(a.pending) >= a.size {
+			batch, err := a.flush(ctx, m, opts)
+			result.Moved += batch.Moved
+			result.Sent += batch.Sent
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// flush sends the pending messages as one envelope and deletes them from the
+// source. Messages of an envelope that can't be sent are released by the
+// transfer, so either way they are no longer pending.
+func (a *aggregator) flush(ctx context.Context, m *mover.Mover, opts mover.Options) (mover.Result, error) {
+	if len(a.pending) == 0 {
+		return mover.Result{}, nil
+	}
+
+	opts.Drop = nil
+	opts.Entries = archiveEntries(timeEntries(a.envelopeEntries))
+
+	result, err := m.Transfer(ctx, opts, a.pending)
+	a.pending, a.pendingBytes = nil, 0
+
+	return result, err
+}
+
+// release gives the pending messages back to the source when a move aborts.
+func (a *aggregator) release(ctx context.Context, m *mover.Mover, opts mover.Options) {
+	if len(a.pending) == 0 {
+		return
+	}
+
+	if err := m.Release(ctx, opts.SourceQueueURL, a.pending); err != nil {
+		log.Warn(color.New(color.FgYellow).Sprintf("Failed to release %d pending messages, they reappear after %ds: %s", len(a.pending), aggregateVisibilityTimeout, err))
+	}
+
+	a.pending, a.pendingBytes = nil, 0
+}
+
+// envelopeEntries combines messages into the entry for a single envelope.
+func (a *aggregator) envelopeEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	records := make([]interface{}, len(messages))
+	for i, message := range messages {
+		body, err := redactBody(aws.ToString(message.Body), redactRules)
+		if err != nil {
+			return nil, err
+		}
+
+		if doc, ok := decodeJSON(body); ok {
+			records[i] = doc
+		} else {
+			records[i] = body
+		}
+	}
+
+	body, err := encodeJSON(map[string]interface{}{a.envelope: records})
+	if err != nil {
+		return nil, err
+	}
+
+	// The envelope takes its ID and FIFO group from the first message.
+	envelope := &types.Message{MessageId: messages[0].MessageId, Attributes: messages[0].Attributes, Body: aws.String(body)}
+
+	return prepareEntries([]*types.Message{envelope})
+}
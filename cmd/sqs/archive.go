@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// messageArchive appends the source messages of a move to a file as dump
+// records, before they are sent, so a move gone wrong can be replayed from it
+// with load. Every batch is synced to disk before the move goes on.
+type messageArchive struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var activeArchive *messageArchive
+
+// openMessageArchive opens path for appending, so the archives of several
+// runs can share a file.
+func openMessageArchive(path string) (*messageArchive, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageArchive{file: file}, nil
+}
+
+// write appends the records of messages and waits until they are on disk.
+func (a *messageArchive) write(messages []*types.Message) error {
+	var lines []byte
+	for _, message := range messages {
+		line, err := json.Marshal(newDumpRecord(message))
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(lines); err != nil {
+		return err
+	}
+
+	return a.file.Sync()
+}
+
+// archiveEntries archives the messages of every batch before entries builds
+// what is sent for them, when there is an archive, so no message leaves the
+// source without a copy on disk.
+func archiveEntries(entries func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error)) func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	if activeArchive == nil {
+		return entries
+	}
+
+	return func(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+		if err := activeArchive.write(messages); err != nil {
+			return nil, fmt.Errorf("unable to archive the messages: %s", err)
+		}
+
+		return entries(messages)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// receiveAttributeNames lists the system attributes requested from the
+// source on top of anything a mode needs for itself.
+func receiveAttributeNames(extra ...string) []string {
+	var names []string
+
+	if !*stripAttributes {
+		names = append(names, string(types.MessageSystemAttributeNameAWSTraceHeader))
+	}
+
+	if wrapCloudEvents != nil || expireAge > 0 || expiryLifetime > 0 || activeManifest != nil {
+		extra = append(extra, string(types.MessageSystemAttributeNameSentTimestamp))
+	}
+
+	// The receive counts of moved messages are reported in the summary.
+	extra = append(extra, string(types.MessageSystemAttributeNameApproximateReceiveCount), string(types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp))
+
+	extra = append(extra, activeFifo.fifoAttributeNames()...)
+	if *verifyOrder {
+		extra = append(extra, string(types.MessageSystemAttributeNameSequenceNumber))
+	}
+	extra = append(extra, activeFilter.systemAttributeNames()...)
+
+	return append(names, extra...)
+}
+
+// queueAttributeNames converts attribute names for the AttributeNames of a
+// receive, which emulators still read instead of MessageSystemAttributeNames.
+func queueAttributeNames(names []string) []types.QueueAttributeName {
+	converted := make([]types.QueueAttributeName, len(names))
+	for i, name := range names {
+		converted[i] = types.QueueAttributeName(name)
+	}
+
+	return converted
+}
+
+// receiveMessageAttributeNames requests every custom message attribute unless
+// --strip-attributes is set, in which case only the attributes the filter
+// and --dedupe-by need are requested. With --message-attribute only the
+// selected ones and those needed are, which keeps receives small on queues whose
+// messages carry many attributes.
+func receiveMessageAttributeNames() []string {
+	needed := activeFilter.attributeNames()
+	if dedupeAttribute != "" {
+		needed = append(needed, dedupeAttribute)
+	}
+
+	if *stripAttributes {
+		return needed
+	}
+
+	if len(*messageAttributes) > 0 {
+		return append(append([]string{}, *messageAttributes...), needed...)
+	}
+
+	return []string{"All"}
+}
+
+// keepAttribute reports whether a received message attribute is carried over:
+// any of them by default, or those --message-attribute selects, by name or by
+// a PREFIX.* pattern as SQS understands it.
+func keepAttribute(name string) bool {
+	if len(*messageAttributes) == 0 {
+		return true
+	}
+
+	for _, selected := range *messageAttributes {
+		if selected == name || (strings.HasSuffix(selected, ".*") && strings.HasPrefix(name, strings.TrimSuffix(selected, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyAttributes carries the message attributes and the X-Ray trace header
+// of a received message over to its destination entry.
+func copyAttributes(message *types.Message, entry *types.SendMessageBatchRequestEntry) {
+	if *stripAttributes {
+		return
+	}
+
+	if len(message.MessageAttributes) > 0 {
+		entry.MessageAttributes = make(map[string]types.MessageAttributeValue, len(message.MessageAttributes))
+		for name, value := range message.MessageAttributes {
+			if keepAttribute(name) {
+				entry.MessageAttributes[name] = value
+			}
+		}
+	}
+
+	if header, ok := message.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)]; ok {
+		entry.MessageSystemAttributes = map[string]types.MessageSystemAttributeValue{
+			string(types.MessageSystemAttributeNameForSendsAWSTraceHeader): {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(header),
+			},
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// avroCodec decodes base64 encoded Avro bodies in the Confluent wire format:
+// a zero magic byte, a big-endian schema ID and the Avro binary encoding.
+// Schemas are fetched from the registry by ID and cached. The JSON form uses
+// the standard Avro JSON encoding, so union values appear wrapped in their
+// type name, e.g. {"email": {"string": "..."}}.
+type avroCodec struct {
+	registry string
+	client   *http.Client
+
+	mu     sync.Mutex
+	codecs map[uint32]*goavro.Codec
+}
+
+func newAvroCodec(registry string) *avroCodec {
+	return &avroCodec{
+		registry: strings.TrimSuffix(registry, "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		codecs:   map[uint32]*goavro.Codec{},
+	}
+}
+
+// decodeWire splits a body into its schema ID and Avro payload.
+func decodeWire(body string) (uint32, []byte, error) {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(data) < 5 || data[0] != 0 {
+		return 0, nil, fmt.Errorf("body is not in the schema registry wire format")
+	}
+
+	return binary.BigEndian.Uint32(data[1:5]), data[5:], nil
+}
+
+func (c *avroCodec) toJSON(body string) (string, error) {
+	id, payload, err := decodeWire(body)
+	if err != nil {
+		return "", err
+	}
+
+	codec, err := c.codec(id)
+	if err != nil {
+		return "", err
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return "", err
+	}
+
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return "", err
+	}
+
+	return string(textual), nil
+}
+
+// fromJSON re-encodes document with the schema the original body used.
+func (c *avroCodec) fromJSON(original string, document string) (string, error) {
+	id, _, err := decodeWire(original)
+	if err != nil {
+		return "", err
+	}
+
+	codec, err := c.codec(id)
+	if err != nil {
+		return "", err
+	}
+
+	native, _, err := codec.NativeFromTextual([]byte(document))
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 5, 5+len(document))
+	binary.BigEndian.PutUint32(data[1:5], id)
+
+	data, err = codec.BinaryFromNative(data, native)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (c *avroCodec) codec(id uint32) (*goavro.Codec, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if codec, ok := c.codecs[id]; ok {
+		return codec, nil
+	}
+
+	resp, err := c.client.Get(fmt.Sprintf("%s/schemas/ids/%d", c.registry, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema registry responded with %s for schema %d", resp.Status, id)
+	}
+
+	var schema struct {
+		Schema string `json:"schema"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
+		return nil, fmt.Errorf("parsing schema %d: %s", id, err)
+	}
+
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("compiling schema %d: %s", id, err)
+	}
+
+	c.codecs[id] = codec
+	return codec, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+const (
+	// benchBatchSize is the number of messages in every batch sent, received
+	// and deleted by bench-transport.
+	benchBatchSize = 10
+
+	// benchMaxEmptyReceives is how many empty receives in a row end a
+	// worker's draining, as standard queues may answer a receive with
+	// nothing while they still hold messages.
+	benchMaxEmptyReceives = 5
+)
+
+// benchResult is what one transport did in bench-transport.
+type benchResult struct {
+	transport string
+	calls     int64
+	messages  int64
+	elapsed   time.Duration
+
+	// allocated and mallocs are the heap bytes and objects the process
+	// allocated during the run.
+	allocated uint64
+	mallocs   uint64
+}
+
+// runBenchTransport sends, receives and deletes the same messages through a
+// temporary queue with the SDK and then the raw transport, and prints how
+// long each took and what it allocated, to tell whether the raw transport is
+// worth keeping. It returns the exit code.
+func runBenchTransport(svc *sqs.Client, batches int, workers int, bodySize int) int {
+	log.Info(color.New(color.FgCyan).Sprintf("Moving %d batches of %d messages of %d bytes with %d workers through each transport", batches, benchBatchSize, bodySize, workers))
+
+	var results []benchResult
+
+	for _, name := range []string{"sdk", "raw"} {
+		var client mover.SQSAPI = svc
+		if name == "raw" {
+			client = newRawClient(svc)
+		}
+
+		result, err := benchTransport(svc, client, name, batches, workers, bodySize)
+		if err != nil {
+			logAwsError("Failed to benchmark the "+name+" transport", err)
+			return failureCode(err, exitFailed)
+		}
+
+		results = append(results, result)
+	}
+
+	fmt.Printf("%-10s %8s %10s %10s %12s %12s %12s\n", "transport", "calls", "seconds", "calls/s", "messages/s", "bytes/call", "allocs/call")
+	for _, r := range results {
+		seconds := r.elapsed.Seconds()
+		fmt.Printf("%-10s %8d %10.2f %10.1f %12.1f %12d %12d\n", r.transport, r.calls, seconds,
+			float64(r.calls)/seconds, float64(r.messages)/seconds, r.allocated/uint64(r.calls), r.mallocs/uint64(r.calls))
+	}
+
+	sdk, raw := results[0], results[1]
+	log.Info(color.New(color.FgCyan).Sprintf("raw took %s of the time of sdk and allocated %s of its bytes per call",
+		percent(raw.elapsed.Seconds(), sdk.elapsed.Seconds()), percent(float64(raw.allocated)/float64(raw.calls), float64(sdk.allocated)/float64(sdk.calls))))
+
+	return 0
+}
+
+// benchTransport moves the messages of one transport through a queue of its
+// own, created for the run and deleted afterwards, so the transports don't
+// see each other's messages.
+func benchTransport(svc *sqs.Client, client mover.SQSAPI, name string, batches int, workers int, bodySize int) (benchResult, error) {
+	created, err := svc.CreateQueue(runCtx, &sqs.CreateQueueInput{
+		QueueName: aws.String(fmt.Sprintf("sqsmover-bench-%s-%d", name, time.Now().UnixNano())),
+		Attributes: map[string]string{
+			string(types.QueueAttributeNameMessageRetentionPeriod): "60",
+		},
+	})
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	queueURL := aws.ToString(created.QueueUrl)
+	defer func() {
+		if _, err := svc.DeleteQueue(context.WithoutCancel(runCtx), &sqs.DeleteQueueInput{QueueUrl: aws.String(queueURL)}); err != nil {
+			logAwsError("Failed to delete the benchmark queue "+queueURL, err)
+		}
+	}()
+
+	body := aws.String(strings.Repeat("x", bodySize))
+	total := int64(batches * benchBatchSize)
+
+	var (
+		calls  atomic.Int64
+		moved  atomic.Int64
+		next   atomic.Int64
+		before runtime.MemStats
+		after  runtime.MemStats
+	)
+
+	send := func() error {
+		for next.Add(1) <= int64(batches) {
+			entries := make([]types.SendMessageBatchRequestEntry, benchBatchSize)
+			for i := range entries {
+				entries[i] = types.SendMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: body}
+			}
+
+			resp, err := client.SendMessageBatch(runCtx, &sqs.SendMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries})
+			calls.Add(1)
+			if err != nil {
+				return err
+			}
+			if len(resp.Failed) > 0 {
+				return fmt.Errorf("%d messages of a batch were refused: %s", len(resp.Failed), aws.ToString(resp.Failed[0].Message))
+			}
+		}
+		return nil
+	}
+
+	drain := func() error {
+		for empty := 0; moved.Load() < total && empty < benchMaxEmptyReceives; {
+			resp, err := client.ReceiveMessage(runCtx, &sqs.ReceiveMessageInput{
+				QueueUrl:            aws.String(queueURL),
+				MaxNumberOfMessages: benchBatchSize,
+				VisibilityTimeout:   30,
+				WaitTimeSeconds:     1,
+			})
+			calls.Add(1)
+			if err != nil {
+				return err
+			}
+
+			if len(resp.Messages) == 0 {
+				empty++
+				continue
+			}
+			empty = 0
+
+			entries := make([]types.DeleteMessageBatchRequestEntry, len(resp.Messages))
+			for i, message := range resp.Messages {
+				entries[i] = types.DeleteMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), ReceiptHandle: message.ReceiptHandle}
+			}
+
+			if _, err := client.DeleteMessageBatch(runCtx, &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries}); err != nil {
+				return err
+			}
+			calls.Add(1)
+			moved.Add(int64(len(resp.Messages)))
+		}
+		return nil
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for _, phase := range []func() error{send, drain} {
+		if err := benchConcurrently(workers, phase); err != nil {
+			return benchResult{}, err
+		}
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if moved.Load() < total {
+		return benchResult{}, fmt.Errorf("received only %d of the %d messages sent", moved.Load(), total)
+	}
+
+	return benchResult{
+		transport: name,
+		calls:     calls.Load(),
+		messages:  total,
+		elapsed:   elapsed,
+		allocated: after.TotalAlloc - before.TotalAlloc,
+		mallocs:   after.Mallocs - before.Mallocs,
+	}, nil
+}
+
+// benchConcurrently runs work on that many goroutines and returns the
+// first error.
+func benchConcurrently(workers int, work func() error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := work(); err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// percent formats part as a percentage of whole.
+func percent(part float64, whole float64) string {
+	if whole == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.0f%%", 100*part/whole)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// diffContext is how many unchanged lines a diff shows around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the table diffLines fills in. Bodies with more lines
+// than that allows are shown as replaced as a whole.
+const maxDiffCells = 4_000_000
+
+// bodyDiff is the unified diff of a body a transform rewrote.
+type bodyDiff struct {
+	MessageID string `json:"message_id"`
+	Diff      string `json:"diff"`
+}
+
+// bodyDiffs collects the diffs of the first bodies the transforms change,
+// and counts the bodies they change.
+type bodyDiffs struct {
+	mu        sync.Mutex
+	sample    int
+	rewritten int
+	diffs     []bodyDiff
+}
+
+// activeDiffs is set while simulating with --transform, so the transforms
+// report what they change.
+var activeDiffs *bodyDiffs
+
+// record compares the body of a message before and after the transforms.
+// Bodies in a --codec format are compared as the JSON the transforms saw,
+// and JSON bodies are indented with their keys sorted, so a diff shows the
+// fields that changed rather than the order set and del write them in.
+func (d *bodyDiffs) record(id string, before string, after string) {
+	if before == after {
+		return
+	}
+
+	original, transformed := comparableBody(before), comparableBody(after)
+	if original == transformed {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rewritten++
+	if len(d.diffs) >= d.sample {
+		return
+	}
+
+	d.diffs = append(d.diffs, bodyDiff{
+		MessageID: id,
+		Diff:      unifiedDiff(id, strings.Split(original, "\n"), strings.Split(transformed, "\n")),
+	})
+}
+
+// comparableBody decodes body and, when it is JSON, indents it with its keys
+// sorted.
+func comparableBody(body string) string {
+	document := decodeBody(body)
+
+	doc, ok := decodeJSON(document)
+	if !ok {
+		return document
+	}
+
+	encoded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return document
+	}
+
+	return string(encoded)
+}
+
+// print writes the diffs collected, coloured like git diff.
+func (d *bodyDiffs) print() {
+	for _, diff := range d.diffs {
+		fmt.Println()
+		for _, line := range strings.Split(strings.TrimSuffix(diff.Diff, "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+				color.New(color.Bold).Println(line)
+			case strings.HasPrefix(line, "@@"):
+				color.New(color.FgCyan).Println(line)
+			case strings.HasPrefix(line, "-"):
+				color.New(color.FgRed).Println(line)
+			case strings.HasPrefix(line, "+"):
+				color.New(color.FgGreen).Println(line)
+			default:
+				fmt.Println(line)
+			}
+		}
+	}
+}
+
+// diffOp is a line of a diff: kept, removed or added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the edit from a to b that keeps their longest common
+// subsequence of lines.
+func diffLines(a []string, b []string) []diffOp {
+	// Lines both sides start or end with need no table.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if (len(x)+1)*(len(y)+1) > maxDiffCells {
+		for _, line := range x {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range y {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		// common[i][j] is the length of the longest common subsequence of
+		// x[i:] and y[j:].
+		common := make([][]int, len(x)+1)
+		for i := range common {
+			common[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else {
+					common[i][j] = max(common[i+1][j], common[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				ops = append(ops, diffOp{' ', x[i]})
+				i++
+				j++
+			case j == len(y) || (i < len(x) && common[i+1][j] >= common[i][j+1]):
+				ops = append(ops, diffOp{'-', x[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', y[j]})
+				j++
+			}
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+// unifiedDiff formats the diff of the body of message id in the unified
+// format of diff -u, with diffContext lines around each change.
+func unifiedDiff(id string, a []string, b []string) string {
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (original)\n+++ %s (transformed)\n", id, id)
+
+	// lineA and lineB are the lines of a and b before ops[i].
+	lineA, lineB := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		lineA[i+1], lineB[i+1] = lineA[i], lineB[i]
+		if op.kind != '+' {
+			lineA[i+1]++
+		}
+		if op.kind != '-' {
+			lineB[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// A hunk runs from diffContext lines before a change to diffContext
+		// lines after the last change closer than twice that to the next.
+		start := max(i-diffContext, 0)
+		end := i
+		for k := i; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k + 1
+			} else if k-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(lineA[start], lineA[end]-lineA[start]), hunkRange(lineB[start], lineB[end]-lineB[start]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+		}
+
+		i = end
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk, where start
+// counts the lines before it.
+func hunkRange(start int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// errBounced stops a move once --bounce-limit messages came back.
+var errBounced = errors.New("moved messages came back to the source")
+
+// bounceCheck notices messages a move sent that reach its source again, as
+// when a redrive from a dead-letter queue hands its consumers messages they
+// still fail on, and the redrive policy returns them. SQS keeps the message
+// ID across a redrive, so a received message is a bounce when its ID is one
+// a destination gave a message of the run. Bounces are left in the source,
+// and the move is stopped once limit of them came back.
+type bounceCheck struct {
+	limit int
+
+	mu      sync.Mutex
+	sent    map[string]bool
+	bounced map[string]bool
+
+	// stop cancels the move in progress with errBounced.
+	stop context.CancelCauseFunc
+}
+
+var activeBounces *bounceCheck
+
+func newBounceCheck(limit int) *bounceCheck {
+	return &bounceCheck{limit: limit, sent: map[string]bool{}, bounced: map[string]bool{}}
+}
+
+// event notes the message IDs of sent batches, as mover.Options.Events.
+func (c *bounceCheck) event(event mover.Event) {
+	sent, ok := event.(*mover.BatchSent)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range sent.MessageIDs {
+		c.sent[id] = true
+	}
+}
+
+// bounce reports whether message was sent by this run and came back, and
+// stops the move when it is the bounce that reaches the limit.
+func (c *bounceCheck) bounce(message *types.Message) bool {
+	id := aws.ToString(message.MessageId)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.sent[id] {
+		return false
+	}
+
+	if !c.bounced[id] {
+		c.bounced[id] = true
+		if len(c.bounced) == c.limit && c.stop != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("%d moved messages came back to the source, stopping the move", c.limit))
+			c.stop(errBounced)
+		}
+	}
+
+	return true
+}
+
+// count returns how many distinct messages came back.
+func (c *bounceCheck) count() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.bounced)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// defaultCloudEventsType is used when no type is configured or a jsonpath
+// type doesn't match the body.
+const defaultCloudEventsType = "com.sqsmover.message"
+
+// cloudEventsMapping configures --to-cloudevents. Type and source are either
+// constants or `jsonpath:<expr>` lookups into the body.
+type cloudEventsMapping struct {
+	eventType string
+	source    string
+
+	typePath   jsonPath
+	sourcePath jsonPath
+}
+
+var (
+	wrapCloudEvents   *cloudEventsMapping
+	unwrapCloudEvents bool
+)
+
+func newCloudEventsMapping(eventType string, source string) (*cloudEventsMapping, error) {
+	m := &cloudEventsMapping{eventType: eventType, source: source}
+
+	if strings.HasPrefix(eventType, "jsonpath:") {
+		path, err := parseJSONPath(strings.TrimPrefix(eventType, "jsonpath:"))
+		if err != nil {
+			return nil, err
+		}
+		m.typePath = path
+		m.eventType = defaultCloudEventsType
+	}
+
+	if strings.HasPrefix(source, "jsonpath:") {
+		path, err := parseJSONPath(strings.TrimPrefix(source, "jsonpath:"))
+		if err != nil {
+			return nil, err
+		}
+		m.sourcePath = path
+		m.source = "sqsmover"
+	}
+
+	return m, nil
+}
+
+// wrap returns body inside a structured-mode CloudEvents 1.0 JSON envelope.
+func (m *cloudEventsMapping) wrap(id string, body string, origin *types.Message) string {
+	event := map[string]interface{}{
+		"specversion": "1.0",
+		"id":          id,
+		"type":        m.eventType,
+		"source":      m.source,
+	}
+
+	if sent := sentTimestamp(origin); !sent.IsZero() {
+		event["time"] = sent.UTC().Format(time.RFC3339Nano)
+	}
+
+	if doc, ok := decodeJSON(decodeBody(body)); ok {
+		event["datacontenttype"] = "application/json"
+		event["data"] = doc
+		m.mapFrom(event, doc)
+	} else {
+		event["datacontenttype"] = "text/plain"
+		event["data"] = body
+	}
+
+	encoded, err := encodeJSON(event)
+	if err != nil {
+		return body
+	}
+
+	return encoded
+}
+
+func (m *cloudEventsMapping) mapFrom(event map[string]interface{}, doc interface{}) {
+	if m.typePath != nil {
+		if values := m.typePath.get(doc); len(values) == 1 {
+			event["type"] = values[0]
+		}
+	}
+
+	if m.sourcePath != nil {
+		if values := m.sourcePath.get(doc); len(values) == 1 {
+			event["source"] = values[0]
+		}
+	}
+}
+
+// unwrapCloudEvent returns the data of a structured-mode CloudEvent, or body
+// unchanged when it isn't one.
+func unwrapCloudEvent(body string) string {
+	doc, ok := decodeJSON(body)
+	if !ok {
+		return body
+	}
+
+	event, ok := doc.(map[string]interface{})
+	if !ok || event["specversion"] == nil {
+		return body
+	}
+
+	if encoded, ok := event["data_base64"].(string); ok {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return body
+		}
+		return string(data)
+	}
+
+	switch data := event["data"].(type) {
+	case nil:
+		return ""
+	case string:
+		return data
+	default:
+		encoded, err := encodeJSON(data)
+		if err != nil {
+			return body
+		}
+		return encoded
+	}
+}
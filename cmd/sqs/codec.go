@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// payloadCodec converts binary message bodies to JSON and back, so that
+// filters, redaction and enrichment can work on queues that don't carry
+// JSON text.
+type payloadCodec interface {
+	toJSON(body string) (string, error)
+	fromJSON(original string, document string) (string, error)
+}
+
+// activeCodec is set when a payload format such as --proto-type is given.
+var activeCodec payloadCodec
+
+// decodeBody returns the JSON form of body, or body itself when no codec is
+// configured or the body can't be decoded.
+func decodeBody(body string) string {
+	if activeCodec == nil {
+		return body
+	}
+
+	document, err := activeCodec.toJSON(body)
+	if err != nil {
+		return body
+	}
+
+	return document
+}
+
+// decodeForRewrite returns the JSON form of body for a rewrite that
+// encodeBody encodes back. Unlike decodeBody, a body the codec can't decode
+// is an error, since the rewrite would otherwise be skipped or run on the
+// encoded bytes.
+func decodeForRewrite(body string) (string, error) {
+	if activeCodec == nil {
+		return body, nil
+	}
+
+	document, err := activeCodec.toJSON(body)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode the body: %s", err)
+	}
+
+	return document, nil
+}
+
+// encodeBody re-encodes a JSON document produced from original. A document
+// the codec can't encode is an error rather than a reason to fall back to
+// original, which would undo a redaction or a transform.
+func encodeBody(original string, document string) (string, error) {
+	if activeCodec == nil {
+		return document, nil
+	}
+
+	body, err := activeCodec.fromJSON(original, document)
+	if err != nil {
+		return "", fmt.Errorf("unable to re-encode the rewritten body: %s", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// runCollapse collapses the messages of one run that carry the same payload,
+// such as the identical retries a dead-letter queue piles up, into the first
+// of them that was sent. Unlike the dedup store it remembers nothing across
+// runs.
+//
+// A copy only counts as a duplicate once the message it collapses into was
+// sent, so a first copy that fails to send, is set aside or is never sent
+// because the move stopped doesn't take the payload down with the others.
+// Copies received while the first is still on its way are held in the
+// source, skipped like messages the filter doesn't match, and collapsed when
+// they are received again after it was sent.
+type runCollapse struct {
+	// attribute is the message attribute duplicates share, or empty when
+	// they share their body.
+	attribute string
+
+	mu sync.Mutex
+	// sending has the message of each key that is on its way to the
+	// destination, kept the one that was sent, and held the copies received
+	// while it was on its way, by message ID.
+	sending    map[string]string
+	kept       map[string]string
+	held       map[string]map[string]*types.Message
+	wasHeld    map[string]bool
+	duplicates map[string]bool
+}
+
+var (
+	activeCollapse *runCollapse
+
+	// dedupeAttribute is the attribute --dedupe-by names, if any.
+	dedupeAttribute string
+)
+
+// parseDedupeBy parses --dedupe-by, body or attribute:NAME, and returns
+// the attribute it names.
+func parseDedupeBy(spec string) (string, error) {
+	if spec == "body" {
+		return "", nil
+	}
+
+	name, ok := strings.CutPrefix(spec, "attribute:")
+	if !ok || name == "" {
+		return "", fmt.Errorf("--dedupe-by must be body or attribute:NAME, not %q", spec)
+	}
+
+	return name, nil
+}
+
+func newRunCollapse(attribute string) *runCollapse {
+	return &runCollapse{
+		attribute:  attribute,
+		sending:    map[string]string{},
+		kept:       map[string]string{},
+		held:       map[string]map[string]*types.Message{},
+		wasHeld:    map[string]bool{},
+		duplicates: map[string]bool{},
+	}
+}
+
+// key hashes what duplicates of message share. An attribute is hashed with
+// its data type, so a Number and a String of the same text differ. Messages
+// without the attribute have no key and are never duplicates.
+func (c *runCollapse) key(message *types.Message) (string, bool) {
+	h := sha256.New()
+	if c.attribute == "" {
+		writeKeyPart(h, []byte(aws.ToString(message.Body)))
+	} else {
+		value, ok := message.MessageAttributes[c.attribute]
+		if !ok {
+			return "", false
+		}
+		writeKeyPart(h, []byte(aws.ToString(value.DataType)))
+		writeKeyPart(h, []byte(aws.ToString(value.StringValue)))
+		writeKeyPart(h, value.BinaryValue)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// writeKeyPart writes part to the hash of a key after its length, so parts
+// can't run into each other: a string "ab" and binary "c" hash apart from a
+// string "a" and binary "bc".
+func writeKeyPart(h hash.Hash, part []byte) {
+	binary.Write(h, binary.BigEndian, uint32(len(part)))
+	h.Write(part)
+}
+
+// hold reports whether message must stay in the source for now because
+// another message with its key is on its way to the destination. A message
+// that isn't held and has no sent copy becomes the one on its way.
+func (c *runCollapse) hold(message *types.Message) bool {
+	key, ok := c.key(message)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.kept[key]; ok {
+		return false
+	}
+
+	id := aws.ToString(message.MessageId)
+	if sending, ok := c.sending[key]; ok && sending != id {
+		if c.held[key] == nil {
+			c.held[key] = map[string]*types.Message{}
+		}
+		c.held[key][id] = message
+		c.wasHeld[id] = true
+		return true
+	}
+
+	c.sending[key] = id
+	return false
+}
+
+// duplicate reports whether another message with the key of message was
+// sent in this run, noting it as collapsed if so. The message that was sent
+// is never its own duplicate, however often it is received.
+func (c *runCollapse) duplicate(message *types.Message) bool {
+	key, ok := c.key(message)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := aws.ToString(message.MessageId)
+	kept, ok := c.kept[key]
+	if !ok || kept == id {
+		return false
+	}
+
+	c.duplicates[id] = true
+	return true
+}
+
+// sent records the messages the destination accepted as the ones their
+// copies collapse into, as mover.Options.Sent, and returns the copies held
+// for them, so they can be released to be collapsed straight away.
+func (c *runCollapse) sent(messages []*types.Message) []*types.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var held []*types.Message
+	for _, message := range messages {
+		key, ok := c.key(message)
+		if !ok {
+			continue
+		}
+
+		if _, ok := c.kept[key]; !ok {
+			c.kept[key] = aws.ToString(message.MessageId)
+		}
+		delete(c.sending, key)
+
+		for _, copied := range c.held[key] {
+			held = append(held, copied)
+		}
+		delete(c.held, key)
+	}
+
+	return held
+}
+
+// collapsed counts the distinct messages found to be duplicates.
+func (c *runCollapse) collapsed() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.duplicates)
+}
+
+// reclaimed counts the duplicates that were held before they were
+// collapsed, which the mover counted as skipped as well.
+func (c *runCollapse) reclaimed() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for id := range c.duplicates {
+		if c.wasHeld[id] {
+			n++
+		}
+	}
+
+	return n
+}
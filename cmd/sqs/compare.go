@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// compareAttributes are the configuration attributes compare lines up, those
+// that change how a queue delivers the messages it holds.
+var compareAttributes = []types.QueueAttributeName{
+	types.QueueAttributeNameFifoQueue,
+	types.QueueAttributeNameContentBasedDeduplication,
+	types.QueueAttributeNameVisibilityTimeout,
+	types.QueueAttributeNameMessageRetentionPeriod,
+	types.QueueAttributeNameDelaySeconds,
+	types.QueueAttributeNameMaximumMessageSize,
+	types.QueueAttributeNameReceiveMessageWaitTimeSeconds,
+	types.QueueAttributeNameRedrivePolicy,
+	types.QueueAttributeNameKmsMasterKeyId,
+}
+
+// compareSide is one of the queues compare looks at.
+type compareSide struct {
+	url        string
+	attributes map[string]string
+	peeked     *diffSide
+}
+
+// readCompareSide reads the attributes of a queue and peeks at up to peek of
+// its messages, leaving them in the queue.
+func readCompareSide(svc *sqs.Client, queue string, peek int) (*compareSide, error) {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := allowQueue(queueURL); err != nil {
+		return nil, err
+	}
+
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	side := &compareSide{url: queueURL, attributes: attrs.Attributes, peeked: newDiffSide(queueNameFromURL(queueURL))}
+	if peek == 0 {
+		return side, nil
+	}
+
+	if side.peeked, err = readDiffQueue(svc, queueURL, peek); err != nil {
+		return nil, err
+	}
+
+	return side, nil
+}
+
+// runCompare prints the depths, oldest peeked messages and configuration of
+// two queues side by side, to check a migration before and after it ran.
+// With overlap it also counts the peeked bodies both queues hold. Nothing is
+// moved or deleted. It returns the exit code.
+func runCompare(svc *sqs.Client, a string, b string, peek int, overlap bool) int {
+	sides := make([]*compareSide, 2)
+
+	for i, queue := range []string{a, b} {
+		side, err := readCompareSide(svc, queue, peek)
+		if err != nil {
+			logAwsError("Failed to read "+queue, err)
+			return failureCode(err, exitQueue)
+		}
+		sides[i] = side
+	}
+
+	names := []string{queueNameFromURL(sides[0].url), queueNameFromURL(sides[1].url)}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Comparing %s and %s", names[0], names[1]))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tQUEUE\tVISIBLE\tIN FLIGHT\tDELAYED\tPEEKED\tOLDEST PEEKED")
+	for i, side := range sides {
+		fmt.Fprintf(w, "\t%s\t%d\t%d\t%d\t%d\t%s\n", names[i],
+			intAttribute(side.attributes, types.QueueAttributeNameApproximateNumberOfMessages),
+			intAttribute(side.attributes, types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+			intAttribute(side.attributes, types.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+			side.peeked.total, oldestAge(side.peeked.oldest))
+	}
+	w.Flush()
+
+	fmt.Println()
+
+	differ := 0
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\tATTRIBUTE\t%s\t%s\t\n", strings.ToUpper(names[0]), strings.ToUpper(names[1]))
+	for _, name := range compareAttributes {
+		values := []string{compareValue(sides[0].attributes, name), compareValue(sides[1].attributes, name)}
+
+		mark := ""
+		if values[0] != values[1] {
+			mark = "differs"
+			differ++
+		}
+
+		fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n", name, values[0], values[1], mark)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if differ > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("%d settings differ between %s and %s", differ, names[0], names[1]))
+	} else {
+		log.Info(color.New(color.FgCyan).Sprintf("%s and %s are configured the same", names[0], names[1]))
+	}
+
+	if overlap {
+		logOverlap(sides[0].peeked, sides[1].peeked)
+	}
+
+	return 0
+}
+
+// logOverlap reports how many of the bodies peeked at in each queue were also
+// peeked at in the other. Unless every message was peeked at, a body found in
+// one queue only may still be among the messages of the other that weren't.
+func logOverlap(a *diffSide, b *diffSide) {
+	for _, pair := range [][2]*diffSide{{a, b}, {b, a}} {
+		side, other := pair[0], pair[1]
+
+		_, only := side.missingFrom(other)
+		log.Info(color.New(color.FgCyan).Sprintf("%d of the %d bodies peeked at in %s were also peeked at in %s", side.total-only, side.total, side.name, other.name))
+	}
+}
+
+// compareValue returns an attribute of a queue as compare shows it: the
+// redrive policy as its dead-letter queue and receive count, and - when the
+// queue doesn't have the attribute.
+func compareValue(attributes map[string]string, name types.QueueAttributeName) string {
+	value, ok := attributes[string(name)]
+	if !ok {
+		return "-"
+	}
+
+	if name == types.QueueAttributeNameRedrivePolicy {
+		var policy struct {
+			DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+			MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+		}
+		if err := json.Unmarshal([]byte(value), &policy); err == nil && policy.DeadLetterTargetArn != "" {
+			target := policy.DeadLetterTargetArn[strings.LastIndex(policy.DeadLetterTargetArn, ":")+1:]
+			return fmt.Sprintf("%s after %s receives", target, policy.MaxReceiveCount)
+		}
+	}
+
+	return value
+}
+
+// oldestAge shows how long ago the oldest peeked message was sent.
+func oldestAge(oldest time.Time) string {
+	if oldest.IsZero() {
+		return "-"
+	}
+
+	return time.Since(oldest).Round(time.Second).String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigPath is where named moves are read from unless --config or
+// SQSMOVER_CONFIG names another file. A leading ~ stands for the home
+// directory.
+const defaultConfigPath = "~/.sqsmover.yaml"
+
+// moveConfig is the config file: named moves, each a set of move or global
+// flags with their values, such as
+//
+//	moves:
+//	  orders-dlq-redrive:
+//	    source: orders-dlq
+//	    destination: orders
+//	    region: eu-west-1
+//	    rate: 50
+type moveConfig struct {
+	Moves map[string]map[string]interface{} `yaml:"moves"`
+}
+
+// configFlags are the flags the named move of a run set, so operation
+// policies that deny a flag apply to them too.
+var configFlags []string
+
+// expandRun turns "run NAME" on the command line into a move. The flags of the
+// named move become the defaults of those flags, so flags given on the
+// command line override them, and run NAME is replaced by move. Command lines
+// of other commands are returned unchanged, and so is a run without a name,
+// for kingpin to report.
+func expandRun(args []string) ([]string, error) {
+	path := orDefault(os.Getenv("SQSMOVER_CONFIG"), defaultConfigPath)
+
+	flags := map[string]*kingpin.FlagModel{}
+	for _, flag := range kingpin.CommandLine.Model().Flags {
+		flags["--"+flag.Name] = flag
+		if flag.Short != 0 {
+			flags["-"+string(flag.Short)] = flag
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			name, value, inline := strings.Cut(arg, "=")
+			if flag, ok := flags[name]; ok && !flag.IsBoolFlag() && !inline && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+
+			if name == "--config" {
+				path = value
+			}
+			continue
+		}
+
+		if arg != runCommand.FullCommand() || i+1 >= len(args) || strings.HasPrefix(args[i+1], "-") {
+			return args, nil
+		}
+
+		if err := applyNamedMove(path, args[i+1]); err != nil {
+			return nil, err
+		}
+
+		expanded := append(append([]string{}, args[:i]...), moveCommand.FullCommand())
+		return append(expanded, args[i+2:]...), nil
+	}
+
+	return args, nil
+}
+
+// applyNamedMove reads the config file and sets the flags of the named move
+// as defaults.
+func applyNamedMove(path string, name string) error {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config %s: %s", path, err)
+	}
+
+	var config moveConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return fmt.Errorf("parsing config %s: %s", path, err)
+	}
+
+	move, ok := config.Moves[name]
+	if !ok {
+		names := make([]string, 0, len(config.Moves))
+		for name := range config.Moves {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return fmt.Errorf("%s has no move named %q; it has %s", path, name, strings.Join(names, ", "))
+	}
+
+	for key, value := range move {
+		flag := moveCommand.GetFlag(key)
+		if flag == nil {
+			flag = kingpin.CommandLine.GetFlag(key)
+		}
+
+		if flag == nil || key == "config" || key == "help" {
+			return fmt.Errorf("parsing config %s: move %q sets %s, which isn't a flag of the move command", path, name, key)
+		}
+
+		values, err := configValues(value)
+		if err != nil {
+			return fmt.Errorf("parsing config %s: move %q sets %s to %s", path, name, key, err)
+		}
+
+		flag.Default(values...)
+		configFlags = append(configFlags, key)
+	}
+
+	return nil
+}
+
+// configValues returns the flag values of a config value: a scalar, or a list
+// for a flag that can be repeated.
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("nothing")
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.(map[interface{}]interface{}); ok {
+				return nil, fmt.Errorf("a list of mappings")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("a mapping")
+	}
+
+	return []string{fmt.Sprint(value)}, nil
+}
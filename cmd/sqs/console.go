@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/tj/go-progress"
+	"github.com/tj/go/term"
+)
+
+// plainInterval is how often plain progress is printed when the output isn't
+// a terminal, so CI logs get a line now and then instead of one per batch.
+const plainInterval = 5 * time.Second
+
+const (
+	// progressPollInterval is how often the source is counted again while a
+	// move runs, as the count it starts from is approximate and producers
+	// may keep adding to it.
+	progressPollInterval = 15 * time.Second
+
+	// progressRecountDelay is the least time between two counts, when a
+	// move keeps doing more than its count.
+	progressRecountDelay = 2 * time.Second
+)
+
+// plainConsole reports whether progress has to be drawn without ANSI escape
+// codes: when asked to with --plain or --no-progress, when stdout isn't a
+// terminal, on terminals that declare themselves dumb, and on Windows
+// consoles other than Windows Terminal.
+func plainConsole() bool {
+	if *plain || *noProgress || !isTerminal(os.Stdout) || os.Getenv("TERM") == "dumb" {
+		return true
+	}
+
+	return runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == ""
+}
+
+// progressDisplay shows how far a move got, as a bar redrawn in place or, in
+// plain mode, as text.
+type progressDisplay struct {
+	mu sync.Mutex
+
+	total int
+	done  int
+
+	started time.Time
+	samples []metricsSample
+
+	// recounting is set once done passed the total, until the source is
+	// counted again, and no total or time left is shown meanwhile. recount
+	// asks the poll started with pollSource for that count.
+	recounting bool
+	recount    chan struct{}
+	quit       chan struct{}
+
+	bar    *progress.Bar
+	render func(string)
+
+	plain    bool
+	terminal bool
+	printed  time.Time
+
+	// events reports progress as JSON events instead, for --output json.
+	events bool
+
+	stopped bool
+}
+
+// shownProgress is the display started last, so a run that panics can stop
+// it and get the cursor back.
+var shownProgress *progressDisplay
+
+// startProgress starts showing progress towards total messages. Call stop
+// once the move is over.
+func startProgress(total int) *progressDisplay {
+	p := &progressDisplay{total: total, started: time.Now()}
+	p.samples = []metricsSample{{at: p.started}}
+	shownProgress = p
+
+	if eventOutput != nil {
+		p.events = true
+		return p
+	}
+
+	if plainConsole() {
+		p.plain = true
+		// CI runners may attach a terminal that keeps every carriage
+		// return, so --no-progress prints lines as if there was none.
+		p.terminal = isTerminal(os.Stdout) && !*noProgress
+		return p
+	}
+
+	term.HideCursor()
+
+	p.bar = newProgressBar(total)
+	p.render = term.Renderer()
+
+	return p
+}
+
+// pollSource counts the messages left in the source every
+// progressPollInterval, and as soon as the move does more than expected, to
+// keep the total close to what the move will do. inFlight returns the
+// messages received but not done yet, which the source hides. The total
+// never goes over limit, when there is one.
+func (p *progressDisplay) pollSource(svc *sqs.Client, queueURL string, limit int, inFlight func() int) {
+	p.recount = make(chan struct{}, 1)
+	p.quit = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(progressPollInterval)
+		defer ticker.Stop()
+
+		var counted time.Time
+		for {
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+			case <-p.recount:
+				select {
+				case <-p.quit:
+					return
+				case <-time.After(time.Until(counted.Add(progressRecountDelay))):
+				}
+			}
+
+			attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+				QueueUrl:       aws.String(queueURL),
+				AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+			})
+			counted = time.Now()
+			if err != nil {
+				// The last total stands until the next count.
+				continue
+			}
+
+			p.counted(intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessages)+inFlight(), limit)
+		}
+	}()
+}
+
+// counted sets the total from the messages left in the source.
+func (p *progressDisplay) counted(left int, limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := p.done + left
+	if limit > 0 {
+		total = min(total, limit)
+	}
+
+	p.total = max(total, p.done)
+	p.recounting = false
+}
+
+func (p *progressDisplay) update(done int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done = done
+	p.samples = addSample(p.samples, done)
+
+	// The count was under. Without a poll the total follows done, otherwise
+	// the source is counted again and no total is shown until then.
+	if done > p.total {
+		p.total = done
+		if p.recount != nil {
+			p.recounting = true
+			select {
+			case p.recount <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	if p.events {
+		fields := map[string]interface{}{"done": done, "total": p.total, "rate": p.rate(), "elapsed_seconds": int(time.Since(p.started).Seconds())}
+		if left, ok := p.left(); ok {
+			fields["eta_seconds"] = int(left.Seconds())
+		}
+		emitEvent("progress", fields)
+		return
+	}
+
+	if !p.plain {
+		if p.recounting {
+			p.render("\t\t" + p.text())
+			return
+		}
+
+		p.bar.Total = float64(p.total)
+		p.bar.ValueInt(done)
+		p.bar.Text(p.stats())
+		p.render(p.bar.String())
+		return
+	}
+
+	if p.terminal {
+		// A carriage return rewrites the line on every console.
+		fmt.Printf("\r\t%s", p.text())
+		return
+	}
+
+	if time.Since(p.printed) >= plainInterval {
+		fmt.Printf("\t%s\n", p.text())
+		p.printed = time.Now()
+	}
+}
+
+// stop ends the display. Displays already stopped are left alone.
+func (p *progressDisplay) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+
+	if p.quit != nil {
+		close(p.quit)
+	}
+
+	switch {
+	case p.events:
+	case !p.plain:
+		term.ShowCursor()
+	case p.terminal:
+		fmt.Println()
+	case p.done > 0:
+		fmt.Printf("\t%s\n", p.text())
+	}
+}
+
+func (p *progressDisplay) text() string {
+	if p.recounting {
+		return fmt.Sprintf("%d messages, more than counted, counting the source again (%s)", p.done, p.stats())
+	}
+
+	percent := 100.0
+	if p.total > 0 {
+		// Rounded down, so a move isn't shown as done before it is.
+		percent = math.Floor(float64(p.done)*1000/float64(p.total)) / 10
+	}
+
+	return fmt.Sprintf("%d of %d messages (%.1f%%, %s)", p.done, p.total, percent, p.stats())
+}
+
+// stats returns the rate, the time elapsed and, when it is known, the time
+// left.
+func (p *progressDisplay) stats() string {
+	stats := fmt.Sprintf("%.1f/s, %s elapsed", p.rate(), time.Since(p.started).Round(time.Second))
+	if left, ok := p.left(); ok {
+		stats += fmt.Sprintf(", %s left", left.Round(time.Second))
+	}
+
+	return stats
+}
+
+// rate returns the messages done per second over the last minute.
+func (p *progressDisplay) rate() float64 {
+	return sampleRate(p.samples)
+}
+
+// left returns the time until the total is done at the current rate. It is
+// unknown while the source is counted again or nothing was done lately.
+func (p *progressDisplay) left() (time.Duration, bool) {
+	rate := p.rate()
+	if p.recounting || rate <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(float64(p.total-p.done) / rate * float64(time.Second)), true
+}
+
+func newProgressBar(total int) *progress.Bar {
+	b := progress.NewInt(total)
+	b.Width = 40
+	b.StartDelimiter = color.New(color.FgCyan).Sprint("|")
+	b.EndDelimiter = color.New(color.FgCyan).Sprint("|")
+	b.Filled = color.New(color.FgCyan).Sprint("█")
+	b.Empty = color.New(color.FgCyan).Sprint("░")
+	b.Template(`		{{.Bar}} {{.Percent | printf "%3.0f"}}% {{.Text}}`)
+
+	return b
+}
+
+// plainLogs drops colours and non-ASCII symbols from the log output.
+func plainLogs() {
+	color.NoColor = true
+
+	for level := range cli.Strings {
+		cli.Strings[level] = "-"
+	}
+	cli.Strings[log.ErrorLevel] = "x"
+	cli.Strings[log.FatalLevel] = "x"
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
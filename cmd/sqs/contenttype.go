@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// contentTypes are the types detectContentType tells apart, in the order
+// they are checked.
+var contentTypes = []string{"json", "xml", "gzip", "protobuf", "base64", "text", "binary"}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// detectContentType guesses what a message body holds from its content
+// alone. Binary payloads reach SQS as raw bytes or base64, so base64 bodies
+// are labelled after what they decode to when that is gzip or looks like
+// Protocol Buffers, and as base64 otherwise. Protocol Buffers carry no
+// marker, so any binary that parses as their wire format counts.
+func detectContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+
+	switch {
+	case trimmed == "":
+		return "text"
+	case json.Valid([]byte(trimmed)) && (trimmed[0] == '{' || trimmed[0] == '['):
+		return "json"
+	case trimmed[0] == '<' && isXML(trimmed):
+		return "xml"
+	}
+
+	if kind := binaryContentType([]byte(body)); kind != "" {
+		return kind
+	}
+
+	if decoded, ok := decodeBase64Body(trimmed); ok {
+		if kind := binaryContentType(decoded); kind != "" {
+			return kind
+		}
+		return "base64"
+	}
+
+	if utf8.ValidString(body) && isPrintable(body) {
+		return "text"
+	}
+
+	return "binary"
+}
+
+// binaryContentType returns gzip or protobuf when data is one of them, and
+// an empty string otherwise.
+func binaryContentType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic) && len(data) >= 18:
+		return "gzip"
+	case !isPrintable(string(data)) && isProtoWire(data):
+		return "protobuf"
+	}
+
+	return ""
+}
+
+// isXML reports whether body is a well-formed XML document with a root
+// element.
+func isXML(body string) bool {
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	root := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return root
+		}
+		if err != nil {
+			return false
+		}
+
+		if _, ok := token.(xml.StartElement); ok {
+			root = true
+		}
+	}
+}
+
+// decodeBase64Body decodes body when it is standard or URL-safe base64, as
+// binary payloads are usually sent. Short bodies are left alone, since many
+// words are valid base64.
+func decodeBase64Body(body string) ([]byte, bool) {
+	if len(body) < 16 || len(body)%4 != 0 {
+		return nil, false
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+		if decoded, err := encoding.DecodeString(body); err == nil {
+			return decoded, true
+		}
+	}
+
+	return nil, false
+}
+
+// isProtoWire reports whether data parses as a sequence of Protocol Buffers
+// fields to its end.
+func isProtoWire(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 || number < 1 || kind == protowire.StartGroupType || kind == protowire.EndGroupType {
+			return false
+		}
+		data = data[n:]
+
+		n = protowire.ConsumeFieldValue(number, kind, data)
+		if n < 0 {
+			return false
+		}
+		data = data[n:]
+	}
+
+	return true
+}
+
+// isPrintable reports whether s holds only printable characters and
+// whitespace.
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r == utf8.RuneError || (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/fatih/color"
+)
+
+// queueCooldown is how long the states SQS refuses some calls in while they
+// last, a queue deleted or purged recently, take to clear by themselves.
+const queueCooldown = 60 * time.Second
+
+const (
+	// cooldownAttempts caps how often a call is made while it keeps
+	// running into a cooldown.
+	cooldownAttempts = 3
+
+	// countdownStep is how often the wait for a cooldown is logged.
+	countdownStep = 10 * time.Second
+)
+
+// withCooldown makes the call, and when it fails with a cooldown error waits
+// the cooldown out and tries again instead of giving up.
+func withCooldown(what string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || !coolingDown(err) || attempt == cooldownAttempts {
+			return err
+		}
+
+		log.Warn(color.New(color.FgYellow).Sprintf("Unable to %s yet: %s", what, apiErr.ErrorMessage()))
+		countdown(queueCooldown)
+	}
+}
+
+// coolingDown reports whether err is one SQS returns while a queue is in a
+// state that clears by itself.
+func coolingDown(err error) bool {
+	var deleted *types.QueueDeletedRecently
+	var purging *types.PurgeQueueInProgress
+	return errors.As(err, &deleted) || errors.As(err, &purging)
+}
+
+// countdown waits for d, logging the time left every countdownStep.
+func countdown(d time.Duration) {
+	for remaining := d; remaining > 0; remaining -= countdownStep {
+		log.Info(color.New(color.FgCyan).Sprintf("Retrying in %s...", remaining))
+
+		wait := countdownStep
+		if remaining < wait {
+			wait = remaining
+		}
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// exitOnPanic ends a run that panicked as one that failed, instead of with a
+// Go stack trace and the terminal left without its cursor: the progress
+// display is stopped, the error logged, with its stack under --verbose, and
+// the tool exits with exitFailed. main defers it first, so it runs once the
+// cleanup deferred by the run is done. Moves recover in runMove, to finish
+// with a summary.
+func exitOnPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	restoreTerminal()
+	err := panicError(v)
+	log.Error(color.New(color.FgRed).Sprintf("Stopped by an unexpected error: %s", err))
+	log.Debug(string(err.Stack))
+	os.Exit(exitFailed)
+}
+
+// panicError describes a panic recovered from, with the stack of the
+// goroutine that panicked.
+func panicError(v interface{}) *mover.PanicError {
+	stack := make([]byte, 64<<10)
+	return &mover.PanicError{Value: v, Stack: stack[:runtime.Stack(stack, false)]}
+}
+
+// restoreTerminal stops the progress display, if one is still shown.
+func restoreTerminal() {
+	if shownProgress != nil {
+		shownProgress.stop()
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fatih/color"
+)
+
+const (
+	// credentialRefreshWindow is how long before expiry temporary
+	// credentials are renewed, so a batch is never signed with credentials
+	// about to lapse.
+	credentialRefreshWindow = 5 * time.Minute
+
+	// assumedRoleDuration is how long the credentials of a role assumed
+	// with --role-arn last, the longest every role allows, so an MFA code
+	// is asked for as rarely as possible.
+	assumedRoleDuration = time.Hour
+)
+
+// assumedRole is a role a config assumes with STS on top of its profile.
+type assumedRole struct {
+	arn        string
+	externalID string
+	mfaSerial  string
+}
+
+// globalRole is the role given with --role-arn, assumed for both sides of a
+// move and by every other command.
+func globalRole() assumedRole {
+	return assumedRole{arn: *roleArn, externalID: *externalID, mfaSerial: *mfaSerial}
+}
+
+// sourceRole and destinationRole are the roles assumed for each side of a
+// move, defaulting to the global role flag by flag.
+func sourceRole() assumedRole {
+	return assumedRole{
+		arn:        orDefault(*sourceRoleArn, *roleArn),
+		externalID: orDefault(*sourceExtID, *externalID),
+		mfaSerial:  orDefault(*sourceMFA, *mfaSerial),
+	}
+}
+
+func destinationRole() assumedRole {
+	return assumedRole{
+		arn:        orDefault(*destinationRoleArn, *roleArn),
+		externalID: orDefault(*destinationExtID, *externalID),
+		mfaSerial:  orDefault(*destinationMFA, *mfaSerial),
+	}
+}
+
+// validate returns an error when an external ID or MFA device is given
+// without a role to use them with.
+func (r assumedRole) validate(flag string) error {
+	if r.arn == "" && (r.externalID != "" || r.mfaSerial != "") {
+		return fmt.Errorf("an external ID or MFA serial needs a role to assume with %s", flag)
+	}
+
+	return nil
+}
+
+// assume returns a copy of cfg that assumes the role with cfg's
+// credentials. With an MFA device the code is read from stdin each time the
+// role is assumed, which happens about once an hour.
+func (r assumedRole) assume(cfg aws.Config) aws.Config {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), r.arn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "sqsmover"
+		o.Duration = assumedRoleDuration
+		if r.externalID != "" {
+			o.ExternalID = aws.String(r.externalID)
+		}
+		if r.mfaSerial != "" {
+			o.SerialNumber = aws.String(r.mfaSerial)
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}
+	})
+
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(provider, refreshEarly)
+	return cfg
+}
+
+// refreshEarly makes a credentials cache renew credentials once they get
+// within the refresh window of their expiry.
+func refreshEarly(o *aws.CredentialsCacheOptions) {
+	o.ExpiryWindow = credentialRefreshWindow
+}
+
+// refreshingProvider reports the renewals of the credentials cache it wraps.
+// Assumed roles, SSO, credential processes and instance roles report an
+// expiry and are re-fetched by the cache once they get within the refresh
+// window; credentials that never expire are used as they are.
+type refreshingProvider struct {
+	creds aws.CredentialsProvider
+
+	mu        sync.Mutex
+	retrieved bool
+	expires   time.Time
+}
+
+func (p *refreshingProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	value, err := p.creds.Retrieve(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.retrieved && value.CanExpire && !value.Expires.Equal(p.expires):
+		log.Info(color.New(color.FgCyan).Sprintf("Refreshed AWS credentials, now valid until %s", value.Expires.Local().Format(time.Kitchen)))
+	case !p.retrieved && !value.CanExpire && value.SessionToken != "":
+		log.Warn(color.New(color.FgYellow).Sprintf("Using temporary credentials that can't be refreshed. Runs that outlive them will fail; use a profile with role_arn or credential_process instead"))
+	}
+
+	p.retrieved = true
+	p.expires = value.Expires
+	return value, nil
+}
+
+// keepCredentialsAlive makes the config report the renewals of its
+// credentials, which its cache makes before they expire.
+func keepCredentialsAlive(cfg aws.Config) aws.Config {
+	cfg.Credentials = &refreshingProvider{creds: cfg.Credentials}
+	return cfg
+}
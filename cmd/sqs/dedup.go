@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// dedupStore remembers the messages moved by recent runs in a file, so a
+// message that an earlier run sent but had not deleted yet when this run
+// received it again is deleted instead of sent twice. Entries older than the
+// window are forgotten.
+//
+// The file is a snapshot of the store. The batches sent since it was written
+// are appended to a journal next to it, so recording a batch costs as much
+// as the batch rather than the whole store. The journal is folded into a new
+// snapshot once it outgrows the snapshot, and both are synced to disk before
+// a batch is deleted from the source.
+type dedupStore struct {
+	path   string
+	window time.Duration
+	byBody bool
+
+	// resume marks the state file of --resume, which belongs to one move
+	// and is removed once the move completes.
+	resume bool
+
+	// copying marks a store used by --copy, whose drops delete nothing.
+	copying bool
+
+	mu    sync.Mutex
+	moved map[string]time.Time
+
+	// dropping has the IDs of the messages dropped as sent by an earlier
+	// run, until their delete succeeded and they move to skipped.
+	dropping map[string]bool
+	skipped  map[string]bool
+
+	// journal is open once this run appended to it, and journaled counts
+	// the messages it holds.
+	journal   *os.File
+	journaled int
+
+	// prior is the checkpoint of the earlier runs of a resumed move, and
+	// current the progress of this run, which started at started.
+	prior     resumeCheckpoint
+	current   mover.Result
+	lastBatch []string
+	started   time.Time
+	saved     time.Time
+}
+
+// resumeCheckpoint is how far a move with --resume got over the runs that
+// were interrupted before it completed, so the counts of the run that
+// completes it cover the whole move.
+type resumeCheckpoint struct {
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	Runs           int       `json:"runs"`
+	Moved          int       `json:"moved"`
+	Sent           int       `json:"sent"`
+	Dropped        int       `json:"dropped"`
+	Skipped        int       `json:"skipped"`
+	Failed         int       `json:"failed"`
+	LastBatch      []string  `json:"last_batch,omitempty"`
+}
+
+// resumeFile is the content of a --resume state file. Files written before
+// checkpoints were kept hold the sent messages alone, as a dedup store does.
+type resumeFile struct {
+	Checkpoint *resumeCheckpoint    `json:"checkpoint,omitempty"`
+	Sent       map[string]time.Time `json:"sent,omitempty"`
+}
+
+// checkpointInterval is how often progress that sent nothing, such as
+// drops, is written to the state file. Sends are written as they happen.
+const checkpointInterval = 10 * time.Second
+
+// minCompaction is the fewest messages the journal holds before it is folded
+// into the snapshot.
+const minCompaction = 1000
+
+var activeDedup *dedupStore
+
+// maxRetention is the longest SQS keeps a message, and so the longest a
+// resumed move can still receive a message it sent before.
+const maxRetention = 14 * 24 * time.Hour
+
+// openDedupStore reads the store at path, which doesn't have to exist yet,
+// and forgets the entries that fell out of the window.
+func openDedupStore(path string, window time.Duration, by string) (*dedupStore, error) {
+	s := &dedupStore{path: path, window: window, byBody: by == "body", moved: map[string]time.Time{}, dropping: map[string]bool{}, skipped: map[string]bool{}, started: time.Now()}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		var file resumeFile
+		if err := json.Unmarshal(data, &file); err == nil && file.Checkpoint != nil {
+			s.prior = *file.Checkpoint
+			if file.Sent != nil {
+				s.moved = file.Sent
+			}
+		} else if err := json.Unmarshal(data, &s.moved); err != nil {
+			return nil, fmt.Errorf("parsing dedup store %s: %s", path, err)
+		}
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf("reading the journal of %s: %s", path, err)
+	}
+
+	cutoff := time.Now().Add(-window)
+	for key, moved := range s.moved {
+		if moved.Before(cutoff) {
+			delete(s.moved, key)
+		}
+	}
+
+	return s, nil
+}
+
+// journalPath is the journal of the store at path.
+func journalPath(path string) string {
+	return path + ".journal"
+}
+
+// replay adds the batches of the journal to the store. A last line cut short
+// by a crash is left out, as its batch wasn't deleted from the source yet.
+func (s *dedupStore) replay() error {
+	f, err := os.Open(journalPath(s.path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry resumeFile
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+
+		for key, sent := range entry.Sent {
+			if sent.After(s.moved[key]) {
+				s.moved[key] = sent
+			}
+		}
+		if entry.Checkpoint != nil {
+			s.prior = *entry.Checkpoint
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *dedupStore) key(message *types.Message) string {
+	if !s.byBody {
+		return aws.ToString(message.MessageId)
+	}
+
+	sum := sha256.Sum256([]byte(aws.ToString(message.Body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// seen reports whether a recent run already moved the message, noting it
+// as dropped if so. It counts as skipped once its delete succeeded.
+func (s *dedupStore) seen(message *types.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.moved[s.key(message)]; !ok {
+		return false
+	}
+
+	id := aws.ToString(message.MessageId)
+	if s.copying {
+		s.skipped[id] = true
+	} else {
+		s.dropping[id] = true
+	}
+	return true
+}
+
+// event counts the dropped messages a delete removed as skipped, as
+// mover.Options.Events.
+func (s *dedupStore) event(event mover.Event) {
+	deleted, ok := event.(*mover.BatchDeleted)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, message := range deleted.Messages {
+		id := aws.ToString(message.MessageId)
+		if s.dropping[id] {
+			delete(s.dropping, id)
+			s.skipped[id] = true
+		}
+	}
+}
+
+// record adds sent messages to the store and appends them to the journal,
+// so a run that dies halfway still protects the next one from what it sent.
+func (s *dedupStore) record(messages []*types.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.openJournal(); err != nil {
+		logAwsError("Failed to write the dedup store", err)
+	}
+
+	now := time.Now().UTC()
+	batch := make(map[string]time.Time, len(messages))
+	s.lastBatch = make([]string, 0, len(messages))
+	for _, message := range messages {
+		key := s.key(message)
+		s.moved[key] = now
+		batch[key] = now
+		s.lastBatch = append(s.lastBatch, aws.ToString(message.MessageId))
+	}
+
+	if err := s.append(batch); err != nil {
+		logAwsError("Failed to write the dedup store", err)
+	}
+}
+
+// openJournal starts the journal of the run afresh from a snapshot of the
+// store, unless it is open already.
+func (s *dedupStore) openJournal() error {
+	if s.journal != nil {
+		return nil
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(journalPath(s.path), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.journal = f
+	return nil
+}
+
+// append writes sent messages, and the checkpoint of --resume, to the
+// journal and syncs it. An append that leaves the journal larger than the
+// snapshot folds it in.
+func (s *dedupStore) append(sent map[string]time.Time) error {
+	if err := s.openJournal(); err != nil {
+		return err
+	}
+
+	entry := resumeFile{Sent: sent}
+	if s.resume {
+		checkpoint := s.checkpoint()
+		entry.Checkpoint = &checkpoint
+	}
+	s.saved = time.Now()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+
+	s.journaled += len(sent)
+	if s.journaled >= minCompaction && s.journaled*2 > len(s.moved) {
+		return s.save()
+	}
+
+	return nil
+}
+
+// progress notes the totals of the run for the checkpoint of --resume, and
+// writes them out every checkpointInterval.
+func (s *dedupStore) progress(total mover.Result) {
+	if !s.resume {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = total
+	if time.Since(s.saved) < checkpointInterval {
+		return
+	}
+
+	if err := s.append(nil); err != nil {
+		logAwsError("Failed to write the resume state", err)
+	}
+}
+
+// checkpoint adds the progress of this run to that of the earlier ones.
+func (s *dedupStore) checkpoint() resumeCheckpoint {
+	c := s.prior
+	if c.StartedAt.IsZero() {
+		c.StartedAt = s.started.UTC()
+	}
+	c.UpdatedAt = time.Now().UTC()
+	c.ElapsedSeconds += time.Since(s.started).Seconds()
+	c.Runs++
+	c.Moved += s.current.Moved
+	c.Sent += s.current.Sent
+	c.Dropped += s.current.Dropped
+	c.Skipped += s.current.Skipped
+	c.Failed += s.current.Failed
+	c.LastBatch = s.lastBatch
+
+	return c
+}
+
+// save replaces the snapshot in one rename, so it is never left half
+// written, once it is on disk, and empties the journal it now holds. The
+// state file of --resume also gets the checkpoint of the move.
+func (s *dedupStore) save() error {
+	var body interface{} = s.moved
+	if s.resume {
+		checkpoint := s.checkpoint()
+		body = resumeFile{Checkpoint: &checkpoint, Sent: s.moved}
+	}
+	s.saved = time.Now()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(s.path))
+
+	s.journaled = 0
+	if s.journal != nil {
+		return s.journal.Truncate(0)
+	}
+
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Filesystems that can't sync a
+// directory still replace the file atomically, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// remaining returns how many of limit messages are left to take once the
+// earlier runs of a resumed move took theirs.
+func (s *dedupStore) remaining(limit int) int {
+	return limit - s.prior.Moved - s.prior.Dropped
+}
+
+// resumed reports whether earlier runs of the move were interrupted.
+func (s *dedupStore) resumed() bool {
+	return s.resume && s.prior.Runs > 0
+}
+
+// finishResume adds the counts of the earlier runs of a resumed move to the
+// summary, then removes the state file of a completed move, or writes the
+// last checkpoint of one that stopped and tells how to resume it.
+func (s *dedupStore) finishResume(completed bool, summary *runSummary) {
+	if !s.resume {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Messages an earlier run sent but didn't delete were moved by it,
+	// although this run is the one that deleted them.
+	resent := len(s.skipped)
+	summary.Moved += resent
+	summary.Dropped -= resent
+
+	if s.prior.Runs > 0 {
+		summary.Moved += s.prior.Moved
+		summary.Sent += s.prior.Sent
+		summary.Dropped += s.prior.Dropped
+		summary.Skipped += s.prior.Skipped
+		summary.Failed += s.prior.Failed
+
+		prior := s.prior
+		summary.Resumed = &prior
+		elapsed := time.Duration(prior.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+		log.Info(color.New(color.FgCyan).Sprintf("Counting the %d messages moved by the %d earlier runs of the move, which took %s, in the totals", prior.Moved, prior.Runs, elapsed))
+	}
+
+	if !completed {
+		s.current = mover.Result{Moved: summary.Moved - s.prior.Moved, Sent: summary.Sent - s.prior.Sent, Dropped: summary.Dropped - s.prior.Dropped, Skipped: summary.Skipped - s.prior.Skipped, Failed: summary.Failed - s.prior.Failed}
+		if err := s.save(); err != nil {
+			logAwsError("Failed to write the resume state", err)
+		}
+
+		if len(s.moved) > 0 {
+			log.Info(color.New(color.FgCyan).Sprintf("Run the move again with --resume %s to skip the %d messages already sent", s.path, len(s.moved)))
+		}
+		return
+	}
+
+	if s.journal != nil {
+		s.journal.Close()
+	}
+
+	for _, path := range []string{s.path, journalPath(s.path)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warn(color.New(color.FgYellow).Sprintf("Unable to remove the resume state %s: %s", path, err))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maxDelaySeconds is the longest delay SQS accepts for a message.
+const maxDelaySeconds = 900
+
+// sendDelay holds messages back in the destination for between min and max
+// seconds, so a redrive doesn't reach the consumers all at once.
+type sendDelay struct {
+	min int64
+	max int64
+}
+
+var activeDelay *sendDelay
+
+// parseDelay reads --delay-seconds N or --delay-spread MIN..MAX. It returns
+// nil when neither is given.
+func parseDelay(seconds int64, spread string) (*sendDelay, error) {
+	if seconds != 0 && spread != "" {
+		return nil, fmt.Errorf("--delay-seconds can't be combined with --delay-spread")
+	}
+
+	d := &sendDelay{min: seconds, max: seconds}
+
+	if spread != "" {
+		parts := strings.SplitN(spread, "..", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--delay-spread %q must look like MIN..MAX, e.g. 0..900", spread)
+		}
+
+		var minErr, maxErr error
+		d.min, minErr = strconv.ParseInt(parts[0], 10, 64)
+		d.max, maxErr = strconv.ParseInt(parts[1], 10, 64)
+		if minErr != nil || maxErr != nil {
+			return nil, fmt.Errorf("--delay-spread %q must look like MIN..MAX, e.g. 0..900", spread)
+		}
+
+		if d.min > d.max {
+			return nil, fmt.Errorf("--delay-spread %q starts above where it ends", spread)
+		}
+	}
+
+	if d.min < 0 || d.max > maxDelaySeconds {
+		return nil, fmt.Errorf("delays must be between 0 and %d seconds", maxDelaySeconds)
+	}
+
+	if d.max == 0 {
+		return nil, nil
+	}
+
+	return d, nil
+}
+
+// apply sets the delay of entry, picking it at random from the range so the
+// messages reappear evenly spread over it.
+func (d *sendDelay) apply(entry *types.SendMessageBatchRequestEntry) {
+	delay := d.min
+	if d.max > d.min {
+		delay += rand.Int63n(d.max - d.min + 1)
+	}
+
+	entry.DelaySeconds = int32(delay)
+}
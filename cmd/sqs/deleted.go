@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// checkDestinationExists reads the attributes of the destination before
+// anything is sent to it. GetQueueUrl keeps returning the URL of a deleted
+// queue for up to 60 seconds, and sends in that window may still succeed,
+// losing the messages.
+func checkDestinationExists(svc *sqs.Client, queueURL string) error {
+	_, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+
+	var missing *types.QueueDoesNotExist
+	if errors.As(err, &missing) {
+		return fmt.Errorf("%s was deleted; SQS may still return its URL for up to 60 seconds, and a queue with the same name can only be created again after that", queueNameFromURL(queueURL))
+	}
+
+	return err
+}
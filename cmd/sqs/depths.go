@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// depthReport compares the depths of both queues before and after a move.
+// Depths count visible, in flight and delayed messages, and are as
+// approximate as SQS reports them.
+type depthReport struct {
+	SourceBefore      int      `json:"source_before"`
+	SourceAfter       int      `json:"source_after"`
+	DestinationBefore int      `json:"destination_before"`
+	DestinationAfter  int      `json:"destination_after"`
+	Anomalies         []string `json:"anomalies,omitempty"`
+
+	// destinations are the queues whose depths add up to the destination's,
+	// more than one when the move spreads its messages.
+	destinations []string
+}
+
+// depthAttributes are summed into the depth of a queue.
+var depthAttributes = []types.QueueAttributeName{
+	types.QueueAttributeNameApproximateNumberOfMessages,
+	types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+	types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+}
+
+// totalDepth returns the number of messages stored in a queue, whatever their
+// visibility.
+func totalDepth(svc *sqs.Client, queueURL string) (int, error) {
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: depthAttributes,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sumDepth(attrs.Attributes), nil
+}
+
+func sumDepth(attributes map[string]string) int {
+	total := 0
+	for _, name := range depthAttributes {
+		total += intAttribute(attributes, name)
+	}
+
+	return total
+}
+
+// destinationDepth returns the depths of the destinations added up.
+func (r *depthReport) destinationDepth(svc *sqs.Client) (int, error) {
+	total := 0
+	for _, queueURL := range r.destinations {
+		depth, err := totalDepth(svc, queueURL)
+		if err != nil {
+			return 0, err
+		}
+		total += depth
+	}
+
+	return total, nil
+}
+
+// finish measures the depths after the move and flags differences the move
+// doesn't explain: a destination that grew by less than was sent points at
+// consumers already processing the messages or FIFO deduplication dropping
+// them, and a source that shrank by less than was taken at producers still
+// writing to it.
+func (r *depthReport) finish(sourceSvc *sqs.Client, destinationSvc *sqs.Client, summary *runSummary) error {
+	var err error
+
+	if r.SourceAfter, err = totalDepth(sourceSvc, summary.Source); err != nil {
+		return err
+	}
+
+	if r.DestinationAfter, err = r.destinationDepth(destinationSvc); err != nil {
+		return err
+	}
+
+	if grown := r.DestinationAfter - r.DestinationBefore; grown < summary.Sent {
+		r.Anomalies = append(r.Anomalies, fmt.Sprintf("destination grew by %d but %d messages were sent", grown, summary.Sent))
+	}
+
+	taken := summary.Moved + summary.Dropped
+	if shrunk := r.SourceBefore - r.SourceAfter; !*copyMessages && shrunk < taken {
+		r.Anomalies = append(r.Anomalies, fmt.Sprintf("source shrank by %d but %d messages were taken", shrunk, taken))
+	}
+
+	return nil
+}
+
+func (r *depthReport) log() {
+	log.Info(color.New(color.FgCyan).Sprintf("Approximate depths: source %d -> %d, destination %d -> %d", r.SourceBefore, r.SourceAfter, r.DestinationBefore, r.DestinationAfter))
+
+	for _, anomaly := range r.Anomalies {
+		log.Warn(color.New(color.FgYellow).Sprintf("Depths don't add up: %s. Consumers or producers may be active on the queues, or FIFO deduplication dropped messages", anomaly))
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// diffFilePrefix marks a side of a diff as a dump file rather than a queue.
+const diffFilePrefix = "file:"
+
+// diffSide holds the messages of one side of a diff, counted by body hash.
+// examples keeps the first message seen with each body, for the report, and
+// oldest the earliest time one of them was sent.
+type diffSide struct {
+	name     string
+	total    int
+	counts   map[string]int
+	examples map[string]*types.Message
+	oldest   time.Time
+}
+
+func newDiffSide(name string) *diffSide {
+	return &diffSide{name: name, counts: map[string]int{}, examples: map[string]*types.Message{}}
+}
+
+func (d *diffSide) add(message *types.Message) {
+	sum := sha256.Sum256([]byte(aws.ToString(message.Body)))
+	hash := hex.EncodeToString(sum[:])
+
+	d.total++
+	d.counts[hash]++
+	if d.examples[hash] == nil {
+		d.examples[hash] = message
+	}
+
+	if sent := sentTimestamp(message); !sent.IsZero() && (d.oldest.IsZero() || sent.Before(d.oldest)) {
+		d.oldest = sent
+	}
+}
+
+// missingFrom returns the hashes d holds more often than other, with how
+// many more, in a stable order.
+func (d *diffSide) missingFrom(other *diffSide) ([]string, int) {
+	var hashes []string
+	extra := 0
+
+	for hash, count := range d.counts {
+		if n := count - other.counts[hash]; n > 0 {
+			hashes = append(hashes, hash)
+			extra += n
+		}
+	}
+	sort.Strings(hashes)
+
+	return hashes, extra
+}
+
+// readDiffSide reads a queue, leaving its messages in place, or a dump file
+// when the reference starts with file:.
+func readDiffSide(svc *sqs.Client, reference string, limit int) (*diffSide, error) {
+	if strings.HasPrefix(reference, diffFilePrefix) {
+		return readDiffFile(strings.TrimPrefix(reference, diffFilePrefix), limit)
+	}
+
+	return readDiffQueue(svc, reference, limit)
+}
+
+func readDiffFile(path string, limit int) (*diffSide, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	side := newDiffSide(path)
+
+	scanner, err := newDumpScanner(f)
+	if err != nil {
+		return nil, err
+	}
+
+	line := 0
+	for scanner.Scan() && (limit == 0 || side.total < limit) {
+		line++
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		messages, err := parseLoadLine("jsonl", scanner.Text(), line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", path, line, err)
+		}
+
+		for _, message := range messages {
+			if limit > 0 && side.total >= limit {
+				break
+			}
+			side.add(message)
+		}
+	}
+
+	return side, scanner.Err()
+}
+
+func readDiffQueue(svc *sqs.Client, queue string, limit int) (*diffSide, error) {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := allowQueue(queueURL); err != nil {
+		return nil, err
+	}
+
+	side := newDiffSide(queueNameFromURL(queueURL))
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	_, err = mover.New(svc, nil).Move(ctx, mover.Options{
+		SourceQueueURL:    queueURL,
+		Limit:             limit,
+		MaxRetries:        defaultMaxRetries,
+		VisibilityTimeout: copyVisibilityTimeout,
+		AttributeNames:    []string{string(types.MessageSystemAttributeNameSentTimestamp)},
+		Copy:              true,
+		Handle: func(ctx context.Context, messages []*types.Message) (mover.Result, error) {
+			for _, message := range messages {
+				side.add(message)
+			}
+			return mover.Result{Moved: len(messages)}, nil
+		},
+	})
+
+	return side, err
+}
+
+// allowQueue checks the operation policies against a queue a read-only
+// command resolved.
+func allowQueue(queueURL string) error {
+	resolved := invocation{command: activeCommand, source: queueNameFromURL(queueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runDiff compares the bodies of two queues or dump files and lists the
+// messages only one of them holds. It returns the exit code: 0 when both
+// hold the same bodies as often.
+func runDiff(svc *sqs.Client, a string, b string, limit int, show int) int {
+	sides := make([]*diffSide, 2)
+
+	for i, reference := range []string{a, b} {
+		side, err := readDiffSide(svc, reference, limit)
+		if err != nil {
+			logAwsError("Failed to read "+reference, err)
+			if strings.HasPrefix(reference, diffFilePrefix) {
+				return exitFailed
+			}
+			return failureCode(err, exitQueue)
+		}
+
+		log.Info(color.New(color.FgCyan).Sprintf("Read %d messages from %s", side.total, side.name))
+		sides[i] = side
+	}
+
+	onlyA, extraA := sides[0].missingFrom(sides[1])
+	onlyB, extraB := sides[1].missingFrom(sides[0])
+
+	if extraA == 0 && extraB == 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Both hold the same %d message bodies", sides[0].total))
+		return 0
+	}
+
+	log.Warn(color.New(color.FgYellow).Sprintf("%d messages only in %s, %d only in %s", extraA, sides[0].name, extraB, sides[1].name))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tONLY IN\tCOUNT\tHASH\tMESSAGE ID\tBODY")
+	for i, hashes := range [][]string{onlyA, onlyB} {
+		side, other := sides[i], sides[1-i]
+
+		for n, hash := range hashes {
+			if n == show {
+				fmt.Fprintf(w, "\t%s\t\t\t\t%d more bodies\n", side.name, len(hashes)-show)
+				break
+			}
+
+			example := side.examples[hash]
+			fmt.Fprintf(w, "\t%s\t%d\t%s\t%s\t%s\n", side.name, side.counts[hash]-other.counts[hash], hash[:12], aws.ToString(example.MessageId), bodyPreview(aws.ToString(example.Body)))
+		}
+	}
+	w.Flush()
+
+	return exitDiffers
+}
+
+// bodyPreview shortens a body to one line for a table.
+func bodyPreview(body string) string {
+	body = strings.Join(strings.Fields(body), " ")
+
+	if runes := []rune(body); len(runes) > 60 {
+		return string(runes[:57]) + "..."
+	}
+
+	return body
+}
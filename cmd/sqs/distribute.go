@@ -0,0 +1,82 @@
+package main
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// destinations returns the queues given with --destination, which may be
+// repeated or list several queues separated by commas, with sqs:// taken off.
+// Sink URLs are taken as they are, since they may contain commas.
+func destinations() []string {
+	var queues []string
+
+	for _, value := range *destinationQueues {
+		if mover.IsSink(value) {
+			queues = append(queues, value)
+			continue
+		}
+
+		for _, queue := range strings.Split(value, ",") {
+			if queue = strings.TrimPrefix(strings.TrimSpace(queue), sqsScheme); queue != "" {
+				queues = append(queues, queue)
+			}
+		}
+	}
+
+	if *destinationTopic != "" {
+		queues = append(queues, mover.SNSSinkURL(*destinationTopic))
+	}
+
+	return queues
+}
+
+// firstDestination returns the first queue given with --destination, or ""
+// when there is none.
+func firstDestination() string {
+	if queues := destinations(); len(queues) > 0 {
+		return queues[0]
+	}
+
+	return ""
+}
+
+// destinationRouter spreads the messages of a move over several destination
+// queues: round-robin by default, by a hash of a message attribute with
+// --hash-attribute, so messages with the same value always land in the same
+// queue, or to all of them with --fanout.
+type destinationRouter struct {
+	queueURLs []string
+	attribute string
+	fanout    bool
+
+	// next is shared by the workers, so the round-robin holds across them.
+	next atomic.Uint64
+}
+
+// activeRouter is set up when the move has several destinations.
+var activeRouter *destinationRouter
+
+// route returns the queues an entry is sent to. Entries without the hashed
+// attribute are spread round-robin.
+func (r *destinationRouter) route(entry *types.SendMessageBatchRequestEntry) []string {
+	if r.fanout {
+		return r.queueURLs
+	}
+
+	if value, ok := entry.MessageAttributes[r.attribute]; ok && r.attribute != "" {
+		h := fnv.New32a()
+		h.Write([]byte(aws.ToString(value.StringValue)))
+		h.Write(value.BinaryValue)
+
+		return []string{r.queueURLs[h.Sum32()%uint32(len(r.queueURLs))]}
+	}
+
+	i := r.next.Add(1) - 1
+	return []string{r.queueURLs[i%uint64(len(r.queueURLs))]}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDestinationTopicGuardrails(t *testing.T) {
+	queues, topic := *destinationQueues, *destinationTopic
+	t.Cleanup(func() { *destinationQueues, *destinationTopic = queues, topic })
+
+	*destinationQueues = []string{ordersQueue}
+	*destinationTopic = "arn:aws:sns:us-east-1:444455556666:alerts"
+
+	got := destinations()
+	if want := []string{ordersQueue, foreignSNS}; !slices.Equal(got, want) {
+		t.Fatalf("destinations = %v, want %v", got, want)
+	}
+
+	rails := guardrails{DenyDestinationAccount: stringList{"444455556666"}, path: "guardrails.yaml"}
+
+	if err := rails.check(ordersDLQ, got[0]); err != nil {
+		t.Errorf("the queue in an allowed account was blocked: %v", err)
+	}
+
+	err := rails.check(ordersDLQ, got[1])
+	if err == nil || !strings.Contains(err.Error(), "into account 444455556666") {
+		t.Errorf("check of the topic = %v, want it blocked as in a denied account", err)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// dumpRecord is one line of a dump file. The system attributes SQS sets are
+// written out as typed fields, for reading dumps with jq and the like, and
+// also kept as they came in Attributes, which is what load sends again.
+type dumpRecord struct {
+	MessageID               string                   `json:"message_id"`
+	Body                    string                   `json:"body"`
+	SentTimestamp           *time.Time               `json:"sent_timestamp,omitempty"`
+	FirstReceiveTimestamp   *time.Time               `json:"first_receive_timestamp,omitempty"`
+	ApproximateReceiveCount int                      `json:"approximate_receive_count,omitempty"`
+	SenderID                string                   `json:"sender_id,omitempty"`
+	MessageGroupID          string                   `json:"message_group_id,omitempty"`
+	MessageDeduplicationID  string                   `json:"message_deduplication_id,omitempty"`
+	SequenceNumber          string                   `json:"sequence_number,omitempty"`
+	TraceHeader             string                   `json:"aws_trace_header,omitempty"`
+	DeadLetterQueueSource   string                   `json:"dead_letter_queue_source_arn,omitempty"`
+	Attributes              map[string]string        `json:"attributes,omitempty"`
+	MessageAttributes       map[string]dumpAttribute `json:"message_attributes,omitempty"`
+
+	// Count is the number of messages with this body the record stands for,
+	// when dump --dedupe wrote it for more than one.
+	Count int `json:"count,omitempty"`
+}
+
+// dumpAttribute is a message attribute as written to a dump file. Binary
+// values are base64 encoded.
+type dumpAttribute struct {
+	DataType    string `json:"data_type"`
+	StringValue string `json:"string_value,omitempty"`
+	BinaryValue []byte `json:"binary_value,omitempty"`
+}
+
+func newDumpRecord(message *types.Message) dumpRecord {
+	record := dumpRecord{
+		MessageID:  aws.ToString(message.MessageId),
+		Body:       aws.ToString(message.Body),
+		Attributes: maps.Clone(message.Attributes),
+	}
+
+	if sent := sentTimestamp(message); !sent.IsZero() {
+		sent = sent.UTC()
+		record.SentTimestamp = &sent
+	}
+
+	if received := timestampAttribute(message, types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp); !received.IsZero() {
+		received = received.UTC()
+		record.FirstReceiveTimestamp = &received
+	}
+
+	record.ApproximateReceiveCount, _ = strconv.Atoi(record.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+
+	for field, name := range record.systemFields() {
+		*field = record.Attributes[name]
+	}
+
+	if len(message.MessageAttributes) > 0 {
+		record.MessageAttributes = make(map[string]dumpAttribute, len(message.MessageAttributes))
+		for name, value := range message.MessageAttributes {
+			record.MessageAttributes[name] = dumpAttribute{
+				DataType:    aws.ToString(value.DataType),
+				StringValue: aws.ToString(value.StringValue),
+				BinaryValue: value.BinaryValue,
+			}
+		}
+	}
+
+	return record
+}
+
+// systemFields maps the string fields of the record to the system attributes
+// they hold.
+func (r *dumpRecord) systemFields() map[*string]string {
+	return map[*string]string{
+		&r.SenderID:               string(types.MessageSystemAttributeNameSenderId),
+		&r.MessageGroupID:         string(types.MessageSystemAttributeNameMessageGroupId),
+		&r.MessageDeduplicationID: string(types.MessageSystemAttributeNameMessageDeduplicationId),
+		&r.SequenceNumber:         string(types.MessageSystemAttributeNameSequenceNumber),
+		&r.TraceHeader:            string(types.MessageSystemAttributeNameAWSTraceHeader),
+		&r.DeadLetterQueueSource:  string(types.MessageSystemAttributeNameDeadLetterQueueSourceArn),
+	}
+}
+
+// runDump writes the messages of a queue to a JSON Lines file. Messages stay
+// in the queue and are made visible again at the end, unless drain is set, in
+// which case each batch is deleted once it is safely on disk. Bodies are
+// masked by rules, and the file is encrypted when kmsKey is set. With dedupe,
+// messages are kept in memory by body and each body written once, with the
+// number of messages that carried it, when the dump ends. The file is
+// compressed with compression, one of dumpCompressions. Up to piiSample
+// messages are scanned for PII first, which stops the dump unless
+// acknowledgePII is set. It reports whether the dump completed.
+func runDump(svc *sqs.Client, queue string, path string, drain bool, limit int, rules []redactRule, kmsKey string, dedupe bool, compression string, piiSample int, acknowledgePII bool) bool {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		logAwsError("Failed to resolve queue", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Queue URL: %s", queueURL))
+
+	resolved := invocation{command: activeCommand, source: queueNameFromURL(queueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			logAwsError("Dump blocked by policy", err)
+			return false
+		}
+	}
+
+	// The file takes the messages out of the account, so the scan always
+	// runs, on the bodies as they will be written.
+	if !checkPII(svc, queueURL, piiSample, rules, acknowledgePII, "dump") {
+		return false
+	}
+
+	queueAttributes, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		logAwsError("Failed to get queue attributes", err)
+		return false
+	}
+
+	numberOfMessages, _ := strconv.Atoi(queueAttributes.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+	if limit > 0 && numberOfMessages > limit {
+		numberOfMessages = limit
+	}
+
+	var sealer *dumpSealer
+	var header []byte
+	if kmsKey != "" {
+		if sealer, header, err = newDumpSealer(kmsKey); err != nil {
+			logAwsError("Failed to get a data key from KMS", err)
+			return false
+		}
+	}
+
+	// A dump is a backup, so an existing file is never overwritten.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to create %s: %s", path, err))
+		return false
+	}
+	defer f.Close()
+
+	out, err := newDumpCompressor(f, compression)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to compress %s: %s", path, err))
+		return false
+	}
+
+	w := bufio.NewWriter(out)
+
+	if header != nil {
+		if _, err := w.Write(append(header, '\n')); err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to write %s: %s", path, err))
+			return false
+		}
+	}
+
+	// writeRecord adds a record to the file, encrypted as asked.
+	writeRecord := func(record dumpRecord) error {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		if sealer != nil {
+			line = sealer.seal(line)
+		}
+
+		_, err = w.Write(append(line, '\n'))
+		return err
+	}
+
+	// unique has the record of every body seen with --dedupe, by the hash of
+	// the body, and bodies the hashes in the order they were first seen.
+	unique := map[string]*dumpRecord{}
+	var bodies []string
+
+	// write adds the record of a message to the file, masked as asked, or
+	// counts it with --dedupe.
+	write := func(message *types.Message) error {
+		record := newDumpRecord(message)
+
+		body, err := redactBody(record.Body, rules)
+		if err != nil {
+			return err
+		}
+		record.Body = body
+
+		if !dedupe {
+			return writeRecord(record)
+		}
+
+		sum := sha256.Sum256([]byte(aws.ToString(message.Body)))
+		key := string(sum[:])
+		if seen, ok := unique[key]; ok {
+			seen.Count++
+			return nil
+		}
+
+		record.Count = 1
+		unique[key] = &record
+		bodies = append(bodies, key)
+		return nil
+	}
+
+	m := mover.New(svc, nil)
+
+	opts := mover.Options{
+		SourceQueueURL:        queueURL,
+		Limit:                 limit,
+		MaxRetries:            defaultMaxRetries,
+		AttributeNames:        []string{string(types.QueueAttributeNameAll)},
+		MessageAttributeNames: []string{"All"},
+		Copy:                  !drain,
+	}
+
+	// A dump that keeps the messages copies them to the file, so they stay
+	// hidden for as long as it runs.
+	if !drain {
+		opts.VisibilityTimeout = copyVisibilityTimeout
+	}
+
+	opts.Handle = func(ctx context.Context, messages []*types.Message) (mover.Result, error) {
+		ctx = context.WithoutCancel(ctx)
+
+		for _, message := range messages {
+			if err := write(message); err != nil {
+				m.Release(ctx, queueURL, messages)
+				return mover.Result{}, err
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			m.Release(ctx, queueURL, messages)
+			return mover.Result{}, err
+		}
+
+		if !drain {
+			return mover.Result{Moved: len(messages)}, nil
+		}
+
+		// Messages are only deleted once they are on disk.
+		if err := out.Flush(); err != nil {
+			m.Release(ctx, queueURL, messages)
+			return mover.Result{}, err
+		}
+
+		if err := f.Sync(); err != nil {
+			m.Release(ctx, queueURL, messages)
+			return mover.Result{}, err
+		}
+
+		return mover.Result{Moved: len(messages)}, m.Delete(ctx, opts, messages)
+	}
+
+	if drain {
+		log.Info(color.New(color.FgCyan).Sprintf("Starting to drain messages into %s...", path))
+	} else {
+		log.Info(color.New(color.FgCyan).Sprintf("Starting to dump messages into %s...", path))
+	}
+	fmt.Println()
+
+	display := startProgress(numberOfMessages)
+	display.pollSource(svc, queueURL, limit, m.InFlight)
+
+	opts.Progress = func(total mover.Result) {
+		display.update(total.Moved)
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := m.Move(ctx, opts)
+	display.stop()
+
+	// Deduplicated records are written once their counts are known, also
+	// when the dump was stopped, since the messages stay in the queue.
+	if dedupe {
+		if writeErr := writeDedupedRecords(writeRecord, unique, bodies); writeErr != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to write %s: %s", path, writeErr))
+			return false
+		}
+	}
+
+	// An encrypted dump ends with a record counting the lines before it,
+	// also when it was stopped, so a reader can tell it wasn't cut short.
+	if sealer != nil {
+		if _, endErr := w.Write(append(sealer.end(), '\n')); endErr != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to finish %s: %s", path, endErr))
+			return false
+		}
+	}
+
+	if closeErr := closeDump(f, w, out); closeErr != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to finish %s: %s", path, closeErr))
+		return false
+	}
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Warn(color.New(color.FgYellow).Sprintf("Interrupted. Wrote %d messages to %s", result.Moved, path))
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			log.Warn(color.New(color.FgYellow).Sprintf("Timed out after %s. Wrote %d messages to %s", *timeout, result.Moved, path))
+		} else {
+			logAwsError(fmt.Sprintf("Failed to dump messages after writing %d to %s", result.Moved, path), err)
+		}
+		return false
+	}
+
+	fmt.Println()
+	if drain {
+		log.Info(color.New(color.FgCyan).Sprintf("Done. Wrote %d messages to %s and deleted them from the queue", result.Moved, path))
+	} else if dedupe {
+		log.Info(color.New(color.FgCyan).Sprintf("Done. Wrote %d messages to %s as %d distinct bodies", result.Moved, path, len(bodies)))
+	} else {
+		log.Info(color.New(color.FgCyan).Sprintf("Done. Wrote %d messages to %s", result.Moved, path))
+	}
+
+	return true
+}
+
+// writeDedupedRecords writes the records --dedupe kept, in the order their
+// bodies were first seen. A record that stands for a single message is
+// written as dump writes it without --dedupe.
+func writeDedupedRecords(writeRecord func(dumpRecord) error, unique map[string]*dumpRecord, bodies []string) error {
+	for _, key := range bodies {
+		record := *unique[key]
+		if record.Count == 1 {
+			record.Count = 0
+		}
+
+		if err := writeRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeDump writes out what is buffered, ends the compressed stream and
+// waits until the file is on disk.
+func closeDump(f *os.File, w *bufio.Writer, out dumpCompressor) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
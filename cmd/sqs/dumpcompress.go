@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// dumpCompressions are the values of dump --compress.
+var dumpCompressions = []string{"none", "gzip", "zstd"}
+
+// zstdMagic starts every Zstandard frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// dumpCompressor compresses a dump as it is written. Flush pushes what was
+// written so far through to the file, and Close ends the stream.
+type dumpCompressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// plainDump is the dumpCompressor of an uncompressed dump.
+type plainDump struct {
+	io.Writer
+}
+
+func (plainDump) Flush() error { return nil }
+func (plainDump) Close() error { return nil }
+
+// newDumpCompressor compresses what is written to w with compression, one
+// of dumpCompressions.
+func newDumpCompressor(w io.Writer, compression string) (dumpCompressor, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	default:
+		return plainDump{w}, nil
+	}
+}
+
+// decompressDump returns a reader of the contents of a dump or load file,
+// decompressed when it starts like a gzip or Zstandard stream.
+func decompressDump(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+
+	// A file shorter than a magic number is read as it is.
+	start, _ := buffered.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(start, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(start, zstdMagic):
+		// With a concurrency of one the stream is decoded as it is read,
+		// without goroutines that would have to be stopped with Close.
+		return zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+	default:
+		return buffered, nil
+	}
+}
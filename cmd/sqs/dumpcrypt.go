@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// dumpCipher is the encryption of dumps written with --encrypt-dump, as
+// named in their header.
+const dumpCipher = "AES-256-GCM"
+
+// encryptedDumpHeader is the first line of an encrypted dump. It holds the
+// data key the lines are encrypted with, itself encrypted with the KMS key,
+// so only those allowed to decrypt with the key can read the dump. The lines
+// after it are dump records sealed with the data key, and the last one is an
+// end record counting them.
+type encryptedDumpHeader struct {
+	Encryption   string `json:"encryption"`
+	KMSKeyID     string `json:"kms_key_id"`
+	EncryptedKey []byte `json:"encrypted_key"`
+}
+
+// The additional data records and the end record are sealed with, so one
+// can't pass for the other.
+var (
+	dumpRecordData = []byte("sqsmover dump record")
+	dumpEndData    = []byte("sqsmover dump end")
+)
+
+// dumpEnd is the end record of an encrypted dump.
+type dumpEnd struct {
+	Records uint64 `json:"records"`
+}
+
+// dumpSealer encrypts the lines of a dump. Every line gets the next nonce of
+// a counter, which is safe since every dump has a data key of its own, and
+// binds the line to its place in the file: a reader expects the nonces in
+// order, so lines that were reordered or dropped don't decrypt.
+type dumpSealer struct {
+	aead  cipher.AEAD
+	count uint64
+}
+
+// kmsClient returns a KMS client for the region of keyID when it is an ARN,
+// or for --region.
+func kmsClient(keyID string) (*kms.Client, error) {
+	keyRegion := *region
+	if parsed, err := arn.Parse(keyID); err == nil {
+		keyRegion = parsed.Region
+	}
+
+	cfg, err := newConfig(*profile, keyRegion, *endpointURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return kms.NewFromConfig(cfg), nil
+}
+
+// newDumpSealer asks KMS for a data key under keyID and returns the sealer
+// using it, with the header to write before the first line.
+func newDumpSealer(keyID string) (*dumpSealer, []byte, error) {
+	client, err := kmsClient(keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := client.GenerateDataKey(runCtx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newDumpAEAD(key.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := json.Marshal(encryptedDumpHeader{
+		Encryption:   dumpCipher,
+		KMSKeyID:     aws.ToString(key.KeyId),
+		EncryptedKey: key.CiphertextBlob,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &dumpSealer{aead: aead}, header, nil
+}
+
+func newDumpAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts a record, returning the nonce and ciphertext base64 encoded.
+func (s *dumpSealer) seal(line []byte) []byte {
+	return s.sealAs(line, dumpRecordData)
+}
+
+// end returns the end record, which counts the records sealed before it. A
+// reader refuses a file without it, as one that was cut short.
+func (s *dumpSealer) end() []byte {
+	line, _ := json.Marshal(dumpEnd{Records: s.count})
+	return s.sealAs(line, dumpEndData)
+}
+
+func (s *dumpSealer) sealAs(line []byte, data []byte) []byte {
+	nonce := dumpNonce(s.aead, s.count)
+	s.count++
+
+	sealed := s.aead.Seal(nonce, nonce, line, data)
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(encoded, sealed)
+
+	return encoded
+}
+
+// dumpNonce is the nonce of line number i, counted from the first after the
+// header.
+func dumpNonce(aead cipher.AEAD, i uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], i)
+	return nonce
+}
+
+// dumpScanner reads the lines of a dump or load file like bufio.Scanner,
+// decrypting them when the file was written with --encrypt-dump. An
+// encrypted file must hold its lines in the order they were written and end
+// with its end record.
+type dumpScanner struct {
+	scanner *bufio.Scanner
+	aead    cipher.AEAD
+	first   *string
+	text    string
+	err     error
+
+	// count is the number of the next encrypted line, and ended is set once
+	// the end record was read.
+	count uint64
+	ended bool
+}
+
+// newDumpScanner decompresses r when dump --compress wrote it, and reads its
+// first line to tell whether it is encrypted, and if so decrypts its data key
+// with KMS.
+func newDumpScanner(r io.Reader) (*dumpScanner, error) {
+	r, err := decompressDump(r)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLoadLine)
+
+	s := &dumpScanner{scanner: scanner}
+	if !scanner.Scan() {
+		return s, scanner.Err()
+	}
+
+	first := scanner.Text()
+
+	var header encryptedDumpHeader
+	if json.Unmarshal([]byte(first), &header) != nil || header.Encryption == "" {
+		s.first = &first
+		return s, nil
+	}
+
+	if header.Encryption != dumpCipher {
+		return nil, fmt.Errorf("the file is encrypted with %s, which this version can't decrypt", header.Encryption)
+	}
+
+	client, err := kmsClient(header.KMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := client.Decrypt(runCtx, &kms.DecryptInput{
+		KeyId:          aws.String(header.KMSKeyID),
+		CiphertextBlob: header.EncryptedKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the data key of the file with %s: %s", header.KMSKeyID, err)
+	}
+
+	if s.aead, err = newDumpAEAD(key.Plaintext); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Scan advances to the next line, which Text then returns. It returns false
+// at the end of the file or on the first line that can't be decrypted.
+func (s *dumpScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if s.first != nil {
+		s.text, s.first = *s.first, nil
+		return true
+	}
+
+	for {
+		if !s.scanner.Scan() {
+			if s.aead != nil && !s.ended && s.scanner.Err() == nil {
+				s.err = fmt.Errorf("the encrypted file ends after %d records without its end record, so it was cut short", s.count)
+			}
+			return false
+		}
+
+		s.text = s.scanner.Text()
+		if s.aead == nil {
+			return true
+		}
+
+		if strings.TrimSpace(s.text) == "" {
+			continue
+		}
+
+		if s.ended {
+			s.err = fmt.Errorf("the encrypted file has lines after its end record")
+			return false
+		}
+
+		return s.open()
+	}
+}
+
+// open decrypts the current line, which must be the next record or the end
+// record.
+func (s *dumpScanner) open() bool {
+	sealed, err := base64.StdEncoding.DecodeString(s.text)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		s.err = fmt.Errorf("line %d of the encrypted file is damaged", s.count+1)
+		return false
+	}
+
+	nonce := sealed[:s.aead.NonceSize()]
+	if !bytes.Equal(nonce, dumpNonce(s.aead, s.count)) {
+		s.err = fmt.Errorf("line %d of the encrypted file is out of place, lines were reordered or removed", s.count+1)
+		return false
+	}
+	s.count++
+
+	if line, err := s.aead.Open(nil, nonce, sealed[len(nonce):], dumpRecordData); err == nil {
+		s.text = string(line)
+		return true
+	}
+
+	line, err := s.aead.Open(nil, nonce, sealed[len(nonce):], dumpEndData)
+	if err != nil {
+		s.err = fmt.Errorf("line %d of the encrypted file can't be decrypted: %s", s.count, err)
+		return false
+	}
+
+	var end dumpEnd
+	if err := json.Unmarshal(line, &end); err != nil || end.Records != s.count-1 {
+		s.err = fmt.Errorf("the end record of the encrypted file doesn't match its %d records", s.count-1)
+		return false
+	}
+
+	// The end record isn't a line of the dump: the file ends here.
+	s.ended = true
+	return s.Scan()
+}
+
+func (s *dumpScanner) Text() string {
+	return s.text
+}
+
+func (s *dumpScanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.scanner.Err()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// sealedDump returns the encrypted lines of a dump of records, the end
+// record last, sealed with a fixed data key in place of one from KMS.
+func sealedDump(t *testing.T, records ...string) []string {
+	t.Helper()
+
+	aead, err := newDumpAEAD(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealer := &dumpSealer{aead: aead}
+
+	var lines []string
+	for _, record := range records {
+		lines = append(lines, string(sealer.seal([]byte(record))))
+	}
+
+	return append(lines, string(sealer.end()))
+}
+
+// openDump reads encrypted lines back as a dump scanner with the same key.
+func openDump(t *testing.T, lines []string) ([]string, error) {
+	t.Helper()
+
+	aead, err := newDumpAEAD(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &dumpScanner{scanner: bufio.NewScanner(strings.NewReader(strings.Join(lines, "\n"))), aead: aead}
+
+	var records []string
+	for s.Scan() {
+		records = append(records, s.Text())
+	}
+
+	return records, s.Err()
+}
+
+func TestEncryptedDump(t *testing.T) {
+	records := []string{`{"body":"a"}`, `{"body":"b"}`, `{"body":"c"}`}
+
+	tests := []struct {
+		name string
+		edit func(lines []string) []string
+
+		// wantErr is part of the error, or empty when every record reads
+		// back.
+		wantErr string
+	}{
+		{name: "intact", edit: func(lines []string) []string { return lines }},
+		{name: "blank lines", edit: func(lines []string) []string { return append([]string{"", lines[0], " "}, lines[1:]...) }},
+		{name: "reordered", edit: func(lines []string) []string {
+			return []string{lines[1], lines[0], lines[2], lines[3]}
+		}, wantErr: "out of place"},
+		{name: "record removed", edit: func(lines []string) []string {
+			return []string{lines[0], lines[2], lines[3]}
+		}, wantErr: "out of place"},
+		{name: "cut short", edit: func(lines []string) []string { return lines[:3] }, wantErr: "cut short"},
+		{name: "line after the end", edit: func(lines []string) []string { return append(lines, lines[0]) }, wantErr: "after its end record"},
+		{name: "tampered", edit: func(lines []string) []string {
+			sealed, _ := base64.StdEncoding.DecodeString(lines[1])
+			sealed[len(sealed)-1] ^= 1
+			return []string{lines[0], base64.StdEncoding.EncodeToString(sealed), lines[2], lines[3]}
+		}, wantErr: "can't be decrypted"},
+		{name: "not base64", edit: func(lines []string) []string {
+			return []string{lines[0], "not a sealed line", lines[2], lines[3]}
+		}, wantErr: "damaged"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := openDump(t, test.edit(sealedDump(t, records...)))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("reading the dump = %v, want an error about %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading the dump failed: %s", err)
+			}
+
+			if strings.Join(got, "\n") != strings.Join(records, "\n") {
+				t.Errorf("read %q, want %q", got, records)
+			}
+		})
+	}
+}
+
+func TestPlainDumpScanner(t *testing.T) {
+	s, err := newDumpScanner(strings.NewReader("{\"body\":\"a\"}\n{\"body\":\"b\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`{"body":"a"}`, `{"body":"b"}`}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
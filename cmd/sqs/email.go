@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/ses/types"
+	"github.com/fatih/color"
+)
+
+// emailRow is one line of the summary email.
+type emailRow struct {
+	Label string
+	Value string
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px">
+<p>{{.Title}}</p>
+<table style="border-collapse: collapse">
+{{- range .Rows}}
+<tr><th style="text-align: left; padding: 4px 16px 4px 0; vertical-align: top">{{.Label}}</th><td style="padding: 4px 0">{{.Value}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// emailSubject names the queues and the outcome, so the email can be found
+// again by searching for the queues.
+func emailSubject(summary runSummary) string {
+	return fmt.Sprintf("[sqsmover] %s: %s to %s, moved %d messages", summary.Status, queueNameFromURL(summary.Source), queueNameFromURL(summary.Destination), summary.Moved)
+}
+
+// emailRows lays out the run summary, with the same figures as the webhook
+// payload and the final log line.
+func emailRows(summary runSummary) []emailRow {
+	host, _ := os.Hostname()
+
+	rows := []emailRow{
+		{"Run ID", summary.RunID},
+		{"Status", summary.Status},
+	}
+
+	if summary.StopReason != "" {
+		rows = append(rows, emailRow{"Stop reason", summary.StopReason})
+	}
+
+	if summary.Account != "" {
+		rows = append(rows, emailRow{"Account", summary.Account})
+	}
+
+	if summary.Operator != nil {
+		rows = append(rows, emailRow{"Operator", summary.Operator.Arn})
+	}
+
+	rows = append(rows,
+		emailRow{"Source", summary.Source},
+		emailRow{"Destination", summary.Destination},
+		emailRow{"Started", summary.StartedAt.Format(time.RFC3339)},
+		emailRow{"Finished", summary.FinishedAt.Format(time.RFC3339)},
+		emailRow{"Duration", summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second).String()},
+		emailRow{"Moved", fmt.Sprint(summary.Moved)},
+		emailRow{"Sent", fmt.Sprint(summary.Sent)},
+		emailRow{"Dropped", fmt.Sprint(summary.Dropped)},
+		emailRow{"Skipped", fmt.Sprint(summary.Skipped)},
+		emailRow{"Failed", fmt.Sprint(summary.Failed)},
+	)
+
+	if summary.Depths != nil {
+		d := summary.Depths
+		rows = append(rows,
+			emailRow{"Source depth", fmt.Sprintf("%d before, %d after", d.SourceBefore, d.SourceAfter)},
+			emailRow{"Destination depth", fmt.Sprintf("%d before, %d after", d.DestinationBefore, d.DestinationAfter)},
+		)
+
+		for _, anomaly := range d.Anomalies {
+			rows = append(rows, emailRow{"Anomaly", anomaly})
+		}
+	}
+
+	if summary.Error != "" {
+		rows = append(rows, emailRow{"Error", summary.Error})
+	}
+
+	if host != "" {
+		rows = append(rows, emailRow{"Host", host})
+	}
+
+	return rows
+}
+
+// emailBodies renders the summary as plain text and as HTML.
+func emailBodies(summary runSummary) (string, string, error) {
+	title := fmt.Sprintf("sqsmover run %s %s.", summary.RunID, summary.Status)
+	rows := emailRows(summary)
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n\n", title)
+	for _, row := range rows {
+		fmt.Fprintf(&text, "%-18s %s\n", row.Label+":", row.Value)
+	}
+
+	var html bytes.Buffer
+	if err := emailTemplate.Execute(&html, struct {
+		Title string
+		Rows  []emailRow
+	}{title, rows}); err != nil {
+		return "", "", err
+	}
+
+	return text.String(), html.String(), nil
+}
+
+// notifyEmail sends the run summary with SES to the --notify-email addresses.
+// A failed send is reported but doesn't change the outcome of the run.
+func notifyEmail(summary runSummary) {
+	if len(*notifyEmails) == 0 {
+		return
+	}
+
+	if err := sendSummaryEmail(summary); err != nil {
+		logAwsError("Failed to email the summary", err)
+		return
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Emailed the summary to %s", strings.Join(*notifyEmails, ", ")))
+}
+
+func sendSummaryEmail(summary runSummary) error {
+	cfg, err := newConfig(*profile, orDefault(*notifyEmailRegion, *region), *endpointURL)
+	if err != nil {
+		return err
+	}
+
+	text, html, err := emailBodies(summary)
+	if err != nil {
+		return err
+	}
+
+	_, err = ses.NewFromConfig(cfg).SendEmail(context.WithoutCancel(runCtx), &ses.SendEmailInput{
+		Source:      aws.String(*notifyEmailFrom),
+		Destination: &sestypes.Destination{ToAddresses: *notifyEmails},
+		Message: &sestypes.Message{
+			Subject: &sestypes.Content{Charset: aws.String("UTF-8"), Data: aws.String(emailSubject(summary))},
+			Body: &sestypes.Body{
+				Text: &sestypes.Content{Charset: aws.String("UTF-8"), Data: aws.String(text)},
+				Html: &sestypes.Content{Charset: aws.String("UTF-8"), Data: aws.String(html)},
+			},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// emulatorCredentials are the placeholder keys LocalStack and ElasticMQ
+// accept, used for an endpoint when no real credentials can be found.
+var emulatorCredentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+
+// checkEndpoint fails unless endpoint is empty or an http:// or https:// URL.
+// Without a scheme the SDK would assume HTTPS, which emulators rarely serve.
+func checkEndpoint(flag string, endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s %q must be a URL such as http://localhost:4566", flag, endpoint)
+	}
+
+	return nil
+}
+
+// sideEndpoint returns the endpoint of one side of a move: its own flag,
+// then --endpoint-url, then the endpoint of its queue when the queue is given
+// as the URL of an emulator.
+func sideEndpoint(flag string, queue string) string {
+	return orDefault(flag, orDefault(*endpointURL, queueEndpoint(queue)))
+}
+
+// queueEndpoint returns the scheme and host of a queue URL outside AWS, such
+// as http://localhost:4566/000000000000/orders, so a queue copied from
+// LocalStack or ElasticMQ is called where it lives. It returns "" for AWS
+// queue URLs and anything that isn't a URL.
+func queueEndpoint(queue string) string {
+	if !strings.HasPrefix(queue, "http://") && !strings.HasPrefix(queue, "https://") {
+		return ""
+	}
+
+	u, err := url.Parse(queue)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := u.Hostname()
+	for _, suffix := range []string{".amazonaws.com", ".amazonaws.com.cn", ".api.aws"} {
+		if strings.HasSuffix(host, suffix) {
+			return ""
+		}
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// useEmulatorCredentials gives a config with an endpoint placeholder
+// credentials when the usual chain finds none, so LocalStack and ElasticMQ
+// can be used without configuring a profile.
+func useEmulatorCredentials(cfg *aws.Config) {
+	if cfg.Credentials != nil {
+		if _, err := cfg.Credentials.Retrieve(runCtx); err == nil {
+			return
+		}
+	}
+
+	cfg.Credentials = emulatorCredentials
+}
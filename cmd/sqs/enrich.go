@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// dynamoEnricher looks up one DynamoDB item per message and copies selected
+// fields of it onto the outgoing message as message attributes.
+type dynamoEnricher struct {
+	db      *dynamodb.Client
+	table   string
+	key     string
+	keyType dbtypes.ScalarAttributeType
+	path    jsonPath
+	fields  []string
+}
+
+// parseEnrichSpec splits TABLE:KEY=jsonpath:EXPR into its parts.
+func parseEnrichSpec(spec string) (table string, key string, path jsonPath, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return "", "", nil, fmt.Errorf("enrichment %q must look like TABLE:KEY=jsonpath:EXPR", spec)
+	}
+
+	keyParts := strings.SplitN(parts[1], "=", 2)
+	if len(keyParts) != 2 || !strings.HasPrefix(keyParts[1], "jsonpath:") {
+		return "", "", nil, fmt.Errorf("enrichment %q must look like TABLE:KEY=jsonpath:EXPR", spec)
+	}
+
+	path, err = parseJSONPath(strings.TrimPrefix(keyParts[1], "jsonpath:"))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return parts[0], keyParts[0], path, nil
+}
+
+func newDynamoEnricher(cfg aws.Config, spec string, fields []string) (*dynamoEnricher, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("--enrich-dynamodb needs at least one --enrich-field")
+	}
+
+	table, key, path, err := parseEnrichSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	db := dynamodb.NewFromConfig(cfg)
+
+	desc, err := db.DescribeTable(runCtx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, err
+	}
+
+	var partitionKey string
+	for _, element := range desc.Table.KeySchema {
+		if element.KeyType == dbtypes.KeyTypeRange {
+			return nil, fmt.Errorf("table %s has a sort key, only partition key lookups are supported", table)
+		}
+		partitionKey = aws.ToString(element.AttributeName)
+	}
+
+	if partitionKey != key {
+		return nil, fmt.Errorf("table %s is keyed by %s, not %s", table, partitionKey, key)
+	}
+
+	e := &dynamoEnricher{db: db, table: table, key: key, path: path, fields: fields}
+	for _, definition := range desc.Table.AttributeDefinitions {
+		if aws.ToString(definition.AttributeName) == key {
+			e.keyType = definition.AttributeType
+		}
+	}
+
+	return e, nil
+}
+
+// enrich adds the looked up fields to entries, reading each key from the
+// entry body. It returns how many entries had no matching item.
+func (e *dynamoEnricher) enrich(entries []*types.SendMessageBatchRequestEntry) (int, error) {
+	keys := make([]string, len(entries))
+	var lookups []map[string]dbtypes.AttributeValue
+	requested := map[string]bool{}
+
+	for i, entry := range entries {
+		keys[i] = e.keyFromBody(aws.ToString(entry.MessageBody))
+		if keys[i] == "" || requested[keys[i]] {
+			continue
+		}
+
+		requested[keys[i]] = true
+		lookups = append(lookups, e.keyAttribute(keys[i]))
+	}
+
+	items := map[string]map[string]dbtypes.AttributeValue{}
+
+	for len(lookups) > 0 {
+		resp, err := e.db.BatchGetItem(runCtx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]dbtypes.KeysAndAttributes{
+				e.table: {Keys: lookups},
+			},
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, item := range resp.Responses[e.table] {
+			items[attributeString(item[e.key])] = item
+		}
+
+		lookups = nil
+		if unprocessed, ok := resp.UnprocessedKeys[e.table]; ok {
+			lookups = unprocessed.Keys
+		}
+	}
+
+	missing := 0
+
+	for i, entry := range entries {
+		item, ok := items[keys[i]]
+		if !ok {
+			missing++
+			continue
+		}
+
+		for _, field := range e.fields {
+			value, ok := item[field]
+			if !ok {
+				continue
+			}
+
+			if entry.MessageAttributes == nil {
+				entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+			}
+
+			dataType := "String"
+			if _, ok := value.(*dbtypes.AttributeValueMemberN); ok {
+				dataType = "Number"
+			}
+
+			entry.MessageAttributes[field] = types.MessageAttributeValue{
+				DataType:    aws.String(dataType),
+				StringValue: aws.String(attributeString(value)),
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+func (e *dynamoEnricher) keyFromBody(body string) string {
+	doc, ok := decodeJSON(decodeBody(body))
+	if !ok {
+		return ""
+	}
+
+	values := e.path.get(doc)
+	if len(values) != 1 {
+		return ""
+	}
+
+	switch value := values[0].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+
+	return ""
+}
+
+func (e *dynamoEnricher) keyAttribute(key string) map[string]dbtypes.AttributeValue {
+	var value dbtypes.AttributeValue = &dbtypes.AttributeValueMemberS{Value: key}
+	if e.keyType == dbtypes.ScalarAttributeTypeN {
+		value = &dbtypes.AttributeValueMemberN{Value: key}
+	}
+
+	return map[string]dbtypes.AttributeValue{e.key: value}
+}
+
+// attributeString renders scalar DynamoDB values as message attribute text.
+// Other values are rendered as DynamoDB JSON, such as {"L":[{"S":"a"}]}.
+func attributeString(value dbtypes.AttributeValue) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case *dbtypes.AttributeValueMemberS:
+		return value.Value
+	case *dbtypes.AttributeValueMemberN:
+		return value.Value
+	case *dbtypes.AttributeValueMemberBOOL:
+		return fmt.Sprintf("%t", value.Value)
+	}
+
+	encoded, _ := json.Marshal(dynamoJSON(value))
+	return string(encoded)
+}
+
+// dynamoJSON returns value in the shape of DynamoDB JSON, ready to encode.
+func dynamoJSON(value dbtypes.AttributeValue) map[string]interface{} {
+	switch value := value.(type) {
+	case *dbtypes.AttributeValueMemberS:
+		return map[string]interface{}{"S": value.Value}
+	case *dbtypes.AttributeValueMemberN:
+		return map[string]interface{}{"N": value.Value}
+	case *dbtypes.AttributeValueMemberB:
+		return map[string]interface{}{"B": value.Value}
+	case *dbtypes.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": value.Value}
+	case *dbtypes.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": value.Value}
+	case *dbtypes.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": value.Value}
+	case *dbtypes.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": value.Value}
+	case *dbtypes.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": value.Value}
+	case *dbtypes.AttributeValueMemberL:
+		list := make([]interface{}, len(value.Value))
+		for i, element := range value.Value {
+			list[i] = dynamoJSON(element)
+		}
+		return map[string]interface{}{"L": list}
+	case *dbtypes.AttributeValueMemberM:
+		members := make(map[string]interface{}, len(value.Value))
+		for name, member := range value.Value {
+			members[name] = dynamoJSON(member)
+		}
+		return map[string]interface{}{"M": members}
+	}
+
+	return map[string]interface{}{}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	jsonhandler "github.com/apex/log/handlers/json"
+	"github.com/fatih/color"
+)
+
+// eventOutput receives the events of --output json. It is nil otherwise.
+var eventOutput io.Writer
+
+// startJSONOutput switches to machine-readable output: events as JSON lines
+// on stdout, logs as JSON on stderr, and no progress bar. Anything else the
+// command prints goes to stderr so it can't break the event stream.
+func startJSONOutput() {
+	eventOutput = os.Stdout
+	os.Stdout = os.Stderr
+
+	color.NoColor = true
+	log.SetHandler(runHandler{next: jsonhandler.New(os.Stderr)})
+}
+
+// emitEvent writes one event with the fields of payload, which has to encode
+// as a JSON object.
+func emitEvent(event string, payload interface{}) {
+	if eventOutput == nil {
+		return
+	}
+
+	json.NewEncoder(eventOutput).Encode(eventFields(event, payload))
+}
+
+// eventFields adds the event name, run ID and time to the fields of payload.
+func eventFields(event string, payload interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if payload != nil {
+		if data, err := json.Marshal(payload); err == nil {
+			json.Unmarshal(data, &fields)
+		}
+	}
+
+	fields["event"] = event
+	fields["run_id"] = runID
+	fields["time"] = time.Now().UTC()
+
+	return fields
+}
+
+// summaryEvent is the final event of a move.
+type summaryEvent struct {
+	runSummary
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func emitSummary(summary runSummary) {
+	// A source with nothing to move has no status, as in sweep reports.
+	if summary.Status == "" {
+		summary.Status = "empty"
+	}
+
+	if summary.FinishedAt.IsZero() {
+		summary.FinishedAt = time.Now().UTC()
+	}
+
+	event := summaryEvent{runSummary: summary, DurationSeconds: summary.FinishedAt.Sub(summary.StartedAt).Seconds()}
+
+	emitEvent("summary", event)
+	if activeProgress != nil {
+		activeProgress.publish("summary", event)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/aws/smithy-go"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Exit codes, so scripts can tell why a run failed.
+const (
+	exitFailed  = 1 // any failure not covered below
+	exitUsage   = 2 // invalid flags, arguments or configuration files
+	exitQueue   = 3 // a queue couldn't be resolved
+	exitPartial = 4 // the move stopped after some messages were moved
+	exitAuth    = 5 // AWS rejected the credentials or denied access
+	exitDiffers = 6 // diff found messages only one side holds
+)
+
+// Stop reasons, reported as stop_reason in the summary so automation can tell
+// a run that finished from the ways one can be cut short.
+const (
+	stopDrained       = "drained"             // the source had nothing left to move
+	stopLimit         = "limit"               // --limit or --percent messages were moved or dropped
+	stopDuration      = "duration"            // --duration passed
+	stopIdle          = "idle"                // --idle-exit passed without new messages
+	stopEmpty         = "empty"               // there was nothing to move
+	stopInterrupted   = "interrupted"         // Ctrl-C or SIGTERM
+	stopTimeout       = "timeout"             // --timeout passed
+	stopGuardrail     = "guardrail"           // a guardrail blocked the run
+	stopPolicy        = "policy"              // an operation policy blocked the run
+	stopPIIScan       = "pii_scan"            // the PII scan didn't pass
+	stopNotConfirmed  = "not_confirmed"       // --safe asked and the move wasn't confirmed
+	stopBounced       = "bounced"             // --bounce-limit moved messages came back to the source
+	stopUsage         = "invalid_usage"       // flags or queues that can't be combined
+	stopQueue         = "queue_unavailable"   // a queue couldn't be resolved or read
+	stopAccessDenied  = "access_denied"       // AWS rejected the credentials or denied access
+	stopReceiveFailed = "receive_failed"      // receiving from the source failed
+	stopEntriesFailed = "entries_failed"      // a transform or other rewrite failed
+	stopSendFailed    = "send_failed"         // sending to the destination failed
+	stopDeleteFailed  = "delete_failed"       // deleting from the source failed
+	stopTaskFailed    = "task_failed"         // the server-side move task failed
+	stopTaskCancelled = "task_cancelled"      // the server-side move task was cancelled
+	stopVerification  = "verification_failed" // a --via-staging hop couldn't be verified
+	stopPanic         = "panic"               // an unexpected error, logged with its stack under --verbose
+	stopFailed        = "failed"              // any other failure
+)
+
+// authErrorCodes are the AWS error codes of missing, invalid or expired
+// credentials and of denied access.
+var authErrorCodes = map[string]bool{
+	"NoCredentialProviders":             true,
+	"InvalidClientTokenId":              true,
+	"UnrecognizedClientException":       true,
+	"SignatureDoesNotMatch":             true,
+	"ExpiredToken":                      true,
+	"ExpiredTokenException":             true,
+	"InvalidAccessKeyId":                true,
+	"AccessDenied":                      true,
+	"AccessDeniedException":             true,
+	"SharedConfigProfileNotExistsError": true,
+	"SharedConfigAssumeRoleError":       true,
+}
+
+func init() {
+	// Kingpin exits with 1 on parse errors and in Fatalf.
+	kingpin.CommandLine.Terminate(func(status int) {
+		if status != 0 {
+			status = exitUsage
+		}
+		os.Exit(status)
+	})
+}
+
+// failureCode returns exitAuth when err comes from AWS rejecting the caller,
+// and fallback otherwise.
+func failureCode(err error, fallback int) int {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && authErrorCodes[apiErr.ErrorCode()] {
+		return exitAuth
+	}
+
+	return fallback
+}
+
+// setupStopReason tells why a run that failed before moving anything stopped,
+// from its exit code.
+func setupStopReason(code int) string {
+	switch code {
+	case exitUsage:
+		return stopUsage
+	case exitQueue:
+		return stopQueue
+	case exitAuth:
+		return stopAccessDenied
+	default:
+		return stopFailed
+	}
+}
+
+// finishStopReason tells why a move that didn't record a reason of its own
+// stopped.
+func finishStopReason(completed bool) string {
+	if completed {
+		return stopDrained
+	}
+
+	return stopFailed
+}
+
+// moveStopReason tells why a move run with ctx ended with err, once done
+// of limit messages were taken. A --follow stopped by ctx ends without an
+// error, so ctx is looked at first.
+func moveStopReason(ctx context.Context, err error, done int, limit int) string {
+	switch {
+	case durationOver(ctx):
+		return stopDuration
+	case ctx.Err() != nil:
+		return errorStopReason(ctx.Err())
+	case err != nil:
+		return errorStopReason(err)
+	case limit > 0 && done >= limit:
+		return stopLimit
+	default:
+		return stopDrained
+	}
+}
+
+// durationOver reports whether the move of ctx ended because its --duration
+// passed, rather than --timeout or an interrupt.
+func durationOver(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded) && runCtx.Err() == nil
+}
+
+// errorStopReason tells why a run stopped on err: the step of the move that
+// failed, or how the run was cut short.
+func errorStopReason(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return stopInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		return stopTimeout
+	case failureCode(err, exitFailed) == exitAuth:
+		return stopAccessDenied
+	}
+
+	var panicErr *mover.PanicError
+	if errors.As(err, &panicErr) {
+		return stopPanic
+	}
+
+	var moveErr *mover.Error
+	if !errors.As(err, &moveErr) {
+		return stopFailed
+	}
+
+	switch moveErr.Op {
+	case mover.OpReceive:
+		return stopReceiveFailed
+	case mover.OpEntries:
+		return stopEntriesFailed
+	case mover.OpSend:
+		return stopSendFailed
+	case mover.OpDelete:
+		return stopDeleteFailed
+	default:
+		return stopFailed
+	}
+}
+
+// exitStatus returns the exit code a run with this summary ends with. Moves
+// that failed after moving messages are partial whatever stopped them, since
+// the queues then need looking at before running again, and so are completed
+// moves that set messages aside with --on-error.
+func (s runSummary) exitStatus() int {
+	switch {
+	case s.Status == "completed" && s.Failed > 0:
+		return exitPartial
+	case s.Status == "" || s.Status == "completed":
+		return 0
+	case s.Moved+s.Dropped > 0:
+		return exitPartial
+	case s.exitCode != 0:
+		return s.exitCode
+	default:
+		return exitFailed
+	}
+}
+
+// logFinalSummary prints the message counts of a run, whether it completed
+// or not.
+func logFinalSummary(summary runSummary) {
+	received := summary.Moved + summary.Dropped + summary.Skipped + summary.Failed
+
+	deleted := summary.Moved + summary.Dropped - summary.Undeleted
+	if *copyMessages {
+		deleted = 0
+	}
+
+	if summary.Undeleted > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("%d messages were sent but could not be deleted from the source, and will be received again once their visibility timeout expires", summary.Undeleted))
+	}
+
+	format := "Summary: received %d, sent %d, deleted %d, failed %d"
+	if summary.Failed > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf(format, received, summary.Sent, deleted, summary.Failed))
+	} else {
+		log.Info(color.New(color.FgCyan).Sprintf(format, received, summary.Sent, deleted, summary.Failed))
+	}
+
+	if summary.Bytes.Chunks > 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Data: received %s, sent %s, billed as %d requests of up to 64 KB", formatBytes(summary.Bytes.Received), formatBytes(summary.Bytes.Sent), summary.Bytes.Chunks))
+	}
+}
+
+// byteReport is the data a run carried, as the bytes section of the summary.
+type byteReport struct {
+	Received int64 `json:"received"`
+	Sent     int64 `json:"sent"`
+	Chunks   int64 `json:"billed_chunks"`
+}
+
+// formatBytes shows a size in bytes, KB, MB or GB of 1024 of the unit
+// below.
+func formatBytes(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d bytes", size)
+	}
+
+	value := float64(size) / 1024
+	for _, unit := range []string{"KB", "MB"} {
+		if value < 1024 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+		value /= 1024
+	}
+
+	return fmt.Sprintf("%.1f GB", value)
+}
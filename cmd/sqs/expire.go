@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// expireAge is the --expire-older-than age. Messages sent longer ago than
+// that aren't moved. Zero expires nothing.
+var expireAge time.Duration
+
+// expireQueueURL is the --expire-to queue that expired messages are sent to
+// instead of being dropped.
+var expireQueueURL string
+
+// expiryAttribute is the message attribute --attach-expiry stamps.
+const expiryAttribute = "expiresAt"
+
+// maxMessageAttributes is how many message attributes SQS accepts on a
+// message.
+const maxMessageAttributes = 10
+
+// expiryLifetime is the --attach-expiry age. Zero stamps nothing.
+var expiryLifetime time.Duration
+
+// parseAge reads an age such as 7d, 36h or 90m.
+func parseAge(age string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("age %q must be a positive number of days, such as 7d", age)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(age)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("age %q must look like 7d, 36h or 90m", age)
+	}
+
+	return d, nil
+}
+
+// isExpired reports whether the message was first sent longer than
+// --expire-older-than ago. Messages without a SentTimestamp never expire.
+func isExpired(message *types.Message) bool {
+	if expireAge == 0 {
+		return false
+	}
+
+	sent := sentTimestamp(message)
+	return !sent.IsZero() && time.Since(sent) > expireAge
+}
+
+// stampExpiry sets the expiresAt attribute of entry to when the message it
+// came from expires: expiryLifetime after it was first sent, in RFC 3339 and
+// UTC. A stamp the message carries already is replaced. Messages without a
+// SentTimestamp expire that long from now.
+func stampExpiry(entry *types.SendMessageBatchRequestEntry, origin *types.Message) error {
+	if _, ok := entry.MessageAttributes[expiryAttribute]; !ok && len(entry.MessageAttributes) >= maxMessageAttributes {
+		return fmt.Errorf("message %s already has %d message attributes, the most SQS accepts, so %s can't be added", aws.ToString(origin.MessageId), maxMessageAttributes, expiryAttribute)
+	}
+
+	sent := sentTimestamp(origin)
+	if sent.IsZero() {
+		sent = time.Now()
+	}
+
+	if entry.MessageAttributes == nil {
+		entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+	}
+
+	entry.MessageAttributes[expiryAttribute] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(sent.Add(expiryLifetime).UTC().Format(time.RFC3339)),
+	}
+
+	return nil
+}
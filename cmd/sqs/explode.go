@@ -0,0 +1,41 @@
+package main
+
+// explodePath is set by --explode-jsonpath.
+var explodePath jsonPath
+
+// explodeBody splits a JSON body into one body per value matched by the
+// --explode-jsonpath expression, for example every element of `$.records[*]`.
+// Bodies the path doesn't match are returned unchanged. With a payload codec
+// the elements are sent as JSON, since they are no longer of the source type.
+func explodeBody(body string) []string {
+	if explodePath == nil {
+		return []string{body}
+	}
+
+	doc, ok := decodeJSON(decodeBody(body))
+	if !ok {
+		return []string{body}
+	}
+
+	values := explodePath.get(doc)
+	if len(values) == 0 {
+		return []string{body}
+	}
+
+	bodies := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			bodies = append(bodies, s)
+			continue
+		}
+
+		encoded, err := encodeJSON(value)
+		if err != nil {
+			return []string{body}
+		}
+
+		bodies = append(bodies, encoded)
+	}
+
+	return bodies
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fifoSettings describes how entries are prepared for FIFO queues.
+type fifoSettings struct {
+	source       bool
+	destination  bool
+	contentDedup bool
+	groupID      string
+
+	// requeue gives every entry a deduplication ID of its own when a FIFO
+	// queue is moved into itself, since SQS would otherwise take an entry
+	// for the message it came from and drop it before the original is
+	// deleted.
+	requeue bool
+
+	// groupPath reads the group ID from the body when the group is given
+	// as jsonpath:EXPR.
+	groupPath jsonPath
+}
+
+var activeFifo fifoSettings
+
+func isFifoQueue(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// setupFifo detects FIFO queues on either side and checks that every
+// destination message will get a group ID. groupID is either a constant or
+// `jsonpath:<expr>`, which reads the group from each body.
+func setupFifo(svc *sqs.Client, sourceQueueURL string, destinationQueueURL string, groupID string) (fifoSettings, error) {
+	return setupFifoDestination(svc, isFifoQueue(sourceQueueURL), destinationQueueURL, groupID)
+}
+
+// setupFifoDestination is setupFifo for messages that don't come from a
+// queue. sourceFifo says whether they carry their own group IDs.
+func setupFifoDestination(svc *sqs.Client, sourceFifo bool, destinationQueueURL string, groupID string) (fifoSettings, error) {
+	settings := fifoSettings{
+		source:      sourceFifo,
+		destination: isFifoQueue(destinationQueueURL),
+		groupID:     groupID,
+	}
+
+	if strings.HasPrefix(groupID, "jsonpath:") {
+		path, err := parseJSONPath(strings.TrimPrefix(groupID, "jsonpath:"))
+		if err != nil {
+			return settings, err
+		}
+		settings.groupPath = path
+	}
+
+	if !settings.destination {
+		return settings, nil
+	}
+
+	if !settings.source && groupID == "" {
+		return settings, fmt.Errorf("moving from a standard queue into a FIFO queue needs --message-group-id")
+	}
+
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(destinationQueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameContentBasedDeduplication},
+	})
+	if err != nil {
+		return settings, err
+	}
+
+	if value, ok := attrs.Attributes[string(types.QueueAttributeNameContentBasedDeduplication)]; ok {
+		settings.contentDedup = value == "true"
+	}
+
+	return settings, nil
+}
+
+// fifoAttributeNames lists the system attributes needed to carry group and
+// deduplication IDs over from a FIFO source.
+func (f fifoSettings) fifoAttributeNames() []string {
+	if !f.source {
+		return nil
+	}
+
+	return []string{string(types.MessageSystemAttributeNameMessageGroupId), string(types.MessageSystemAttributeNameMessageDeduplicationId)}
+}
+
+// apply sets the group and deduplication IDs on an entry bound for a FIFO
+// destination. The original deduplication ID is reused when the entry is the
+// whole source message; otherwise the entry ID, which is stable across
+// retries, is used unless the queue deduplicates on content. Requeued entries
+// always get the entry ID prefixed with the run ID.
+func (f fifoSettings) apply(entry *types.SendMessageBatchRequestEntry, origin *types.Message) {
+	if !f.destination {
+		return
+	}
+
+	switch {
+	case f.groupPath != nil:
+		entry.MessageGroupId = aws.String(f.groupFromBody(entry, origin))
+	case f.groupID == "":
+		if group, ok := origin.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]; ok {
+			entry.MessageGroupId = aws.String(group)
+		}
+	default:
+		entry.MessageGroupId = aws.String(f.groupID)
+	}
+
+	if f.requeue {
+		entry.MessageDeduplicationId = aws.String(runID + "-" + aws.ToString(entry.Id))
+		return
+	}
+
+	if dedup, ok := origin.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)]; ok && aws.ToString(entry.Id) == aws.ToString(origin.MessageId) {
+		entry.MessageDeduplicationId = aws.String(dedup)
+		return
+	}
+
+	if !f.contentDedup {
+		entry.MessageDeduplicationId = entry.Id
+	}
+}
+
+// groupFromBody returns the value groupPath matches in the entry body. Bodies
+// it doesn't match keep the source group, or get a group of their own named
+// after the source message when the source isn't FIFO.
+func (f fifoSettings) groupFromBody(entry *types.SendMessageBatchRequestEntry, origin *types.Message) string {
+	if doc, ok := decodeJSON(decodeBody(aws.ToString(entry.MessageBody))); ok {
+		if values := f.groupPath.get(doc); len(values) == 1 {
+			switch value := values[0].(type) {
+			case string:
+				if value != "" {
+					return value
+				}
+			case nil:
+			default:
+				if encoded, err := encodeJSON(value); err == nil {
+					return encoded
+				}
+			}
+		}
+	}
+
+	if group, ok := origin.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]; ok {
+		return group
+	}
+
+	return aws.ToString(origin.MessageId)
+}
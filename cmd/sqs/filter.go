@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// filterVisibilityTimeout keeps skipped messages hidden long enough that a
+// pass isn't handed the same messages over and over.
+const filterVisibilityTimeout = 30
+
+// windowLayouts are the forms of the times --older-than and --newer-than
+// take besides ages, read in UTC unless they carry an offset.
+var windowLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// systemAttributePrefix marks a filter attribute as a system attribute set by
+// SQS, such as system:SenderId, rather than a message attribute.
+const systemAttributePrefix = "system:"
+
+// messageFilter selects the messages a move takes from the source. A message
+// has to match the body pattern, every attribute and the window it was sent
+// in. Messages it rejects are left alone and reappear in the source once
+// their visibility timeout expires.
+type messageFilter struct {
+	body       *regexp.Regexp
+	attributes map[string]string
+	system     map[string]string
+
+	// sentBefore and sentAfter bound the SentTimestamp of the messages
+	// moved, when they aren't zero.
+	sentBefore time.Time
+	sentAfter  time.Time
+
+	// sample is the share of the messages --sample and --sample-count
+	// take, when it isn't zero.
+	sample float64
+}
+
+var activeFilter *messageFilter
+
+// parseFilter builds the filter for --filter-body, --filter-attribute,
+// --older-than and --newer-than, returning nil when none was given. Ages
+// are counted back from now.
+func parseFilter(bodyPattern string, attributes []string, olderThan string, newerThan string) (*messageFilter, error) {
+	if bodyPattern == "" && len(attributes) == 0 && olderThan == "" && newerThan == "" {
+		return nil, nil
+	}
+
+	f := &messageFilter{attributes: map[string]string{}, system: map[string]string{}}
+
+	if bodyPattern != "" {
+		re, err := regexp.Compile(bodyPattern)
+		if err != nil {
+			return nil, fmt.Errorf("--filter-body: %s", err)
+		}
+		f.body = re
+	}
+
+	for _, attribute := range attributes {
+		i := strings.Index(attribute, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("--filter-attribute %q is not of the form key=value", attribute)
+		}
+
+		name, value := attribute[:i], attribute[i+1:]
+		if strings.HasPrefix(name, systemAttributePrefix) {
+			f.system[strings.TrimPrefix(name, systemAttributePrefix)] = value
+		} else {
+			f.attributes[name] = value
+		}
+	}
+
+	now := time.Now()
+
+	if olderThan != "" {
+		before, err := parseWindowBound(olderThan, now)
+		if err != nil {
+			return nil, fmt.Errorf("--older-than: %s", err)
+		}
+		f.sentBefore = before
+	}
+
+	if newerThan != "" {
+		after, err := parseWindowBound(newerThan, now)
+		if err != nil {
+			return nil, fmt.Errorf("--newer-than: %s", err)
+		}
+		f.sentAfter = after
+	}
+
+	if !f.sentBefore.IsZero() && !f.sentAfter.IsZero() && !f.sentAfter.Before(f.sentBefore) {
+		return nil, fmt.Errorf("--newer-than %s is not before --older-than %s, so no message would be moved", f.sentAfter.UTC().Format(time.RFC3339), f.sentBefore.UTC().Format(time.RFC3339))
+	}
+
+	return f, nil
+}
+
+// parseWindowBound reads an age such as 36h, as that long before now, or a
+// time such as 2024-01-01T00:00.
+func parseWindowBound(value string, now time.Time) (time.Time, error) {
+	for _, layout := range windowLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an age such as 7d, 36h or 90m nor a time such as 2024-01-01T00:00", value)
+	}
+
+	return now.Add(-age), nil
+}
+
+func (f *messageFilter) matches(message *types.Message) bool {
+	if f.body != nil && !f.body.MatchString(decodeBody(aws.ToString(message.Body))) {
+		return false
+	}
+
+	for name, want := range f.attributes {
+		value, ok := message.MessageAttributes[name]
+		if !ok || aws.ToString(value.StringValue) != want {
+			return false
+		}
+	}
+
+	for name, want := range f.system {
+		value, ok := message.Attributes[name]
+		if !ok || value != want {
+			return false
+		}
+	}
+
+	if !f.sentBefore.IsZero() || !f.sentAfter.IsZero() {
+		sent := sentTimestamp(message)
+		if sent.IsZero() || (!f.sentBefore.IsZero() && !sent.Before(f.sentBefore)) || (!f.sentAfter.IsZero() && !sent.After(f.sentAfter)) {
+			return false
+		}
+	}
+
+	if f.sample > 0 && !f.sampled(message) {
+		return false
+	}
+
+	return true
+}
+
+// partition separates the messages the filter rejects. A nil filter matches
+// everything.
+func (f *messageFilter) partition(messages []*types.Message) ([]*types.Message, []*types.Message) {
+	if f == nil {
+		return messages, nil
+	}
+
+	var matched, skipped []*types.Message
+
+	for _, message := range messages {
+		if f.matches(message) {
+			matched = append(matched, message)
+		} else {
+			skipped = append(skipped, message)
+		}
+	}
+
+	return matched, skipped
+}
+
+// attributeNames lists the message attributes the filter looks at.
+func (f *messageFilter) attributeNames() []string {
+	if f == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(f.attributes))
+	for name := range f.attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// systemAttributeNames lists the system attributes the filter looks at.
+func (f *messageFilter) systemAttributeNames() []string {
+	if f == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(f.system)+1)
+	for name := range f.system {
+		names = append(names, name)
+	}
+	if !f.sentBefore.IsZero() || !f.sentAfter.IsZero() {
+		names = append(names, string(types.MessageSystemAttributeNameSentTimestamp))
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+)
+
+// fingerprint hashes the body hashes of the side with their counts in a
+// fixed order, so it doesn't depend on the order the messages were read in.
+// Two sides have the same fingerprint when they hold the same bodies as often.
+func (d *diffSide) fingerprint() string {
+	hashes := make([]string, 0, len(d.counts))
+	for hash := range d.counts {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	sum := sha256.New()
+	for _, hash := range hashes {
+		fmt.Fprintf(sum, "%s %d\n", hash, d.counts[hash])
+	}
+
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// runFingerprint prints the fingerprint and message count of a queue, or of a
+// dump file when the reference starts with file:. It returns the exit code.
+func runFingerprint(svc *sqs.Client, reference string, limit int) int {
+	side, err := readDiffSide(svc, reference, limit)
+	if err != nil {
+		logAwsError("Failed to read "+reference, err)
+		if strings.HasPrefix(reference, diffFilePrefix) {
+			return exitFailed
+		}
+		return failureCode(err, exitQueue)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Read %d messages from %s", side.total, side.name))
+
+	fmt.Printf("%s  %d\n", side.fingerprint(), side.total)
+
+	return 0
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultGuardrailsPath is where platform teams install organisation-wide
+// guardrails alongside the binary. SQSMOVER_GUARDRAILS can point at another
+// file; both are enforced when present.
+const defaultGuardrailsPath = "/etc/sqsmover/guardrails.yaml"
+
+type guardrails struct {
+	DenySourceAccount       stringList `yaml:"deny-source-account"`
+	DenyDestinationAccount  stringList `yaml:"deny-destination-account"`
+	AllowDestinationAccount stringList `yaml:"allow-destination-account"`
+	RequireSameRegion       bool       `yaml:"require-same-region"`
+	RequireSameAccount      bool       `yaml:"require-same-account"`
+
+	path string
+}
+
+// stringList accepts either a single YAML scalar or a sequence of them.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*l = list
+	return nil
+}
+
+func (l stringList) contains(value string) bool {
+	for _, item := range l {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func loadGuardrails() ([]guardrails, error) {
+	files, err := readAdminFiles(defaultGuardrailsPath, "SQSMOVER_GUARDRAILS")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]guardrails, 0, len(files))
+
+	for _, file := range files {
+		g := guardrails{path: file.path}
+		if err := yaml.UnmarshalStrict(file.data, &g); err != nil {
+			return nil, fmt.Errorf("parsing guardrails %s: %s", file.path, err)
+		}
+
+		result = append(result, g)
+	}
+
+	return result, nil
+}
+
+type adminFile struct {
+	path string
+	data []byte
+}
+
+// readAdminFiles reads the administrator-installed file at defaultPath and
+// the one named by envVar. A missing file is skipped; an unreadable one is an
+// error so that a broken install never silently disables enforcement.
+func readAdminFiles(defaultPath string, envVar string) ([]adminFile, error) {
+	paths := []string{defaultPath}
+	if path := os.Getenv(envVar); path != "" {
+		paths = append(paths, path)
+	}
+
+	var files []adminFile
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %s", path, err)
+		}
+
+		files = append(files, adminFile{path: path, data: data})
+	}
+
+	return files, nil
+}
+
+// check returns an error describing the first guardrail the move violates.
+// The destination may be a sink URL as well as a queue URL. A guardrail that
+// needs the account or region of a side that can't be told, such as an S3
+// sink or an emulator queue, fails closed.
+func (g guardrails) check(sourceQueueURL string, destinationQueueURL string) error {
+	sourceAccount, sourceRegion := resourceLocation(sourceQueueURL)
+	destinationAccount, destinationRegion := resourceLocation(destinationQueueURL)
+
+	switch {
+	case sourceAccount == "" && (len(g.DenySourceAccount) > 0 || g.RequireSameAccount):
+		return fmt.Errorf("the account of %s can't be told, which %s needs to allow the move", sourceQueueURL, g.path)
+	case destinationAccount == "" && (len(g.DenyDestinationAccount) > 0 || len(g.AllowDestinationAccount) > 0 || g.RequireSameAccount):
+		return fmt.Errorf("the account of %s can't be told, which %s needs to allow the move", destinationQueueURL, g.path)
+	case g.RequireSameRegion && (sourceRegion == "" || destinationRegion == ""):
+		return fmt.Errorf("%s requires source and destination in the same region, and the region of one can't be told", g.path)
+	case g.DenySourceAccount.contains(sourceAccount):
+		return fmt.Errorf("moving messages out of account %s is denied by %s", sourceAccount, g.path)
+	case g.DenyDestinationAccount.contains(destinationAccount):
+		return fmt.Errorf("moving messages into account %s is denied by %s", destinationAccount, g.path)
+	case len(g.AllowDestinationAccount) > 0 && !g.AllowDestinationAccount.contains(destinationAccount):
+		return fmt.Errorf("account %s is not an allowed destination in %s", destinationAccount, g.path)
+	case g.RequireSameAccount && sourceAccount != destinationAccount:
+		return fmt.Errorf("%s requires source and destination queues in the same account", g.path)
+	case g.RequireSameRegion && sourceRegion != destinationRegion:
+		return fmt.Errorf("%s requires source and destination queues in the same region", g.path)
+	}
+
+	return nil
+}
+
+// resourceLocation returns the account and region of a queue URL, an ARN or
+// an SNS sink URL, sns:///TOPIC-ARN. Either is empty when it can't be told.
+func resourceLocation(resource string) (string, string) {
+	resource = strings.TrimPrefix(resource, mover.SNSSinkURL(""))
+
+	if arn.IsARN(resource) {
+		parsed, err := arn.Parse(resource)
+		if err != nil {
+			return "", ""
+		}
+		return parsed.AccountID, parsed.Region
+	}
+
+	return queueAccountID(resource), queueRegion(resource)
+}
+
+// queueRegion extracts the region from a queue URL host such as
+// sqs.<region>.amazonaws.com or the legacy <region>.queue.amazonaws.com.
+func queueRegion(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+
+	labels := strings.Split(u.Hostname(), ".")
+	switch {
+	case len(labels) >= 3 && labels[0] == "sqs":
+		return labels[1]
+	case len(labels) >= 3 && labels[1] == "queue":
+		return labels[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	ordersDLQ   = "https://sqs.us-east-1.amazonaws.com/111122223333/orders_dlq"
+	ordersQueue = "https://sqs.us-east-1.amazonaws.com/111122223333/orders"
+	foreignEU   = "https://sqs.eu-west-1.amazonaws.com/444455556666/orders"
+	foreignSNS  = "sns:///arn:aws:sns:us-east-1:444455556666:alerts"
+	localSNS    = "sns:///arn:aws:sns:us-east-1:111122223333:alerts"
+	s3Sink      = "s3://incident-archive/orders-dlq"
+	emulatorDLQ = "http://localhost:9324/queue/orders_dlq"
+)
+
+func TestGuardrailsCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		rails       guardrails
+		source      string
+		destination string
+
+		// wantErr is part of the error, or empty when the move is allowed.
+		wantErr string
+	}{
+		{name: "no rules", source: ordersDLQ, destination: foreignEU},
+		{name: "denied source", rails: guardrails{DenySourceAccount: stringList{"111122223333"}}, source: ordersDLQ, destination: ordersQueue, wantErr: "out of account 111122223333"},
+		{name: "denied destination", rails: guardrails{DenyDestinationAccount: stringList{"444455556666"}}, source: ordersDLQ, destination: foreignEU, wantErr: "into account 444455556666"},
+		{name: "other destination", rails: guardrails{DenyDestinationAccount: stringList{"444455556666"}}, source: ordersDLQ, destination: ordersQueue},
+		{name: "allowed destination", rails: guardrails{AllowDestinationAccount: stringList{"111122223333"}}, source: ordersDLQ, destination: ordersQueue},
+		{name: "not allowed destination", rails: guardrails{AllowDestinationAccount: stringList{"111122223333"}}, source: ordersDLQ, destination: foreignEU, wantErr: "not an allowed destination"},
+		{name: "same account", rails: guardrails{RequireSameAccount: true}, source: ordersDLQ, destination: foreignEU, wantErr: "same account"},
+		{name: "same region", rails: guardrails{RequireSameRegion: true}, source: ordersDLQ, destination: foreignEU, wantErr: "same region"},
+
+		{name: "denied topic", rails: guardrails{DenyDestinationAccount: stringList{"444455556666"}}, source: ordersDLQ, destination: foreignSNS, wantErr: "into account 444455556666"},
+		{name: "allowed topic", rails: guardrails{AllowDestinationAccount: stringList{"111122223333"}, RequireSameRegion: true}, source: ordersDLQ, destination: localSNS},
+		{name: "topic in another account", rails: guardrails{RequireSameAccount: true}, source: ordersDLQ, destination: foreignSNS, wantErr: "same account"},
+
+		{name: "sink without account rules", rails: guardrails{DenySourceAccount: stringList{"444455556666"}}, source: ordersDLQ, destination: s3Sink},
+		{name: "sink with a deny list", rails: guardrails{DenyDestinationAccount: stringList{"444455556666"}}, source: ordersDLQ, destination: s3Sink, wantErr: "can't be told"},
+		{name: "sink with an allow list", rails: guardrails{AllowDestinationAccount: stringList{"111122223333"}}, source: ordersDLQ, destination: s3Sink, wantErr: "can't be told"},
+		{name: "sink in the same region", rails: guardrails{RequireSameRegion: true}, source: ordersDLQ, destination: s3Sink, wantErr: "can't be told"},
+		{name: "emulator source with a deny list", rails: guardrails{DenySourceAccount: stringList{"444455556666"}}, source: emulatorDLQ, destination: ordersQueue, wantErr: "can't be told"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.rails.path = "guardrails.yaml"
+
+			err := test.rails.check(test.source, test.destination)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("check = %v, want the move allowed", err)
+			case test.wantErr != "" && err == nil:
+				t.Errorf("check allowed the move, want an error about %q", test.wantErr)
+			case test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr):
+				t.Errorf("check = %v, want an error about %q", err, test.wantErr)
+			}
+		})
+	}
+}
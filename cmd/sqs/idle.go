@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// errIdle ends a --follow once --idle-exit passed without new messages.
+var errIdle = errors.New("no new messages arrived for --idle-exit")
+
+// idleExit ends a follow that saw no new messages for a while, so it can run
+// as a task that ends on its own, such as a Kubernetes Job. A message is new
+// when it was moved, dropped or skipped for the first time; a skipped one
+// that keeps coming back doesn't keep the follow going.
+type idleExit struct {
+	after time.Duration
+
+	mu    sync.Mutex
+	done  int
+	timer *time.Timer
+}
+
+var activeIdleExit *idleExit
+
+// start cancels ctx with errIdle once after passed without new messages,
+// counting from now. stop ends the watch.
+func (i *idleExit) start(stop context.CancelCauseFunc) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.done = 0
+	i.timer = time.AfterFunc(i.after, func() { stop(errIdle) })
+}
+
+// progress starts the wait over when the move got further, as
+// mover.Options.Progress.
+func (i *idleExit) progress(total mover.Result) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if done := total.Moved + total.Dropped + total.Skipped + total.Failed; done > i.done && i.timer != nil {
+		i.done = done
+		i.timer.Reset(i.after)
+	}
+}
+
+// stop ends the watch once the move ended.
+func (i *idleExit) stop() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// inventoryQueue describes one queue found by the inventory command.
+type inventoryQueue struct {
+	Account          string `json:"account"`
+	Region           string `json:"region"`
+	Name             string `json:"name"`
+	URL              string `json:"url"`
+	Fifo             bool   `json:"fifo"`
+	Messages         int    `json:"messages"`
+	MessagesInFlight int    `json:"messages_in_flight"`
+	MessagesDelayed  int    `json:"messages_delayed"`
+	DeadLetterQueue  string `json:"dead_letter_queue,omitempty"`
+	IsDeadLetter     bool   `json:"is_dead_letter_queue"`
+}
+
+type inventoryTarget struct {
+	account string
+	region  string
+	cfg     aws.Config
+}
+
+// regionConfig returns a copy of cfg that calls region.
+func regionConfig(cfg aws.Config, region string) aws.Config {
+	cfg = cfg.Copy()
+	cfg.Region = region
+	return cfg
+}
+
+// runInventory lists every queue in each account and region and writes the
+// result as JSON or CSV.
+func runInventory(base aws.Config, accountsPath string, regions []string, format string, output string) {
+	var targets []inventoryTarget
+
+	if accountsPath == "" {
+		for _, r := range regions {
+			targets = append(targets, inventoryTarget{region: r, cfg: regionConfig(base, r)})
+		}
+	} else {
+		accounts, err := loadSweepAccounts(accountsPath)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to read accounts: %s", err))
+			return
+		}
+
+		for _, account := range accounts {
+			accountConfig := configForAccount(base, account)
+			accountRegions := regions
+			if account.Region != "" {
+				accountRegions = []string{account.Region}
+			}
+
+			for _, r := range accountRegions {
+				targets = append(targets, inventoryTarget{account: account.ID, region: r, cfg: regionConfig(accountConfig, r)})
+			}
+		}
+	}
+
+	var queues []inventoryQueue
+
+	for _, target := range targets {
+		found, err := inventoryRegion(sqs.NewFromConfig(target.cfg), target.account, target.region)
+		if err != nil {
+			logAwsError(fmt.Sprintf("Failed to list queues in %s %s", target.account, target.region), err)
+			continue
+		}
+
+		log.Info(color.New(color.FgCyan).Sprintf("Found %d queues in %s %s", len(found), target.account, target.region))
+		queues = append(queues, found...)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create %s: %s", output, err))
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	if format == "csv" {
+		err = writeInventoryCSV(w, queues)
+	} else {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(queues)
+	}
+
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to write inventory: %s", err))
+	}
+}
+
+func inventoryRegion(svc *sqs.Client, account string, region string) ([]inventoryQueue, error) {
+	resp, err := svc.ListQueues(runCtx, &sqs.ListQueuesInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]inventoryQueue, 0, len(resp.QueueUrls))
+	deadLetterTargets := map[string]bool{}
+	arns := map[string]int{}
+
+	for _, queueURL := range resp.QueueUrls {
+		attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+		})
+		if err != nil {
+			logAwsError(fmt.Sprintf("Failed to get attributes of %s", queueURL), err)
+			continue
+		}
+
+		q := inventoryQueue{
+			Account:          account,
+			Region:           region,
+			Name:             queueNameFromURL(queueURL),
+			URL:              queueURL,
+			Messages:         intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessages),
+			MessagesInFlight: intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+			MessagesDelayed:  intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+		}
+
+		if q.Account == "" {
+			q.Account = queueAccountID(queueURL)
+		}
+
+		if fifo, ok := attrs.Attributes[string(types.QueueAttributeNameFifoQueue)]; ok {
+			q.Fifo = fifo == "true"
+		}
+
+		if policy, ok := attrs.Attributes[string(types.QueueAttributeNameRedrivePolicy)]; ok {
+			if target := deadLetterTargetArn(policy); target != "" {
+				q.DeadLetterQueue = target[strings.LastIndex(target, ":")+1:]
+				deadLetterTargets[target] = true
+			}
+		}
+
+		if arn, ok := attrs.Attributes[string(types.QueueAttributeNameQueueArn)]; ok {
+			arns[arn] = len(queues)
+		}
+
+		queues = append(queues, q)
+	}
+
+	for arn, i := range arns {
+		queues[i].IsDeadLetter = deadLetterTargets[arn]
+	}
+
+	return queues, nil
+}
+
+// deadLetterTargetArn extracts the DLQ ARN from a RedrivePolicy document.
+func deadLetterTargetArn(redrivePolicy string) string {
+	var policy struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}
+
+	if err := json.Unmarshal([]byte(redrivePolicy), &policy); err != nil {
+		return ""
+	}
+
+	return policy.DeadLetterTargetArn
+}
+
+func intAttribute(attributes map[string]string, name types.QueueAttributeName) int {
+	n, _ := strconv.Atoi(attributes[string(name)])
+	return n
+}
+
+func writeInventoryCSV(w io.Writer, queues []inventoryQueue) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"account", "region", "name", "url", "fifo", "messages", "messages_in_flight", "messages_delayed", "dead_letter_queue", "is_dead_letter_queue"})
+
+	for _, q := range queues {
+		out.Write([]string{
+			q.Account,
+			q.Region,
+			q.Name,
+			q.URL,
+			strconv.FormatBool(q.Fifo),
+			strconv.Itoa(q.Messages),
+			strconv.Itoa(q.MessagesInFlight),
+			strconv.Itoa(q.MessagesDelayed),
+			q.DeadLetterQueue,
+			strconv.FormatBool(q.IsDeadLetter),
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed subset of JSONPath: a root `$` followed by dotted
+// member names, bracketed names or indexes, and `*` wildcards, for example
+// `$.card.number`, `$.items[0].sku` or `$.records[*]`.
+type jsonPath []pathStep
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseJSONPath(expr string) (jsonPath, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", expr)
+	}
+
+	var path jsonPath
+	rest := expr[1:]
+
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath %q has an empty member name", expr)
+			}
+
+			if name == "*" {
+				path = append(path, pathStep{wildcard: true})
+			} else {
+				path = append(path, pathStep{key: name})
+			}
+
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("jsonpath %q has an unterminated [", expr)
+			}
+
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				path = append(path, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				path = append(path, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("jsonpath %q has an invalid index [%s]", expr, inner)
+				}
+
+				path = append(path, pathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath %q has an unexpected %q", expr, rest[0])
+		}
+	}
+
+	return path, nil
+}
+
+// get returns every value in doc matched by the path.
+func (p jsonPath) get(doc interface{}) []interface{} {
+	if len(p) == 0 {
+		return []interface{}{doc}
+	}
+
+	var result []interface{}
+	for _, child := range p[0].children(doc) {
+		result = append(result, p[1:].get(child)...)
+	}
+
+	return result
+}
+
+// replace calls fn for every value matched by the path and stores its result
+// in place. It returns the updated document and whether anything matched.
+func (p jsonPath) replace(doc interface{}, fn func(interface{}) interface{}) (interface{}, bool) {
+	if len(p) == 0 {
+		return fn(doc), true
+	}
+
+	step, matched := p[0], false
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if step.wildcard || (!step.isIndex && key == step.key) {
+				if updated, ok := p[1:].replace(value, fn); ok {
+					node[key] = updated
+					matched = true
+				}
+			}
+		}
+	case []interface{}:
+		for i, value := range node {
+			if step.wildcard || (step.isIndex && i == step.index) {
+				if updated, ok := p[1:].replace(value, fn); ok {
+					node[i] = updated
+					matched = true
+				}
+			}
+		}
+	}
+
+	return doc, matched
+}
+
+func (s pathStep) children(doc interface{}) []interface{} {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			result := make([]interface{}, 0, len(node))
+			for _, value := range node {
+				result = append(result, value)
+			}
+			return result
+		}
+
+		if value, ok := node[s.key]; ok && !s.isIndex {
+			return []interface{}{value}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return node
+		}
+
+		if s.isIndex && s.index < len(node) {
+			return []interface{}{node[s.index]}
+		}
+	}
+
+	return nil
+}
+
+// encodeJSON renders doc compactly without escaping HTML characters, so
+// rewritten bodies stay as close to the original text as possible.
+func encodeJSON(doc interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// payloadPointer is the S3 location the SQS Extended Client stores a large
+// body at. The message itself carries a JSON array of the pointer class and
+// this object, such as
+// ["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"b","s3Key":"k"}].
+type payloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// parsePayloadPointer returns the pointer class and location of an extended
+// client body, and whether the body is one. Both the current class and the
+// one of older Java clients are recognised.
+func parsePayloadPointer(body string) (string, payloadPointer, bool) {
+	var pointer payloadPointer
+
+	if !strings.HasPrefix(strings.TrimSpace(body), "[") {
+		return "", pointer, false
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &parts); err != nil || len(parts) != 2 {
+		return "", pointer, false
+	}
+
+	var class string
+	if err := json.Unmarshal(parts[0], &class); err != nil {
+		return "", pointer, false
+	}
+
+	if !strings.HasSuffix(class, ".PayloadS3Pointer") && !strings.HasSuffix(class, ".MessageS3Pointer") {
+		return "", pointer, false
+	}
+
+	if err := json.Unmarshal(parts[1], &pointer); err != nil || pointer.Bucket == "" || pointer.Key == "" {
+		return "", pointer, false
+	}
+
+	return class, pointer, true
+}
+
+// largePayloads re-points extended client bodies at the bucket given with
+// --large-payload-bucket, so the receiving account reads the payloads from
+// there. With --large-payload-copy the objects are copied over first; without
+// it they are expected to be there already, for example by replication.
+// Other bodies are moved unchanged.
+type largePayloads struct {
+	s3     *s3.Client
+	bucket string
+	copy   bool
+
+	// copied remembers the objects already copied, so a message moved twice
+	// or exploded into several entries is copied once. Workers share it.
+	mu     sync.Mutex
+	copied map[payloadPointer]bool
+}
+
+// activeLargePayloads is set up by --large-payload-bucket.
+var activeLargePayloads *largePayloads
+
+func newLargePayloads(cfg aws.Config, bucket string, copy bool) *largePayloads {
+	return &largePayloads{s3: s3.NewFromConfig(cfg), bucket: bucket, copy: copy, copied: map[payloadPointer]bool{}}
+}
+
+// repoint rewrites the pointers of entries to the destination bucket, copying
+// the objects first when asked to. A failed copy stops the batch, so its
+// messages stay in the source.
+func (p *largePayloads) repoint(entries []*types.SendMessageBatchRequestEntry) error {
+	for _, entry := range entries {
+		class, pointer, ok := parsePayloadPointer(aws.ToString(entry.MessageBody))
+		if !ok {
+			continue
+		}
+
+		if pointer.Bucket == p.bucket {
+			continue
+		}
+
+		if p.copy && !p.isCopied(pointer) {
+			_, err := p.s3.CopyObject(runCtx, &s3.CopyObjectInput{
+				Bucket:     aws.String(p.bucket),
+				Key:        aws.String(pointer.Key),
+				CopySource: aws.String(url.PathEscape(pointer.Bucket + "/" + pointer.Key)),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to copy the payload of message %s from s3://%s/%s: %s", aws.ToString(entry.Id), pointer.Bucket, pointer.Key, err)
+			}
+
+			p.mu.Lock()
+			p.copied[pointer] = true
+			p.mu.Unlock()
+		}
+
+		body, err := json.Marshal([]interface{}{class, payloadPointer{Bucket: p.bucket, Key: pointer.Key}})
+		if err != nil {
+			return err
+		}
+
+		entry.MessageBody = aws.String(string(body))
+	}
+
+	return nil
+}
+
+func (p *largePayloads) isCopied(pointer payloadPointer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.copied[pointer]
+}
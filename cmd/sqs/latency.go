@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets, in
+// seconds, from a call within a region to a receive waiting out its long
+// poll.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25}
+
+// latencySteps are the steps of a batch whose latencies are measured: the
+// SQS calls, and the building of the destination entries, where transforms,
+// enrichment and the other hooks run.
+var latencySteps = []string{mover.OpReceive, mover.OpEntries, mover.OpSend, mover.OpDelete}
+
+// latencyHistogram counts the latencies of one step in latencyBuckets, with
+// a last bucket for those above them.
+type latencyHistogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// latencies measures the steps of the batches of a run. Workers add to it
+// concurrently.
+type latencies struct {
+	mu    sync.Mutex
+	steps map[string]*latencyHistogram
+}
+
+// latencyReport sums up the latencies of a step in the run summary.
+type latencyReport struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// stepLatencies are the latencyReport of every step measured.
+type stepLatencies map[string]latencyReport
+
+// activeLatencies is started afresh by every move.
+var activeLatencies = newLatencies()
+
+func newLatencies() *latencies {
+	return &latencies{steps: map[string]*latencyHistogram{}}
+}
+
+// observe counts a step that took d.
+func (l *latencies) observe(step string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h := l.steps[step]
+	if h == nil {
+		h = &latencyHistogram{counts: make([]int64, len(latencyBuckets)+1)}
+		l.steps[step] = h
+	}
+
+	h.counts[sort.SearchFloat64s(latencyBuckets, d.Seconds())]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// since counts a step that started at start, as in
+// defer activeLatencies.since(step, time.Now()).
+func (l *latencies) since(step string, start time.Time) {
+	l.observe(step, time.Since(start))
+}
+
+// merge adds the latencies of other, for metrics that span several moves.
+func (l *latencies) merge(other *latencies) {
+	if other == nil || other == l {
+		return
+	}
+
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for step, o := range other.steps {
+		h := l.steps[step]
+		if h == nil {
+			h = &latencyHistogram{counts: make([]int64, len(latencyBuckets)+1)}
+			l.steps[step] = h
+		}
+
+		for i, count := range o.counts {
+			h.counts[i] += count
+		}
+		h.count += o.count
+		h.sum += o.sum
+		h.max = max(h.max, o.max)
+	}
+}
+
+// quantile estimates the latency q of the observations fall under, in
+// seconds, assuming they spread evenly within their bucket.
+func (h *latencyHistogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+	lower, seen := 0.0, int64(0)
+
+	for i, count := range h.counts {
+		upper := h.max.Seconds()
+		if i < len(latencyBuckets) {
+			upper = min(latencyBuckets[i], upper)
+		}
+
+		if count > 0 && float64(seen+count) >= rank {
+			return lower + (upper-lower)*(rank-float64(seen))/float64(count)
+		}
+
+		seen += count
+		if i < len(latencyBuckets) {
+			lower = latencyBuckets[i]
+		}
+	}
+
+	return h.max.Seconds()
+}
+
+// report returns the percentiles of every step measured, for the summary.
+func (l *latencies) report() stepLatencies {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.steps) == 0 {
+		return nil
+	}
+
+	report := make(stepLatencies, len(l.steps))
+	for step, h := range l.steps {
+		report[step] = latencyReport{
+			Count: h.count,
+			P50:   milliseconds(h.quantile(0.5)),
+			P95:   milliseconds(h.quantile(0.95)),
+			P99:   milliseconds(h.quantile(0.99)),
+			Max:   milliseconds(h.max.Seconds()),
+		}
+	}
+
+	return report
+}
+
+// log lists the percentiles of every step measured, in the order of a batch.
+func (l *latencies) log() {
+	report := l.report()
+	if len(report) == 0 {
+		return
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Latencies by step:"))
+	for _, step := range latencySteps {
+		if r, ok := report[step]; ok {
+			log.Info(color.New(color.FgCyan).Sprintf("  %-8s p50 %.0fms  p95 %.0fms  p99 %.0fms  max %.0fms  (%d measured)", step, r.P50, r.P95, r.P99, r.Max, r.Count))
+		}
+	}
+}
+
+// writeMetrics writes the latencies as Prometheus histograms, with the
+// labels of the other metrics and the step.
+func (l *latencies) writeMetrics(b *strings.Builder, labels string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	const name = "sqsmover_step_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Latency of the receive, send and delete calls and of building the destination entries.\n# TYPE %s histogram\n", name, name)
+
+	for _, step := range latencySteps {
+		h, ok := l.steps[step]
+		if !ok {
+			continue
+		}
+
+		stepLabels := fmt.Sprintf("%s,step=%q", labels, step)
+
+		cumulative := int64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%g\"} %d\n", name, stepLabels, bound, cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, stepLabels, h.count)
+		fmt.Fprintf(b, "%s_sum{%s} %g\n", name, stepLabels, h.sum.Seconds())
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, stepLabels, h.count)
+	}
+}
+
+func milliseconds(seconds float64) float64 {
+	return float64(time.Duration(seconds*float64(time.Second)).Round(time.Millisecond)) / float64(time.Millisecond)
+}
+
+// timedClient measures the receives, sends and deletes of a move in
+// activeLatencies, retries by the SDK included.
+type timedClient struct {
+	mover.SQSAPI
+}
+
+func (c timedClient) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	defer activeLatencies.since(mover.OpReceive, time.Now())
+	return c.SQSAPI.ReceiveMessage(ctx, input, opts...)
+}
+
+func (c timedClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	defer activeLatencies.since(mover.OpSend, time.Now())
+	return c.SQSAPI.SendMessageBatch(ctx, input, opts...)
+}
+
+func (c timedClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	defer activeLatencies.since(mover.OpSend, time.Now())
+	return c.SQSAPI.SendMessage(ctx, input, opts...)
+}
+
+func (c timedClient) DeleteMessageBatch(ctx context.Context, input *sqs.DeleteMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	defer activeLatencies.since(mover.OpDelete, time.Now())
+	return c.SQSAPI.DeleteMessageBatch(ctx, input, opts...)
+}
+
+// timeEntries measures build in activeLatencies.
+func timeEntries(build func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error)) func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	return func(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+		defer activeLatencies.since(mover.OpEntries, time.Now())
+		return build(messages)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// maxLoadLine is the longest line a load file may have: a 1 MiB message
+// with room for JSON escaping and attributes.
+const maxLoadLine = 4 << 20
+
+// message turns a dump record back into the message it was read from.
+func (r dumpRecord) message() *types.Message {
+	message := &types.Message{
+		MessageId:  aws.String(r.MessageID),
+		Body:       aws.String(r.Body),
+		Attributes: make(map[string]string, len(r.Attributes)),
+	}
+	maps.Copy(message.Attributes, r.Attributes)
+
+	// Records written by hand may only have the typed fields.
+	for field, name := range r.systemFields() {
+		if *field != "" && message.Attributes[name] == "" {
+			message.Attributes[name] = *field
+		}
+	}
+
+	if r.SentTimestamp != nil && message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)] == "" {
+		message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)] = strconv.FormatInt(r.SentTimestamp.UnixMilli(), 10)
+	}
+
+	if len(r.MessageAttributes) > 0 {
+		message.MessageAttributes = make(map[string]types.MessageAttributeValue, len(r.MessageAttributes))
+		for name, value := range r.MessageAttributes {
+			attribute := types.MessageAttributeValue{DataType: aws.String(value.DataType)}
+			if value.BinaryValue != nil {
+				attribute.BinaryValue = value.BinaryValue
+			} else {
+				attribute.StringValue = aws.String(value.StringValue)
+			}
+			message.MessageAttributes[name] = attribute
+		}
+	}
+
+	return message
+}
+
+// messages returns the messages the record stands for: the one it was read
+// from, and a copy for every other message dump --dedupe counted with its
+// body. Copies are named after the message with -2, -3 and so on, and leave
+// its deduplication ID behind, so a FIFO queue doesn't drop them.
+func (r dumpRecord) messages() []*types.Message {
+	messages := []*types.Message{r.message()}
+
+	for i := 2; i <= r.Count; i++ {
+		copied := r.message()
+		copied.MessageId = aws.String(fmt.Sprintf("%s-%d", r.MessageID, i))
+		delete(copied.Attributes, string(types.MessageSystemAttributeNameMessageDeduplicationId))
+		messages = append(messages, copied)
+	}
+
+	return messages
+}
+
+// parseLoadLine reads one line of a load file: a dump record in the jsonl
+// format, or a bare body in the lines format, and returns the messages it
+// stands for. Lines without a message ID are named after the run and line
+// number.
+func parseLoadLine(format string, text string, line int) ([]*types.Message, error) {
+	var record dumpRecord
+
+	if format == "jsonl" {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+
+		if record.Count < 0 {
+			return nil, fmt.Errorf("count can't be negative")
+		}
+	} else {
+		record.Body = text
+	}
+
+	if record.MessageID == "" {
+		record.MessageID = fmt.Sprintf("%s-%d", runID, line)
+	}
+
+	return record.messages(), nil
+}
+
+// countMessages returns the number of messages in a file, for the progress
+// bar: one for every non-empty line, or as many as a record counts.
+func countMessages(path string, format string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner, err := newDumpScanner(f)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		// Lines that aren't records are reported when they are loaded.
+		var record struct {
+			Count int `json:"count"`
+		}
+		if format == "jsonl" && json.Unmarshal([]byte(scanner.Text()), &record) == nil && record.Count > 1 {
+			n += record.Count
+		} else {
+			n++
+		}
+	}
+
+	return n, scanner.Err()
+}
+
+// runLoad sends every line of a file to a queue in batches of ten. Dump
+// records get their message attributes and trace header back, and their
+// group and deduplication IDs when the queue is FIFO. Batches are paced by
+// rate, ramped up over rampUp, and only sent within hours when it is set. It
+// reports whether every line was sent.
+func runLoad(svc *sqs.Client, path string, queue string, format string, groupID string, rate float64, rampUp time.Duration, hours *activeHours) bool {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		logAwsError("Failed to resolve queue", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Queue URL: %s", queueURL))
+
+	resolved := invocation{command: activeCommand, destination: queueNameFromURL(queueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			logAwsError("Load blocked by policy", err)
+			return false
+		}
+	}
+
+	if err := checkDestinationExists(svc, queueURL); err != nil {
+		logAwsError("Queue is unavailable", err)
+		return false
+	}
+
+	fifo, err := setupFifoDestination(svc, format == "jsonl", queueURL, groupID)
+	if err != nil {
+		logAwsError("Unable to load into the FIFO queue", err)
+		return false
+	}
+	activeFifo = fifo
+
+	total, err := countMessages(path, format)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+		return false
+	}
+	defer f.Close()
+
+	scanner, err := newDumpScanner(f)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+		return false
+	}
+
+	m := mover.New(nil, svc)
+	opts := mover.Options{DestinationQueueURL: queueURL, MaxRetries: defaultMaxRetries, Rate: rate, RampUp: rampUp}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Starting to load %d messages from %s...", total, path))
+	fmt.Println()
+
+	display := startProgress(total)
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The ramp up starts over whenever the load waited for --active-hours,
+	// since the consumers may have scaled down in the meantime.
+	pacer := mover.NewPacer(opts)
+
+	var batch []*types.Message
+	sent := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		entries, _ := convertToEntries(batch)
+		for _, entry := range entries {
+			if fifo.destination && entry.MessageGroupId == nil {
+				return fmt.Errorf("message %s has no MessageGroupId, pass --message-group-id", aws.ToString(entry.Id))
+			}
+		}
+
+		waited, err := hours.wait(ctx)
+		if err != nil {
+			return err
+		}
+		if waited {
+			pacer = mover.NewPacer(opts)
+		}
+
+		if err := pacer.Wait(ctx, entries); err != nil {
+			return err
+		}
+
+		n, err := m.Send(context.WithoutCancel(ctx), opts, entries)
+		sent += n
+		display.update(sent)
+
+		batch = batch[:0]
+
+		return err
+	}
+
+	// fail stops the load, telling where to pick it up again.
+	fail := func(line int, err error) bool {
+		display.stop()
+		if ctx.Err() != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Interrupted at line %d after sending %d messages", line, sent))
+			return false
+		}
+		logAwsError(fmt.Sprintf("Failed to load %s at line %d after sending %d messages", path, line, sent), err)
+		return false
+	}
+
+	line := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			display.stop()
+			log.Warn(color.New(color.FgYellow).Sprintf("Interrupted at line %d after sending %d messages", line, sent))
+			return false
+		}
+
+		line++
+
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		messages, err := parseLoadLine(format, text, line)
+		if err != nil {
+			return fail(line, err)
+		}
+
+		for _, message := range messages {
+			batch = append(batch, message)
+
+			if len(batch) == 10 {
+				if err := flush(); err != nil {
+					return fail(line, err)
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fail(line, err)
+	}
+
+	if err := flush(); err != nil {
+		return fail(line, err)
+	}
+
+	display.stop()
+
+	fmt.Println()
+	log.Info(color.New(color.FgCyan).Sprintf("Done. Loaded %d messages", sent))
+
+	return true
+}
@@ -1,218 +1,1768 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"github.com/fatih/color"
-	"github.com/tj/go-progress"
-	"github.com/tj/go/term"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	sourceQueue      = kingpin.Flag("source", "Source queue to move messages from").Short('s').Required().String()
-	destinationQueue = kingpin.Flag("destination", "Destination queue to move messages to").Short('d').Required().String()
-	profile          = kingpin.Flag("profile", "AWS Profile for source and destination queues").Short('p').Default("default").String()
-	region           = kingpin.Flag("region", "AWS Region for source and destination queues").Short('r').Default("us-east-1").String()
+	profile      = kingpin.Flag("profile", "AWS Profile for source and destination queues").Short('p').Default("default").String()
+	region       = kingpin.Flag("region", "AWS Region for source and destination queues").Short('r').Default("us-east-1").String()
+	roleArn      = kingpin.Flag("role-arn", "IAM role to assume with STS for source and destination queues, on top of --profile").PlaceHolder("ARN").String()
+	externalID   = kingpin.Flag("external-id", "External ID the role of --role-arn requires").PlaceHolder("ID").String()
+	mfaSerial    = kingpin.Flag("mfa-serial", "Serial number or ARN of the MFA device the role of --role-arn requires; the code is read from stdin").PlaceHolder("ARN").String()
+	endpointURL  = kingpin.Flag("endpoint-url", "Endpoint for all AWS calls, e.g. http://localhost:4566 for LocalStack or http://localhost:9324 for ElasticMQ").PlaceHolder("URL").String()
+	accountsFile = kingpin.Flag("accounts", "YAML file of accounts and roles; the command runs in every account in turn").PlaceHolder("accounts.yaml").String()
+	tfDir        = kingpin.Flag("terraform-dir", "Terraform working directory used to resolve tf: queue references").Default(".").String()
+	plain        = kingpin.Flag("plain", "Show progress as text without colours or ANSI escape codes (automatic on old Windows consoles and when output isn't a terminal)").Bool()
+	noProgress   = kingpin.Flag("no-progress", "Print progress as a plain line every few seconds instead of redrawing it, as when output isn't a terminal, for CI logs that keep every character").Bool()
+	runIDFlag    = kingpin.Flag("run-id", "ID added to the logs and notifications of this run, to correlate them; generated when omitted").PlaceHolder("ID").Envar("SQSMOVER_RUN_ID").String()
+	tfState      = kingpin.Flag("terraform-state", "Terraform state file used to resolve tf: queue references instead of running terraform state pull").String()
+	verbose      = kingpin.Flag("verbose", "Log every AWS call with its request ID, latency, batch size and retries").Bool()
+	debug        = kingpin.Flag("debug", "Like --verbose, and also log every failed attempt the SDK retries").Bool()
+	configPath   = kingpin.Flag("config", "Config file defining the named moves of the run command").Default(defaultConfigPath).Envar("SQSMOVER_CONFIG").String()
+	readOnly     = kingpin.Flag("read-only", "Only allow commands that leave queues and messages as they are, and fail any AWS call that would change them").Envar("SQSMOVER_READ_ONLY").Bool()
+
+	moveCommand         = kingpin.Command("move", "Move messages from one queue to another").Default()
+	sourceQueue         = moveCommand.Flag("source", "Source queue to move messages from, or a glob such as orders-*-dlq to move every queue it matches in turn").Short('s').String()
+	destinationQueues   = moveCommand.Flag("destination", destinationHelp()).Short('d').Strings()
+	destinationTopic    = moveCommand.Flag("destination-topic", "SNS topic ARN to republish messages to instead of a queue, so all its subscribers get them again; bodies that are SNS notifications are unwrapped first").PlaceHolder("ARN").String()
+	destinationTemplate = moveCommand.Flag("destination-template", "With a --source glob, Go template naming the destination of each queue from .Source, such as '{{trimSuffix .Source \"-dlq\"}}'").PlaceHolder("TEMPLATE").String()
+	fanout              = moveCommand.Flag("fanout", "Send every message to all the destinations instead of spreading them round-robin").Bool()
+	hashAttribute       = moveCommand.Flag("hash-attribute", "Spread messages over the destinations by a hash of this message attribute, so equal values land in the same queue").PlaceHolder("NAME").String()
+	redrive             = moveCommand.Flag("redrive", "Queue or dead-letter queue whose redrive policy pairs it with the other side; moves from the dead-letter queue back, instead of --source and --destination").PlaceHolder("QUEUE").String()
+	toDeadLetter        = moveCommand.Flag("to-dead-letter", "With --redrive, move into the dead-letter queue instead of out of it").Bool()
+	sourceProfile       = moveCommand.Flag("source-profile", "AWS Profile for the source queue, defaults to --profile").String()
+	sourceRegion        = moveCommand.Flag("source-region", "AWS Region for the source queue, defaults to --region").String()
+	destinationProfile  = moveCommand.Flag("destination-profile", "AWS Profile for the destination queue, defaults to --profile").String()
+	destinationRegion   = moveCommand.Flag("destination-region", "AWS Region for the destination queue, defaults to --region").String()
+	sourceRoleArn       = moveCommand.Flag("source-role-arn", "IAM role to assume for the source queue, defaults to --role-arn").PlaceHolder("ARN").String()
+	sourceExtID         = moveCommand.Flag("source-external-id", "External ID of the source role, defaults to --external-id").PlaceHolder("ID").String()
+	sourceMFA           = moveCommand.Flag("source-mfa-serial", "MFA device of the source role, defaults to --mfa-serial").PlaceHolder("ARN").String()
+	destinationRoleArn  = moveCommand.Flag("destination-role-arn", "IAM role to assume for the destination queue, defaults to --role-arn").PlaceHolder("ARN").String()
+	destinationExtID    = moveCommand.Flag("destination-external-id", "External ID of the destination role, defaults to --external-id").PlaceHolder("ID").String()
+	destinationMFA      = moveCommand.Flag("destination-mfa-serial", "MFA device of the destination role, defaults to --mfa-serial").PlaceHolder("ARN").String()
+	sourceEndpoint      = moveCommand.Flag("source-endpoint", "Endpoint for AWS calls on the source side, e.g. http://localhost:4566 for LocalStack").PlaceHolder("URL").String()
+	destinationEndpoint = moveCommand.Flag("destination-endpoint", "Endpoint for AWS calls on the destination side").PlaceHolder("URL").String()
+	preferNewest        = moveCommand.Flag("prefer-newest", "Move the most recently sent messages first, working back through older backlog").Bool()
+	newestSlice         = moveCommand.Flag("newest-slice", "Width of each SentTimestamp window used by --prefer-newest").Default("1h").Duration()
+	redact              = moveCommand.Flag("redact", "Mask a JSON field before sending, e.g. jsonpath:$.card.number (repeatable)").PlaceHolder("jsonpath:EXPR").Strings()
+	transformSpecs      = moveCommand.Flag("transform", "Rewrite each body before sending with set:PATH=JSON, del:PATH, template:TEXT or exec:COMMAND (repeatable, applied in order)").PlaceHolder("KIND:EXPR").Strings()
+	transformWorkers    = moveCommand.Flag("transform-workers", "Goroutines shared by all workers that run --transform, for transforms that need more CPU than the network workers leave; 0 runs them in each worker").PlaceHolder("N").Int()
+	scanPII             = moveCommand.Flag("scan-pii", "Sample source messages for likely PII before moving (always on for cross-account moves)").Bool()
+	piiSample           = moveCommand.Flag("pii-sample", "Number of messages sampled by the PII scan").Default("50").Int()
+	acknowledgePII      = moveCommand.Flag("acknowledge-pii", "Proceed even though the PII scan found likely PII").Bool()
+	enrichDynamo        = moveCommand.Flag("enrich-dynamodb", "Look up an item per message and add its fields as attributes, e.g. orders:pk=jsonpath:$.orderId").PlaceHolder("TABLE:KEY=jsonpath:EXPR").String()
+	enrichFields        = moveCommand.Flag("enrich-field", "Item field copied onto the message by --enrich-dynamodb (repeatable)").Strings()
+	largePayloadBucket  = moveCommand.Flag("large-payload-bucket", "Re-point S3-backed Extended Client payloads at this bucket, which the destination reads from").PlaceHolder("BUCKET").String()
+	largePayloadCopy    = moveCommand.Flag("large-payload-copy", "Copy the S3 objects of Extended Client payloads into --large-payload-bucket before re-pointing them").Bool()
+	filterBody          = moveCommand.Flag("filter-body", "Only move messages whose body matches this regular expression").PlaceHolder("REGEX").String()
+	filterAttributes    = moveCommand.Flag("filter-attribute", "Only move messages with this message attribute value (repeatable)").PlaceHolder("KEY=VALUE").Strings()
+	olderThan           = moveCommand.Flag("older-than", "Only move messages sent longer ago than an age such as 7d, 36h or 90m, or before a time such as 2024-01-01T00:00 (UTC unless it has an offset)").PlaceHolder("AGE|TIME").String()
+	newerThan           = moveCommand.Flag("newer-than", "Only move messages sent more recently than an age, or after a time, in the forms of --older-than").PlaceHolder("AGE|TIME").String()
+	dropIf              = moveCommand.Flag("drop-if", "Delete messages matching a JSONPath predicate without sending them, e.g. '$.type == \"test\"' (repeatable)").PlaceHolder("PREDICATE").Strings()
+	prioritize          = moveCommand.Flag("prioritize", "Move messages matching a JSONPath predicate first and the rest after them, e.g. '$.tier == \"gold\"'").PlaceHolder("PREDICATE").String()
+	explode             = moveCommand.Flag("explode-jsonpath", "Send one destination message per value matched in the body, e.g. $.records[*]").PlaceHolder("EXPR").String()
+	aggregateSize       = moveCommand.Flag("aggregate", "Combine up to this many source messages into one destination message").Int()
+	envelopeKey         = moveCommand.Flag("envelope", "Key holding the array of combined messages in --aggregate envelopes").Default("records").String()
+	protoDescriptor     = moveCommand.Flag("proto-descriptor", "Compiled descriptor set used to decode base64 protobuf bodies").PlaceHolder("set.pb").ExistingFile()
+	protoType           = moveCommand.Flag("proto-type", "Fully qualified protobuf message type of the bodies, e.g. my.Event").String()
+	avroRegistry        = moveCommand.Flag("avro-registry", "Schema registry URL used to decode base64 Confluent Avro bodies").PlaceHolder("URL").String()
+	toCloudEvents       = moveCommand.Flag("to-cloudevents", "Wrap bodies in a CloudEvents 1.0 JSON envelope").Bool()
+	fromCloudEvents     = moveCommand.Flag("from-cloudevents", "Unwrap the data of CloudEvents JSON envelopes").Bool()
+	ceType              = moveCommand.Flag("ce-type", "CloudEvents type for --to-cloudevents, or jsonpath:EXPR to read it from the body").Default(defaultCloudEventsType).String()
+	ceSource            = moveCommand.Flag("ce-source", "CloudEvents source for --to-cloudevents, or jsonpath:EXPR; defaults to the source queue ARN").String()
+	limit               = moveCommand.Flag("limit", "Stop after this many source messages were moved or dropped").PlaceHolder("N").Int()
+	limitPercent        = moveCommand.Flag("percent", "Stop after this share of the messages in the source when the move starts, such as 25, rather than an absolute --limit").PlaceHolder("PCT").Float64()
+	tagDefaults         = moveCommand.Flag("tag-defaults", "Take defaults for flags not given from the sqsmover:default-FLAG tags of the source queue, such as sqsmover:default-destination").Bool()
+	sampleShare         = moveCommand.Flag("sample", "Move a random share of the messages, such as 10%, leaving the others in the source").PlaceHolder("PCT").String()
+	sampleCount         = moveCommand.Flag("sample-count", "Move about this many messages, picked at random across the source, leaving the others in the source").PlaceHolder("N").Int()
+	workers             = moveCommand.Flag("workers", "Number of concurrent receive, send and delete loops").Default("1").Int()
+	prefetch            = moveCommand.Flag("prefetch", "Batches each worker receives ahead of the one it sends, and sent batches waiting to be deleted, so round trips overlap; 0 runs them one after another").Default("2").Int()
+	transport           = moveCommand.Flag("transport", "sdk, or raw to sign receives, sends and deletes and post them over pooled HTTP/2 connections without the SDK (experimental)").Default("sdk").Enum("sdk", "raw")
+	verifyChecksums     = moveCommand.Flag("verify-checksums", "Check the MD5 digests SQS returns for the bodies and attributes of received and sent messages, and send again what was stored with a different digest").Bool()
+	maxRetries          = moveCommand.Flag("max-retries", "Times a throttled or partially failed batch is retried before the move stops").Default("5").Int()
+	onError             = moveCommand.Flag("on-error", "What to do with messages SQS refuses once retried: abort the move, skip them and leave them in the source, or dlq:QUEUE to send them there unchanged").Default("abort").String()
+	rate                = moveCommand.Flag("rate", "Most source messages moved per second across all workers, to spare the consumers of the destination; 0 means no limit").PlaceHolder("N").Float64()
+	byteRate            = moveCommand.Flag("byte-rate", "Most bytes of bodies and message attributes moved per second across all workers, such as 512KB; 0 means no limit").PlaceHolder("SIZE").Bytes()
+	batchInterval       = moveCommand.Flag("batch-interval", "Pause between batches across all workers, such as 500ms").Duration()
+	rampUp              = moveCommand.Flag("ramp-up", "Start --rate and --byte-rate at a tenth and raise them evenly to the full rate over this long, such as 5m, so the consumers of the destination can scale up first").Duration()
+	bounceLimit         = moveCommand.Flag("bounce-limit", "Stop the move once this many moved messages came back to the source, as when consumers fail on them again and a redrive policy returns them; they are left in the source. 0 doesn't check").PlaceHolder("N").Int()
+	deleteAfter         = moveCommand.Flag("delete-after", "Keep moved messages hidden in the source and delete them only this long after they were sent, such as 10m; interrupting the run before then rolls the move back").Duration()
+	visibilityTimeout   = moveCommand.Flag("visibility-timeout", "Seconds received messages stay hidden in the source while their batch is moved; defaults to 10 plus the longest the retries can back off for, times the batches --prefetch lets wait ahead").PlaceHolder("SECONDS").Int64()
+	waitTime            = moveCommand.Flag("wait-time", "Seconds each receive long polls for messages, up to 20; 0 returns straight away").Default("0").Int64()
+	emptyReceives       = moveCommand.Flag("empty-receives", "Receives in a row that must come back empty, each after the first long polling for at least 2 seconds, before the source is taken for drained, unless it reports no visible messages; 1 stops on the first").Default("3").PlaceHolder("N").Int()
+	viaStaging          = moveCommand.Flag("via-staging", "Move through a temporary staging queue next to the destination, verifying each hop, and delete it afterwards").Bool()
+	follow              = moveCommand.Flag("follow", "Keep moving messages as they arrive once the source is drained, long polling until stopped").Bool()
+	idleExitAfter       = moveCommand.Flag("idle-exit", "With --follow, stop following once no new messages arrived for this long, such as 10m, and end like a completed move").Duration()
+	moveDuration        = moveCommand.Flag("duration", "Move for at most this long, such as 10m, then finish the batches in flight and stop like a completed move; with --follow, stop following then").Duration()
+	timeout             = moveCommand.Flag("timeout", "Overall deadline for the move, such as 30m; batches in flight are finished and held messages released when it passes").Duration()
+	delaySeconds        = moveCommand.Flag("delay-seconds", "Seconds moved messages stay hidden in the destination before consumers see them, up to 900").PlaceHolder("N").Int64()
+	delaySpread         = moveCommand.Flag("delay-spread", "Spread the delays of moved messages at random over this range of seconds, such as 0..900").PlaceHolder("MIN..MAX").String()
+	dedupStorePath      = moveCommand.Flag("dedup-store", "File remembering the messages moved by recent runs, so scheduled runs that receive a message again don't send it twice").PlaceHolder("FILE").String()
+	dedupWindow         = moveCommand.Flag("dedup-window", "How long --dedup-store remembers a moved message").Default("1h").Duration()
+	dedupStoreKey       = moveCommand.Flag("dedup-store-key", "Recognise messages moved before by their message-id or by a hash of their body").Default("message-id").Enum("message-id", "body")
+	verifyOrder         = moveCommand.Flag("verify-order", "With a FIFO source and destination, check that every message group arrived in the order it left the source, and report it in the summary").Bool()
+	dedupeBy            = moveCommand.Flag("dedupe-by", "Collapse messages of this run with the same body, or the same value of the message attribute NAME, into the first of them that is sent").PlaceHolder("body|attribute:NAME").String()
+	dedupeAction        = moveCommand.Flag("dedupe-action", "What happens to the duplicates --dedupe-by finds: deleted from the source or left there").Default("delete").Enum("delete", "leave")
+	resumeState         = moveCommand.Flag("resume", "State file of this move: messages it sent are recorded there, and a run that is started again after an interruption skips them; removed once the move completes").PlaceHolder("FILE").String()
+	expireOlderThan     = moveCommand.Flag("expire-older-than", "Drop messages first sent longer ago than this, such as 7d or 36h, instead of moving them").PlaceHolder("AGE").String()
+	attachExpiry        = moveCommand.Flag("attach-expiry", "Stamp an expiresAt message attribute on moved messages, this long after they were first sent, such as 2h or 7d, so consumers can discard stale ones").PlaceHolder("AGE").String()
+	keepReceiveCount    = moveCommand.Flag("keep-receive-count", "Stamp x-original-receive-count and x-original-first-receive message attributes on moved messages, with how often and since when they were received in the source").Bool()
+	expireTo            = moveCommand.Flag("expire-to", "Send messages expired by --expire-older-than to this quarantine queue instead of dropping them").PlaceHolder("QUEUE").String()
+	copyMessages        = moveCommand.Flag("copy", "Send messages to the destination but leave them in the source").Bool()
+	stripAttributes     = moveCommand.Flag("strip-attributes", "Send only message bodies, dropping message attributes and the trace header").Bool()
+	messageAttributes   = moveCommand.Flag("message-attribute", "Receive and carry over only this message attribute, or those matching PREFIX.* (repeatable); all of them by default").PlaceHolder("NAME").Strings()
+	simulateFrom        = moveCommand.Flag("simulate-from", "Run the filters, drops, expiry, priority and body rewrites against the messages of a dump file and report where they would go, without any AWS calls").PlaceHolder("FILE").String()
+	showDiffs           = moveCommand.Flag("show-diffs", "With --simulate-from and --transform, print a unified diff of the original and transformed body of the first N messages the transforms change (0 for none)").Default("3").PlaceHolder("N").Int()
+	preflight           = moveCommand.Flag("preflight", "Check before moving that the source can be received from and deleted from and the destination sent to, and warn about FIFO mismatches and a smaller maximum message size at the destination").Bool()
+	allowSameQueue      = moveCommand.Flag("allow-same-queue", "Allow the source and destination to be the same queue, to requeue its messages with fresh attributes and receive counts").Bool()
+	messageGroupID      = moveCommand.Flag("message-group-id", "MessageGroupId for messages sent to a FIFO destination, or jsonpath:EXPR to read it from each body, overriding the source group").String()
+	serverSide          = moveCommand.Flag("server-side", "Let SQS move the messages with a message move task when the source is a dead-letter queue, falling back to moving them here when it can't").Bool()
+	progressQueue       = moveCommand.Flag("progress-queue", "Queue to send started, progress and summary events to as JSON messages, for dashboards and orchestrators").PlaceHolder("QUEUE").String()
+	progressInterval    = moveCommand.Flag("progress-interval", "How often progress is sent to --progress-queue while it changes").Default("10s").Duration()
+	metricsAddr         = moveCommand.Flag("metrics-addr", "Serve Prometheus metrics of the move on this address while it runs, such as :9090").PlaceHolder("ADDR").String()
+	outputFormat        = moveCommand.Flag("output", "text, or json for JSON events on stdout and JSON logs on stderr instead of the progress bar").Default("text").Enum("text", "json")
+	webhookURLs         = moveCommand.Flag("webhook-url", "POST a JSON summary to this URL when the move finishes (repeatable)").Strings()
+	webhookSecret       = moveCommand.Flag("webhook-secret", "Secret used to sign webhook payloads with HMAC-SHA256").Envar("SQSMOVER_WEBHOOK_SECRET").String()
+	notifyEmails        = moveCommand.Flag("notify-email", "Email the run summary to this address with SES when the move finishes (repeatable)").PlaceHolder("ADDRESS").Strings()
+	notifyEmailFrom     = moveCommand.Flag("notify-email-from", "Sender of --notify-email, an address or domain verified in SES").PlaceHolder("ADDRESS").String()
+	notifyEmailRegion   = moveCommand.Flag("notify-email-region", "Region to send --notify-email from, defaults to --region").PlaceHolder("REGION").String()
+	safeMode            = moveCommand.Flag("safe", "Guard a production redrive: ask before moving, and unless given otherwise move at --rate 50 with --ramp-up 2m, --bounce-limit 10, --audit-log sqsmover-audit.jsonl and --archive sqsmover-archive-RUN.jsonl").Bool()
+	assumeYes           = moveCommand.Flag("yes", "With --safe, move without asking for confirmation").Bool()
+	moveAudit           = moveCommand.Flag("audit-log", "File to append a JSON line to when the move starts, is refused at the confirmation or finishes, naming who ran it and what it moved").PlaceHolder("FILE").String()
+	manifestPath        = moveCommand.Flag("audit-file", "File to create with a row for every message the move sent: the source and destination message IDs and MD5s, when it was sent and moved, its receive count and its batch; CSV when it ends in .csv, JSON lines otherwise").PlaceHolder("FILE").String()
+	archivePath         = moveCommand.Flag("archive", "File to append every moved message to as a dump record before it is sent, to replay the move with load; synced to disk batch by batch").PlaceHolder("FILE").String()
+
+	inventoryCommand = kingpin.Command("inventory", "List queues with their depths and dead-letter status")
+	inventoryRegions = inventoryCommand.Flag("regions", "Regions to list queues in (repeatable, defaults to --region)").Strings()
+	inventoryFormat  = inventoryCommand.Flag("format", "Output format").Default("json").Enum("json", "csv")
+	inventoryOutput  = inventoryCommand.Flag("output", "Write the inventory to this file instead of stdout").Short('o').String()
+
+	watchCommand     = kingpin.Command("watch-depth", "Watch a queue's depth and alert when it reaches a threshold")
+	watchQueue       = watchCommand.Flag("queue", "Queue to watch").Short('q').Required().String()
+	watchThreshold   = watchCommand.Flag("threshold", "Depth that triggers the alert").Required().Int()
+	watchInterval    = watchCommand.Flag("interval", "Time between depth checks").Default("30s").Duration()
+	watchWebhookURLs = watchCommand.Flag("webhook-url", "POST a JSON alert to this URL and keep watching instead of exiting (repeatable)").Strings()
+	watchSecret      = watchCommand.Flag("webhook-secret", "Secret used to sign webhook payloads with HMAC-SHA256").PlaceHolder("SECRET").Envar("SQSMOVER_WEBHOOK_SECRET").String()
+
+	probeCommand = kingpin.Command("probe", "Send a test message with a temporary reply queue and wait for the consumer to answer")
+	probeQueue   = probeCommand.Flag("queue", "Queue to probe").Short('q').Required().String()
+	probeBody    = probeCommand.Flag("body", "Body of the probe message").Default(`{"sqsmover":"probe"}`).String()
+	probeGroupID = probeCommand.Flag("message-group-id", "MessageGroupId used when the probed queue is FIFO").Default("sqsmover-probe").String()
+	probeTimeout = probeCommand.Flag("timeout", "How long to wait for the reply").Default("1m").Duration()
+
+	migrateCommand     = kingpin.Command("migrate-to-fifo", "Create a FIFO copy of a standard queue and move its messages into it")
+	migrateSource      = migrateCommand.Flag("source", "Standard queue to migrate").Short('s').Required().String()
+	migrateDestination = migrateCommand.Flag("destination", "Name of the FIFO queue to create, defaults to the source name with .fifo").Short('d').String()
+	migrateGroupID     = migrateCommand.Flag("group-id", "MessageGroupId for every message, or jsonpath:EXPR to read it from each body; asked for when omitted").String()
+	migrateDedup       = migrateCommand.Flag("dedup", "Deduplicate on the source message ID or on the body; asked for when omitted").Enum("message-id", "content")
+
+	swapCommand = kingpin.Command("swap", "Exchange the messages of two queues through a temporary queue, such as after traffic was written to the wrong one in a blue/green cutover")
+	swapA       = swapCommand.Flag("a", "First queue").Required().String()
+	swapB       = swapCommand.Flag("b", "Second queue").Required().String()
+	swapYes     = swapCommand.Flag("yes", "Swap without asking for confirmation").Bool()
+
+	dumpCommand        = kingpin.Command("dump", "Write a queue's messages to a JSON Lines file, leaving them in the queue unless --delete is given")
+	dumpQueue          = dumpCommand.Flag("queue", "Queue to dump").Short('q').Required().String()
+	dumpOutput         = dumpCommand.Flag("output", "File to write, one JSON message per line; an existing file is never overwritten").Short('o').Required().String()
+	dumpDelete         = dumpCommand.Flag("delete", "Delete messages from the queue once they are written to the file").Bool()
+	dumpLimit          = dumpCommand.Flag("limit", "Stop after this many messages").PlaceHolder("N").Int()
+	dumpRedact         = dumpCommand.Flag("redact", "Mask a JSON field of the bodies written, e.g. jsonpath:$.card.number (repeatable, or separated by commas)").PlaceHolder("jsonpath:EXPR").Strings()
+	dumpEncrypt        = dumpCommand.Flag("encrypt-dump", "Encrypt the file with a data key from KMS, so only those allowed to decrypt with --kms-key can read it").Bool()
+	dumpKMSKey         = dumpCommand.Flag("kms-key", "KMS key that encrypts the data key of --encrypt-dump").PlaceHolder("ARN").String()
+	dumpCompress       = dumpCommand.Flag("compress", "Compress the file; load, diff, fingerprint and --simulate-from recognise compressed files").Default("none").Enum(dumpCompressions...)
+	dumpDedupe         = dumpCommand.Flag("dedupe", "Write each distinct body once with the number of messages that carried it, which load sends again; the records are kept in memory until the dump ends").Bool()
+	dumpPIISample      = dumpCommand.Flag("pii-sample", "Number of messages sampled by the PII scan that runs before every dump").Default("50").Int()
+	dumpAcknowledgePII = dumpCommand.Flag("acknowledge-pii", "Proceed even though the PII scan found likely PII").Bool()
+
+	loadCommand     = kingpin.Command("load", "Send the messages of a dump or a line-delimited file to a queue")
+	loadInput       = loadCommand.Flag("input", "File to read").Short('i').Required().String()
+	loadDestination = loadCommand.Flag("destination", "Queue to send the messages to").Short('d').Required().String()
+	loadFormat      = loadCommand.Flag("format", "jsonl reads records written by dump, lines sends each line as a body").Default("jsonl").Enum("jsonl", "lines")
+	loadGroupID     = loadCommand.Flag("message-group-id", "MessageGroupId for a FIFO queue, or jsonpath:EXPR to read it from each body, overriding the group in the records").String()
+	loadRate        = loadCommand.Flag("rate", "Most messages sent per second, to spare the consumers of the queue; 0 means no limit").PlaceHolder("N").Float64()
+	loadRampUp      = loadCommand.Flag("ramp-up", "Start --rate at a tenth and raise it evenly to the full rate over this long, such as 5m, and again whenever --active-hours opens").Duration()
+	loadActiveHours = loadCommand.Flag("active-hours", "Only send between these local times, such as 22:00-06:00, waiting for the window to open outside them").PlaceHolder("HH:MM-HH:MM").String()
+
+	diffCommand = kingpin.Command("diff", "Compare the message bodies of two queues or dump files, leaving the queues as they are")
+	diffA       = diffCommand.Flag("a", "First queue, or file:PATH for a file written by dump").Required().String()
+	diffB       = diffCommand.Flag("b", "Second queue, or file:PATH for a file written by dump").Required().String()
+	diffLimit   = diffCommand.Flag("limit", "Read at most this many messages from each side").PlaceHolder("N").Int()
+	diffShow    = diffCommand.Flag("show", "Number of differing bodies listed for each side").Default("10").Int()
+
+	compareCommand = kingpin.Command("compare", "Compare the depths, oldest messages and configuration of two queues, leaving their messages as they are")
+	compareA       = compareCommand.Flag("a", "First queue").Required().String()
+	compareB       = compareCommand.Flag("b", "Second queue").Required().String()
+	comparePeek    = compareCommand.Flag("peek", "Messages peeked at in each queue to find the oldest one; 0 reads only the queue attributes").Default("100").Int()
+	compareOverlap = compareCommand.Flag("overlap", "Also count the peeked bodies found in both queues").Bool()
+
+	fingerprintCommand = kingpin.Command("fingerprint", "Print a hash of the message bodies of a queue or dump file that doesn't depend on their order, with their count")
+	fingerprintQueue   = fingerprintCommand.Flag("queue", "Queue, or file:PATH for a file written by dump").Short('q').Required().String()
+	fingerprintLimit   = fingerprintCommand.Flag("limit", "Read at most this many messages").PlaceHolder("N").Int()
+
+	peekCommand = kingpin.Command("peek", "Show messages of a queue with their attributes and leave them in the queue")
+	peekQueue   = peekCommand.Flag("queue", "Queue to peek at").Short('q').Required().String()
+	peekCount   = peekCommand.Flag("count", "Number of messages shown").Short('n').Default("10").Int()
+	peekPretty  = peekCommand.Flag("pretty", "Indent JSON bodies").Bool()
+	peekType    = peekCommand.Flag("filter-content-type", "Only show messages whose body is detected as this type").PlaceHolder("TYPE").Enum(contentTypes...)
+	peekRedact  = peekCommand.Flag("redact", "Mask a JSON field of the bodies shown, e.g. jsonpath:$.card.number (repeatable, or separated by commas)").PlaceHolder("jsonpath:EXPR").Strings()
+
+	uiCommand = kingpin.Command("ui", "Serve a web dashboard on localhost to list queues and start and follow moves")
+	uiListen  = uiCommand.Flag("listen", "Address to serve the dashboard on, a loopback one unless --tenants and --tls-cert are given").Default("127.0.0.1:8080").String()
+	uiTenants = uiCommand.Flag("tenants", "YAML file of the teams the dashboard serves, each with a token, credentials and a limit of concurrent moves").PlaceHolder("tenants.yaml").String()
+	uiAudit   = uiCommand.Flag("audit-log", "File to append a JSON line to for every move the dashboard starts, refuses, cancels or finishes").PlaceHolder("FILE").String()
+	uiTLSCert = uiCommand.Flag("tls-cert", "Certificate to serve the dashboard over HTTPS with").PlaceHolder("FILE").String()
+	uiTLSKey  = uiCommand.Flag("tls-key", "Private key of --tls-cert").PlaceHolder("FILE").String()
+
+	benchCommand  = kingpin.Command("bench-transport", "Compare the sdk and raw transports by sending, receiving and deleting messages through temporary queues")
+	benchBatches  = benchCommand.Flag("batches", "Batches of 10 messages moved with each transport").Default("100").Int()
+	benchWorkers  = benchCommand.Flag("workers", "Concurrent calls with each transport").Default("8").Int()
+	benchBodySize = benchCommand.Flag("body-size", "Size of each message body").Default("1KB").Bytes()
+
+	tasksCommand       = kingpin.Command("tasks", "View and cancel the message move tasks SQS runs on dead-letter queues")
+	tasksListCommand   = tasksCommand.Command("list", "List the recent message move tasks of a dead-letter queue")
+	tasksListQueue     = tasksListCommand.Flag("queue", "Dead-letter queue whose tasks are listed").Short('q').Required().String()
+	tasksCancelCommand = tasksCommand.Command("cancel", "Cancel the running message move task of a dead-letter queue; messages it already moved stay in the destination")
+	tasksCancelQueue   = tasksCancelCommand.Flag("queue", "Dead-letter queue whose running task is cancelled").Short('q').String()
+	tasksCancelHandle  = tasksCancelCommand.Flag("task-handle", "Handle of the task to cancel, as tasks list shows it, instead of --queue").PlaceHolder("HANDLE").String()
+
+	runCommand = kingpin.Command("run", "Run a move defined by name in the config file; move flags given after the name override its values")
+	runName    = runCommand.Arg("name", "Name of the move in the config file").Required().String()
+
+	taskCommand   = kingpin.Command("task", "Run a move described by a JSON document and write the result as JSON, for Step Functions and batch jobs")
+	taskInputPath = taskCommand.Flag("input", "JSON parameter document: a file, - for stdin, or the document itself").Short('i').Default("-").String()
+	taskOutput    = taskCommand.Flag("output", "Where to write the JSON result: - for stdout, a file, or an s3://bucket/key URL").Short('o').Default("-").String()
+
+	redactRules      []redactRule
+	activePolicies   []operationPolicy
+	activeCommand    string
+	activeEnricher   *dynamoEnricher
+	dropRules        []predicate
+	priorityRule     *predicate
+	activeAggregator *aggregator
+
+	// runCtx carries the --timeout deadline to every AWS call of the run.
+	runCtx = context.Background()
 )
 
 func main() {
-	log.SetHandler(cli.Default)
+	defer exitOnPanic()
 
-	fmt.Println()
-	defer fmt.Println()
+	log.SetHandler(runHandler{next: cli.Default})
 
 	kingpin.UsageTemplate(kingpin.CompactUsageTemplate)
-	kingpin.Parse()
-
-	sess, err := session.NewSessionWithOptions(session.Options{
-		Profile: *profile,
-		Config: aws.Config{
-			Region: aws.String(*region),
-		},
-		SharedConfigState: session.SharedConfigEnable,
-	})
 
+	args, err := expandRun(os.Args[1:])
 	if err != nil {
-		log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session for region \r\n", *region))
-		return
+		kingpin.Fatalf("%s", err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
+	command := kingpin.Parse()
+
+	runID = orDefault(*runIDFlag, newRunID())
+
+	if *verbose || *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if *timeout < 0 {
+		kingpin.Fatalf("--timeout can't be negative")
+	}
+
+	for flag, endpoint := range map[string]string{"--endpoint-url": *endpointURL, "--source-endpoint": *sourceEndpoint, "--destination-endpoint": *destinationEndpoint} {
+		if err := checkEndpoint(flag, endpoint); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
 	}
 
-	svc := sqs.New(sess)
+	for flag, role := range map[string]assumedRole{"--role-arn": globalRole(), "--source-role-arn or --role-arn": sourceRole(), "--destination-role-arn or --role-arn": destinationRole()} {
+		if err := role.validate(flag); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+	}
+
+	if *timeout > 0 {
+		ctx, cancel := context.WithTimeout(runCtx, *timeout)
+		defer cancel()
+		runCtx = ctx
+	}
 
-	sourceQueueURL, err := resolveQueueURL(svc, *sourceQueue)
+	if *outputFormat == "json" {
+		startJSONOutput()
+	}
+
+	if plainConsole() {
+		plainLogs()
+	}
 
+	policies, err := loadPolicies()
 	if err != nil {
-		logAwsError("Failed to resolve source queue", err)
+		kingpin.Fatalf("%s", err)
+	}
+
+	activePolicies = policies
+
+	for _, p := range policies {
+		if p.ReadOnly {
+			*readOnly = true
+		}
+	}
+
+	if *readOnly {
+		if err := checkReadOnly(command); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+	}
+
+	inv := currentInvocation(command)
+	activeCommand = inv.command
+	for _, p := range policies {
+		if err := p.allow(inv); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+	}
+
+	if command == inventoryCommand.FullCommand() {
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		regions := *inventoryRegions
+		if len(regions) == 0 {
+			regions = []string{*region}
+		}
+
+		runInventory(cfg, *accountsFile, regions, *inventoryFormat, *inventoryOutput)
 		return
 	}
 
-	log.Info(color.New(color.FgCyan).Sprintf("Source queue URL: %s", sourceQueueURL))
+	if command == watchCommand.FullCommand() {
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-	destinationQueueURL, err := resolveQueueURL(svc, *destinationQueue)
+		if !watchDepth(sqs.NewFromConfig(cfg), *watchQueue, *watchThreshold, *watchInterval, *watchWebhookURLs, *watchSecret) {
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err != nil {
-		logAwsError("Failed to resolve destination queue", err)
+	if command == probeCommand.FullCommand() {
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		if !runProbe(sqs.NewFromConfig(cfg), *probeQueue, *probeBody, *probeGroupID, *probeTimeout) {
+			os.Exit(1)
+		}
 		return
 	}
 
-	log.Info(color.New(color.FgCyan).Sprintf("Destination queue URL: %s", destinationQueueURL))
+	if command == tasksListCommand.FullCommand() || command == tasksCancelCommand.FullCommand() {
+		if command == tasksCancelCommand.FullCommand() && (*tasksCancelQueue == "") == (*tasksCancelHandle == "") {
+			kingpin.Fatalf("tasks cancel needs either --queue or --task-handle")
+		}
 
-	queueAttributes, err := svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
-		QueueUrl:       aws.String(sourceQueueURL),
-		AttributeNames: []*string{aws.String("All")},
-	})
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-	numberOfMessages, _ := strconv.Atoi(*queueAttributes.Attributes["ApproximateNumberOfMessages"])
+		code := 0
+		if command == tasksListCommand.FullCommand() {
+			code = runTasksList(sqs.NewFromConfig(cfg), *tasksListQueue)
+		} else {
+			code = runTasksCancel(sqs.NewFromConfig(cfg), *tasksCancelQueue, *tasksCancelHandle)
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return
+	}
 
-	log.Info(color.New(color.FgCyan).Sprintf("Approximate number of messages in the source queue: %s",
-		*queueAttributes.Attributes["ApproximateNumberOfMessages"]))
+	if command == migrateCommand.FullCommand() {
+		rails, err := loadGuardrails()
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
 
-	if numberOfMessages == 0 {
-		log.Info("Looks like nothing to move. Done.")
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		migration := fifoMigration{source: *migrateSource, destination: *migrateDestination, groupID: *migrateGroupID, dedup: *migrateDedup}
+		if code := runMigrateToFifo(sqs.NewFromConfig(cfg), migration, rails).exitStatus(); code != 0 {
+			os.Exit(code)
+		}
 		return
 	}
 
-	moveMessages(sourceQueueURL, destinationQueueURL, svc, numberOfMessages)
+	if command == swapCommand.FullCommand() {
+		rails, err := loadGuardrails()
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
 
-}
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-func resolveQueueURL(svc *sqs.SQS, queueName string) (string, error) {
-	params := &sqs.GetQueueUrlInput{
-		QueueName: aws.String(queueName),
+		if code := runSwap(sqs.NewFromConfig(cfg), *swapA, *swapB, *swapYes, rails).exitStatus(); code != 0 {
+			os.Exit(code)
+		}
+		return
 	}
-	resp, err := svc.GetQueueUrl(params)
 
-	if err != nil {
-		return "", err
+	if command == dumpCommand.FullCommand() {
+		if *dumpLimit < 0 {
+			kingpin.Fatalf("--limit can't be negative")
+		}
+
+		if *dumpPIISample < 1 {
+			kingpin.Fatalf("--pii-sample must be at least 1")
+		}
+
+		rules, err := parseRedactRules(*dumpRedact)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+
+		// A drain would leave the masked file as the only copy of the
+		// messages.
+		if len(rules) > 0 && *dumpDelete {
+			kingpin.Fatalf("--redact can't be combined with --delete")
+		}
+
+		// Messages would have to stay hidden until the counts are written
+		// at the end.
+		if *dumpDedupe && *dumpDelete {
+			kingpin.Fatalf("--dedupe can't be combined with --delete")
+		}
+
+		// Encrypted lines look random, so there is nothing to compress.
+		if *dumpCompress != "none" && *dumpEncrypt {
+			kingpin.Fatalf("--compress can't be combined with --encrypt-dump")
+		}
+
+		if *dumpEncrypt != (*dumpKMSKey != "") {
+			kingpin.Fatalf("--encrypt-dump and --kms-key must be given together")
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		if !runDump(sqs.NewFromConfig(cfg), *dumpQueue, *dumpOutput, *dumpDelete, *dumpLimit, rules, *dumpKMSKey, *dumpDedupe, *dumpCompress, *dumpPIISample, *dumpAcknowledgePII) {
+			os.Exit(1)
+		}
+		return
 	}
 
-	return *resp.QueueUrl, nil
-}
+	if command == loadCommand.FullCommand() {
+		if *loadRate < 0 || *loadRampUp < 0 {
+			kingpin.Fatalf("--rate and --ramp-up can't be negative")
+		}
 
-func logAwsError(message string, err error) {
-	if awsErr, ok := err.(awserr.Error); ok {
-		log.Error(color.New(color.FgRed).Sprintf("%s. Error: %s", message, awsErr.Message()))
-	} else {
-		log.Error(color.New(color.FgRed).Sprintf("%s. Error: %s", message, err.Error()))
+		if *loadRampUp > 0 && *loadRate == 0 {
+			kingpin.Fatalf("--ramp-up needs --rate, the rate to ramp up to")
+		}
+
+		var hours *activeHours
+		if *loadActiveHours != "" {
+			if hours, err = parseActiveHours(*loadActiveHours); err != nil {
+				kingpin.Fatalf("%s", err)
+			}
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		if !runLoad(sqs.NewFromConfig(cfg), *loadInput, *loadDestination, *loadFormat, *loadGroupID, *loadRate, *loadRampUp, hours) {
+			os.Exit(1)
+		}
+		return
 	}
-}
 
-func convertToEntries(messages []*sqs.Message) []*sqs.SendMessageBatchRequestEntry {
-	result := make([]*sqs.SendMessageBatchRequestEntry, len(messages))
-	for i, message := range messages {
-		result[i] = &sqs.SendMessageBatchRequestEntry{
-			MessageBody: message.Body,
-			Id:          message.MessageId,
+	if command == diffCommand.FullCommand() {
+		if *diffLimit < 0 || *diffShow < 0 {
+			kingpin.Fatalf("--limit and --show can't be negative")
 		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		if code := runDiff(sqs.NewFromConfig(cfg), *diffA, *diffB, *diffLimit, *diffShow); code != 0 {
+			os.Exit(code)
+		}
+		return
 	}
 
-	return result
-}
+	if command == compareCommand.FullCommand() {
+		if *comparePeek < 0 {
+			kingpin.Fatalf("--peek can't be negative")
+		}
+		if *compareOverlap && *comparePeek == 0 {
+			kingpin.Fatalf("--overlap needs messages to peek at, --peek can't be 0")
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-func convertSuccessfulMessageToBatchRequestEntry(messages []*sqs.Message) []*sqs.DeleteMessageBatchRequestEntry {
-	result := make([]*sqs.DeleteMessageBatchRequestEntry, len(messages))
-	for i, message := range messages {
-		result[i] = &sqs.DeleteMessageBatchRequestEntry{
-			ReceiptHandle: message.ReceiptHandle,
-			Id:            message.MessageId,
+		if code := runCompare(sqs.NewFromConfig(cfg), *compareA, *compareB, *comparePeek, *compareOverlap); code != 0 {
+			os.Exit(code)
 		}
+		return
 	}
 
-	return result
-}
+	if command == fingerprintCommand.FullCommand() {
+		if *fingerprintLimit < 0 {
+			kingpin.Fatalf("--limit can't be negative")
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-func moveMessages(sourceQueueURL string, destinationQueueURL string, svc *sqs.SQS, numberOfMessages int) {
-	params := &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(sourceQueueURL),
-		VisibilityTimeout:   aws.Int64(2),
-		WaitTimeSeconds:     aws.Int64(0),
-		MaxNumberOfMessages: aws.Int64(10),
+		if code := runFingerprint(sqs.NewFromConfig(cfg), *fingerprintQueue, *fingerprintLimit); code != 0 {
+			os.Exit(code)
+		}
+		return
 	}
 
-	log.Info(color.New(color.FgCyan).Sprintf("Starting to move messages..."))
-	fmt.Println()
+	if command == peekCommand.FullCommand() {
+		if *peekCount < 1 {
+			kingpin.Fatalf("--count must be at least 1")
+		}
+
+		rules, err := parseRedactRules(*peekRedact)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
+
+		if !runPeek(sqs.NewFromConfig(cfg), *peekQueue, *peekCount, *peekPretty, *peekType, rules) {
+			os.Exit(1)
+		}
+		return
+	}
 
-	term.HideCursor()
-	defer term.ShowCursor()
+	if command == uiCommand.FullCommand() {
+		rails, err := loadGuardrails()
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
+		}
 
-	b := progress.NewInt(numberOfMessages)
-	b.Width = 40
-	b.StartDelimiter = color.New(color.FgCyan).Sprint("|")
-	b.EndDelimiter = color.New(color.FgCyan).Sprint("|")
-	b.Filled = color.New(color.FgCyan).Sprint("█")
-	b.Empty = color.New(color.FgCyan).Sprint("░")
-	b.Template(`		{{.Bar}} {{.Text}}{{.Percent | printf "%3.0f"}}%`)
+		if (*uiTLSCert == "") != (*uiTLSKey == "") {
+			kingpin.Fatalf("--tls-cert and --tls-key must be given together")
+		}
 
-	render := term.Renderer()
+		var tenants []*uiTenant
+		if *uiTenants != "" {
+			if tenants, err = loadTenants(*uiTenants); err != nil {
+				kingpin.Fatalf("%s", err)
+			}
+		}
 
-	messagesProcessed := 0
+		var audit *auditLog
+		if *uiAudit != "" {
+			if audit, err = openAuditLog(*uiAudit); err != nil {
+				kingpin.Fatalf("unable to open the audit log: %s", err)
+			}
+		}
 
-	for {
-		resp, err := svc.ReceiveMessage(params)
+		if err := runUI(sqs.NewFromConfig(cfg), *region, *uiListen, rails, tenants, audit); err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to serve the UI: %s", err))
+			os.Exit(1)
+		}
+		return
+	}
 
-		if len(resp.Messages) == 0 {
-			fmt.Println()
-			log.Info(color.New(color.FgCyan).Sprintf("Done. Moved %s messages", strconv.Itoa(numberOfMessages)))
-			return
+	if command == benchCommand.FullCommand() {
+		if *benchBatches < 1 || *benchWorkers < 1 {
+			kingpin.Fatalf("--batches and --workers must be at least 1")
+		}
+		if *benchBodySize < 1 || int(*benchBodySize) > maxMessageBytes/benchBatchSize {
+			kingpin.Fatalf("--body-size must be between 1 and %d bytes, so a batch fits in one request", maxMessageBytes/benchBatchSize)
 		}
 
+		cfg, err := newConfig(*profile, *region, *endpointURL)
 		if err != nil {
-			logAwsError("Failed to receive messages", err)
-			return
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session: %s", err))
+			os.Exit(exitAuth)
 		}
 
-		batch := &sqs.SendMessageBatchInput{
-			QueueUrl: aws.String(destinationQueueURL),
-			Entries:  convertToEntries(resp.Messages),
+		if code := runBenchTransport(sqs.NewFromConfig(cfg), *benchBatches, *benchWorkers, int(*benchBodySize)); code != 0 {
+			os.Exit(code)
 		}
+		return
+	}
 
-		sendResp, err := svc.SendMessageBatch(batch)
+	if command == taskCommand.FullCommand() {
+		in, err := readTaskInput(*taskInputPath)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
 
+		rails, err := loadGuardrails()
 		if err != nil {
-			logAwsError("Failed to un-queue messages to the destination", err)
-			return
+			kingpin.Fatalf("%s", err)
 		}
 
-		if len(sendResp.Failed) > 0 {
-			log.Error(color.New(color.FgRed).Sprintf("%s messages failed to enqueue, exiting", len(sendResp.Failed)))
-			return
+		if code := runTask(in, *taskOutput, rails); code != 0 {
+			os.Exit(code)
 		}
+		return
+	}
 
-		if len(sendResp.Successful) == len(resp.Messages) {
-			deleteMessageBatch := &sqs.DeleteMessageBatchInput{
-				Entries:  convertSuccessfulMessageToBatchRequestEntry(resp.Messages),
-				QueueUrl: aws.String(sourceQueueURL),
-			}
+	fmt.Println()
+	defer fmt.Println()
 
-			deleteResp, err := svc.DeleteMessageBatch(deleteMessageBatch)
+	if *tagDefaults && *sourceQueue != "" && *simulateFrom == "" && !isQueuePattern(*sourceQueue) {
+		side := sourceSideConfig()
+		cfg, err := newRoleConfig(side.profile, side.region, side.endpoint, side.role)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session for region %s\r\n", side.region))
+			os.Exit(exitAuth)
+		}
 
-			if err != nil {
-				logAwsError("Failed to delete messages from source queue", err)
-				return
-			}
+		if err := applyTagDefaults(sqs.NewFromConfig(cfg), *sourceQueue); err != nil {
+			logAwsError("Unable to read the default options of the source queue", err)
+			os.Exit(failureCode(err, exitQueue))
+		}
 
-			if len(deleteResp.Failed) > 0 {
-				log.Error(color.New(color.FgRed).Sprintf("Error deleting messages, the following were not deleted\n %s", deleteResp.Failed))
-				return
+		inv := currentInvocation(command)
+		for _, p := range activePolicies {
+			if err := p.allow(inv); err != nil {
+				kingpin.Fatalf("%s", err)
 			}
+		}
+	}
+
+	if *redrive == "" && *simulateFrom == "" && (*sourceQueue == "" || len(destinations()) == 0 && *destinationTemplate == "") {
+		kingpin.Fatalf("--source and --destination or --destination-topic are required, unless --redrive or --simulate-from is given")
+	}
+
+	if *simulateFrom != "" && (*redrive != "" || *accountsFile != "" || *enrichDynamo != "" || *aggregateSize > 0 || *largePayloadCopy) {
+		kingpin.Fatalf("--simulate-from can't be combined with --redrive, --accounts, --enrich-dynamodb, --aggregate or --large-payload-copy, which need AWS")
+	}
+
+	if *destinationTemplate != "" {
+		if !isQueuePattern(*sourceQueue) {
+			kingpin.Fatalf("--destination-template needs a --source glob, such as orders-*-dlq")
+		}
+		if len(destinations()) > 0 {
+			kingpin.Fatalf("--destination-template can't be combined with --destination or --destination-topic")
+		}
+		if _, err := parseDestinationTemplate(*destinationTemplate); err != nil {
+			kingpin.Fatalf("--destination-template: %s", err)
+		}
+	}
+
+	if isQueuePattern(*sourceQueue) && (*simulateFrom != "" || *accountsFile != "" || *tagDefaults || *follow || *resumeState != "") {
+		kingpin.Fatalf("a --source glob can't be combined with --simulate-from, --accounts, --tag-defaults, --follow or --resume")
+	}
+
+	if *showDiffs < 0 {
+		kingpin.Fatalf("--show-diffs must not be negative")
+	}
+
+	if *redrive != "" {
+		if *sourceQueue != "" || len(destinations()) > 0 {
+			kingpin.Fatalf("--redrive can't be combined with --source or --destination")
+		}
+
+		if separateSides() {
+			kingpin.Fatalf("--redrive can't be combined with separate source and destination profiles, regions, roles or endpoints, since it finds both queues with the same client")
+		}
+	}
+
+	if *toDeadLetter && *redrive == "" {
+		kingpin.Fatalf("--to-dead-letter needs --redrive")
+	}
+
+	rules, err := parseRedactRules(*redact)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	redactRules = rules
+
+	for _, spec := range *transformSpecs {
+		t, err := parseTransform(spec)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		transforms = append(transforms, t)
+	}
+
+	if *transformWorkers < 0 {
+		kingpin.Fatalf("--transform-workers can't be negative")
+	}
+
+	if *transformWorkers > 0 && len(transforms) > 0 {
+		activeTransformPool = newTransformPool(*transformWorkers)
+	}
+
+	if *protoType != "" {
+		if *protoDescriptor == "" {
+			kingpin.Fatalf("--proto-type needs --proto-descriptor")
+		}
 
-			messagesProcessed += len(resp.Messages)
+		codec, err := newProtoCodec(*protoDescriptor, *protoType)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		activeCodec = codec
+	}
+
+	if *avroRegistry != "" {
+		if activeCodec != nil {
+			kingpin.Fatalf("--avro-registry can't be combined with --proto-type")
+		}
+		activeCodec = newAvroCodec(*avroRegistry)
+	}
+
+	unwrapCloudEvents = *fromCloudEvents
+
+	if *explode != "" {
+		path, err := parseJSONPath(*explode)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		explodePath = path
+	}
+
+	if *aggregateSize > 0 {
+		if *explode != "" || *preferNewest {
+			kingpin.Fatalf("--aggregate can't be combined with --explode-jsonpath or --prefer-newest")
 		}
 
-		// Increase the total if the approximation was under - avoids exception
-		if messagesProcessed > numberOfMessages {
-			b.Total = float64(messagesProcessed)
+		if len(transforms) > 0 {
+			kingpin.Fatalf("--aggregate can't be combined with --transform")
 		}
+	}
+
+	if *limit < 0 {
+		kingpin.Fatalf("--limit can't be negative")
+	}
+
+	if *limitPercent < 0 || *limitPercent > 100 {
+		kingpin.Fatalf("--percent must be between 0 and 100")
+	}
+
+	if *limitPercent > 0 && (*limit > 0 || *follow) {
+		kingpin.Fatalf("--percent can't be combined with --limit or --follow")
+	}
+
+	if *sampleCount < 0 {
+		kingpin.Fatalf("--sample-count can't be negative")
+	}
+
+	if *sampleCount > 0 && (*sampleShare != "" || *limit > 0 || *limitPercent > 0 || *follow) {
+		kingpin.Fatalf("--sample-count can't be combined with --sample, --limit, --percent or --follow")
+	}
+
+	if *safeMode && *preferNewest {
+		kingpin.Fatalf("--safe can't be combined with --prefer-newest, which can't be paced")
+	}
+
+	if *assumeYes && !*safeMode {
+		kingpin.Fatalf("--yes needs --safe, the only move that asks")
+	}
+
+	if *safeMode && *simulateFrom == "" {
+		applySafeDefaults()
+	}
+
+	if *workers < 1 {
+		kingpin.Fatalf("--workers must be at least 1")
+	}
 
-		b.ValueInt(messagesProcessed)
-		render(b.String())
+	if *maxRetries < 0 {
+		kingpin.Fatalf("--max-retries can't be negative")
+	}
+
+	if *prefetch < 0 || *prefetch > maxPrefetch {
+		kingpin.Fatalf("--prefetch must be between 0 and %d", maxPrefetch)
+	}
+
+	if *visibilityTimeout < 0 || *visibilityTimeout > 43200 {
+		kingpin.Fatalf("--visibility-timeout must be between 0 and 43200 seconds")
+	}
+
+	if *waitTime < 0 || *waitTime > 20 {
+		kingpin.Fatalf("--wait-time must be between 0 and 20 seconds")
+	}
+
+	if *emptyReceives < 1 {
+		kingpin.Fatalf("--empty-receives must be at least 1")
+	}
+
+	if *workers > 1 && (*aggregateSize > 0 || *preferNewest) {
+		kingpin.Fatalf("--workers can't be combined with --aggregate or --prefer-newest")
+	}
+
+	if *rate < 0 || *byteRate < 0 || *batchInterval < 0 {
+		kingpin.Fatalf("--rate, --byte-rate and --batch-interval can't be negative")
+	}
+
+	if (*rate > 0 || *byteRate > 0 || *batchInterval > 0) && *preferNewest {
+		kingpin.Fatalf("--rate, --byte-rate and --batch-interval can't be combined with --prefer-newest")
+	}
+
+	if *rampUp < 0 {
+		kingpin.Fatalf("--ramp-up can't be negative")
+	}
+
+	if *rampUp > 0 && *rate == 0 && *byteRate == 0 {
+		kingpin.Fatalf("--ramp-up needs --rate or --byte-rate, the rate to ramp up to")
+	}
+
+	if *bounceLimit < 0 {
+		kingpin.Fatalf("--bounce-limit can't be negative")
+	}
+
+	if *bounceLimit > 0 && *allowSameQueue {
+		kingpin.Fatalf("--bounce-limit can't be combined with --allow-same-queue, which brings every message back")
+	}
+
+	if *bounceLimit > 0 && (*viaStaging || *preferNewest) {
+		kingpin.Fatalf("--bounce-limit can't be combined with --via-staging or --prefer-newest")
+	}
+
+	if *manifestPath != "" && *viaStaging {
+		kingpin.Fatalf("--audit-file can't be combined with --via-staging, whose second hop it can't follow")
+	}
+
+	if *deleteAfter < 0 || *deleteAfter > 11*time.Hour {
+		kingpin.Fatalf("--delete-after must be between 0 and 11h, since SQS hides a message for 12 hours at most")
+	}
+
+	if *moveDuration < 0 {
+		kingpin.Fatalf("--duration can't be negative")
+	}
+
+	if *moveDuration > 0 && (*deleteAfter > 0 || *viaStaging) {
+		kingpin.Fatalf("--duration can't be combined with --delete-after or --via-staging, which need the move to finish")
+	}
+
+	if *idleExitAfter < 0 {
+		kingpin.Fatalf("--idle-exit can't be negative")
+	}
+
+	if *idleExitAfter > 0 && !*follow {
+		kingpin.Fatalf("--idle-exit needs --follow, since a move without it ends once the source is drained")
+	}
+
+	if *follow && (*copyMessages || *preferNewest || *prioritize != "" || *deleteAfter > 0 || *accountsFile != "") {
+		kingpin.Fatalf("--follow can't be combined with --copy, --prefer-newest, --prioritize, --delete-after or --accounts, which need the move to drain the source")
+	}
+
+	if *viaStaging && (*preferNewest || *follow || *deleteAfter > 0 || *delaySeconds > 0 || *delaySpread != "" || *verifyOrder) {
+		kingpin.Fatalf("--via-staging can't be combined with --prefer-newest, --follow, --delete-after, --delay-seconds, --delay-spread or --verify-order")
+	}
+
+	if *fanout && *hashAttribute != "" {
+		kingpin.Fatalf("--fanout can't be combined with --hash-attribute")
+	}
+
+	if (*fanout || *hashAttribute != "") && len(destinations()) < 2 {
+		kingpin.Fatalf("--fanout and --hash-attribute need several --destination queues")
+	}
+
+	if len(destinations()) > 1 && *viaStaging {
+		kingpin.Fatalf("--via-staging can't be combined with several --destination queues")
+	}
+
+	if *destinationTopic != "" {
+		if topic, err := arn.Parse(*destinationTopic); err != nil || topic.Service != "sns" {
+			kingpin.Fatalf("--destination-topic must be the ARN of an SNS topic, such as arn:aws:sns:eu-west-1:123456789012:orders")
+		}
+	}
+
+	if err := checkSinkDestinations(destinations()); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if *hashAttribute != "" && (*stripAttributes || !keepAttribute(*hashAttribute)) {
+		kingpin.Fatalf("--hash-attribute needs the attribute %s, which --strip-attributes or --message-attribute leave out", *hashAttribute)
+	}
+
+	if *deleteAfter > 0 && (*copyMessages || *preferNewest) {
+		kingpin.Fatalf("--delete-after can't be combined with --copy or --prefer-newest")
+	}
+
+	if len(*messageAttributes) > 0 && *stripAttributes {
+		kingpin.Fatalf("--message-attribute can't be combined with --strip-attributes")
+	}
+
+	if *largePayloadCopy && *largePayloadBucket == "" {
+		kingpin.Fatalf("--large-payload-copy needs --large-payload-bucket, the bucket to copy payloads into")
+	}
+
+	if len(*notifyEmails) > 0 && *notifyEmailFrom == "" {
+		kingpin.Fatalf("--notify-email needs --notify-email-from, the verified SES sender")
+	}
+
+	if *prioritize != "" && (*copyMessages || *preferNewest) {
+		kingpin.Fatalf("--prioritize can't be combined with --copy or --prefer-newest")
+	}
+
+	if *copyMessages && *preferNewest {
+		kingpin.Fatalf("--copy can't be combined with --prefer-newest")
+	}
+
+	skipFailed, failedQueueRef, err = parseOnError(*onError)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	delay, err := parseDelay(*delaySeconds, *delaySpread)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	activeDelay = delay
+
+	if *expireOlderThan != "" {
+		age, err := parseAge(*expireOlderThan)
+		if err != nil {
+			kingpin.Fatalf("--expire-older-than: %s", err)
+		}
+		expireAge = age
+
+		if *aggregateSize > 0 && *expireTo != "" {
+			kingpin.Fatalf("--expire-to can't be combined with --aggregate")
+		}
+	} else if *expireTo != "" {
+		kingpin.Fatalf("--expire-to needs --expire-older-than")
+	}
+
+	if *attachExpiry != "" {
+		lifetime, err := parseAge(*attachExpiry)
+		if err != nil {
+			kingpin.Fatalf("--attach-expiry: %s", err)
+		}
+		expiryLifetime = lifetime
+	}
+
+	if *progressInterval <= 0 {
+		kingpin.Fatalf("--progress-interval must be positive")
+	}
+
+	if *dedupStorePath != "" {
+		if *dedupWindow <= 0 {
+			kingpin.Fatalf("--dedup-window must be positive")
+		}
+
+		store, err := openDedupStore(*dedupStorePath, *dedupWindow, *dedupStoreKey)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		store.copying = *copyMessages
+		activeDedup = store
+	}
+
+	if *dedupeBy != "" {
+		attribute, err := parseDedupeBy(*dedupeBy)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		dedupeAttribute = attribute
+	}
+
+	if *resumeState != "" {
+		if *dedupStorePath != "" || *accountsFile != "" {
+			kingpin.Fatalf("--resume can't be combined with --dedup-store or --accounts")
+		}
+
+		store, err := openDedupStore(*resumeState, maxRetention, *dedupStoreKey)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		store.resume = true
+		store.copying = *copyMessages
+		activeDedup = store
+
+		switch {
+		case store.resumed():
+			log.Info(color.New(color.FgCyan).Sprintf("Resuming a move interrupted %d times, which already moved %d messages in %s", store.prior.Runs, store.prior.Moved, time.Duration(store.prior.ElapsedSeconds*float64(time.Second)).Round(time.Second)))
+		case len(store.moved) > 0:
+			log.Info(color.New(color.FgCyan).Sprintf("Resuming a move that already sent %d messages", len(store.moved)))
+		}
+	}
+
+	filter, err := parseFilter(*filterBody, *filterAttributes, *olderThan, *newerThan)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	activeFilter = filter
+
+	if *sampleShare != "" {
+		share, err := parseSampleShare(*sampleShare)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		activeFilter = activeFilter.withSample(share)
+	}
+
+	for _, expr := range *dropIf {
+		rule, err := parsePredicate(expr)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		dropRules = append(dropRules, rule)
+	}
+
+	if *prioritize != "" {
+		rule, err := parsePredicate(*prioritize)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		priorityRule = &rule
+	}
+
+	if *simulateFrom != "" {
+		if !runSimulation(*simulateFrom) {
+			os.Exit(exitFailed)
+		}
+		return
+	}
+
+	rails, err := loadGuardrails()
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if *moveAudit != "" {
+		if activeAudit, err = openAuditLog(*moveAudit); err != nil {
+			kingpin.Fatalf("unable to open the audit log: %s", err)
+		}
+	}
+
+	if *archivePath != "" {
+		if activeArchive, err = openMessageArchive(*archivePath); err != nil {
+			kingpin.Fatalf("unable to open the archive: %s", err)
+		}
+	}
+
+	if *manifestPath != "" {
+		if activeManifest, err = openMessageManifest(*manifestPath); err != nil {
+			kingpin.Fatalf("unable to create the audit file: %s", err)
+		}
+	}
+
+	if *metricsAddr != "" {
+		if err := startMetrics(*metricsAddr); err != nil {
+			kingpin.Fatalf("unable to serve metrics on %s: %s", *metricsAddr, err)
+		}
+	}
+
+	if *accountsFile != "" {
+		if separateSides() {
+			kingpin.Fatalf("--accounts can't be combined with separate source and destination profiles, regions, roles or endpoints")
+		}
+
+		cfg, err := newConfig(*profile, *region, *endpointURL)
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session for region %s\r\n", *region))
+			os.Exit(exitAuth)
+		}
+
+		if code := sweepAccounts(cfg, *accountsFile, rails); code != 0 {
+			fmt.Println()
+			os.Exit(code)
+		}
+		return
+	}
+
+	sourceSide, destinationSide := sourceSideConfig(), destinationSideConfig()
+
+	sourceCfg, err := newRoleConfig(sourceSide.profile, sourceSide.region, sourceSide.endpoint, sourceSide.role)
+
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session for region %s\r\n", sourceSide.region))
+		os.Exit(exitAuth)
+	}
+
+	destinationCfg := sourceCfg
+	if destinationSide != sourceSide {
+		destinationCfg, err = newRoleConfig(destinationSide.profile, destinationSide.region, destinationSide.endpoint, destinationSide.role)
+
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to create AWS session for region %s\r\n", destinationSide.region))
+			os.Exit(exitAuth)
+		}
+	}
+
+	if isQueuePattern(*sourceQueue) {
+		if code := runPatternMoves(sqs.NewFromConfig(sourceCfg), sqs.NewFromConfig(destinationCfg), rails); code != 0 {
+			fmt.Println()
+			os.Exit(code)
+		}
+		return
+	}
+
+	summary := runMove(sqs.NewFromConfig(sourceCfg), sqs.NewFromConfig(destinationCfg), rails)
+	logFinalSummary(summary)
+	if summary.Status != "" {
+		notifyWebhooks(summary)
+		notifyEmail(summary)
+	}
+	emitSummary(summary)
+
+	if code := summary.exitStatus(); code != 0 {
+		fmt.Println()
+		os.Exit(code)
+	}
+}
+
+// sideConfig is where one side of a move is reached.
+type sideConfig struct {
+	profile  string
+	region   string
+	endpoint string
+	role     assumedRole
+}
+
+func sourceSideConfig() sideConfig {
+	return sideConfig{profile: orDefault(*sourceProfile, *profile), region: orDefault(*sourceRegion, *region), endpoint: sideEndpoint(*sourceEndpoint, orDefault(*sourceQueue, *redrive)), role: sourceRole()}
+}
+
+func destinationSideConfig() sideConfig {
+	return sideConfig{profile: orDefault(*destinationProfile, *profile), region: orDefault(*destinationRegion, *region), endpoint: sideEndpoint(*destinationEndpoint, orDefault(firstDestination(), *redrive)), role: destinationRole()}
+}
+
+// separateSides reports whether a flag reaches the source or the destination
+// apart from the other side.
+func separateSides() bool {
+	return *sourceProfile != "" || *sourceRegion != "" || *destinationProfile != "" || *destinationRegion != "" ||
+		*sourceEndpoint != "" || *destinationEndpoint != "" ||
+		*sourceRoleArn != "" || *sourceExtID != "" || *sourceMFA != "" ||
+		*destinationRoleArn != "" || *destinationExtID != "" || *destinationMFA != ""
+}
+
+// newConfig creates a config that assumes the role given with --role-arn, if
+// any, as newRoleConfig does.
+func newConfig(profile string, region string, endpoint string) (aws.Config, error) {
+	return newRoleConfig(profile, region, endpoint, globalRole())
+}
+
+// newRoleConfig creates a config whose credentials are renewed before they
+// expire. Profiles that assume an MFA protected role prompt for a code each
+// time the role is assumed. A role with an ARN is then assumed with the
+// profile's credentials. A non-empty endpoint replaces the AWS endpoints,
+// for example to reach LocalStack, and makes do with placeholder credentials
+// when none are configured.
+func newRoleConfig(profile string, region string, endpoint string, role assumedRole) (aws.Config, error) {
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+		config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}),
+		config.WithCredentialsCacheOptions(refreshEarly),
+	}
+
+	// The SDK refuses a profile missing from the shared files, which the
+	// default one may be when credentials come from the environment.
+	if profile != "default" {
+		options = append(options, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(runCtx, options...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if endpoint != "" {
+		cfg.BaseEndpoint = aws.String(endpoint)
+		useEmulatorCredentials(&cfg)
+	}
+
+	if *verbose || *debug {
+		traceRequests(&cfg)
+	}
+
+	if *readOnly {
+		guardReadOnly(&cfg)
+	}
+
+	if role.arn != "" {
+		cfg = role.assume(cfg)
+	}
+
+	return keepCredentialsAlive(cfg), nil
+}
+
+// orDefault returns value, or fallback when value is empty.
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// runMove resolves both queues, runs the pre-move checks and moves the
+// messages. The clients may be the same, or belong to different accounts or
+// regions. The summary has an empty status when there was nothing to move.
+func runMove(sourceSvc *sqs.Client, destinationSvc *sqs.Client, rails []guardrails) (summary runSummary) {
+	summary = runSummary{RunID: runID, StartedAt: time.Now().UTC()}
+	stampOperator(sourceSvc, &summary)
+
+	failAs := func(code int, message string, err error) runSummary {
+		logAwsError(message, err)
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf("%s: %s", message, err)
+		summary.FinishedAt = time.Now().UTC()
+		summary.exitCode = failureCode(err, code)
+		summary.StopReason = orDefault(summary.StopReason, setupStopReason(summary.exitCode))
+		return summary
+	}
+
+	fail := func(message string, err error) runSummary {
+		return failAs(exitFailed, message, err)
+	}
+
+	// A move the audit log saw start is recorded as finished however it
+	// ends, after a panic below was turned into a failure.
+	var audited bool
+	defer func() {
+		if audited {
+			activeAudit.record(moveAuditRecord(auditFinish, summary, summary.Error))
+		}
+	}()
+
+	// A panic ends the move as a failure, so the summary, webhooks and exit
+	// status still report it. Messages in flight were released on the way.
+	defer func() {
+		if v := recover(); v != nil {
+			restoreTerminal()
+			err := panicError(v)
+			summary.StopReason = stopPanic
+			summary = fail("Move stopped by an unexpected error", err)
+			log.Debug(string(err.Stack))
+		}
+	}()
+
+	sourceRef, destinationRefs := *sourceQueue, destinations()
+	if *redrive != "" {
+		var destinationRef string
+		var err error
+		sourceRef, destinationRef, err = redrivePair(sourceSvc, *redrive, *toDeadLetter)
+		if err != nil {
+			return failAs(exitQueue, "Failed to find the queues to redrive", err)
+		}
+		destinationRefs = []string{destinationRef}
+	}
+
+	sourceQueueURL, err := resolveQueueURL(sourceSvc, sourceRef)
+
+	if err != nil {
+		return failAs(exitQueue, "Failed to resolve source queue", err)
+	}
+
+	summary.Source = sourceQueueURL
+	log.Info(color.New(color.FgCyan).Sprintf("Source queue URL: %s", sourceQueueURL))
+	emitEvent("queue_resolved", map[string]string{"side": "source", "queue": sourceRef, "url": sourceQueueURL})
+
+	activeSink = nil
+	destinationURLs := make([]string, 0, len(destinationRefs))
+	for _, destinationRef := range destinationRefs {
+		if isSinkDestination(destinationRef) {
+			sink, err := openDestinationSink(destinationSvc, destinationRef)
+			if err != nil {
+				return failAs(exitUsage, "Failed to open the destination sink", err)
+			}
+			defer sink.close()
+
+			activeSink = sink
+			log.Info(color.New(color.FgCyan).Sprintf("Destination sink: %s", destinationRef))
+			emitEvent("queue_resolved", map[string]string{"side": "destination", "queue": destinationRef, "url": destinationRef})
+			destinationURLs = append(destinationURLs, destinationRef)
+			continue
+		}
+
+		destinationQueueURL, err := resolveQueueURL(destinationSvc, destinationRef)
+
+		if err != nil {
+			return failAs(exitQueue, "Failed to resolve destination queue", err)
+		}
+
+		log.Info(color.New(color.FgCyan).Sprintf("Destination queue URL: %s", destinationQueueURL))
+		emitEvent("queue_resolved", map[string]string{"side": "destination", "queue": destinationRef, "url": destinationQueueURL})
+		destinationURLs = append(destinationURLs, destinationQueueURL)
+	}
+
+	// The first destination stands for all of them in the summary, metrics
+	// and progress events.
+	destinationQueueURL := destinationURLs[0]
+	summary.Destination = destinationQueueURL
+
+	if len(destinationURLs) > 1 {
+		for i, queueURL := range destinationURLs {
+			if sameQueue(sourceQueueURL, queueURL) {
+				return failAs(exitUsage, "Refusing to move a queue into itself", fmt.Errorf("%s is both the source and one of the destinations", queueNameFromURL(queueURL)))
+			}
+
+			if isFifoQueue(queueURL) != isFifoQueue(destinationQueueURL) {
+				return failAs(exitUsage, "Unable to spread messages over the destinations", fmt.Errorf("some destinations are FIFO queues and others aren't"))
+			}
+
+			for _, earlier := range destinationURLs[:i] {
+				if sameQueue(earlier, queueURL) {
+					return failAs(exitUsage, "Unable to spread messages over the destinations", fmt.Errorf("%s is given more than once", queueNameFromURL(queueURL)))
+				}
+			}
+		}
+	}
+
+	requeueSince = time.Time{}
+	if sameQueue(sourceQueueURL, destinationQueueURL) {
+		if !*allowSameQueue {
+			return failAs(exitUsage, "Refusing to move a queue into itself", fmt.Errorf("source and destination are both %s; pass --allow-same-queue to requeue its messages on purpose", queueNameFromURL(sourceQueueURL)))
+		}
+
+		if *copyMessages {
+			return fail("Unable to copy messages", fmt.Errorf("copying a queue into itself would never end"))
+		}
+
+		if *preferNewest {
+			return failAs(exitUsage, "Unable to requeue messages", fmt.Errorf("--prefer-newest can't requeue a queue into itself"))
+		}
+
+		// Messages sent back before the move started are the ones to take.
+		requeueSince = summary.StartedAt
+		log.Warn(color.New(color.FgYellow).Sprintf("Requeueing %s into itself. Messages sent back during the run are left alone", queueNameFromURL(sourceQueueURL)))
+	}
+
+	// References such as tf: and cfn: only reveal the queue they point at
+	// once resolved, so the policy is checked again against the real names.
+	for _, queueURL := range destinationURLs {
+		// Policies match a sink by its whole URL.
+		destinationName := queueNameFromURL(queueURL)
+		if activeSink != nil {
+			destinationName = queueURL
+		}
+
+		resolved := invocation{command: activeCommand, source: queueNameFromURL(sourceQueueURL), destination: destinationName}
+		for _, p := range activePolicies {
+			if err := p.allow(resolved); err != nil {
+				summary.StopReason = stopPolicy
+				return fail("Move blocked by policy", err)
+			}
+		}
+
+		for _, g := range rails {
+			if err := g.check(sourceQueueURL, queueURL); err != nil {
+				summary.StopReason = stopGuardrail
+				return fail("Move blocked by guardrail", err)
+			}
+		}
+
+		if activeSink != nil {
+			continue
+		}
+
+		if err := checkDestinationExists(destinationSvc, queueURL); err != nil {
+			return failAs(exitQueue, "Destination queue is unavailable", err)
+		}
+	}
+
+	activeRouter = nil
+	if len(destinationURLs) > 1 {
+		activeRouter = &destinationRouter{queueURLs: destinationURLs, attribute: *hashAttribute, fanout: *fanout}
+
+		switch {
+		case *fanout:
+			log.Info(color.New(color.FgCyan).Sprintf("Sending every message to all %d destinations", len(destinationURLs)))
+		case *hashAttribute != "":
+			log.Info(color.New(color.FgCyan).Sprintf("Spreading messages over %d destinations by their %s attribute", len(destinationURLs), *hashAttribute))
+		default:
+			log.Info(color.New(color.FgCyan).Sprintf("Spreading messages over %d destinations round-robin", len(destinationURLs)))
+		}
+	}
+
+	expireQueueURL = ""
+	if *expireTo != "" {
+		expireQueueURL, err = resolveQueueURL(destinationSvc, *expireTo)
+		if err != nil {
+			return failAs(exitQueue, "Failed to resolve the quarantine queue", err)
+		}
+
+		if err := allowDestination(expireQueueURL); err != nil {
+			summary.StopReason = stopPolicy
+			return fail("Quarantine queue blocked by policy", err)
+		}
+
+		if isFifoQueue(expireQueueURL) {
+			return fail("Unable to quarantine expired messages", fmt.Errorf("%s is a FIFO queue, expired messages can only be sent to a standard queue", queueNameFromURL(expireQueueURL)))
+		}
+	}
+
+	failedQueueURL = ""
+	if failedQueueRef != "" {
+		failedQueueURL, err = resolveQueueURL(destinationSvc, failedQueueRef)
+		if err != nil {
+			return failAs(exitQueue, "Failed to resolve the --on-error queue", err)
+		}
+
+		if err := allowDestination(failedQueueURL); err != nil {
+			summary.StopReason = stopPolicy
+			return fail("--on-error queue blocked by policy", err)
+		}
+
+		if isFifoQueue(failedQueueURL) {
+			return fail("Unable to set aside failed messages", fmt.Errorf("%s is a FIFO queue, failed messages can only be sent to a standard queue", queueNameFromURL(failedQueueURL)))
+		}
+	}
+	activeRejections = &rejections{}
+	activeLatencies = newLatencies()
+	activeReceives = &receiveCounts{}
+
+	activeCollapse = nil
+	if *dedupeBy != "" {
+		activeCollapse = newRunCollapse(dedupeAttribute)
+	}
+
+	activeOrder = nil
+
+	activeBounces = nil
+	if *bounceLimit > 0 {
+		activeBounces = newBounceCheck(*bounceLimit)
+	}
+
+	activeIdleExit = nil
+	if *idleExitAfter > 0 {
+		activeIdleExit = &idleExit{after: *idleExitAfter}
+	}
+
+	activeProgress = nil
+	if *progressQueue != "" {
+		progressQueueURL, err := resolveQueueURL(destinationSvc, *progressQueue)
+		if err != nil {
+			return failAs(exitQueue, "Failed to resolve progress queue", err)
+		}
+
+		if err := allowDestination(progressQueueURL); err != nil {
+			summary.StopReason = stopPolicy
+			return fail("Progress queue blocked by policy", err)
+		}
+		activeProgress = newProgressPublisher(destinationSvc, progressQueueURL, *progressInterval)
+	}
+
+	fifo, err := setupFifo(destinationSvc, sourceQueueURL, destinationQueueURL, *messageGroupID)
+	if err != nil {
+		return fail("Unable to move into the FIFO queue", err)
+	}
+	fifo.requeue = !requeueSince.IsZero()
+	activeFifo = fifo
+
+	if *verifyOrder {
+		if !fifo.source || !fifo.destination {
+			return failAs(exitUsage, "Unable to verify the order of the messages", fmt.Errorf("--verify-order needs a FIFO source and FIFO destinations"))
+		}
+		activeOrder = newOrderCheck()
+	}
+
+	if fifo.destination && activeDelay != nil {
+		return fail("Unable to delay messages", fmt.Errorf("FIFO queues only support a delay for the whole queue, set with its DelaySeconds attribute"))
+	}
+
+	if fifo.source && *preferNewest {
+		return fail("Unable to move newest first", fmt.Errorf("--prefer-newest would hold back whole message groups of a FIFO source"))
+	}
+
+	if *enrichDynamo != "" {
+		enricher, err := newDynamoEnricher(siblingConfig(destinationSvc), *enrichDynamo, *enrichFields)
+		if err != nil {
+			return fail("Failed to set up enrichment", err)
+		}
+		activeEnricher = enricher
+	}
+
+	if *largePayloadBucket != "" {
+		activeLargePayloads = newLargePayloads(siblingConfig(destinationSvc), *largePayloadBucket, *largePayloadCopy)
+	}
+
+	queueAttributes, err := sourceSvc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(sourceQueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+
+	if err != nil {
+		return fail("Failed to get source queue attributes", err)
+	}
+
+	summary.Queues = snapshotQueues(destinationSvc, sourceQueueURL, queueAttributes.Attributes, destinationURLs)
+
+	numberOfMessages, _ := strconv.Atoi(queueAttributes.Attributes["ApproximateNumberOfMessages"])
+
+	log.Info(color.New(color.FgCyan).Sprintf("Approximate number of messages in the source queue: %s",
+		queueAttributes.Attributes["ApproximateNumberOfMessages"]))
+
+	if numberOfMessages == 0 && !*follow {
+		log.Info("Looks like nothing to move. Done.")
+		summary.StopReason = stopEmpty
+		return summary
+	}
+
+	if *limitPercent > 0 {
+		*limit = shareOf(numberOfMessages, *limitPercent)
+		log.Info(color.New(color.FgCyan).Sprintf("Moving %g%% of the source queue: %d messages", *limitPercent, *limit))
+	}
+
+	if *limit > 0 && *limitPercent == 0 && activeDedup != nil && activeDedup.resumed() {
+		*limit = activeDedup.remaining(*limit)
+		if *limit <= 0 {
+			log.Info("The earlier runs of the move took its --limit of messages already. Done.")
+			summary.Status, summary.StopReason, summary.FinishedAt = "completed", stopLimit, time.Now().UTC()
+			activeDedup.finishResume(true, &summary)
+			return summary
+		}
+		log.Info(color.New(color.FgCyan).Sprintf("Moving the %d messages left of --limit", *limit))
+	}
+
+	if *sampleCount > 0 {
+		activeFilter = activeFilter.withSample(sampleCountShare(*sampleCount, numberOfMessages))
+		*limit = *sampleCount
+		log.Info(color.New(color.FgCyan).Sprintf("Moving about %d messages picked at random, %.3g%% of the source queue", min(*sampleCount, numberOfMessages), activeFilter.sample*100))
+	}
+
+	if *limit > 0 && numberOfMessages > *limit {
+		numberOfMessages = *limit
+	}
+
+	if *preflight {
+		if err := runPreflight(sourceSvc, destinationSvc, sourceQueueURL, queueAttributes.Attributes, destinationURLs); err != nil {
+			return failAs(exitAuth, "Preflight checks failed", err)
+		}
+	}
+
+	if *scanPII || crossAccount(sourceQueueURL, destinationURLs) {
+		if !checkPII(sourceSvc, sourceQueueURL, *piiSample, redactRules, *acknowledgePII, "move") {
+			summary.Status = "failed"
+			summary.Error = "PII scan did not pass"
+			summary.StopReason = stopPIIScan
+			summary.FinishedAt = time.Now().UTC()
+			return summary
+		}
+	}
+
+	if *safeMode {
+		if err := confirmMove(sourceQueueURL, destinationQueueURL, numberOfMessages); err != nil {
+			summary.StopReason = stopNotConfirmed
+			activeAudit.record(moveAuditRecord(auditRefused, summary, err.Error()))
+			return failAs(exitUsage, "Move not confirmed", err)
+		}
+	}
+
+	activeAudit.record(moveAuditRecord(auditStart, summary, ""))
+	audited = true
+
+	if *toCloudEvents {
+		source := *ceSource
+		if source == "" {
+			source = queueArnFromURL(sourceQueueURL)
+		}
+		if source == "" {
+			source = sourceQueueURL
+		}
+
+		mapping, err := newCloudEventsMapping(*ceType, source)
+		if err != nil {
+			return fail("Invalid CloudEvents mapping", err)
+		}
+		wrapCloudEvents = mapping
+	}
+
+	if *aggregateSize > 0 {
+		activeAggregator = &aggregator{size: *aggregateSize, envelope: *envelopeKey}
+	}
+
+	// Depths are compared for the summary when both queues can be read. A
+	// sink has no depth.
+	var depths *depthReport
+	if activeSink == nil {
+		depths = &depthReport{destinations: destinationURLs}
+		if depths.SourceBefore, err = totalDepth(sourceSvc, sourceQueueURL); err == nil {
+			depths.DestinationBefore, err = depths.destinationDepth(destinationSvc)
+		}
+		if err != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Unable to read queue depths, the summary won't compare them: %s", err))
+			depths = nil
+		}
+	}
+
+	useServerSide := false
+	if *serverSide {
+		reason, err := serverSideBlocker(sourceSvc, sourceQueueURL, destinationQueueURL)
+		if err != nil {
+			return fail("Failed to check whether SQS can move the messages", err)
+		}
+
+		if reason != "" {
+			log.Warn(color.New(color.FgYellow).Sprintf("Moving the messages client-side, since %s", reason))
+		}
+		useServerSide = reason == ""
+	}
+
+	var completed bool
+	switch {
+	case useServerSide:
+		completed = moveServerSide(sourceSvc, sourceQueueURL, destinationQueueURL, numberOfMessages, &summary)
+	case *viaStaging:
+		completed = moveViaStaging(sourceQueueURL, destinationQueueURL, sourceSvc, destinationSvc, numberOfMessages, &summary)
+	case *preferNewest:
+		completed = moveNewestFirst(sourceQueueURL, destinationQueueURL, sourceSvc, destinationSvc, numberOfMessages, *newestSlice, *limit, &summary)
+	default:
+		completed = moveMessages(sourceQueueURL, destinationQueueURL, sourceSvc, destinationSvc, numberOfMessages, *workers, *limit, &summary)
+	}
+
+	summary.FinishedAt = time.Now().UTC()
+	summary.Status = "completed"
+	if !completed {
+		summary.Status = "failed"
+	}
+	summary.StopReason = orDefault(summary.StopReason, finishStopReason(completed))
+
+	activeRejections.log()
+	summary.Rejected = activeRejections.list()
+
+	activeLatencies.log()
+	summary.Latencies = activeLatencies.report()
+
+	activeReceives.log()
+	summary.Receives = activeReceives.report()
+	summary.Duplicates = activeCollapse.collapsed()
+	summary.Bounced = activeBounces.count()
+	if summary.Bounced > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("%d moved messages came back to the source and were left there", summary.Bounced))
+	}
+
+	if activeOrder != nil {
+		summary.Ordering = activeOrder.report()
+		summary.Ordering.log()
+	}
+
+	if activeDedup != nil {
+		activeDedup.finishResume(completed, &summary)
+	}
+
+	if depths != nil {
+		if err := depths.finish(sourceSvc, destinationSvc, &summary); err != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Unable to read queue depths after the move: %s", err))
+		} else {
+			depths.log()
+			summary.Depths = depths
+		}
+	}
+
+	return summary
+}
+
+// shareOf returns percent of n messages, rounded up so a share of a queue
+// that isn't empty is at least one message.
+func shareOf(n int, percent float64) int {
+	return int(math.Ceil(float64(n) * percent / 100))
+}
+
+func notifyWebhooks(summary runSummary) {
+	for _, url := range *webhookURLs {
+		if err := postWebhook(url, *webhookSecret, summary); err != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Failed to notify webhook: %s", err))
+		}
+	}
+}
+
+// checkPII samples up to sample messages of the source queue, masked by
+// rules, and reports whether the action, "move" or "dump", may go ahead.
+// Likely PII stops it unless acknowledged is set.
+func checkPII(svc *sqs.Client, sourceQueueURL string, sample int, rules []redactRule, acknowledged bool, action string) bool {
+	log.Info(color.New(color.FgCyan).Sprintf("Scanning up to %d messages for PII...", sample))
+
+	findings, err := scanForPII(svc, sourceQueueURL, sample, rules)
+
+	if err != nil {
+		logAwsError("Failed to sample messages for PII", err)
+		return false
+	}
+
+	if !findings.found() {
+		log.Info(color.New(color.FgCyan).Sprintf("No likely PII found in %d sampled messages", findings.sampled))
+		return true
+	}
+
+	for _, kind := range findings.kinds() {
+		log.Warn(color.New(color.FgYellow).Sprintf("Likely %s found in %d of %d sampled messages", kind, findings.matches[kind], findings.sampled))
+	}
+
+	if acknowledged {
+		log.Warn(color.New(color.FgYellow).Sprintf("Proceeding because --acknowledge-pii was given"))
+		return true
+	}
+
+	log.Error(color.New(color.FgRed).Sprintf("Refusing to %s messages that look like they contain PII. Redact the fields with --redact or pass --acknowledge-pii to proceed", action))
+	return false
+}
+
+func logAwsError(message string, err error) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		log.Error(color.New(color.FgRed).Sprintf("%s. Error: %s", message, apiErr.ErrorMessage()))
+	} else {
+		log.Error(color.New(color.FgRed).Sprintf("%s. Error: %s", message, err.Error()))
 	}
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// manifestColumns are the fields of a manifest row, in the order of the CSV
+// columns.
+var manifestColumns = []string{
+	"run_id", "batch", "moved_at", "source", "source_message_id", "source_md5", "sent_at",
+	"receive_count", "destination", "destination_message_id", "destination_md5",
+}
+
+// manifestRow is a message the move sent, as the manifest records it.
+type manifestRow struct {
+	RunID                string `json:"run_id"`
+	Batch                int64  `json:"batch"`
+	MovedAt              string `json:"moved_at"`
+	Source               string `json:"source"`
+	SourceMessageID      string `json:"source_message_id"`
+	SourceMD5            string `json:"source_md5"`
+	SentAt               string `json:"sent_at,omitempty"`
+	ReceiveCount         string `json:"receive_count,omitempty"`
+	Destination          string `json:"destination"`
+	DestinationMessageID string `json:"destination_message_id"`
+	DestinationMD5       string `json:"destination_md5"`
+}
+
+func (r manifestRow) values() []string {
+	return []string{
+		r.RunID, strconv.FormatInt(r.Batch, 10), r.MovedAt, r.Source, r.SourceMessageID, r.SourceMD5, r.SentAt,
+		r.ReceiveCount, r.Destination, r.DestinationMessageID, r.DestinationMD5,
+	}
+}
+
+// messageManifest writes a row to --audit-file for every message a move
+// sent, pairing the source message with the one it became in the
+// destination, so an incident review can tell exactly which messages were
+// moved and when. It follows the move through mover.Options.Events: the
+// source messages of received batches are kept until they are deleted, and
+// sent entries are matched to them by their IDs.
+type messageManifest struct {
+	mu      sync.Mutex
+	file    *os.File
+	csv     *csv.Writer
+	pending map[string]receivedMessage
+	batches int64
+	failed  bool
+}
+
+// receivedMessage is a source message waiting to be sent, with its queue.
+type receivedMessage struct {
+	queueURL string
+	message  *types.Message
+}
+
+var activeManifest *messageManifest
+
+// openMessageManifest creates path, as CSV when it ends in .csv and as JSON
+// lines otherwise. A manifest is evidence, so an existing file is never
+// overwritten.
+func openMessageManifest(path string) (*messageManifest, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &messageManifest{file: file, pending: map[string]receivedMessage{}}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		m.csv = csv.NewWriter(file)
+		if err := m.csv.Write(manifestColumns); err != nil {
+			return nil, err
+		}
+		m.csv.Flush()
+		return m, m.csv.Error()
+	}
+
+	return m, nil
+}
+
+// event records a batch, as mover.Options.Events.
+func (m *messageManifest) event(event mover.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch e := event.(type) {
+	case *mover.BatchReceived:
+		for _, message := range e.Messages {
+			m.pending[aws.ToString(message.MessageId)] = receivedMessage{queueURL: e.QueueURL, message: message}
+		}
+	case *mover.BatchDeleted:
+		for _, message := range e.Messages {
+			delete(m.pending, aws.ToString(message.MessageId))
+		}
+	case *mover.BatchSent:
+		m.batches++
+		m.sent(e)
+	}
+}
+
+// sent writes the rows of a sent batch.
+func (m *messageManifest) sent(batch *mover.BatchSent) {
+	movedAt := time.Now().UTC().Format(time.RFC3339Nano)
+
+	for i, entry := range batch.Entries {
+		row := manifestRow{
+			RunID:           runID,
+			Batch:           m.batches,
+			MovedAt:         movedAt,
+			SourceMessageID: aws.ToString(entry.Id),
+			Destination:     batch.QueueURL,
+			DestinationMD5:  md5Hex(aws.ToString(entry.MessageBody)),
+		}
+
+		if i < len(batch.MessageIDs) {
+			row.DestinationMessageID = batch.MessageIDs[i]
+		}
+
+		if received, ok := m.origin(aws.ToString(entry.Id)); ok {
+			message := received.message
+			row.Source = received.queueURL
+			row.SourceMessageID = aws.ToString(message.MessageId)
+			row.SourceMD5 = aws.ToString(message.MD5OfBody)
+			row.ReceiveCount = message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]
+			if sent := sentTimestamp(message); !sent.IsZero() {
+				row.SentAt = sent.UTC().Format(time.RFC3339Nano)
+			}
+		}
+
+		m.write(row)
+	}
+
+	if m.csv != nil {
+		m.csv.Flush()
+		m.check(m.csv.Error())
+	}
+}
+
+// origin finds the source message of an entry by its ID: the message ID, or
+// ID-N for every entry --explode-jsonpath made of it.
+func (m *messageManifest) origin(id string) (receivedMessage, bool) {
+	if received, ok := m.pending[id]; ok {
+		return received, true
+	}
+
+	if i := strings.LastIndex(id, "-"); i > 0 {
+		received, ok := m.pending[id[:i]]
+		return received, ok
+	}
+
+	return receivedMessage{}, false
+}
+
+func (m *messageManifest) write(row manifestRow) {
+	if m.csv != nil {
+		m.check(m.csv.Write(row.values()))
+		return
+	}
+
+	line, err := json.Marshal(row)
+	if err == nil {
+		_, err = m.file.Write(append(line, '\n'))
+	}
+	m.check(err)
+}
+
+// check logs the first error writing the manifest. The move goes on, as it
+// does when the audit log can't be written.
+func (m *messageManifest) check(err error) {
+	if err == nil || m.failed {
+		return
+	}
+
+	m.failed = true
+	log.Warn(color.New(color.FgYellow).Sprintf("Failed to write the manifest, it misses messages from here on: %s", err))
+}
+
+// md5Hex is the MD5 digest of body as SQS reports it for a sent message.
+func md5Hex(body string) string {
+	sum := md5.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
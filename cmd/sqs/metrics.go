@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// metricsRateWindow is how far back the current rate looks, so it follows
+// throttling and slow consumers rather than the average of the whole run.
+const metricsRateWindow = time.Minute
+
+// metricsSample is how many messages were done at a point in time.
+type metricsSample struct {
+	at   time.Time
+	done int
+}
+
+// moveMetrics serves the progress of the moves of a run in the Prometheus
+// text format. Counters add up over the moves of a run, such as the accounts
+// of a sweep or the steps of a swap, so they never go down.
+type moveMetrics struct {
+	mu sync.Mutex
+
+	mover       *mover.Mover
+	source      string
+	destination string
+	started     time.Time
+	expected    int
+
+	// base holds the totals of the moves that finished, and current those of
+	// the running one.
+	base    mover.Result
+	current mover.Result
+	retries int
+
+	// baseLatencies holds the latencies of the moves that finished, and
+	// latencies those of the running one.
+	baseLatencies *latencies
+	latencies     *latencies
+
+	samples []metricsSample
+}
+
+// activeMetrics is set up by --metrics-addr.
+var activeMetrics *moveMetrics
+
+// startMetrics listens on addr and serves /metrics for the rest of the run.
+func startMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	activeMetrics = &moveMetrics{baseLatencies: newLatencies()}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", activeMetrics)
+	go http.Serve(listener, mux)
+
+	log.Info(color.New(color.FgCyan).Sprintf("Serving metrics on http://%s/metrics", listener.Addr()))
+	return nil
+}
+
+// begin starts counting a move of about expected messages made with m.
+func (mm *moveMetrics) begin(m *mover.Mover, sourceQueueURL string, destinationQueueURL string, expected int) {
+	if mm == nil {
+		return
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.mover != nil {
+		mm.retries += mm.mover.Retries()
+	}
+	addTotals(&mm.base, mm.current)
+	if mm.latencies != activeLatencies {
+		mm.baseLatencies.merge(mm.latencies)
+		mm.latencies = activeLatencies
+	}
+
+	mm.mover = m
+	mm.source = queueNameFromURL(sourceQueueURL)
+	mm.destination = queueNameFromURL(destinationQueueURL)
+	mm.started = time.Now()
+	mm.expected = expected
+	mm.current = mover.Result{}
+	mm.samples = []metricsSample{{at: mm.started}}
+}
+
+// update records the totals of the running move.
+func (mm *moveMetrics) update(total mover.Result) {
+	if mm == nil {
+		return
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.current = total
+	mm.samples = addSample(mm.samples, total.Moved+total.Dropped+total.Skipped)
+}
+
+// addSample records how many messages are done now, and drops the samples
+// that fell out of the rate window.
+func addSample(samples []metricsSample, done int) []metricsSample {
+	now := time.Now()
+	samples = append(samples, metricsSample{at: now, done: done})
+
+	// Keep the last sample older than the window, so the rate spans all of
+	// it.
+	for len(samples) > 2 && now.Sub(samples[1].at) > metricsRateWindow {
+		samples = samples[1:]
+	}
+
+	return samples
+}
+
+// sampleRate returns the messages done per second over the samples.
+func sampleRate(samples []metricsSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(last.done-first.done) / elapsed
+}
+
+func (mm *moveMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	total := mm.base
+	addTotals(&total, mm.current)
+
+	retries, inFlight := mm.retries, 0
+	if mm.mover != nil {
+		retries += mm.mover.Retries()
+		inFlight = mm.mover.InFlight()
+	}
+
+	labels := fmt.Sprintf(`run_id=%q,source=%q,destination=%q`, runID, mm.source, mm.destination)
+
+	var b strings.Builder
+	metric := func(name string, kind string, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s{%s} %g\n", name, help, name, kind, name, labels, value)
+	}
+
+	metric("sqsmover_messages_moved_total", "counter", "Source messages sent to the destination and deleted.", float64(total.Moved))
+	metric("sqsmover_messages_sent_total", "counter", "Messages sent to the destination.", float64(total.Sent))
+	metric("sqsmover_messages_dropped_total", "counter", "Source messages deleted without being sent to the destination.", float64(total.Dropped))
+	metric("sqsmover_messages_skipped_total", "counter", "Messages the filter left in the source.", float64(total.Skipped))
+	metric("sqsmover_messages_failed_total", "counter", "Messages whose batch couldn't be sent or deleted.", float64(total.Failed))
+	metric("sqsmover_received_bytes_total", "counter", "Bytes of bodies and message attributes received from the source.", float64(total.ReceivedBytes))
+	metric("sqsmover_sent_bytes_total", "counter", "Bytes of bodies and message attributes the destination accepted.", float64(total.SentBytes))
+	metric("sqsmover_payload_chunks_total", "counter", "64 KB chunks SQS bills the receives that returned messages and the sends as.", float64(total.PayloadChunks))
+	metric("sqsmover_retries_total", "counter", "Calls repeated after throttling, server errors or failed batch entries.", float64(retries))
+	metric("sqsmover_messages_in_flight", "gauge", "Received messages whose batch is still being moved.", float64(inFlight))
+
+	if mm.mover != nil {
+		done := mm.current.Moved + mm.current.Dropped + mm.current.Skipped
+		rate := sampleRate(mm.samples)
+
+		metric("sqsmover_messages_expected", "gauge", "Approximate number of messages in the source when the move started.", float64(mm.expected))
+		metric("sqsmover_rate_messages_per_second", "gauge", "Messages done per second over the last minute.", rate)
+		metric("sqsmover_start_time_seconds", "gauge", "Start of the running move since the Unix epoch.", float64(mm.started.Unix()))
+
+		if rate > 0 && done < mm.expected {
+			metric("sqsmover_eta_seconds", "gauge", "Seconds until the messages expected are done at the current rate.", float64(mm.expected-done)/rate)
+		}
+	}
+
+	latencies := newLatencies()
+	latencies.merge(mm.baseLatencies)
+	latencies.merge(mm.latencies)
+	latencies.writeMetrics(&b, labels)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
+
+// addTotals adds the counts of other to total.
+func addTotals(total *mover.Result, other mover.Result) {
+	total.Moved += other.Moved
+	total.Sent += other.Sent
+	total.Dropped += other.Dropped
+	total.Skipped += other.Skipped
+	total.Failed += other.Failed
+	total.ReceivedBytes += other.ReceivedBytes
+	total.SentBytes += other.SentBytes
+	total.PayloadChunks += other.PayloadChunks
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// migratedAttributes are copied from the standard source queue onto the FIFO
+// queue created for it.
+var migratedAttributes = []types.QueueAttributeName{
+	types.QueueAttributeNameVisibilityTimeout,
+	types.QueueAttributeNameMessageRetentionPeriod,
+	types.QueueAttributeNameDelaySeconds,
+	types.QueueAttributeNameMaximumMessageSize,
+	types.QueueAttributeNameReceiveMessageWaitTimeSeconds,
+}
+
+// fifoMigration holds the choices made for migrate-to-fifo.
+type fifoMigration struct {
+	source      string
+	destination string
+	groupID     string
+	dedup       string
+}
+
+// runMigrateToFifo creates a FIFO copy of a standard queue, moves the messages
+// into it and checks that they all arrived.
+func runMigrateToFifo(svc *sqs.Client, m fifoMigration, rails []guardrails) runSummary {
+	summary := runSummary{RunID: runID, StartedAt: time.Now().UTC()}
+	stampOperator(svc, &summary)
+
+	failAs := func(code int, message string, err error) runSummary {
+		logAwsError(message, err)
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf("%s: %s", message, err)
+		summary.FinishedAt = time.Now().UTC()
+		summary.exitCode = failureCode(err, code)
+		summary.StopReason = orDefault(summary.StopReason, setupStopReason(summary.exitCode))
+		return summary
+	}
+
+	fail := func(message string, err error) runSummary {
+		return failAs(exitFailed, message, err)
+	}
+
+	sourceQueueURL, err := resolveQueueURL(svc, m.source)
+	if err != nil {
+		return failAs(exitQueue, "Failed to resolve source queue", err)
+	}
+
+	summary.Source = sourceQueueURL
+
+	if isFifoQueue(sourceQueueURL) {
+		return fail("Unable to migrate", fmt.Errorf("%s is already a FIFO queue", sourceQueueURL))
+	}
+
+	if m.destination == "" {
+		m.destination = queueNameFromURL(sourceQueueURL) + ".fifo"
+	}
+
+	if !strings.HasSuffix(m.destination, ".fifo") {
+		return fail("Unable to migrate", fmt.Errorf("FIFO queue names must end in .fifo, got %q", m.destination))
+	}
+
+	if err := m.choose(); err != nil {
+		return fail("Unable to migrate", err)
+	}
+
+	resolved := invocation{command: migrateCommand.FullCommand(), source: queueNameFromURL(sourceQueueURL), destination: m.destination}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			summary.StopReason = stopPolicy
+			return fail("Migration blocked by policy", err)
+		}
+	}
+
+	sourceAttributes, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(sourceQueueURL),
+		AttributeNames: append([]types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages}, migratedAttributes...),
+	})
+	if err != nil {
+		return fail("Failed to get source queue attributes", err)
+	}
+
+	attributes := map[string]string{
+		string(types.QueueAttributeNameFifoQueue):                 "true",
+		string(types.QueueAttributeNameContentBasedDeduplication): fmt.Sprint(m.dedup == "content"),
+	}
+	for _, name := range migratedAttributes {
+		if value, ok := sourceAttributes.Attributes[string(name)]; ok {
+			attributes[string(name)] = value
+		}
+	}
+
+	// A FIFO queue deleted within the last minute can't be created again
+	// until SQS lets go of its name.
+	var created *sqs.CreateQueueOutput
+	err = withCooldown("create "+m.destination, func() error {
+		created, err = svc.CreateQueue(runCtx, &sqs.CreateQueueInput{
+			QueueName:  aws.String(m.destination),
+			Attributes: attributes,
+		})
+		return err
+	})
+	if err != nil {
+		return fail("Failed to create the FIFO queue", err)
+	}
+
+	destinationQueueURL := aws.ToString(created.QueueUrl)
+	summary.Destination = destinationQueueURL
+	log.Info(color.New(color.FgCyan).Sprintf("FIFO queue URL: %s", destinationQueueURL))
+
+	for _, g := range rails {
+		if err := g.check(sourceQueueURL, destinationQueueURL); err != nil {
+			summary.StopReason = stopGuardrail
+			return fail("Migration blocked by guardrail", err)
+		}
+	}
+
+	fifo, err := setupFifo(svc, sourceQueueURL, destinationQueueURL, m.groupID)
+	if err != nil {
+		return fail("Unable to move into the FIFO queue", err)
+	}
+	activeFifo = fifo
+
+	numberOfMessages := intAttribute(sourceAttributes.Attributes, types.QueueAttributeNameApproximateNumberOfMessages)
+
+	log.Info(color.New(color.FgCyan).Sprintf("Approximate number of messages in the source queue: %d", numberOfMessages))
+
+	if numberOfMessages > 0 && !moveMessages(sourceQueueURL, destinationQueueURL, svc, svc, numberOfMessages, 1, 0, &summary) {
+		summary.Status = "failed"
+		summary.FinishedAt = time.Now().UTC()
+		return summary
+	}
+
+	summary.Status = "completed"
+	summary.StopReason = orDefault(summary.StopReason, stopDrained)
+	if !validateMigration(svc, sourceQueueURL, destinationQueueURL, summary.Sent) {
+		summary.Status = "failed"
+		summary.Error = "migrated queue did not validate"
+		summary.StopReason = stopVerification
+	}
+
+	summary.FinishedAt = time.Now().UTC()
+	return summary
+}
+
+// choose asks for the group and deduplication strategies that were not given
+// as flags. Without a terminal the group has to be given up front.
+func (m *fifoMigration) choose() error {
+	interactive := isTerminal(os.Stdin)
+
+	if m.groupID == "" {
+		if !interactive {
+			return fmt.Errorf("--group-id is required when not running in a terminal")
+		}
+
+		fmt.Println("Every FIFO message needs a group. Messages in a group are delivered in order, one at a time.")
+		m.groupID = prompt("Group ID, or jsonpath:EXPR to read it from each body", "migration")
+	}
+
+	if m.dedup == "" {
+		m.dedup = "message-id"
+
+		if interactive {
+			fmt.Println("Deduplicate on the source message ID, or on a hash of the body (identical bodies within 5 minutes are dropped).")
+			for {
+				m.dedup = prompt("Deduplication (message-id or content)", "message-id")
+				if m.dedup == "message-id" || m.dedup == "content" {
+					break
+				}
+			}
+		}
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Group ID: %s, deduplication: %s", m.groupID, m.dedup))
+	return nil
+}
+
+// validateMigration compares what is left in the source and what arrived in
+// the FIFO queue with the number of messages sent.
+func validateMigration(svc *sqs.Client, sourceQueueURL string, destinationQueueURL string, sent int) bool {
+	names := []types.QueueAttributeName{
+		types.QueueAttributeNameApproximateNumberOfMessages,
+		types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+	}
+
+	depth := func(queueURL string) (int, error) {
+		attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(queueURL), AttributeNames: names})
+		if err != nil {
+			return 0, err
+		}
+
+		total := 0
+		for _, name := range names {
+			total += intAttribute(attrs.Attributes, name)
+		}
+		return total, nil
+	}
+
+	left, err := depth(sourceQueueURL)
+	if err != nil {
+		logAwsError("Failed to validate the source queue", err)
+		return false
+	}
+
+	arrived, err := depth(destinationQueueURL)
+	if err != nil {
+		logAwsError("Failed to validate the FIFO queue", err)
+		return false
+	}
+
+	ok := true
+
+	if left > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("About %d messages are still in the source queue", left))
+		ok = false
+	}
+
+	if arrived < sent {
+		log.Warn(color.New(color.FgYellow).Sprintf("Sent %d messages but the FIFO queue holds about %d. Some may have been deduplicated or already consumed", sent, arrived))
+		ok = false
+	}
+
+	if ok {
+		log.Info(color.New(color.FgCyan).Sprintf("Validated: the source is empty and the FIFO queue holds about %d messages", arrived))
+	}
+
+	return ok
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// prompt asks a question on the terminal, returning fallback for an empty
+// answer.
+func prompt(question string, fallback string) string {
+	fmt.Printf("%s [%s]: ", question, fallback)
+
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return fallback
+	}
+
+	return answer
+}
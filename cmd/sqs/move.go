@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// defaultMaxRetries is the --max-retries default, for commands that move
+// messages without the move flags.
+const defaultMaxRetries = 5
+
+// defaultPrefetch is the --prefetch default, and maxPrefetch its highest
+// value: each batch waiting ahead adds to how long messages stay hidden.
+const (
+	defaultPrefetch = 2
+	maxPrefetch     = 10
+)
+
+// copyVisibilityTimeout hides copied messages, so a copy doesn't keep
+// receiving messages it already sent. The mover renews it half way through
+// for as long as the copy runs, and releases the messages at the end.
+const copyVisibilityTimeout = 30
+
+// followWaitTime is how long each receive of --follow long polls for new
+// messages, the most SQS allows.
+const followWaitTime = 20
+
+// requeueSince is when a move whose source and destination are the same queue
+// started, so the messages it sends back aren't taken again. It is zero for
+// moves between two queues.
+var requeueSince time.Time
+
+// convertToEntries builds the destination entries for messages along with the
+// message each entry came from. A message exploded by --explode-jsonpath turns
+// into one entry per array element.
+func convertToEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, []*types.Message) {
+	result := make([]*types.SendMessageBatchRequestEntry, 0, len(messages))
+	origins := make([]*types.Message, 0, len(messages))
+	for _, message := range messages {
+		body := *message.Body
+		if unwrapCloudEvents {
+			body = unwrapCloudEvent(body)
+		}
+
+		bodies := explodeBody(body)
+		for i, body := range bodies {
+			id := message.MessageId
+			if len(bodies) > 1 {
+				id = aws.String(fmt.Sprintf("%s-%d", *message.MessageId, i))
+			}
+
+			entry := &types.SendMessageBatchRequestEntry{
+				MessageBody: aws.String(body),
+				Id:          id,
+			}
+			copyAttributes(message, entry)
+			activeFifo.apply(entry, message)
+
+			result = append(result, entry)
+			origins = append(origins, message)
+		}
+	}
+
+	return result, origins
+}
+
+// moveOptions configures the mover for the move given on the command line.
+func moveOptions(sourceQueueURL string, destinationQueueURL string) mover.Options {
+	opts := mover.Options{
+		SourceQueueURL:        sourceQueueURL,
+		DestinationQueueURL:   destinationQueueURL,
+		AttributeNames:        receiveAttributeNames(),
+		MessageAttributeNames: receiveMessageAttributeNames(),
+		Entries:               archiveEntries(timeEntries(prepareEntries)),
+		MaxRetries:            *maxRetries,
+		Copy:                  *copyMessages,
+		VisibilityTimeout:     int32(*visibilityTimeout),
+		WaitTimeSeconds:       int32(*waitTime),
+		EmptyReceives:         *emptyReceives,
+		Rate:                  *rate,
+		ByteRate:              float64(*byteRate),
+		RampUp:                *rampUp,
+		BatchInterval:         *batchInterval,
+		DeleteAfter:           *deleteAfter,
+		Prefetch:              *prefetch,
+		Since:                 requeueSince,
+		Follow:                *follow,
+	}
+
+	// A follow waits for new messages rather than polling an empty source.
+	if opts.Follow && opts.WaitTimeSeconds == 0 {
+		opts.WaitTimeSeconds = followWaitTime
+	}
+
+	if opts.VisibilityTimeout == 0 {
+		opts.VisibilityTimeout = mover.PrefetchVisibilityTimeout(opts.MaxRetries, opts.Prefetch)
+	}
+
+	if len(dropRules) > 0 || activeDedup != nil || (expireAge > 0 && expireQueueURL == "") || (activeCollapse != nil && *dedupeAction == "delete") {
+		opts.Drop = isDropped
+	}
+
+	if expireAge > 0 && expireQueueURL != "" {
+		opts.Divert = isExpired
+		opts.DivertQueueURL = expireQueueURL
+	}
+
+	opts.Sent = func(messages []*types.Message) {
+		activeReceives.record(messages)
+		if activeDedup != nil {
+			activeDedup.record(messages)
+		}
+		if activeOrder != nil {
+			activeOrder.receivedBatch(messages)
+		}
+	}
+
+	if activeOrder != nil {
+		opts.Sequenced = activeOrder.sequenced
+	}
+
+	if activeFilter != nil {
+		opts.Filter = activeFilter.matches
+	}
+
+	// Duplicates left in the source, and copies held until the message
+	// they collapse into was sent, are skipped like messages the filter
+	// doesn't match, once the filter has let them through.
+	if activeCollapse != nil {
+		filter := opts.Filter
+		leave := *dedupeAction == "leave"
+		opts.Filter = func(message *types.Message) bool {
+			if filter != nil && !filter(message) {
+				return false
+			}
+			return !(leave && activeCollapse.duplicate(message)) && !activeCollapse.hold(message)
+		}
+	}
+
+	// Messages that came back are left in the source before any other
+	// filter sees them.
+	if activeBounces != nil || activeManifest != nil || activeDedup != nil {
+		opts.Events = moveEvent
+	}
+
+	if activeBounces != nil {
+		filter := opts.Filter
+		opts.Filter = func(message *types.Message) bool {
+			return !activeBounces.bounce(message) && (filter == nil || filter(message))
+		}
+	}
+
+	if activeRouter != nil {
+		opts.Route = activeRouter.route
+	}
+
+	if skipFailed {
+		opts.SkipFailed = true
+		opts.FailedQueueURL = failedQueueURL
+		opts.Rejected = activeRejections.add
+	}
+
+	return opts
+}
+
+// moveEvent passes an event of the move on to the checks and records
+// following it.
+func moveEvent(event mover.Event) {
+	if activeBounces != nil {
+		activeBounces.event(event)
+	}
+	if activeManifest != nil {
+		activeManifest.event(event)
+	}
+	if activeDedup != nil {
+		activeDedup.event(event)
+	}
+}
+
+// prepareEntries builds the destination entries for messages, re-pointing
+// large payloads and applying transforms, enrichment, redaction, CloudEvents
+// wrapping, expiry stamps and delays.
+func prepareEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	entries, origins := convertToEntries(messages)
+
+	if activeLargePayloads != nil {
+		if err := activeLargePayloads.repoint(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := transformEntries(entries); err != nil {
+		return nil, err
+	}
+
+	if activeEnricher != nil {
+		missing, err := activeEnricher.enrich(entries)
+		if err != nil {
+			return nil, err
+		}
+
+		if missing > 0 {
+			log.Warn(color.New(color.FgYellow).Sprintf("%d messages had no enrichment item and are sent unchanged", missing))
+		}
+	}
+
+	for i, entry := range entries {
+		body, err := redactBody(*entry.MessageBody, redactRules)
+		if err != nil {
+			return nil, err
+		}
+		entry.MessageBody = aws.String(body)
+
+		if wrapCloudEvents != nil {
+			entry.MessageBody = aws.String(wrapCloudEvents.wrap(*entry.Id, *entry.MessageBody, origins[i]))
+		}
+
+		if expiryLifetime > 0 {
+			if err := stampExpiry(entry, origins[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		if *keepReceiveCount {
+			if err := stampReceiveCount(entry, origins[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		if activeDelay != nil {
+			activeDelay.apply(entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// isDropped reports whether a message matches a --drop-if predicate, was
+// moved by a recent run, expired without --expire-to or duplicates a message
+// the run sent under --dedupe-action=delete, in which case it is deleted
+// from the source without being sent anywhere.
+func isDropped(message *types.Message) bool {
+	if activeDedup != nil && activeDedup.seen(message) {
+		return true
+	}
+
+	if expireQueueURL == "" && isExpired(message) {
+		return true
+	}
+
+	for _, rule := range dropRules {
+		if rule.matches(aws.ToString(message.Body)) {
+			return true
+		}
+	}
+
+	return activeCollapse != nil && *dedupeAction == "delete" && activeCollapse.duplicate(message)
+}
+
+// logMoveError explains why the mover stopped.
+func logMoveError(err error, destinationSvc *sqs.Client, destinationQueueURL string) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(err, context.Canceled) {
+			log.Warn(color.New(color.FgYellow).Sprintf("Interrupted. Batches in flight were finished and held messages released"))
+		} else {
+			log.Warn(color.New(color.FgYellow).Sprintf("Timed out after %s. Batches in flight were finished and held messages released", *timeout))
+		}
+
+		if *deleteAfter > 0 {
+			log.Warn(color.New(color.FgYellow).Sprintf("Messages waiting to be deleted were left in the source and reappear there within %s", *deleteAfter+time.Minute))
+		}
+		return
+	}
+
+	var panicErr *mover.PanicError
+	if errors.As(err, &panicErr) {
+		log.Error(color.New(color.FgRed).Sprintf("Move stopped by an unexpected error: %v. The messages of the batch were released", panicErr.Value))
+		log.Debug(string(panicErr.Stack))
+		return
+	}
+
+	var moveErr *mover.Error
+	if !errors.As(err, &moveErr) {
+		logAwsError("Move stopped", err)
+		return
+	}
+
+	switch moveErr.Op {
+	case mover.OpReceive:
+		logAwsError("Failed to receive messages", moveErr.Err)
+	case mover.OpEntries:
+		logAwsError("Failed to prepare messages for the destination", moveErr.Err)
+	case mover.OpSend:
+		logAwsError("Failed to un-queue messages to the destination", moveErr.Err)
+		if isAccessDenied(moveErr.Err) {
+			explainSendAccessDenied(destinationSvc, destinationQueueURL)
+		}
+	case mover.OpDelete:
+		logAwsError("Failed to delete messages from source queue", moveErr.Err)
+	}
+}
+
+// addResult counts a mover result in the run summary.
+func addResult(summary *runSummary, result mover.Result) {
+	summary.Moved += result.Moved
+	summary.Sent += result.Sent
+	summary.Dropped += result.Dropped
+	summary.Skipped += result.Skipped
+	summary.Failed += result.Failed
+	summary.Undeleted += result.Undeleted
+	summary.Bytes.Received += result.ReceivedBytes
+	summary.Bytes.Sent += result.SentBytes
+	summary.Bytes.Chunks += result.PayloadChunks
+}
+
+// moveMessages runs the mover on the given number of workers until the
+// source is drained or limit messages were taken from it, drawing a progress
+// bar as batches complete.
+func moveMessages(sourceQueueURL string, destinationQueueURL string, sourceSvc *sqs.Client, destinationSvc *sqs.Client, numberOfMessages int, workers int, limit int, summary *runSummary) bool {
+	m := mover.New(moveClient(sourceSvc), destinationClient(destinationSvc))
+
+	opts := moveOptions(sourceQueueURL, destinationQueueURL)
+	opts.Workers = workers
+	opts.Limit = limit
+
+	// Modes that hold on to messages keep them hidden for at least as long
+	// as they need.
+	if activeAggregator != nil {
+		// Messages wait in the aggregator across several receives.
+		opts.VisibilityTimeout = max(opts.VisibilityTimeout, aggregateVisibilityTimeout)
+		opts.Handle = func(ctx context.Context, messages []*types.Message) (mover.Result, error) {
+			if len(messages) == 0 {
+				return activeAggregator.flush(ctx, m, opts)
+			}
+			return activeAggregator.add(ctx, m, opts, messages)
+		}
+		opts.Abort = func(ctx context.Context) {
+			activeAggregator.release(ctx, m, opts)
+		}
+	} else if opts.Copy {
+		opts.VisibilityTimeout = max(opts.VisibilityTimeout, copyVisibilityTimeout)
+	} else if activeFilter != nil {
+		opts.VisibilityTimeout = max(opts.VisibilityTimeout, filterVisibilityTimeout)
+	}
+
+	verb := "move"
+	if opts.Copy {
+		verb = "copy"
+	}
+
+	if workers > 1 {
+		log.Info(color.New(color.FgCyan).Sprintf("Starting to %s messages with %d workers...", verb, workers))
+	} else {
+		log.Info(color.New(color.FgCyan).Sprintf("Starting to %s messages...", verb))
+	}
+
+	if expireAge > 0 {
+		if expireQueueURL != "" {
+			log.Info(color.New(color.FgCyan).Sprintf("Messages sent more than %s ago go to %s instead and are counted as dropped", *expireOlderThan, queueNameFromURL(expireQueueURL)))
+		} else {
+			log.Info(color.New(color.FgCyan).Sprintf("Messages sent more than %s ago are dropped", *expireOlderThan))
+		}
+	}
+
+	if opts.DeleteAfter > 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Moved messages stay hidden in the source and are deleted %s after they were sent. Interrupt the run before then to roll back", opts.DeleteAfter))
+	}
+	fmt.Println()
+
+	display := startProgress(numberOfMessages)
+	display.pollSource(sourceSvc, sourceQueueURL, limit, m.InFlight)
+	activeMetrics.begin(m, sourceQueueURL, destinationQueueURL, numberOfMessages)
+
+	opts.Progress = func(total mover.Result) {
+		display.update(total.Moved + total.Dropped + total.Skipped)
+		activeMetrics.update(total)
+		if activeDedup != nil {
+			activeDedup.progress(total)
+		}
+		if activeProgress != nil {
+			activeProgress.update(total)
+		}
+		if activeIdleExit != nil {
+			activeIdleExit.progress(total)
+		}
+	}
+
+	if activeProgress != nil {
+		activeProgress.start(sourceQueueURL, destinationQueueURL, numberOfMessages)
+		defer activeProgress.finish()
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *moveDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *moveDuration)
+		defer cancel()
+	}
+
+	// Copies held while the message they collapse into was on its way are
+	// released once it was sent, so they are received again and collapsed
+	// before the source looks drained.
+	if activeCollapse != nil {
+		sent := opts.Sent
+		opts.Sent = func(messages []*types.Message) {
+			sent(messages)
+			held := activeCollapse.sent(messages)
+			if len(held) > 0 {
+				m.Release(context.WithoutCancel(runCtx), sourceQueueURL, held)
+			}
+		}
+	}
+
+	if activeBounces != nil {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		activeBounces.stop = cancel
+	}
+
+	if activeIdleExit != nil {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		activeIdleExit.start(cancel)
+		defer activeIdleExit.stop()
+	}
+
+	switch {
+	case opts.Follow && *moveDuration > 0:
+		log.Info(color.New(color.FgCyan).Sprintf("Once the source is drained, new messages are moved as they arrive for %s. Press Ctrl-C to stop earlier", *moveDuration))
+	case opts.Follow:
+		log.Info(color.New(color.FgCyan).Sprintf("Once the source is drained, new messages are moved as they arrive. Press Ctrl-C to stop"))
+	case *moveDuration > 0:
+		log.Info(color.New(color.FgCyan).Sprintf("Moving for at most %s", *moveDuration))
+	}
+
+	if activeIdleExit != nil {
+		log.Info(color.New(color.FgCyan).Sprintf("The follow ends once no new messages arrived for %s", *idleExitAfter))
+	}
+
+	var err error
+	if priorityRule != nil {
+		err = moveByPriority(ctx, m, opts, summary)
+	} else {
+		var result mover.Result
+		result, err = m.Move(ctx, opts)
+		addResult(summary, result)
+	}
+	display.stop()
+	if *dedupeAction == "delete" {
+		summary.Skipped -= activeCollapse.reclaimed()
+	}
+	summary.StopReason = moveStopReason(ctx, err, summary.Moved+summary.Dropped, limit)
+
+	if cause := context.Cause(ctx); errors.Is(cause, errBounced) {
+		summary.StopReason = stopBounced
+		err = cause
+	}
+
+	// A follow that went idle ended the way it was asked to.
+	if cause := context.Cause(ctx); errors.Is(cause, errIdle) && (err == nil || errors.Is(err, context.Canceled)) {
+		summary.StopReason = stopIdle
+		err = nil
+		log.Info(color.New(color.FgCyan).Sprintf("Stopped following once no new messages arrived for %s. Batches in flight were finished and held messages released", *idleExitAfter))
+	}
+
+	// A move cut short by --duration did what it was given the time for.
+	if durationOver(ctx) && (err == nil || errors.Is(err, context.DeadlineExceeded)) {
+		err = nil
+		log.Info(color.New(color.FgCyan).Sprintf("Stopped once %s passed. Batches in flight were finished and held messages released", *moveDuration))
+	}
+
+	if err != nil {
+		logMoveError(err, destinationSvc, destinationQueueURL)
+		return false
+	}
+
+	fmt.Println()
+	logDone(summary)
+	return true
+}
+
+// moveByPriority moves the messages matching --prioritize in a first pass and
+// the rest in a second one. Messages the first pass leaves are released when
+// it ends, so the second pass doesn't wait for them to reappear. The limit
+// holds across both passes.
+func moveByPriority(ctx context.Context, m *mover.Mover, opts mover.Options, summary *runSummary) error {
+	first := opts
+	first.ReleaseSkipped = true
+	first.VisibilityTimeout = max(opts.VisibilityTimeout, filterVisibilityTimeout)
+	first.Filter = func(message *types.Message) bool {
+		return (opts.Filter == nil || opts.Filter(message)) && priorityRule.matches(aws.ToString(message.Body))
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Moving messages matching %s first", priorityRule.expr))
+
+	// The first pass only skips what the second one takes, so its skipped
+	// messages aren't counted.
+	result, err := m.Move(ctx, first)
+	result.Skipped = 0
+	addResult(summary, result)
+	if err != nil {
+		return err
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Moved %d prioritized messages, moving the rest", result.Moved))
+
+	if opts.Limit > 0 {
+		opts.Limit -= result.Moved + result.Dropped
+		if opts.Limit <= 0 {
+			return nil
+		}
+	}
+
+	progress := opts.Progress
+	opts.Progress = func(total mover.Result) {
+		total.Moved += result.Moved
+		total.Sent += result.Sent
+		total.Dropped += result.Dropped
+		total.Failed += result.Failed
+		progress(total)
+	}
+
+	rest, err := m.Move(ctx, opts)
+	addResult(summary, rest)
+	return err
+}
+
+func logDone(summary *runSummary) {
+	defer logDuplicates()
+	defer logSkipped(summary)
+
+	verb := "Moved"
+	if *copyMessages {
+		verb = "Copied"
+	}
+
+	if summary.Sent != summary.Moved {
+		log.Info(color.New(color.FgCyan).Sprintf("Done. %s %d messages as %d destination messages, dropped %d", verb, summary.Moved, summary.Sent, summary.Dropped))
+		return
+	}
+
+	if summary.Dropped > 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Done. %s %d messages, dropped %d", verb, summary.Moved, summary.Dropped))
+		return
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Done. %s %s messages", verb, strconv.Itoa(summary.Moved)))
+}
+
+func logSkipped(summary *runSummary) {
+	if summary.Skipped > 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Left %d messages that didn't match the filter in the source", summary.Skipped))
+	}
+}
+
+func logDuplicates() {
+	if activeDedup != nil && len(activeDedup.skipped) > 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Dropped %d messages a recent run had already sent, instead of sending them again", len(activeDedup.skipped)))
+	}
+
+	if n := activeCollapse.collapsed(); n > 0 {
+		if *dedupeAction == "leave" {
+			log.Info(color.New(color.FgCyan).Sprintf("Collapsed %d duplicates of messages moved in this run, leaving them in the source", n))
+		} else {
+			log.Info(color.New(color.FgCyan).Sprintf("Collapsed %d duplicates of messages moved in this run, deleting them from the source", n))
+		}
+	}
+}
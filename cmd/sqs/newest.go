@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+const (
+	// newestVisibilityTimeout hides the messages a pass holds outside its
+	// window. Held messages are hidden again for as long whenever half of it
+	// has passed, so they aren't received again before the pass completes,
+	// however long it takes, while a run that dies leaves them hidden no
+	// longer than this.
+	newestVisibilityTimeout = 300
+
+	// newestMaxHeld caps the messages a pass holds, well below the 120,000
+	// messages SQS lets be in flight from a standard queue. A pass that
+	// reaches it ends early, so the next pass starts at the newest message
+	// held and the order is only approximate beyond it.
+	newestMaxHeld = 100000
+)
+
+// moveNewestFirst approximates newest-first replay on standard queues, which
+// offer no ordering guarantees. Each pass moves the messages whose
+// SentTimestamp falls inside the current window and holds everything else
+// invisible; once a pass drains, the held messages are released and the next
+// window starts at the newest message that is still left in the source. A
+// non-zero limit ends the move once that many messages were taken.
+func moveNewestFirst(sourceQueueURL string, destinationQueueURL string, sourceSvc *sqs.Client, destinationSvc *sqs.Client, numberOfMessages int, slice time.Duration, limit int, summary *runSummary) bool {
+	params := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(sourceQueueURL),
+		VisibilityTimeout:     newestVisibilityTimeout,
+		MaxNumberOfMessages:   10,
+		AttributeNames:        queueAttributeNames(receiveAttributeNames(string(types.MessageSystemAttributeNameSentTimestamp))),
+		MessageAttributeNames: receiveMessageAttributeNames(),
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Starting to move messages newest first in %s slices...", slice))
+	fmt.Println()
+
+	display := startProgress(numberOfMessages)
+	defer display.stop()
+
+	if activeProgress != nil {
+		activeProgress.start(sourceQueueURL, destinationQueueURL, numberOfMessages)
+		defer activeProgress.finish()
+	}
+
+	m := mover.New(moveClient(sourceSvc), destinationClient(destinationSvc))
+	opts := moveOptions(sourceQueueURL, destinationQueueURL)
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *moveDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *moveDuration)
+		defer cancel()
+	}
+
+	upper := time.Now().Add(time.Millisecond)
+	skipped := map[string]bool{}
+	capped := false
+
+	// A panic releases the messages held, as the other ways out do, before
+	// runMove recovers from it.
+	var held map[string]*types.Message
+	defer func() {
+		if v := recover(); v != nil {
+			releaseMessages(sourceSvc, sourceQueueURL, held)
+			panic(v)
+		}
+	}()
+
+	for {
+		lower := upper.Add(-slice)
+		held = map[string]*types.Message{}
+
+		// renewAt is when the held messages must be hidden again, half way
+		// through the visibility timeout they were last given.
+		var renewAt time.Time
+
+		for {
+			if durationOver(ctx) {
+				summary.StopReason = stopDuration
+				if !releaseMessages(sourceSvc, sourceQueueURL, held) {
+					return false
+				}
+
+				fmt.Println()
+				logDone(summary)
+				return true
+			}
+
+			if ctx.Err() != nil {
+				summary.StopReason = errorStopReason(ctx.Err())
+				releaseMessages(sourceSvc, sourceQueueURL, held)
+				logMoveError(ctx.Err(), destinationSvc, destinationQueueURL)
+				return false
+			}
+
+			if limit > 0 {
+				remaining := limit - summary.Moved - summary.Dropped
+				if remaining <= 0 {
+					summary.StopReason = stopLimit
+					if !releaseMessages(sourceSvc, sourceQueueURL, held) {
+						return false
+					}
+
+					fmt.Println()
+					logDone(summary)
+					return true
+				}
+
+				if remaining < 10 {
+					params.MaxNumberOfMessages = int32(remaining)
+				}
+			}
+
+			if len(held) >= newestMaxHeld {
+				if !capped {
+					capped = true
+					log.Warn(color.New(color.FgYellow).Sprintf("%d messages outside the window are held, ending the pass early. Messages beyond them are moved in approximate newest-first order", newestMaxHeld))
+				}
+				break
+			}
+
+			if !renewAt.IsZero() && time.Now().After(renewAt) {
+				hideMessages(sourceSvc, sourceQueueURL, held, newestVisibilityTimeout)
+				renewAt = time.Now().Add(newestVisibilityTimeout * time.Second / 2)
+			}
+
+			resp, err := sourceSvc.ReceiveMessage(ctx, params, mover.ShortPoll)
+
+			if err != nil {
+				// A receive cut short by ctx is handled at the top of the
+				// loop like a stop between receives.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				logAwsError("Failed to receive messages", err)
+				summary.StopReason = stopReceiveFailed
+				releaseMessages(sourceSvc, sourceQueueURL, held)
+				return false
+			}
+
+			var inWindow []*types.Message
+			seen := 0
+
+			matched, rejected := activeFilter.partition(messagePointers(resp.Messages))
+			for _, message := range rejected {
+				if skipped[*message.MessageId] {
+					seen++
+				} else {
+					skipped[*message.MessageId] = true
+					summary.Skipped++
+				}
+			}
+
+			for _, message := range matched {
+				sent := sentTimestamp(message)
+
+				if !sent.Before(lower) && sent.Before(upper) {
+					inWindow = append(inWindow, message)
+					continue
+				}
+
+				if _, ok := held[*message.MessageId]; ok {
+					seen++
+				}
+
+				held[*message.MessageId] = message
+				if renewAt.IsZero() {
+					renewAt = time.Now().Add(newestVisibilityTimeout * time.Second / 2)
+				}
+			}
+
+			// The pass is over once the source is empty or only hands back
+			// messages this pass already decided to hold or the filter
+			// skipped.
+			if len(inWindow) == 0 && seen == len(resp.Messages) {
+				break
+			}
+
+			if len(inWindow) == 0 {
+				continue
+			}
+
+			result, err := m.Transfer(ctx, opts, inWindow)
+			addResult(summary, result)
+
+			if err != nil {
+				summary.StopReason = errorStopReason(err)
+				logMoveError(err, destinationSvc, destinationQueueURL)
+				releaseMessages(sourceSvc, sourceQueueURL, held)
+				return false
+			}
+
+			display.update(summary.Moved + summary.Dropped)
+			if activeProgress != nil {
+				activeProgress.update(mover.Result{Moved: summary.Moved, Sent: summary.Sent, Dropped: summary.Dropped, Skipped: summary.Skipped, Failed: summary.Failed})
+			}
+		}
+
+		if len(held) == 0 {
+			fmt.Println()
+			logDone(summary)
+			return true
+		}
+
+		var newest time.Time
+		for _, message := range held {
+			if sent := sentTimestamp(message); sent.After(newest) {
+				newest = sent
+			}
+		}
+
+		if !releaseMessages(sourceSvc, sourceQueueURL, held) {
+			return false
+		}
+
+		upper = newest.Add(time.Millisecond)
+	}
+}
+
+// sentTimestamp returns the time the message was sent to the queue, or the
+// zero time when the attribute was not requested or cannot be parsed.
+func sentTimestamp(message *types.Message) time.Time {
+	return timestampAttribute(message, types.MessageSystemAttributeNameSentTimestamp)
+}
+
+// timestampAttribute returns a system attribute holding epoch milliseconds
+// as a time, or the zero time when it is missing or cannot be parsed.
+func timestampAttribute(message *types.Message, name types.MessageSystemAttributeName) time.Time {
+	value, ok := message.Attributes[string(name)]
+	if !ok {
+		return time.Time{}
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// messagePointers returns pointers to the messages of a receive.
+func messagePointers(messages []types.Message) []*types.Message {
+	pointers := make([]*types.Message, len(messages))
+	for i := range messages {
+		pointers[i] = &messages[i]
+	}
+
+	return pointers
+}
+
+// releaseMessages makes held messages immediately visible again in the source.
+func releaseMessages(svc *sqs.Client, sourceQueueURL string, held map[string]*types.Message) bool {
+	return hideMessages(svc, sourceQueueURL, held, 0)
+}
+
+// hideMessages sets the visibility timeout of held messages to timeout
+// seconds, zero releasing them.
+func hideMessages(svc *sqs.Client, sourceQueueURL string, held map[string]*types.Message, timeout int32) bool {
+	entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, 0, 10)
+
+	flush := func() bool {
+		if len(entries) == 0 {
+			return true
+		}
+
+		resp, err := svc.ChangeMessageVisibilityBatch(context.WithoutCancel(runCtx), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(sourceQueueURL),
+			Entries:  entries,
+		})
+
+		entries = entries[:0]
+
+		if err != nil {
+			if timeout == 0 {
+				logAwsError("Failed to release held messages", err)
+			} else {
+				logAwsError("Failed to keep held messages hidden", err)
+			}
+			return false
+		}
+
+		if len(resp.Failed) > 0 {
+			if timeout == 0 {
+				log.Warn(color.New(color.FgYellow).Sprintf("%d held messages could not be released and will reappear after %ds", len(resp.Failed), newestVisibilityTimeout))
+			} else {
+				log.Warn(color.New(color.FgYellow).Sprintf("%d held messages could not be kept hidden and may be received again during the pass", len(resp.Failed)))
+			}
+		}
+
+		return true
+	}
+
+	for id, message := range held {
+		entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(id),
+			ReceiptHandle:     message.ReceiptHandle,
+			VisibilityTimeout: timeout,
+		})
+
+		if len(entries) == 10 && !flush() {
+			return false
+		}
+	}
+
+	return flush()
+}
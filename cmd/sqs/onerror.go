@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// onErrorQueuePrefix starts an --on-error value naming a side queue.
+const onErrorQueuePrefix = "dlq:"
+
+// rejectedMessage is a message SQS refused, listed in the run summary.
+type rejectedMessage struct {
+	MessageID string `json:"message_id"`
+	Code      string `json:"code"`
+	Reason    string `json:"reason"`
+}
+
+// rejections collects the messages --on-error set aside during a run.
+// Workers add to it concurrently.
+type rejections struct {
+	mu       sync.Mutex
+	messages []rejectedMessage
+}
+
+var (
+	// skipFailed and failedQueueRef are the --on-error policy: abort when
+	// skipFailed is false, otherwise leave refused messages in the source or
+	// send them to failedQueueRef.
+	skipFailed     bool
+	failedQueueRef string
+
+	// failedQueueURL is failedQueueRef resolved for the move.
+	failedQueueURL string
+
+	activeRejections = &rejections{}
+)
+
+// parseOnError reads an --on-error value: abort, skip or dlq:QUEUE.
+func parseOnError(value string) (bool, string, error) {
+	switch {
+	case value == "abort":
+		return false, "", nil
+	case value == "skip":
+		return true, "", nil
+	case strings.HasPrefix(value, onErrorQueuePrefix) && len(value) > len(onErrorQueuePrefix):
+		return true, strings.TrimPrefix(value, onErrorQueuePrefix), nil
+	}
+
+	return false, "", fmt.Errorf("--on-error must be abort, skip or dlq:QUEUE, not %q", value)
+}
+
+func (r *rejections) add(rejection mover.Rejection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, rejectedMessage{
+		MessageID: aws.ToString(rejection.Message.MessageId),
+		Code:      rejection.Code,
+		Reason:    rejection.Reason,
+	})
+}
+
+func (r *rejections) list() []rejectedMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]rejectedMessage(nil), r.messages...)
+}
+
+// log lists the messages that were set aside, with the error SQS refused
+// each of them with.
+func (r *rejections) log() {
+	messages := r.list()
+	if len(messages) == 0 {
+		return
+	}
+
+	if failedQueueURL != "" {
+		log.Warn(color.New(color.FgYellow).Sprintf("%d messages couldn't be moved and were sent to %s:", len(messages), queueNameFromURL(failedQueueURL)))
+	} else {
+		log.Warn(color.New(color.FgYellow).Sprintf("%d messages couldn't be moved and were left in the source:", len(messages)))
+	}
+
+	for _, message := range messages {
+		log.Warn(color.New(color.FgYellow).Sprintf("  %s  %s: %s", message.MessageID, message.Code, message.Reason))
+	}
+}
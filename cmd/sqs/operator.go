@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fatih/color"
+)
+
+// operatorIdentity is who a run acts as, as STS reports the caller, so a
+// redrive can be attributed to a person or role from its own records.
+type operatorIdentity struct {
+	Arn     string `json:"arn"`
+	Account string `json:"account"`
+	UserID  string `json:"user_id"`
+}
+
+// activeOperator is added to every log entry once it is known.
+var activeOperator *operatorIdentity
+
+// stampOperator resolves the identity behind svc and records it in the
+// summary and the logs. A caller STS can't tell is warned about rather than
+// stopping the run, since emulators may not implement STS.
+func stampOperator(svc *sqs.Client, summary *runSummary) {
+	identity, err := sts.NewFromConfig(siblingConfig(svc)).GetCallerIdentity(runCtx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		log.Warn(color.New(color.FgYellow).Sprintf("Unable to resolve the caller identity, the run won't name its operator: %s", err))
+		return
+	}
+
+	activeOperator = &operatorIdentity{
+		Arn:     aws.ToString(identity.Arn),
+		Account: aws.ToString(identity.Account),
+		UserID:  aws.ToString(identity.UserId),
+	}
+	summary.Operator = activeOperator
+
+	log.Info(color.New(color.FgCyan).Sprintf("Running as %s", activeOperator.Arn))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// maxOrderViolations is how many out of order messages the ordering report
+// lists.
+const maxOrderViolations = 20
+
+// orderCheck pairs the sequence numbers of the messages a FIFO to FIFO move
+// received with those the destination gave them, to check with --verify-order
+// that every message group arrived in the order it left.
+type orderCheck struct {
+	mu sync.Mutex
+
+	// received holds the source messages by message ID, once however often
+	// they were received.
+	received map[string]orderedMessage
+
+	// sent holds the sequence numbers of every destination queue by entry
+	// ID.
+	sent map[string]map[string]string
+}
+
+// orderedMessage is a source message as far as its order goes.
+type orderedMessage struct {
+	id       string
+	group    string
+	sequence string
+}
+
+// orderReport is the ordering section of the run summary.
+type orderReport struct {
+	Groups     int              `json:"groups"`
+	Messages   int              `json:"messages"`
+	Unverified int              `json:"unverified,omitempty"`
+	OutOfOrder int              `json:"out_of_order"`
+	Violations []orderViolation `json:"violations,omitempty"`
+}
+
+// orderViolation is a message that reached the destination before one that
+// preceded it in its group in the source.
+type orderViolation struct {
+	Group       string `json:"group"`
+	Destination string `json:"destination"`
+	MessageID   string `json:"message_id"`
+	After       string `json:"after"`
+}
+
+var activeOrder *orderCheck
+
+func newOrderCheck() *orderCheck {
+	return &orderCheck{received: map[string]orderedMessage{}, sent: map[string]map[string]string{}}
+}
+
+// receivedBatch notes the group and sequence number of sent source messages.
+func (c *orderCheck) receivedBatch(messages []*types.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, message := range messages {
+		id := aws.ToString(message.MessageId)
+		c.received[id] = orderedMessage{
+			id:       id,
+			group:    message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+			sequence: message.Attributes[string(types.MessageSystemAttributeNameSequenceNumber)],
+		}
+	}
+}
+
+// sequenced notes the sequence numbers a destination gave entries, as
+// mover.Options.Sequenced.
+func (c *orderCheck) sequenced(queueURL string, entries []*types.SendMessageBatchRequestEntry, sequenceNumbers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sent, ok := c.sent[queueURL]
+	if !ok {
+		sent = map[string]string{}
+		c.sent[queueURL] = sent
+	}
+
+	for i, entry := range entries {
+		sent[aws.ToString(entry.Id)] = sequenceNumbers[i]
+	}
+}
+
+// destinationRange returns the lowest and highest sequence numbers a queue
+// gave the entries of a message: its own ID, or ID-N for every entry it was
+// exploded into.
+func destinationRange(sent map[string]string, id string) (string, string, bool) {
+	if sequence, ok := sent[id]; ok {
+		return sequence, sequence, true
+	}
+
+	var low, high string
+	for i := 0; ; i++ {
+		sequence, ok := sent[fmt.Sprintf("%s-%d", id, i)]
+		if !ok {
+			break
+		}
+		if low == "" || lessSequence(sequence, low) {
+			low = sequence
+		}
+		if high == "" || lessSequence(high, sequence) {
+			high = sequence
+		}
+	}
+
+	return low, high, low != ""
+}
+
+// lessSequence compares two SQS sequence numbers, decimal numbers too large
+// for an int64.
+func lessSequence(a string, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+// report walks every message group in the order of its source sequence
+// numbers, and flags messages a destination gave a sequence number lower
+// than one of the messages before them. Messages without a sequence number
+// on either side, such as those combined by --aggregate, are counted as
+// unverified.
+func (c *orderCheck) report() *orderReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	received := make([]orderedMessage, 0, len(c.received))
+	for _, message := range c.received {
+		received = append(received, message)
+	}
+	sort.Slice(received, func(i, j int) bool {
+		if received[i].group != received[j].group {
+			return received[i].group < received[j].group
+		}
+		return lessSequence(received[i].sequence, received[j].sequence)
+	})
+
+	report := &orderReport{}
+	groups := map[string]bool{}
+	verified := map[string]bool{}
+
+	queues := make([]string, 0, len(c.sent))
+	for queueURL := range c.sent {
+		queues = append(queues, queueURL)
+	}
+	sort.Strings(queues)
+
+	for _, queueURL := range queues {
+		sent := c.sent[queueURL]
+
+		var group, highest, highestID string
+		for _, message := range received {
+			if message.group != group {
+				group, highest, highestID = message.group, "", ""
+			}
+
+			low, high, ok := destinationRange(sent, message.id)
+			if !ok || message.sequence == "" {
+				continue
+			}
+			verified[message.id] = true
+			groups[message.group] = true
+
+			if highest != "" && lessSequence(low, highest) {
+				report.OutOfOrder++
+				if len(report.Violations) < maxOrderViolations {
+					report.Violations = append(report.Violations, orderViolation{
+						Group:       message.group,
+						Destination: queueNameFromURL(queueURL),
+						MessageID:   message.id,
+						After:       highestID,
+					})
+				}
+			}
+
+			if highest == "" || lessSequence(highest, high) {
+				highest, highestID = high, message.id
+			}
+		}
+	}
+
+	report.Groups = len(groups)
+	report.Messages = len(verified)
+	report.Unverified = len(received) - len(verified)
+
+	return report
+}
+
+func (r *orderReport) log() {
+	if r.Unverified > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("The order of %d messages couldn't be checked, since a queue gave no sequence number for them", r.Unverified))
+	}
+
+	if r.OutOfOrder == 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("Order verified: the %d messages of %d groups arrived in the order they left the source", r.Messages, r.Groups))
+		return
+	}
+
+	log.Warn(color.New(color.FgYellow).Sprintf("%d of %d messages arrived out of order in their group", r.OutOfOrder, r.Messages))
+	for _, v := range r.Violations {
+		log.Warn(color.New(color.FgYellow).Sprintf("Group %s: %s reached %s before %s, which preceded it", strconv.Quote(v.Group), v.MessageID, v.Destination, v.After))
+	}
+}
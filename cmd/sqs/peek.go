@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// peekVisibilityTimeout hides peeked messages only briefly, in case the
+// command dies before it makes them visible again.
+const peekVisibilityTimeout = 10
+
+// runPeek prints up to count messages of a queue with their attributes and
+// makes them visible again, so a queue can be looked at before it is moved.
+// JSON bodies are indented when pretty is set. Every message is labelled with
+// the content type detected in its body, and only those of contentType are
+// shown when it is set. Bodies are masked by rules. It reports whether the
+// queue could be read.
+func runPeek(svc *sqs.Client, queue string, count int, pretty bool, contentType string, rules []redactRule) bool {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		logAwsError("Failed to resolve queue", err)
+		return false
+	}
+
+	resolved := invocation{command: activeCommand, source: queueNameFromURL(queueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			logAwsError("Peek blocked by policy", err)
+			return false
+		}
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Queue URL: %s", queueURL))
+	fmt.Println()
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shown := 0
+	contentTypes := map[string]int{}
+
+	var filter func(*types.Message) bool
+	if contentType != "" {
+		filter = func(message *types.Message) bool {
+			return detectContentType(aws.ToString(message.Body)) == contentType
+		}
+	}
+
+	_, err = mover.New(svc, nil).Move(ctx, mover.Options{
+		SourceQueueURL:        queueURL,
+		Limit:                 count,
+		MaxRetries:            defaultMaxRetries,
+		VisibilityTimeout:     peekVisibilityTimeout,
+		AttributeNames:        []string{string(types.QueueAttributeNameAll)},
+		MessageAttributeNames: []string{"All"},
+		Copy:                  true,
+		Filter:                filter,
+		ReleaseSkipped:        true,
+		Handle: func(ctx context.Context, messages []*types.Message) (mover.Result, error) {
+			for _, message := range messages {
+				shown++
+				contentTypes[printMessage(shown, message, pretty, rules)]++
+			}
+			return mover.Result{Moved: len(messages)}, nil
+		},
+	})
+
+	if err != nil {
+		logAwsError("Failed to read messages", err)
+		return false
+	}
+
+	switch {
+	case shown == 0 && contentType != "":
+		log.Info(color.New(color.FgCyan).Sprintf("The queue has no visible %s messages", contentType))
+	case shown == 0:
+		log.Info("The queue has no visible messages")
+	default:
+		log.Info(color.New(color.FgCyan).Sprintf("Showed %d messages (%s), they are visible in the queue again", shown, countContentTypes(contentTypes)))
+	}
+
+	return true
+}
+
+// printMessage prints a message, with the fields rules match masked, and
+// returns the content type of its body.
+func printMessage(n int, message *types.Message, pretty bool, rules []redactRule) string {
+	bold := color.New(color.Bold)
+	// A body that can't be redacted isn't shown.
+	body, err := redactBody(aws.ToString(message.Body), rules)
+	if err != nil {
+		body = fmt.Sprintf("(body withheld: %s)", err)
+	}
+	contentType := detectContentType(body)
+
+	bold.Printf("Message %d: %s\n", n, aws.ToString(message.MessageId))
+	fmt.Printf("  Content type: %s\n", contentType)
+
+	names := make([]string, 0, len(message.Attributes))
+	for name := range message.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := message.Attributes[name]
+		if strings.HasSuffix(name, "Timestamp") {
+			if t := timestampAttribute(message, types.MessageSystemAttributeName(name)); !t.IsZero() {
+				value = t.UTC().Format(time.RFC3339)
+			}
+		}
+		fmt.Printf("  %s: %s\n", name, value)
+	}
+
+	names = names[:0]
+	for name := range message.MessageAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := message.MessageAttributes[name]
+		if value.BinaryValue != nil {
+			fmt.Printf("  %s (%s): %d bytes\n", name, aws.ToString(value.DataType), len(value.BinaryValue))
+		} else {
+			fmt.Printf("  %s (%s): %s\n", name, aws.ToString(value.DataType), aws.ToString(value.StringValue))
+		}
+	}
+
+	if pretty && contentType == "json" {
+		body = indentJSON(body)
+	}
+
+	fmt.Println()
+	fmt.Println(body)
+	fmt.Println()
+
+	return contentType
+}
+
+// countContentTypes lists the number of messages of each content type, in
+// the order of contentTypes.
+func countContentTypes(found map[string]int) string {
+	var counts []string
+	for _, contentType := range contentTypes {
+		if n := found[contentType]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, contentType))
+		}
+	}
+
+	return strings.Join(counts, ", ")
+}
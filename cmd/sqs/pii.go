@@ -0,0 +1,229 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+type piiPattern struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var piiPatterns = []piiPattern{
+	{name: "email address", re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{name: "card number", re: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), valid: cardNumberValid},
+	{name: "social security number", re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+}
+
+// piiFindings counts the sampled messages that matched each kind of PII.
+type piiFindings struct {
+	sampled int
+	matches map[string]int
+}
+
+func (f piiFindings) found() bool {
+	return len(f.matches) > 0
+}
+
+// kinds returns the names of the PII kinds found, sorted for stable output.
+func (f piiFindings) kinds() []string {
+	kinds := make([]string, 0, len(f.matches))
+	for kind := range f.matches {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+// detectPII returns the names of the PII kinds that appear in body.
+func detectPII(body string) []string {
+	var kinds []string
+
+	for _, pattern := range piiPatterns {
+		for _, match := range pattern.re.FindAllString(body, -1) {
+			if pattern.valid == nil || pattern.valid(match) {
+				kinds = append(kinds, pattern.name)
+				break
+			}
+		}
+	}
+
+	return kinds
+}
+
+// sampleVisibilityTimeout hides the sampled messages while they are checked.
+// They are released straight after.
+const sampleVisibilityTimeout = 30
+
+// scanForPII samples up to limit messages from the queue, checks the bodies
+// that would be sent, once masked by rules, for likely PII and then releases
+// the messages again.
+func scanForPII(svc *sqs.Client, queueURL string, limit int, rules []redactRule) (piiFindings, error) {
+	findings := piiFindings{matches: map[string]int{}}
+	held := map[string]*types.Message{}
+
+	defer releaseMessages(svc, queueURL, held)
+
+	for findings.sampled < limit {
+		batch := limit - findings.sampled
+		if batch > 10 {
+			batch = 10
+		}
+
+		resp, err := svc.ReceiveMessage(runCtx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			VisibilityTimeout:   sampleVisibilityTimeout,
+			MaxNumberOfMessages: int32(batch),
+		}, mover.ShortPoll)
+
+		if err != nil {
+			return findings, err
+		}
+
+		if len(resp.Messages) == 0 {
+			break
+		}
+
+		for i := range resp.Messages {
+			message := &resp.Messages[i]
+			if _, ok := held[*message.MessageId]; ok {
+				continue
+			}
+
+			held[*message.MessageId] = message
+			findings.sampled++
+
+			// A body that can't be redacted fails the run, so it is
+			// scanned as it is.
+			body, err := redactBody(*message.Body, rules)
+			if err != nil {
+				body = *message.Body
+			}
+
+			for _, kind := range detectPII(decodeBody(body)) {
+				findings.matches[kind]++
+			}
+		}
+	}
+
+	return findings, nil
+}
+
+// crossAccount reports whether any destination is known to belong to an
+// account other than the source's. A side whose account can't be told, such
+// as a sink or an emulator queue, doesn't make a move cross-account.
+func crossAccount(sourceQueueURL string, destinations []string) bool {
+	sourceAccount, _ := resourceLocation(sourceQueueURL)
+	if sourceAccount == "" {
+		return false
+	}
+
+	for _, destination := range destinations {
+		if account, _ := resourceLocation(destination); account != "" && account != sourceAccount {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queueAccountID extracts the owning account from a queue URL of the form
+// https://sqs.<region>.amazonaws.com/<account>/<name>.
+func queueAccountID(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+
+	// ElasticMQ names queues /queue/<name> when no account is configured.
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "queue" {
+		return ""
+	}
+
+	return parts[0]
+}
+
+// cardRanges are the issuer prefixes of the card networks, from low to high,
+// and the lengths of their numbers.
+var cardRanges = []struct {
+	low, high string
+	lengths   []int
+}{
+	{"4", "4", []int{13, 16, 19}},                 // Visa
+	{"51", "55", []int{16}},                       // Mastercard
+	{"2221", "2720", []int{16}},                   // Mastercard
+	{"34", "34", []int{15}},                       // American Express
+	{"37", "37", []int{15}},                       // American Express
+	{"6011", "6011", []int{16, 17, 18, 19}},       // Discover
+	{"644", "649", []int{16, 17, 18, 19}},         // Discover
+	{"65", "65", []int{16, 17, 18, 19}},           // Discover
+	{"3528", "3589", []int{16, 17, 18, 19}},       // JCB
+	{"300", "305", []int{14, 15, 16, 17, 18, 19}}, // Diners Club
+	{"36", "36", []int{14, 15, 16, 17, 18, 19}},   // Diners Club
+	{"38", "39", []int{16, 17, 18, 19}},           // Diners Club
+	{"62", "62", []int{16, 17, 18, 19}},           // UnionPay
+}
+
+// cardNumberValid reports whether a run of digits, possibly separated by
+// spaces or dashes, is a card number: it starts with the prefix of a card
+// network, has a length that network issues and passes the Luhn check. Other
+// long numbers, such as timestamps in milliseconds, don't count.
+func cardNumberValid(match string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+
+	for _, r := range cardRanges {
+		if len(digits) < len(r.low) {
+			continue
+		}
+
+		prefix := digits[:len(r.low)]
+		if prefix < r.low || prefix > r.high {
+			continue
+		}
+
+		for _, length := range r.lengths {
+			if len(digits) == length {
+				return luhnValid(digits)
+			}
+		}
+	}
+
+	return false
+}
+
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		digits++
+		double = !double
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectPII(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "visa", body: `{"card":"4111111111111111"}`, want: []string{"card number"}},
+		{name: "visa with spaces", body: `card 4111 1111 1111 1111 on file`, want: []string{"card number"}},
+		{name: "amex with dashes", body: `{"card":"3782-822463-10005"}`, want: []string{"card number"}},
+		{name: "mastercard 2 series", body: `{"card":"2221000000000009"}`, want: []string{"card number"}},
+		{name: "failed luhn", body: `{"card":"4111111111111112"}`},
+		{name: "visa of the wrong length", body: `{"card":"41111111111111"}`},
+		{name: "epoch milliseconds", body: `{"sent_at":1760000000008}`},
+		{name: "order id", body: `{"order":9000123456789016}`},
+		{name: "email", body: `{"to":"jane@example.com"}`, want: []string{"email address"}},
+		{name: "ssn", body: `{"ssn":"078-05-1120"}`, want: []string{"social security number"}},
+		{name: "several", body: `jane@example.com 4111111111111111`, want: []string{"email address", "card number"}},
+		{name: "nothing", body: `{"id":42,"status":"failed"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := detectPII(test.body); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("detectPII(%s) = %q, want %q", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCrossAccount(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		destinations []string
+		want         bool
+	}{
+		{name: "same account", source: ordersDLQ, destinations: []string{ordersQueue}},
+		{name: "other account", source: ordersDLQ, destinations: []string{foreignEU}, want: true},
+		{name: "topic in another account", source: ordersDLQ, destinations: []string{foreignSNS}, want: true},
+		{name: "topic in the same account", source: ordersDLQ, destinations: []string{localSNS}},
+		{name: "one of several", source: ordersDLQ, destinations: []string{ordersQueue, foreignEU}, want: true},
+		{name: "s3 sink", source: ordersDLQ, destinations: []string{s3Sink}},
+		{name: "emulator destination", source: ordersDLQ, destinations: []string{emulatorDLQ}},
+		{name: "emulator source", source: emulatorDLQ, destinations: []string{ordersQueue}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := crossAccount(test.source, test.destinations); got != test.want {
+				t.Errorf("crossAccount(%s, %q) = %v, want %v", test.source, test.destinations, got, test.want)
+			}
+		})
+	}
+}
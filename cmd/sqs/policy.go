@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultPolicyPath is where administrators install the operation policy for
+// shared binaries. SQSMOVER_POLICY can point at another file; both are
+// enforced when present.
+const defaultPolicyPath = "/etc/sqsmover/policy.yaml"
+
+// operationPolicy restricts what a single invocation may do. Empty
+// allow-lists permit everything.
+type operationPolicy struct {
+	Commands          stringList `yaml:"commands"`
+	SourceQueues      stringList `yaml:"source-queues"`
+	DestinationQueues stringList `yaml:"destination-queues"`
+	DeniedFlags       stringList `yaml:"denied-flags"`
+	ReadOnly          bool       `yaml:"read-only"`
+
+	path string
+}
+
+// invocation describes what the command line asked for.
+type invocation struct {
+	command     string
+	source      string
+	destination string
+	flags       []string
+}
+
+func loadPolicies() ([]operationPolicy, error) {
+	files, err := readAdminFiles(defaultPolicyPath, "SQSMOVER_POLICY")
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]operationPolicy, 0, len(files))
+
+	for _, file := range files {
+		p := operationPolicy{path: file.path}
+		if err := yaml.UnmarshalStrict(file.data, &p); err != nil {
+			return nil, fmt.Errorf("parsing policy %s: %s", file.path, err)
+		}
+
+		for _, pattern := range append(append(stringList{}, p.SourceQueues...), p.DestinationQueues...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("parsing policy %s: bad queue pattern %q", file.path, pattern)
+			}
+		}
+
+		policies = append(policies, p)
+	}
+
+	return policies, nil
+}
+
+// currentInvocation inspects the command line that kingpin parsed.
+func currentInvocation(command string) invocation {
+	inv := invocation{command: command, source: *sourceQueue, destination: firstDestination()}
+	if inv.command == "" {
+		inv.command = "move"
+	}
+
+	// References and globs are checked once they have been resolved to queues.
+	if isQueueReference(inv.source) || isQueuePattern(inv.source) {
+		inv.source = ""
+	}
+	if isQueueReference(inv.destination) {
+		inv.destination = ""
+	}
+
+	// Flags set by the tags of the source queue count as given.
+	inv.flags = append(givenFlags(), tagFlags...)
+
+	return inv
+}
+
+// givenFlags lists the flags on the command line and those a named move of
+// the config file set.
+func givenFlags() []string {
+	// Flags set by a named move of the config file count as given.
+	flags := append([]string{}, configFlags...)
+
+	context, err := kingpin.CommandLine.ParseContext(os.Args[1:])
+	if err != nil {
+		return flags
+	}
+
+	for _, element := range context.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			flags = append(flags, flag.Model().Name)
+		}
+	}
+
+	return flags
+}
+
+// allow returns an error describing the first rule the invocation breaks.
+func (p operationPolicy) allow(inv invocation) error {
+	if len(p.Commands) > 0 && !p.Commands.contains(inv.command) {
+		return fmt.Errorf("command %q is not permitted by %s", inv.command, p.path)
+	}
+
+	if inv.source != "" && !matchesAny(p.SourceQueues, inv.source) {
+		return fmt.Errorf("source queue %q is not permitted by %s", inv.source, p.path)
+	}
+
+	if inv.destination != "" && !matchesAny(p.DestinationQueues, inv.destination) {
+		return fmt.Errorf("destination queue %q is not permitted by %s", inv.destination, p.path)
+	}
+
+	for _, flag := range inv.flags {
+		if p.DeniedFlags.contains(flag) {
+			return fmt.Errorf("flag --%s is not permitted by %s", flag, p.path)
+		}
+	}
+
+	return nil
+}
+
+// allowDestination checks the operation policies against a queue a command
+// sends to once it was resolved, such as the side queues of a move.
+func allowDestination(queueURL string) error {
+	resolved := invocation{command: activeCommand, destination: queueNameFromURL(queueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchesAny reports whether value matches one of the glob patterns. An
+// empty pattern list matches everything.
+func matchesAny(patterns stringList, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOperationPolicyAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy operationPolicy
+		inv    invocation
+
+		// wantErr is part of the error, or empty when the invocation is
+		// allowed.
+		wantErr string
+	}{
+		{name: "empty policy", inv: invocation{command: "move", source: "orders_dlq", destination: "orders"}},
+		{name: "allowed command", policy: operationPolicy{Commands: stringList{"move", "peek"}}, inv: invocation{command: "peek"}},
+		{name: "command not allowed", policy: operationPolicy{Commands: stringList{"peek"}}, inv: invocation{command: "purge"}, wantErr: `command "purge"`},
+		{name: "source matches a glob", policy: operationPolicy{SourceQueues: stringList{"*_dlq"}}, inv: invocation{command: "move", source: "orders_dlq"}},
+		{name: "source doesn't match", policy: operationPolicy{SourceQueues: stringList{"*_dlq"}}, inv: invocation{command: "move", source: "orders"}, wantErr: `source queue "orders"`},
+		{name: "unresolved source isn't checked", policy: operationPolicy{SourceQueues: stringList{"*_dlq"}}, inv: invocation{command: "move"}},
+		{name: "destination matches", policy: operationPolicy{DestinationQueues: stringList{"orders", "payments"}}, inv: invocation{command: "move", destination: "payments"}},
+		{name: "destination doesn't match", policy: operationPolicy{DestinationQueues: stringList{"orders"}}, inv: invocation{command: "move", destination: "billing"}, wantErr: `destination queue "billing"`},
+		{name: "denied flag", policy: operationPolicy{DeniedFlags: stringList{"purge-source"}}, inv: invocation{command: "move", flags: []string{"limit", "purge-source"}}, wantErr: "flag --purge-source"},
+		{name: "other flags", policy: operationPolicy{DeniedFlags: stringList{"purge-source"}}, inv: invocation{command: "move", flags: []string{"limit"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.policy.path = "policy.yaml"
+
+			err := test.policy.allow(test.inv)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("allow = %v, want the invocation allowed", err)
+			case test.wantErr != "" && err == nil:
+				t.Errorf("allow permitted the invocation, want an error about %q", test.wantErr)
+			case test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr):
+				t.Errorf("allow = %v, want an error about %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    operationPolicy
+		wantErr string
+	}{
+		{
+			name: "lists and read-only",
+			yaml: "commands: [move, peek]\nsource-queues: ['*_dlq']\ndestination-queues: orders\ndenied-flags: [purge-source]\nread-only: true\n",
+			want: operationPolicy{
+				Commands:          stringList{"move", "peek"},
+				SourceQueues:      stringList{"*_dlq"},
+				DestinationQueues: stringList{"orders"},
+				DeniedFlags:       stringList{"purge-source"},
+				ReadOnly:          true,
+			},
+		},
+		{name: "unknown key", yaml: "command: [move]\n", wantErr: "parsing policy"},
+		{name: "bad queue pattern", yaml: "source-queues: ['[orders']\n", wantErr: "bad queue pattern"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(test.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("SQSMOVER_POLICY", path)
+
+			policies, err := loadPolicies()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("loadPolicies = %v, want an error about %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadPolicies failed: %s", err)
+			}
+
+			if len(policies) != 1 {
+				t.Fatalf("loadPolicies returned %d policies, want 1", len(policies))
+			}
+
+			test.want.path = path
+			if !reflect.DeepEqual(policies[0], test.want) {
+				t.Errorf("loadPolicies = %+v, want %+v", policies[0], test.want)
+			}
+		})
+	}
+}
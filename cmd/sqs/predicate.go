@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// predicate tests a message body with a JSONPath expression. It is written as
+// `<path>` (the path exists), `<path> == <json>`, `<path> != <json>` or
+// `<path> =~ <regexp>`, for example `$.type == "healthcheck"`. A path that
+// matches several values satisfies the predicate when any of them does.
+type predicate struct {
+	expr  string
+	path  jsonPath
+	op    string
+	value interface{}
+	re    *regexp.Regexp
+}
+
+var predicateOperators = []string{"==", "!=", "=~"}
+
+func parsePredicate(expr string) (predicate, error) {
+	p := predicate{expr: expr}
+	left, right := expr, ""
+
+	for _, op := range predicateOperators {
+		if i := indexOutsideQuotes(expr, op); i != -1 {
+			p.op = op
+			left, right = expr[:i], strings.TrimSpace(expr[i+len(op):])
+			break
+		}
+	}
+
+	path, err := parseJSONPath(left)
+	if err != nil {
+		return p, err
+	}
+	p.path = path
+
+	switch p.op {
+	case "":
+		return p, nil
+	case "=~":
+		pattern := right
+		if len(pattern) >= 2 && (pattern[0] == '/' || pattern[0] == '"') && pattern[len(pattern)-1] == pattern[0] {
+			pattern = pattern[1 : len(pattern)-1]
+		}
+
+		p.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return p, fmt.Errorf("predicate %q: %s", expr, err)
+		}
+
+		return p, nil
+	}
+
+	// The value must be one JSON literal, so that `== 1 2` or `== "a" x`
+	// are refused rather than compared with their first value.
+	decoder := json.NewDecoder(strings.NewReader(right))
+	decoder.UseNumber()
+	if err := decoder.Decode(&p.value); err != nil {
+		return p, fmt.Errorf("predicate %q: %s is not a JSON value", expr, right)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return p, fmt.Errorf("predicate %q: %s is not a single JSON value", expr, right)
+	}
+
+	return p, nil
+}
+
+// matches reports whether the JSON body satisfies the predicate. Bodies that
+// aren't JSON never match.
+func (p predicate) matches(body string) bool {
+	doc, ok := decodeJSON(decodeBody(body))
+	if !ok {
+		return false
+	}
+
+	return p.matchesDocument(doc)
+}
+
+func (p predicate) matchesDocument(doc interface{}) bool {
+	values := p.path.get(doc)
+
+	if p.op == "" {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		switch p.op {
+		case "==":
+			if jsonEqual(value, p.value) {
+				return true
+			}
+		case "!=":
+			if !jsonEqual(value, p.value) {
+				return true
+			}
+		case "=~":
+			if s, ok := value.(string); ok && p.re.MatchString(s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decodeJSON parses body keeping numbers exact.
+func decodeJSON(body string) (interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+
+	return doc, true
+}
+
+// jsonEqual compares two values decoded with UseNumber. Numbers are equal
+// when they have the same exact value however they are written, such as 1,
+// 1.0 and 1e0, also inside objects and arrays; they are never rounded to
+// float64, so large IDs only match themselves.
+func jsonEqual(a interface{}, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		exactA, okA := new(big.Rat).SetString(a.String())
+		exactB, okB := new(big.Rat).SetString(b.String())
+		if !okA || !okB {
+			return a == b
+		}
+
+		return exactA.Cmp(exactB) == 0
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return a == b
+	}
+}
+
+// indexOutsideQuotes finds op in s, ignoring occurrences inside quoted
+// strings, /regexp/ values and bracketed path segments. A slash only starts
+// a regexp right after an operator, since member names may contain one.
+func indexOutsideQuotes(s string, op string) int {
+	var quote byte
+	depth := 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && endsWithOperator(s[:i]):
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], op):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// endsWithOperator reports whether s, ignoring trailing spaces, ends with a
+// predicate operator.
+func endsWithOperator(s string) bool {
+	s = strings.TrimRight(s, " \t")
+	for _, op := range predicateOperators {
+		if strings.HasSuffix(s, op) {
+			return true
+		}
+	}
+
+	return false
+}
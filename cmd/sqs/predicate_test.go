@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestPredicateMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		body string
+		want bool
+	}{
+		{"path exists", `$.type`, `{"type":"order"}`, true},
+		{"path missing", `$.type`, `{"kind":"order"}`, false},
+		{"string equal", `$.type == "healthcheck"`, `{"type":"healthcheck"}`, true},
+		{"string not equal", `$.type != "healthcheck"`, `{"type":"order"}`, true},
+		{"integer equals decimal", `$.n == 1`, `{"n":1.0}`, true},
+		{"decimal equals integer", `$.n == 1.0`, `{"n":1}`, true},
+		{"exponent equals integer", `$.n == 1e0`, `{"n":1}`, true},
+		{"large integer equals itself", `$.id == 12345678901234567890`, `{"id":12345678901234567890}`, true},
+		{"large integers one apart", `$.id == 12345678901234567891`, `{"id":12345678901234567890}`, false},
+		{"number isn't a string", `$.n == 1`, `{"n":"1"}`, false},
+		{"objects compare by value", `$.a == {"x":1.0}`, `{"a":{"x":1}}`, true},
+		{"regexp with an operator inside", `$.s =~ /a==b/`, `{"s":"xa==by"}`, true},
+		{"regexp with an operator inside, no match", `$.s =~ /a==b/`, `{"s":"a=b"}`, false},
+		{"operator inside a bracketed member", `$['a==b'] == 1`, `{"a==b":1}`, true},
+		{"any of several values", `$.items[*].n == 2`, `{"items":[{"n":1},{"n":2}]}`, true},
+		{"body that isn't JSON", `$.type`, `not json`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := parsePredicate(test.expr)
+			if err != nil {
+				t.Fatalf("parsePredicate(%q) failed: %s", test.expr, err)
+			}
+
+			if got := p.matches(test.body); got != test.want {
+				t.Errorf("%q matches %s = %t, want %t", test.expr, test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParsePredicateRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"two numbers", `$.n == 1 2`},
+		{"string followed by text", `$.type == "a" x`},
+		{"unquoted word", `$.type == healthcheck`},
+		{"object followed by another", `$.a != {} {}`},
+		{"missing value", `$.n ==`},
+		{"invalid regexp", `$.s =~ /(/`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parsePredicate(test.expr); err == nil {
+				t.Errorf("parsePredicate(%q) succeeded, want an error", test.expr)
+			}
+		})
+	}
+}
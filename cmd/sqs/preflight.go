@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// preflightEntryID is the ID of the entries of the batches a preflight check
+// sends. It is given twice, so SQS rejects the batch once it has found the
+// caller may make the call.
+const preflightEntryID = "sqsmover-preflight"
+
+// permissionCheck is a call the move makes on a queue.
+type permissionCheck struct {
+	action   string
+	queueURL string
+	call     func(svc *sqs.Client, queueURL string) error
+}
+
+// runPreflight checks, before anything is moved, what would otherwise stop a
+// move halfway through: calls the caller may not make on the queues, FIFO
+// and standard queues on either side, and destinations that take smaller
+// messages than the source holds. Missing permissions are returned as an
+// error, the rest is logged as warnings.
+func runPreflight(sourceSvc *sqs.Client, destinationSvc *sqs.Client, sourceQueueURL string, sourceAttributes map[string]string, destinationURLs []string) error {
+	log.Info(color.New(color.FgCyan).Sprintf("Running preflight checks"))
+
+	var queues []string
+	if activeSink == nil {
+		queues = append(queues, destinationURLs...)
+	}
+
+	checks := []permissionCheck{
+		{"sqs:ReceiveMessage", sourceQueueURL, checkReceive},
+		{"sqs:ChangeMessageVisibility", sourceQueueURL, checkChangeVisibility},
+	}
+	if !*copyMessages {
+		checks = append(checks, permissionCheck{"sqs:DeleteMessage", sourceQueueURL, checkDelete})
+	}
+	for _, queueURL := range append(queues, expireQueueURL, failedQueueURL) {
+		if queueURL != "" {
+			checks = append(checks, permissionCheck{"sqs:SendMessage", queueURL, checkSend})
+		}
+	}
+
+	var denied []string
+	var firstErr error
+	for _, check := range checks {
+		svc := destinationSvc
+		if check.queueURL == sourceQueueURL {
+			svc = sourceSvc
+		}
+
+		err := check.call(svc, check.queueURL)
+		switch {
+		case err == nil:
+		case isAccessDenied(err):
+			logAwsError(fmt.Sprintf("Not allowed to call %s on %s", check.action, queueNameFromURL(check.queueURL)), err)
+			denied = append(denied, fmt.Sprintf("%s on %s", check.action, queueNameFromURL(check.queueURL)))
+			if firstErr == nil {
+				firstErr = err
+			}
+		default:
+			log.Warn(color.New(color.FgYellow).Sprintf("Unable to check %s on %s: %s", check.action, queueNameFromURL(check.queueURL), err))
+		}
+	}
+
+	for _, queueURL := range queues {
+		checkQueuePair(destinationSvc, sourceQueueURL, sourceAttributes, queueURL)
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("the move would be denied %s: %w", strings.Join(denied, ", "), firstErr)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Preflight checks passed"))
+	return nil
+}
+
+// checkReceive asks for more messages than a receive may return, which SQS
+// refuses without handing any over.
+func checkReceive(svc *sqs.Client, queueURL string) error {
+	_, err := svc.ReceiveMessage(runCtx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: 11,
+	}, mover.ShortPoll)
+
+	return authorized(err)
+}
+
+func checkChangeVisibility(svc *sqs.Client, queueURL string) error {
+	entry := types.ChangeMessageVisibilityBatchRequestEntry{Id: aws.String(preflightEntryID), ReceiptHandle: aws.String(preflightEntryID), VisibilityTimeout: 0}
+	_, err := svc.ChangeMessageVisibilityBatch(runCtx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  []types.ChangeMessageVisibilityBatchRequestEntry{entry, entry},
+	})
+
+	return authorized(err)
+}
+
+func checkDelete(svc *sqs.Client, queueURL string) error {
+	entry := types.DeleteMessageBatchRequestEntry{Id: aws.String(preflightEntryID), ReceiptHandle: aws.String(preflightEntryID)}
+	_, err := svc.DeleteMessageBatch(runCtx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  []types.DeleteMessageBatchRequestEntry{entry, entry},
+	})
+
+	return authorized(err)
+}
+
+func checkSend(svc *sqs.Client, queueURL string) error {
+	entry := types.SendMessageBatchRequestEntry{Id: aws.String(preflightEntryID), MessageBody: aws.String(preflightEntryID)}
+	_, err := svc.SendMessageBatch(runCtx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  []types.SendMessageBatchRequestEntry{entry, entry},
+	})
+
+	return authorized(err)
+}
+
+// authorized turns the error of a preflight call into nil when SQS got past
+// checking the caller's permissions and refused the call as invalid, as
+// preflight calls are made to be.
+func authorized(err error) error {
+	if err == nil || isAccessDenied(err) {
+		return err
+	}
+
+	var notDistinct *types.BatchEntryIdsNotDistinct
+	var overLimit *types.OverLimit
+	if errors.As(err, &notDistinct) || errors.As(err, &overLimit) {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidParameterValue", "InvalidParameterValueException":
+			return nil
+		}
+	}
+
+	return err
+}
+
+// checkQueuePair warns about differences between the source and a
+// destination queue that make some messages fail to move or change how
+// they are delivered.
+func checkQueuePair(svc *sqs.Client, sourceQueueURL string, sourceAttributes map[string]string, destinationQueueURL string) {
+	source, destination := queueNameFromURL(sourceQueueURL), queueNameFromURL(destinationQueueURL)
+
+	switch {
+	case !isFifoQueue(sourceQueueURL) && isFifoQueue(destinationQueueURL):
+		log.Warn(color.New(color.FgYellow).Sprintf("%s is a standard queue and %s a FIFO queue. Messages arrive in the order they are received, not the order they were sent, and FIFO throughput limits apply", source, destination))
+	case isFifoQueue(sourceQueueURL) && !isFifoQueue(destinationQueueURL):
+		log.Warn(color.New(color.FgYellow).Sprintf("%s is a FIFO queue and %s a standard queue. Message groups, ordering and deduplication are lost", source, destination))
+	}
+
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(destinationQueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameMaximumMessageSize},
+	})
+	if err != nil {
+		log.Warn(color.New(color.FgYellow).Sprintf("Unable to read the maximum message size of %s: %s", destination, err))
+		return
+	}
+
+	sourceMax, _ := strconv.Atoi(sourceAttributes[string(types.QueueAttributeNameMaximumMessageSize)])
+	destinationMax, _ := strconv.Atoi(attrs.Attributes[string(types.QueueAttributeNameMaximumMessageSize)])
+
+	if destinationMax > 0 && sourceMax > destinationMax {
+		log.Warn(color.New(color.FgYellow).Sprintf("%s takes messages of up to %d bytes, fewer than the %d of %s. Larger messages are refused and stop the move, unless --on-error sets them aside", destination, destinationMax, sourceMax, source))
+	}
+}
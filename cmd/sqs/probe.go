@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// responseQueueAttribute is the message attribute that tells the consumer
+// where to send its reply. It is the name used by the AWS temporary queue
+// clients, so consumers built on them answer probes without changes.
+const responseQueueAttribute = "ResponseQueueUrl"
+
+// runProbe sends a test message to the queue with a temporary reply queue
+// and waits for the consumer to answer on it. It reports whether a reply
+// arrived within the timeout.
+func runProbe(svc *sqs.Client, queue string, body string, groupID string, timeout time.Duration) bool {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		logAwsError("Failed to resolve queue", err)
+		return false
+	}
+
+	if err := allowDestination(queueURL); err != nil {
+		logAwsError("Probe blocked by policy", err)
+		return false
+	}
+
+	probeID := fmt.Sprintf("sqsmover-probe-%d", time.Now().UnixNano())
+
+	created, err := svc.CreateQueue(runCtx, &sqs.CreateQueueInput{
+		QueueName: aws.String(probeID),
+		Attributes: map[string]string{
+			string(types.QueueAttributeNameMessageRetentionPeriod): "60",
+		},
+	})
+	if err != nil {
+		logAwsError("Failed to create the reply queue", err)
+		return false
+	}
+
+	replyQueueURL := aws.ToString(created.QueueUrl)
+	defer func() {
+		if _, err := svc.DeleteQueue(context.WithoutCancel(runCtx), &sqs.DeleteQueueInput{QueueUrl: aws.String(replyQueueURL)}); err != nil {
+			logAwsError("Failed to delete the reply queue "+replyQueueURL, err)
+		}
+	}()
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(body),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			responseQueueAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(replyQueueURL),
+			},
+		},
+	}
+
+	if isFifoQueue(queueURL) {
+		input.MessageGroupId = aws.String(groupID)
+		input.MessageDeduplicationId = aws.String(probeID)
+	}
+
+	sent := time.Now()
+
+	if _, err := svc.SendMessage(runCtx, input); err != nil {
+		logAwsError("Failed to send the probe message", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Sent probe to %s, waiting up to %s for a reply on %s", queueURL, timeout, replyQueueURL))
+
+	deadline := sent.Add(timeout)
+
+	for time.Now().Before(deadline) {
+		wait := int32(time.Until(deadline).Seconds())
+		if wait > 20 {
+			wait = 20
+		}
+
+		resp, err := svc.ReceiveMessage(runCtx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(replyQueueURL),
+			MaxNumberOfMessages: 1,
+			WaitTimeSeconds:     wait,
+		})
+		if err != nil {
+			logAwsError("Failed to receive the probe reply", err)
+			return false
+		}
+
+		if len(resp.Messages) > 0 {
+			log.Info(color.New(color.FgCyan).Sprintf("Reply received after %s: %s", time.Since(sent).Round(time.Millisecond), aws.ToString(resp.Messages[0].Body)))
+			return true
+		}
+	}
+
+	log.Error(color.New(color.FgRed).Sprintf("No reply within %s. The consumer may be down or not sending replies to %s", timeout, responseQueueAttribute))
+	return false
+}
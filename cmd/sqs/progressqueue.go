@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// progressPublisher sends the events of a move as messages to a queue, for
+// dashboards and orchestrators that would rather read a queue than serve an
+// HTTP endpoint. Progress is sent every interval while it changes, and the
+// summary once the move ends.
+type progressPublisher struct {
+	svc      *sqs.Client
+	queueURL string
+	interval time.Duration
+
+	mu      sync.Mutex
+	total   int
+	result  mover.Result
+	changed bool
+	seq     int
+	failing bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var activeProgress *progressPublisher
+
+func newProgressPublisher(svc *sqs.Client, queueURL string, interval time.Duration) *progressPublisher {
+	return &progressPublisher{svc: svc, queueURL: queueURL, interval: interval}
+}
+
+// start sends the started event and begins sending progress towards total
+// messages. Call finish once the move is over.
+func (p *progressPublisher) start(source string, destination string, total int) {
+	p.total = total
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	p.publish("started", map[string]interface{}{"source": source, "destination": destination, "total": total})
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.flush()
+			}
+		}
+	}()
+}
+
+func (p *progressPublisher) update(result mover.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.result = result
+	p.changed = true
+}
+
+// finish stops the periodic sends and sends the last progress, if it wasn't
+// sent yet.
+func (p *progressPublisher) finish() {
+	if p.stop == nil {
+		return
+	}
+
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+
+	p.flush()
+}
+
+func (p *progressPublisher) flush() {
+	p.mu.Lock()
+	if !p.changed {
+		p.mu.Unlock()
+		return
+	}
+
+	result, total := p.result, p.total
+	p.changed = false
+	p.mu.Unlock()
+
+	done := result.Moved + result.Dropped + result.Skipped
+	if done > total {
+		total = done
+	}
+
+	p.publish("progress", map[string]int{
+		"done":    done,
+		"total":   total,
+		"moved":   result.Moved,
+		"sent":    result.Sent,
+		"dropped": result.Dropped,
+		"skipped": result.Skipped,
+		"failed":  result.Failed,
+	})
+}
+
+// publish sends one event as a JSON message with the same fields as
+// --output json, and the event name as the event message attribute. A queue
+// that can't be reached is reported once; the move goes on regardless.
+func (p *progressPublisher) publish(event string, payload interface{}) {
+	body, err := json.Marshal(eventFields(event, payload))
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.mu.Unlock()
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"event": {DataType: aws.String("String"), StringValue: aws.String(event)},
+		},
+	}
+
+	// Events of a run stay in order on a FIFO queue.
+	if isFifoQueue(p.queueURL) {
+		input.MessageGroupId = aws.String(runID)
+		input.MessageDeduplicationId = aws.String(fmt.Sprintf("%s-%d", runID, seq))
+	}
+
+	_, err = p.svc.SendMessage(context.WithoutCancel(runCtx), input)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil && !p.failing {
+		log.Warn(color.New(color.FgYellow).Sprintf("Unable to send progress to %s: %s", queueNameFromURL(p.queueURL), err))
+	}
+	p.failing = err != nil
+}
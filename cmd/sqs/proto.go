@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoCodec decodes base64 encoded Protocol Buffers bodies of one message
+// type, described by a compiled descriptor set (protoc --descriptor_set_out
+// --include_imports).
+type protoCodec struct {
+	messageType protoreflect.MessageType
+}
+
+func newProtoCodec(descriptorPath string, typeName string) (*protoCodec, error) {
+	data, err := ioutil.ReadFile(descriptorPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing descriptor set %s: %s", descriptorPath, err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("loading descriptor set %s: %s", descriptorPath, err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("finding %s in %s: %s", typeName, descriptorPath, err)
+	}
+
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", typeName)
+	}
+
+	return &protoCodec{messageType: dynamicpb.NewMessageType(messageDescriptor)}, nil
+}
+
+func (c *protoCodec) toJSON(body string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", err
+	}
+
+	message := c.messageType.New().Interface()
+	if err := proto.Unmarshal(data, message); err != nil {
+		return "", err
+	}
+
+	encoded, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func (c *protoCodec) fromJSON(original string, document string) (string, error) {
+	message := c.messageType.New().Interface()
+	if err := protojson.Unmarshal([]byte(document), message); err != nil {
+		return "", err
+	}
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/fatih/color"
+)
+
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException":
+		return true
+	}
+
+	return false
+}
+
+// explainSendAccessDenied prints the destination queue policy together with
+// the statement that would let the current caller send to it.
+func explainSendAccessDenied(svc *sqs.Client, destinationQueueURL string) {
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(destinationQueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNamePolicy, types.QueueAttributeNameQueueArn},
+	})
+
+	queueArn := ""
+	if err != nil {
+		logAwsError("Unable to read the destination queue policy", err)
+	} else {
+		if arn, ok := attrs.Attributes[string(types.QueueAttributeNameQueueArn)]; ok {
+			queueArn = arn
+		}
+
+		if policy, ok := attrs.Attributes[string(types.QueueAttributeNamePolicy)]; ok {
+			log.Info(color.New(color.FgCyan).Sprintf("Current destination queue policy:\n%s", indentJSON(policy)))
+		} else {
+			log.Info(color.New(color.FgCyan).Sprintf("The destination queue has no access policy"))
+		}
+	}
+
+	if queueArn == "" {
+		queueArn = queueArnFromURL(destinationQueueURL)
+	}
+
+	if queueArn == "" {
+		queueArn = "<destination queue ARN>"
+	}
+
+	principal := "<your role ARN>"
+	identity, err := sts.NewFromConfig(siblingConfig(svc)).GetCallerIdentity(runCtx, &sts.GetCallerIdentityInput{})
+	if err == nil {
+		principal = principalArn(*identity.Arn)
+	}
+
+	statement := map[string]interface{}{
+		"Sid":       "AllowSqsmoverSend",
+		"Effect":    "Allow",
+		"Principal": map[string]string{"AWS": principal},
+		"Action":    "sqs:SendMessage",
+		"Resource":  queueArn,
+	}
+
+	encoded, _ := json.MarshalIndent(statement, "", "  ")
+	log.Info(color.New(color.FgCyan).Sprintf("Adding this statement to the destination queue policy grants access:\n%s", encoded))
+}
+
+// principalArn turns an assumed-role session ARN into the role ARN that a
+// resource policy has to name, leaving other principals unchanged.
+func principalArn(callerArn string) string {
+	parts := strings.Split(callerArn, ":")
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return callerArn
+	}
+
+	role := strings.Split(strings.TrimPrefix(parts[5], "assumed-role/"), "/")[0]
+
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], role)
+}
+
+// queueArnFromURL builds the queue ARN from a standard AWS queue URL, returning
+// an empty string for URLs it doesn't recognise.
+func queueArnFromURL(queueURL string) string {
+	region, account := queueRegion(queueURL), queueAccountID(queueURL)
+	if region == "" || account == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("arn:aws:sqs:%s:%s:%s", region, account, queueNameFromURL(queueURL))
+}
+
+func indentJSON(document string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(document), "", "  "); err != nil {
+		return document
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// queueReferencePrefixes mark queue references that have to be looked up
+// before the queue they point at is known.
+var queueReferencePrefixes = []string{"tf:", "cfn:", "ssm:", "secretsmanager:"}
+
+func isQueueReference(queueName string) bool {
+	for _, prefix := range queueReferencePrefixes {
+		if strings.HasPrefix(queueName, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveQueueURL turns a queue reference into its URL. Besides plain queue
+// names it understands infrastructure-as-code references:
+//
+//	tf:module.orders.aws_sqs_queue.dlq   a resource address in Terraform state
+//	cfn:orders-stack/DeadLetterQueueUrl  an output of a CloudFormation stack
+//	ssm:/app/orders/dlq-url              a Parameter Store parameter
+//	secretsmanager:orders/queues#dlq     a Secrets Manager secret, optionally a key of a JSON secret
+func resolveQueueURL(svc *sqs.Client, queueName string) (string, error) {
+	switch {
+	case strings.HasPrefix(queueName, "tf:"):
+		value, err := terraformQueueValue(strings.TrimPrefix(queueName, "tf:"))
+		if err != nil {
+			return "", err
+		}
+
+		return queueURLFromValue(svc, value)
+	case strings.HasPrefix(queueName, "cfn:"):
+		value, err := stackOutputValue(siblingConfig(svc), strings.TrimPrefix(queueName, "cfn:"))
+		if err != nil {
+			return "", err
+		}
+
+		return queueURLFromValue(svc, value)
+	case strings.HasPrefix(queueName, "ssm:"):
+		value, err := parameterValue(siblingConfig(svc), strings.TrimPrefix(queueName, "ssm:"))
+		if err != nil {
+			return "", err
+		}
+
+		return queueURLFromValue(svc, value)
+	case strings.HasPrefix(queueName, "secretsmanager:"):
+		value, err := secretValue(siblingConfig(svc), strings.TrimPrefix(queueName, "secretsmanager:"))
+		if err != nil {
+			return "", err
+		}
+
+		return queueURLFromValue(svc, value)
+	}
+
+	return queueURLFromValue(svc, queueName)
+}
+
+// queueURLFromValue accepts a queue URL, ARN or name as found in state files
+// and stack outputs and returns the queue URL. URLs are used as they are, and
+// ARNs are looked up in the account they name, so queues shared from another
+// account can be reached without knowing their owner.
+func queueURLFromValue(svc *sqs.Client, value string) (string, error) {
+	if strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "http://") {
+		return value, checkQueueRegion(svc, value, queueRegion(value))
+	}
+
+	params := &sqs.GetQueueUrlInput{
+		QueueName: aws.String(value),
+	}
+
+	if parts := strings.Split(value, ":"); len(parts) == 6 && parts[0] == "arn" && parts[2] == "sqs" {
+		if err := checkQueueRegion(svc, value, parts[3]); err != nil {
+			return "", err
+		}
+
+		params.QueueName = aws.String(parts[5])
+		params.QueueOwnerAWSAccountId = aws.String(parts[4])
+	}
+
+	resp, err := svc.GetQueueUrl(runCtx, params)
+
+	if err != nil {
+		return "", err
+	}
+
+	return *resp.QueueUrl, nil
+}
+
+// checkQueueRegion fails when a queue URL or ARN names another region than
+// the client's, since SQS only answers for queues in the region it is called
+// in.
+func checkQueueRegion(svc *sqs.Client, queue string, region string) error {
+	clientRegion := svc.Options().Region
+	if region == "" || clientRegion == "" || region == clientRegion {
+		return nil
+	}
+
+	return fmt.Errorf("%s is in %s, not in %s where it would be called; pass its region", queue, region, clientRegion)
+}
+
+// sameQueue reports whether two resolved queue URLs name the same queue. AWS
+// answers for a queue under more than one host, such as the legacy
+// queue.amazonaws.com for us-east-1, so AWS queues are compared by account,
+// region and name.
+func sameQueue(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	if queueNameFromURL(a) != queueNameFromURL(b) || queueAccountID(a) != queueAccountID(b) {
+		return false
+	}
+
+	if queueEndpoint(a) != "" || queueEndpoint(b) != "" {
+		return queueEndpoint(a) == queueEndpoint(b)
+	}
+
+	return orDefault(queueRegion(a), "us-east-1") == orDefault(queueRegion(b), "us-east-1")
+}
+
+// queueNameFromURL returns the last path segment of a queue URL.
+func queueNameFromURL(queueURL string) string {
+	return queueURL[strings.LastIndex(queueURL, "/")+1:]
+}
+
+// siblingConfig returns a config sharing the client's credentials, region
+// and request tracing, for calling other AWS services on behalf of the same
+// caller.
+func siblingConfig(svc *sqs.Client) aws.Config {
+	opts := svc.Options()
+
+	return aws.Config{
+		Region:           opts.Region,
+		Credentials:      opts.Credentials,
+		BaseEndpoint:     opts.BaseEndpoint,
+		HTTPClient:       opts.HTTPClient,
+		RetryMaxAttempts: opts.RetryMaxAttempts,
+		RetryMode:        opts.RetryMode,
+		APIOptions:       opts.APIOptions,
+		Logger:           opts.Logger,
+	}
+}
+
+type terraformState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// terraformQueueValue finds the resource at address in the Terraform state
+// and returns its url attribute.
+func terraformQueueValue(address string) (string, error) {
+	var data []byte
+	var err error
+
+	if *tfState != "" {
+		data, err = ioutil.ReadFile(*tfState)
+	} else {
+		cmd := exec.Command("terraform", "state", "pull")
+		cmd.Dir = *tfDir
+		data, err = cmd.Output()
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("reading terraform state: %s", err)
+	}
+
+	var state terraformState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", fmt.Errorf("parsing terraform state: %s", err)
+	}
+
+	for _, resource := range state.Resources {
+		base := resource.Type + "." + resource.Name
+		if resource.Mode == "data" {
+			base = "data." + base
+		}
+		if resource.Module != "" {
+			base = resource.Module + "." + base
+		}
+
+		for _, instance := range resource.Instances {
+			instanceAddress := base
+			switch key := instance.IndexKey.(type) {
+			case float64:
+				instanceAddress = fmt.Sprintf("%s[%d]", base, int(key))
+			case string:
+				instanceAddress = fmt.Sprintf("%s[%q]", base, key)
+			}
+
+			if address != instanceAddress && !(address == base && len(resource.Instances) == 1) {
+				continue
+			}
+
+			for _, attribute := range []string{"url", "id", "arn"} {
+				if value, ok := instance.Attributes[attribute].(string); ok && value != "" {
+					return value, nil
+				}
+			}
+
+			return "", fmt.Errorf("terraform resource %s has no url attribute", address)
+		}
+	}
+
+	return "", fmt.Errorf("terraform resource %s not found in state", address)
+}
+
+// stackOutputValue returns the value of an output given as <stack>/<output>.
+func stackOutputValue(cfg aws.Config, reference string) (string, error) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("cloudformation reference %q must look like cfn:<stack>/<output>", reference)
+	}
+
+	resp, err := cloudformation.NewFromConfig(cfg).DescribeStacks(runCtx, &cloudformation.DescribeStacksInput{
+		StackName: aws.String(parts[0]),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, stack := range resp.Stacks {
+		for _, output := range stack.Outputs {
+			if aws.ToString(output.OutputKey) == parts[1] || aws.ToString(output.ExportName) == parts[1] {
+				return aws.ToString(output.OutputValue), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("stack %s has no output %s", parts[0], parts[1])
+}
+
+func parameterValue(cfg aws.Config, name string) (string, error) {
+	resp, err := ssm.NewFromConfig(cfg).GetParameter(runCtx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(aws.ToString(resp.Parameter.Value)), nil
+}
+
+// secretValue returns a secret string, or one key of it when the reference
+// looks like <secret>#<key> and the secret holds a JSON object.
+func secretValue(cfg aws.Config, reference string) (string, error) {
+	id, key := reference, ""
+	if i := strings.LastIndex(reference, "#"); i != -1 {
+		id, key = reference[:i], reference[i+1:]
+	}
+
+	resp, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(runCtx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(aws.ToString(resp.SecretString))
+	if key == "" {
+		return secret, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object", id)
+	}
+
+	value, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string key %s", id, key)
+	}
+
+	return value, nil
+}
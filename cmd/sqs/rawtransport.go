@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/schemas"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// rawMaxConnsPerHost is how many idle connections to one endpoint the raw
+// transport keeps, enough for the workers of a very concurrent move.
+const rawMaxConnsPerHost = 256
+
+// rawTransport is shared by the raw clients, so every worker of a move, and
+// the source and destination when they share an endpoint, draw on one pool of
+// connections. HTTP/2 is used where the endpoint offers it.
+var rawTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	ForceAttemptHTTP2:   true,
+	MaxIdleConns:        rawMaxConnsPerHost,
+	MaxIdleConnsPerHost: rawMaxConnsPerHost,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// rawClient is the experimental --transport=raw: it signs the receives,
+// sends and deletes of a move and posts them straight to the SQS endpoint,
+// bypassing the middleware stack of the SDK. Every other call goes through
+// the SDK client it wraps. The SDK's own retries are skipped, so throttling
+// is left to --max-retries.
+type rawClient struct {
+	*sqs.Client
+
+	client   *http.Client
+	signer   *v4.Signer
+	protocol smithyhttp.ClientProtocol
+	options  sqs.Options
+
+	// endpoint is resolved once, as it is the same for every call.
+	endpoint    string
+	endpointErr error
+}
+
+// moveClient returns the client a move reaches svc's queues through, timed
+// for the latency report.
+func moveClient(svc *sqs.Client) mover.SQSAPI {
+	return timedClient{transportClient(svc)}
+}
+
+// transportClient returns svc itself, or a raw client with --transport=raw.
+// With --verify-checksums the client checks the digests of what it sends
+// and receives, in place of the SDK's check of bodies alone.
+func transportClient(svc *sqs.Client) mover.SQSAPI {
+	if *verifyChecksums {
+		svc = sqs.New(svc.Options(), func(o *sqs.Options) {
+			o.DisableMessageChecksumValidation = true
+		})
+	}
+
+	var client mover.SQSAPI = svc
+	if *transport == "raw" {
+		client = newRawClient(svc)
+	}
+
+	if *verifyChecksums {
+		client = mover.NewChecksumClient(client)
+	}
+
+	return client
+}
+
+func newRawClient(svc *sqs.Client) *rawClient {
+	options := svc.Options()
+	c := &rawClient{
+		Client:   svc,
+		client:   &http.Client{Transport: rawTransport},
+		signer:   v4.NewSigner(),
+		protocol: options.Protocol,
+		options:  options,
+	}
+
+	endpoint, err := options.EndpointResolverV2.ResolveEndpoint(runCtx, sqs.EndpointParameters{
+		Region:   aws.String(options.Region),
+		Endpoint: options.BaseEndpoint,
+	})
+	if err != nil {
+		c.endpointErr = fmt.Errorf("failed to resolve the SQS endpoint: %w", err)
+	} else {
+		c.endpoint = endpoint.URI.String()
+	}
+
+	return c
+}
+
+func (c *rawClient) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	output := &sqs.ReceiveMessageOutput{}
+	schema := smithy.NewOperationSchema(schemas.ReceiveMessage, schemas.ReceiveMessageRequest, schemas.ReceiveMessageResult)
+	return output, c.call(ctx, "ReceiveMessage", schema, input, output)
+}
+
+func (c *rawClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	output := &sqs.SendMessageBatchOutput{}
+	schema := smithy.NewOperationSchema(schemas.SendMessageBatch, schemas.SendMessageBatchRequest, schemas.SendMessageBatchResult)
+	return output, c.call(ctx, "SendMessageBatch", schema, input, output)
+}
+
+func (c *rawClient) DeleteMessageBatch(ctx context.Context, input *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	output := &sqs.DeleteMessageBatchOutput{}
+	schema := smithy.NewOperationSchema(schemas.DeleteMessageBatch, schemas.DeleteMessageBatchRequest, schemas.DeleteMessageBatchResult)
+	return output, c.call(ctx, "DeleteMessageBatch", schema, input, output)
+}
+
+// call signs and sends one request and decodes its response into output.
+// The request is encoded and the response decoded by the SDK's own protocol,
+// so errors come back with the same types and codes, and retries, --on-error
+// and exit codes treat them alike.
+func (c *rawClient) call(ctx context.Context, operation string, schema *smithy.OperationSchema, input smithy.Serializable, output smithy.Deserializable) error {
+	if *readOnly && !isReadOnlyOperation(operation) {
+		return readOnlyError("SQS", operation)
+	}
+
+	if c.endpointErr != nil {
+		return c.endpointErr
+	}
+
+	body, header, err := c.encode(ctx, operation, schema, input)
+	if err != nil {
+		return &smithy.SerializationError{Err: fmt.Errorf("failed to encode %s: %w", operation, err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build %s: %w", operation, err)
+	}
+	req.Header = header
+
+	credentials, err := c.options.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(digest[:]), "sqs", c.options.Region, time.Now()); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = &smithy.OperationError{ServiceID: "SQS", OperationName: operation, Err: &smithyhttp.RequestSendError{Err: err}}
+		c.trace(operation, input, "", start, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	requestID := resp.Header.Get("X-Amzn-Requestid")
+
+	response := &smithyhttp.Response{Response: resp}
+	if err = c.protocol.DeserializeResponse(ctx, schema, sqs.TypeRegistry, response, output); err != nil {
+		err = &smithy.OperationError{
+			ServiceID:     "SQS",
+			OperationName: operation,
+			Err: &awshttp.ResponseError{
+				ResponseError: &smithyhttp.ResponseError{Response: response, Err: err},
+				RequestID:     requestID,
+			},
+		}
+	}
+
+	c.trace(operation, input, requestID, start, err)
+	return err
+}
+
+// encode returns the body and headers of a request, as the SDK would send
+// them. A receive always carries its WaitTimeSeconds, since a move asks for
+// a short poll with zero and the SDK would leave that out.
+func (c *rawClient) encode(ctx context.Context, operation string, schema *smithy.OperationSchema, input smithy.Serializable) ([]byte, http.Header, error) {
+	req := smithyhttp.NewStackRequest().(*smithyhttp.Request)
+	if err := c.protocol.SerializeRequest(ctx, schema, input, req); err != nil {
+		return nil, nil, err
+	}
+
+	var body []byte
+	if stream := req.GetStream(); stream != nil {
+		var err error
+		if body, err = io.ReadAll(stream); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if operation == "ReceiveMessage" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, nil, err
+		}
+
+		if _, ok := fields["WaitTimeSeconds"]; !ok {
+			fields["WaitTimeSeconds"] = json.RawMessage("0")
+		}
+
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return body, req.Header, nil
+}
+
+// trace logs a raw call with --verbose, like the calls made through the SDK.
+func (c *rawClient) trace(operation string, input smithy.Serializable, requestID string, start time.Time, err error) {
+	if !*verbose && !*debug {
+		return
+	}
+
+	fields := log.Fields{
+		"service":    "SQS",
+		"operation":  operation,
+		"request_id": requestID,
+		"transport":  "raw",
+		"latency":    time.Since(start).Round(time.Millisecond).String(),
+	}
+
+	switch params := input.(type) {
+	case *sqs.ReceiveMessageInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["requested"] = params.MaxNumberOfMessages
+	case *sqs.SendMessageBatchInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["batch"] = len(params.Entries)
+	case *sqs.DeleteMessageBatchInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["batch"] = len(params.Entries)
+	}
+
+	if err != nil {
+		log.WithFields(fields).WithField("error", errorCode(err)).Debug("AWS call failed")
+		return
+	}
+
+	log.WithFields(fields).Debug("AWS call")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// readOnlyErrorCode is the code of the error a call blocked by --read-only
+// fails with.
+const readOnlyErrorCode = "ReadOnlyMode"
+
+// readOnlyOperations are the operations that don't match a read-only prefix
+// but leave queues and their messages as they were: received messages are
+// made visible again with them, and encrypted dumps written and read.
+var readOnlyOperations = map[string]bool{
+	"ChangeMessageVisibility":      true,
+	"ChangeMessageVisibilityBatch": true,
+	"GenerateDataKey":              true,
+	"Decrypt":                      true,
+}
+
+// readOnlyPrefixes start the names of the operations that only read, across
+// SQS and the services the commands look things up in.
+var readOnlyPrefixes = []string{"Get", "List", "Describe", "Head", "Query", "Scan", "BatchGet", "Receive", "AssumeRole"}
+
+// checkReadOnly returns an error when the command can change queues or their
+// messages. Peeking, dumping without --delete, comparing, fingerprinting,
+// watching, listing queues or move tasks and simulating are allowed.
+func checkReadOnly(command string) error {
+	switch command {
+	case inventoryCommand.FullCommand(), watchCommand.FullCommand(), peekCommand.FullCommand(), diffCommand.FullCommand(), compareCommand.FullCommand(), fingerprintCommand.FullCommand(), tasksListCommand.FullCommand():
+		return nil
+	case dumpCommand.FullCommand():
+		if *dumpDelete {
+			return fmt.Errorf("dump --delete can't be used with --read-only")
+		}
+		return nil
+	case moveCommand.FullCommand(), "":
+		if *simulateFrom == "" {
+			return fmt.Errorf("move can't be used with --read-only, except with --simulate-from")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%s can't be used with --read-only", command)
+}
+
+// guardReadOnly makes the config fail every call that isn't read-only
+// before it is sent, so a command that got past checkReadOnly still can't
+// send, delete, purge, create or change anything.
+func guardReadOnly(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("sqsmover.readOnly", blockWrites), middleware.Before)
+	})
+}
+
+func blockWrites(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if operation := middleware.GetOperationName(ctx); !isReadOnlyOperation(operation) {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, readOnlyError(middleware.GetServiceID(ctx), operation)
+	}
+
+	return next.HandleInitialize(ctx, in)
+}
+
+// readOnlyError is the error a call blocked by --read-only fails with.
+func readOnlyError(service string, operation string) error {
+	return &smithy.GenericAPIError{
+		Code:    readOnlyErrorCode,
+		Message: fmt.Sprintf("%s %s isn't called with --read-only", service, operation),
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func isReadOnlyOperation(name string) bool {
+	if readOnlyOperations[name] {
+		return true
+	}
+
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// Attributes --keep-receive-count stamps on moved messages.
+const (
+	receiveCountAttribute = "x-original-receive-count"
+	firstReceiveAttribute = "x-original-first-receive"
+)
+
+// receiveCountBuckets are the upper bounds of the receive count histogram,
+// with a last bucket for the counts above them.
+var receiveCountBuckets = []int{0, 1, 2, 3, 5, 10, 20, 50}
+
+// receiveBucket is one bar of the receive count histogram in the summary.
+type receiveBucket struct {
+	Receives string `json:"receives"`
+	Messages int    `json:"messages"`
+}
+
+// receiveReport sums up how often the moved messages were received before
+// the move, which for a dead-letter queue tells how many times they failed.
+type receiveReport struct {
+	Histogram         []receiveBucket `json:"histogram"`
+	Max               int             `json:"max"`
+	FirstReceivedFrom *time.Time      `json:"first_received_from,omitempty"`
+	FirstReceivedTo   *time.Time      `json:"first_received_to,omitempty"`
+}
+
+// receiveCounts collects the receive counts of the messages a run moved.
+// Workers add to it concurrently.
+type receiveCounts struct {
+	mu       sync.Mutex
+	counts   []int
+	max      int
+	earliest time.Time
+	latest   time.Time
+}
+
+// activeReceives is started afresh by every move.
+var activeReceives = &receiveCounts{}
+
+// originalReceiveCount returns how often a message was received before the
+// move: its ApproximateReceiveCount less the receive of the move itself.
+func originalReceiveCount(message *types.Message) (int, bool) {
+	value, ok := message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]
+	if !ok {
+		return 0, false
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(count-1, 0), true
+}
+
+// record counts the messages of a batch once it was sent.
+func (r *receiveCounts) record(messages []*types.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counts == nil {
+		r.counts = make([]int, len(receiveCountBuckets)+1)
+	}
+
+	for _, message := range messages {
+		count, ok := originalReceiveCount(message)
+		if !ok {
+			continue
+		}
+
+		bucket := len(receiveCountBuckets)
+		for i, bound := range receiveCountBuckets {
+			if count <= bound {
+				bucket = i
+				break
+			}
+		}
+		r.counts[bucket]++
+		r.max = max(r.max, count)
+
+		first := timestampAttribute(message, types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp)
+		if first.IsZero() {
+			continue
+		}
+		if r.earliest.IsZero() || first.Before(r.earliest) {
+			r.earliest = first
+		}
+		if first.After(r.latest) {
+			r.latest = first
+		}
+	}
+}
+
+// report returns the histogram for the summary, or nil when no message was
+// counted.
+func (r *receiveCounts) report() *receiveReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &receiveReport{Max: r.max}
+	if !r.earliest.IsZero() {
+		earliest, latest := r.earliest.UTC(), r.latest.UTC()
+		report.FirstReceivedFrom, report.FirstReceivedTo = &earliest, &latest
+	}
+
+	lower := 0
+	for i, messages := range r.counts {
+		label := fmt.Sprintf("%d+", lower)
+		if i < len(receiveCountBuckets) {
+			label = bucketLabel(lower, receiveCountBuckets[i])
+			lower = receiveCountBuckets[i] + 1
+		}
+
+		if messages > 0 {
+			report.Histogram = append(report.Histogram, receiveBucket{Receives: label, Messages: messages})
+		}
+	}
+
+	if len(report.Histogram) == 0 {
+		return nil
+	}
+
+	return report
+}
+
+func bucketLabel(lower int, upper int) string {
+	if lower == upper {
+		return strconv.Itoa(lower)
+	}
+
+	return fmt.Sprintf("%d-%d", lower, upper)
+}
+
+// log prints the histogram of the receive counts.
+func (r *receiveCounts) log() {
+	report := r.report()
+	if report == nil {
+		return
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Receives before the move, by number of messages:"))
+	for _, bucket := range report.Histogram {
+		log.Info(color.New(color.FgCyan).Sprintf("  %-6s %d", bucket.Receives, bucket.Messages))
+	}
+
+	if report.FirstReceivedFrom != nil {
+		log.Info(color.New(color.FgCyan).Sprintf("First received between %s and %s", report.FirstReceivedFrom.Format(time.RFC3339), report.FirstReceivedTo.Format(time.RFC3339)))
+	}
+}
+
+// stampReceiveCount sets the receive count attributes of entry to those of
+// the message it came from. Stamps the message carries already, from an
+// earlier redrive, are replaced.
+func stampReceiveCount(entry *types.SendMessageBatchRequestEntry, origin *types.Message) error {
+	count, ok := originalReceiveCount(origin)
+	if !ok {
+		return nil
+	}
+
+	first := timestampAttribute(origin, types.MessageSystemAttributeNameApproximateFirstReceiveTimestamp)
+
+	added := 0
+	for _, name := range []string{receiveCountAttribute, firstReceiveAttribute} {
+		if _, ok := entry.MessageAttributes[name]; !ok {
+			added++
+		}
+	}
+
+	if len(entry.MessageAttributes)+added > maxMessageAttributes {
+		return fmt.Errorf("message %s already has %d message attributes, so %s can't be added without going over the %d SQS accepts", aws.ToString(origin.MessageId), len(entry.MessageAttributes), receiveCountAttribute, maxMessageAttributes)
+	}
+
+	if entry.MessageAttributes == nil {
+		entry.MessageAttributes = map[string]types.MessageAttributeValue{}
+	}
+
+	entry.MessageAttributes[receiveCountAttribute] = types.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(strconv.Itoa(count)),
+	}
+
+	if !first.IsZero() {
+		entry.MessageAttributes[firstReceiveAttribute] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(first.UTC().Format(time.RFC3339)),
+		}
+	} else {
+		delete(entry.MessageAttributes, firstReceiveAttribute)
+	}
+
+	return nil
+}
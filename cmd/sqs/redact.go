@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// redactedValue replaces every field matched by a redaction rule.
+const redactedValue = "****"
+
+type redactRule struct {
+	spec string
+	path jsonPath
+}
+
+// parseRedactRules parses --redact values of the form `jsonpath:<expr>`. A
+// value may list several rules separated by commas, such as
+// jsonpath:$.card,jsonpath:$.email.
+func parseRedactRules(specs []string) ([]redactRule, error) {
+	rules := make([]redactRule, 0, len(specs))
+
+	for _, spec := range splitRedactSpecs(specs) {
+		expr := strings.TrimPrefix(spec, "jsonpath:")
+		if expr == spec {
+			return nil, fmt.Errorf("unsupported redaction rule %q, expected jsonpath:<expr>", spec)
+		}
+
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, redactRule{spec: spec, path: path})
+	}
+
+	return rules, nil
+}
+
+// splitRedactSpecs splits values at the commas that start another rule, so
+// commas inside an expression are kept.
+func splitRedactSpecs(values []string) []string {
+	var specs []string
+	for _, value := range values {
+		parts := strings.Split(value, ",jsonpath:")
+		specs = append(specs, parts[0])
+		for _, part := range parts[1:] {
+			specs = append(specs, "jsonpath:"+part)
+		}
+	}
+
+	return specs
+}
+
+// redactBody masks every field matched by rules, decoding and re-encoding
+// bodies when a payload codec is set. Bodies that aren't JSON, or that no rule
+// matches, are returned unchanged. It fails closed: a body the codec can't
+// decode, or can't encode once masked, such as when the mask doesn't fit the
+// type of a field, is an error instead of being passed on unmasked.
+func redactBody(body string, rules []redactRule) (string, error) {
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	document, err := decodeForRewrite(body)
+	if err != nil {
+		return "", err
+	}
+
+	doc, ok := decodeJSON(document)
+	if !ok {
+		return body, nil
+	}
+
+	redacted := false
+	for _, rule := range rules {
+		var matched bool
+		doc, matched = rule.path.replace(doc, func(interface{}) interface{} { return redactedValue })
+		redacted = redacted || matched
+	}
+
+	if !redacted {
+		return body, nil
+	}
+
+	encoded, err := encodeJSON(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeBody(body, encoded)
+}
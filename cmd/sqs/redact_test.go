@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// cardCodec returns a codec of the Protocol Buffers type test.Card, with a
+// string email and an int64 number.
+func cardCodec(t *testing.T) *protoCodec {
+	t.Helper()
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("card.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Card"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("email"), JsonName: proto.String("email"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("number"), JsonName: proto.String("number"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}}}
+
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "card.pb")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := newProtoCodec(path, "test.Card")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return codec
+}
+
+// withCodec sets activeCodec for the rest of the test.
+func withCodec(t *testing.T, codec payloadCodec) {
+	previous := activeCodec
+	activeCodec = codec
+	t.Cleanup(func() { activeCodec = previous })
+}
+
+func TestRedactBody(t *testing.T) {
+	card := cardCodec(t)
+
+	cardBody, err := card.fromJSON("", `{"email":"a@example.com","number":"4111111111111111"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		codec payloadCodec
+		body  string
+		rules []string
+
+		// want is the JSON form of the redacted body.
+		want    string
+		wantErr bool
+	}{
+		{name: "json field", body: `{"email":"a@example.com","id":1}`, rules: []string{"jsonpath:$.email"}, want: `{"email":"****","id":1}`},
+		{name: "several rules", body: `{"a":{"b":1},"c":[2]}`, rules: []string{"jsonpath:$.a.b,jsonpath:$.c[0]"}, want: `{"a":{"b":"****"},"c":["****"]}`},
+		{name: "no match", body: `{"id":1}`, rules: []string{"jsonpath:$.email"}, want: `{"id":1}`},
+		{name: "not json", body: "plain text", rules: []string{"jsonpath:$.email"}, want: "plain text"},
+		{name: "no rules", body: `{"email":"a@example.com"}`, want: `{"email":"a@example.com"}`},
+		{name: "typed string field", codec: card, body: cardBody, rules: []string{"jsonpath:$.email"}, want: `{"email":"****","number":"4111111111111111"}`},
+		{name: "typed int field", codec: card, body: cardBody, rules: []string{"jsonpath:$.number"}, wantErr: true},
+		{name: "undecodable body", codec: card, body: "not base64!", rules: []string{"jsonpath:$.email"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withCodec(t, test.codec)
+
+			rules, err := parseRedactRules(test.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := redactBody(test.body, rules)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("redactBody = %q, want an error", got)
+				}
+				if got == test.body {
+					t.Error("the unredacted body was returned along with the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.codec != nil {
+				if got, err = test.codec.toJSON(got); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// protojson spaces its output at random.
+			var compact bytes.Buffer
+			if json.Compact(&compact, []byte(got)) == nil {
+				got = compact.String()
+			}
+
+			if got != test.want {
+				t.Errorf("redactBody = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
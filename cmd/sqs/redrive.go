@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// discoverRedrive finds the queue paired with queue through a redrive policy
+// and returns the URLs of the dead-letter queue and of the queue that
+// dead-letters into it. queue may be either of the two: a queue with a
+// RedrivePolicy is the source of its dead-letter queue, and any other queue
+// is looked up among the dead-letter queues.
+func discoverRedrive(svc *sqs.Client, queue string) (deadLetterURL string, sourceURL string, err error) {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		return "", "", err
+	}
+
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameRedrivePolicy},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if policy, ok := attrs.Attributes[string(types.QueueAttributeNameRedrivePolicy)]; ok {
+		if target := deadLetterTargetArn(policy); target != "" {
+			deadLetterURL, err := queueURLFromValue(svc, target)
+			if err != nil {
+				return "", "", fmt.Errorf("resolving the dead-letter queue %s: %s", target, err)
+			}
+
+			return deadLetterURL, queueURL, nil
+		}
+	}
+
+	var sources []string
+
+	pages := sqs.NewListDeadLetterSourceQueuesPaginator(svc, &sqs.ListDeadLetterSourceQueuesInput{
+		QueueUrl: aws.String(queueURL),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(runCtx)
+		if err != nil {
+			return "", "", err
+		}
+		sources = append(sources, page.QueueUrls...)
+	}
+
+	switch len(sources) {
+	case 0:
+		return "", "", fmt.Errorf("%s has no redrive policy and no queue dead-letters into it", queueNameFromURL(queueURL))
+	case 1:
+		return queueURL, sources[0], nil
+	}
+
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = queueNameFromURL(source)
+	}
+
+	return "", "", fmt.Errorf("%s is the dead-letter queue of %s; pass --source and --destination to pick one", queueNameFromURL(queueURL), strings.Join(names, ", "))
+}
+
+// redrivePair returns the source and destination of a --redrive move: from
+// the dead-letter queue back into the queue it belongs to, or the other way
+// round with --to-dead-letter.
+func redrivePair(svc *sqs.Client, queue string, toDeadLetter bool) (string, string, error) {
+	deadLetterURL, sourceURL, err := discoverRedrive(svc, queue)
+	if err != nil {
+		return "", "", err
+	}
+
+	from, to := deadLetterURL, sourceURL
+	if toDeadLetter {
+		from, to = to, from
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Found the redrive pair, moving %s into %s", queueNameFromURL(from), queueNameFromURL(to)))
+
+	return from, to, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/apex/log"
+)
+
+// runID correlates the logs, notifications and results of one invocation. It
+// is taken from --run-id, so a caller such as a workflow engine can pass its
+// own execution ID, or generated at startup.
+var runID string
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runHandler adds the run ID, and the operator once it is known, to every log
+// entry before handing it on.
+type runHandler struct {
+	next log.Handler
+}
+
+func (h runHandler) HandleLog(e *log.Entry) error {
+	fields := log.Fields{"run_id": runID}
+	if activeOperator != nil {
+		fields["operator"] = activeOperator.Arn
+	}
+	for key, value := range e.Fields {
+		fields[key] = value
+	}
+	e.Fields = fields
+
+	return h.next.HandleLog(e)
+}
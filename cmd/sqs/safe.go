@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+)
+
+// activeAudit is the --audit-log of move, if any.
+var activeAudit *auditLog
+
+// The settings --safe takes for the flags that aren't given.
+const (
+	safeRate        = 50
+	safeRampUp      = 2 * time.Minute
+	safeBounceLimit = 10
+	safeAuditLog    = "sqsmover-audit.jsonl"
+)
+
+// applySafeDefaults fills in the flags --safe guards a production redrive
+// with, leaving those given alone: a paced rate ramped up from a tenth, a
+// stop once moved messages bounce back, an audit log and an archive of what
+// was moved. --safe also asks before moving, see confirmMove.
+func applySafeDefaults() {
+	if *rate == 0 && *byteRate == 0 {
+		*rate = safeRate
+	}
+
+	if *rampUp == 0 {
+		*rampUp = safeRampUp
+	}
+
+	// A requeue brings every message back by design, and a move through
+	// staging receives from a queue of its own.
+	if *bounceLimit == 0 && !*allowSameQueue && !*viaStaging {
+		*bounceLimit = safeBounceLimit
+	}
+
+	if *moveAudit == "" {
+		*moveAudit = safeAuditLog
+	}
+
+	if *archivePath == "" {
+		*archivePath = fmt.Sprintf("sqsmover-archive-%s.jsonl", runID)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Safe mode: archiving moved messages to %s and recording the run in %s", *archivePath, *moveAudit))
+}
+
+// confirmMove asks whether to move about n messages between the queues,
+// unless --yes answered already. Without a terminal to ask on, --yes is
+// required.
+func confirmMove(sourceQueueURL string, destinationQueueURL string, n int) error {
+	if *assumeYes {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("--yes is required with --safe when not running in a terminal")
+	}
+
+	verb := "Move"
+	if *copyMessages {
+		verb = "Copy"
+	}
+
+	answer := prompt(fmt.Sprintf("%s about %d messages from %s to %s? (yes or no)", verb, n, queueNameFromURL(sourceQueueURL), queueNameFromURL(destinationQueueURL)), "no")
+	if answer != "yes" {
+		return fmt.Errorf("answered %q", answer)
+	}
+
+	return nil
+}
+
+// moveAuditRecord describes the move of summary for the audit log.
+func moveAuditRecord(action string, summary runSummary, reason string) auditRecord {
+	record := auditRecord{
+		RunID:       summary.RunID,
+		Action:      action,
+		Source:      summary.Source,
+		Destination: summary.Destination,
+		Limit:       *limit,
+		Status:      summary.Status,
+		Moved:       summary.Moved,
+		StopReason:  summary.StopReason,
+		Error:       reason,
+	}
+
+	if summary.Operator != nil {
+		record.Operator = summary.Operator.Arn
+	}
+
+	return record
+}
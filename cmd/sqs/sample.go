@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// parseSampleShare reads a --sample share such as 10% or 2.5, and returns it
+// as a fraction.
+func parseSampleShare(value string) (float64, error) {
+	share, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%")), 64)
+	if err != nil || share <= 0 || share > 100 {
+		return 0, fmt.Errorf("--sample %q must be a share above 0%% and up to 100%%, such as 10%%", value)
+	}
+
+	return share / 100, nil
+}
+
+// withSample returns f, or a filter matching everything when f is nil, that
+// also leaves out all but share of the messages, picked at random.
+func (f *messageFilter) withSample(share float64) *messageFilter {
+	if f == nil {
+		f = &messageFilter{attributes: map[string]string{}, system: map[string]string{}}
+	}
+	f.sample = share
+
+	return f
+}
+
+// sampled reports whether the sample takes message. The pick is a hash of
+// the message ID and the run ID, so a message received again during the run
+// is picked the same way, and another run picks another sample.
+func (f *messageFilter) sampled(message *types.Message) bool {
+	h := fnv.New64a()
+	h.Write([]byte(runID))
+	h.Write([]byte(aws.ToString(message.MessageId)))
+
+	// FNV barely mixes the last bytes into the high bits, so IDs that only
+	// differ at the end would land close together without the finalizer of
+	// SplitMix64.
+	x := h.Sum64()
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return float64(x>>11)/(1<<53) < f.sample
+}
+
+// sampleCountShare is the share of a source of depth messages that
+// --sample-count picks, so count of them are spread over the whole queue.
+func sampleCountShare(count int, depth int) float64 {
+	if depth <= count {
+		return 1
+	}
+
+	return float64(count) / float64(depth)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+)
+
+// activeHours is the daily window of --active-hours, from start to end after
+// local midnight. A window whose end comes before its start runs past
+// midnight.
+type activeHours struct {
+	spec       string
+	start, end time.Duration
+}
+
+// parseActiveHours parses --active-hours, HH:MM-HH:MM in local time.
+func parseActiveHours(spec string) (*activeHours, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("--active-hours must be HH:MM-HH:MM, not %q", spec)
+	}
+
+	h := &activeHours{spec: spec}
+	for _, bound := range []struct {
+		text  string
+		value *time.Duration
+	}{{from, &h.start}, {to, &h.end}} {
+		clock, err := time.Parse("15:04", strings.TrimSpace(bound.text))
+		if err != nil {
+			return nil, fmt.Errorf("--active-hours must be HH:MM-HH:MM, not %q", spec)
+		}
+		*bound.value = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+
+	if h.start == h.end {
+		return nil, fmt.Errorf("--active-hours %s is empty", spec)
+	}
+
+	return h, nil
+}
+
+// opens returns when the window next opens after now, or now when it is
+// open.
+func (h *activeHours) opens(now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+
+	if h.start < h.end && offset >= h.start && offset < h.end {
+		return now
+	}
+	if h.start > h.end && (offset >= h.start || offset < h.end) {
+		return now
+	}
+
+	if offset < h.start {
+		return midnight.Add(h.start)
+	}
+
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return tomorrow.Add(h.start)
+}
+
+// wait waits until the window is open, or ctx is done, and reports whether
+// it had to wait.
+func (h *activeHours) wait(ctx context.Context) (bool, error) {
+	if h == nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	opens := h.opens(now)
+	if !opens.After(now) {
+		return false, nil
+	}
+
+	log.Warn(color.New(color.FgYellow).Sprintf("Outside --active-hours %s, waiting until %s", h.spec, opens.Format("Mon 15:04")))
+
+	timer := time.NewTimer(opens.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-timer.C:
+		return true, nil
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+const (
+	// serverSidePollInterval is how often a message move task is checked
+	// on.
+	serverSidePollInterval = 5 * time.Second
+
+	// maxServerSideRate is the highest MaxNumberOfMessagesPerSecond SQS
+	// accepts for a message move task.
+	maxServerSideRate = 500
+)
+
+// serverSideBlocker returns why a move can't run as an SQS message move task,
+// or "" when it can. Tasks move every message of a dead-letter queue as it
+// is, into a queue of the same account and region, so anything that looks at
+// or changes single messages has to run in the client.
+func serverSideBlocker(svc *sqs.Client, sourceQueueURL string, destinationQueueURL string) (string, error) {
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{*sampleShare != "" || *sampleCount > 0, "--sample and --sample-count"},
+		{*limitPercent > 0, "--percent"},
+		{*limit > 0, "--limit"},
+		{*follow, "--follow"},
+		{*moveDuration > 0, "--duration"},
+		{*viaStaging, "--via-staging"},
+		{len(destinations()) > 1, "several --destination queues"},
+		{*copyMessages, "--copy"},
+		{*preferNewest, "--prefer-newest"},
+		{activeFilter != nil, "--filter-body, --filter-attribute, --older-than and --newer-than"},
+		{len(dropRules) > 0, "--drop-if"},
+		{priorityRule != nil, "--prioritize"},
+		{len(transforms) > 0, "--transform"},
+		{len(redactRules) > 0, "--redact"},
+		{*enrichDynamo != "", "--enrich-dynamodb"},
+		{*largePayloadBucket != "", "--large-payload-bucket"},
+		{*explode != "", "--explode-jsonpath"},
+		{*aggregateSize > 0, "--aggregate"},
+		{*toCloudEvents || *fromCloudEvents, "--to-cloudevents and --from-cloudevents"},
+		{*stripAttributes || len(*messageAttributes) > 0, "--strip-attributes and --message-attribute"},
+		{*messageGroupID != "", "--message-group-id"},
+		{activeDelay != nil, "--delay-seconds and --delay-spread"},
+		{*deleteAfter > 0, "--delete-after"},
+		{skipFailed, "--on-error"},
+		{activeDedup != nil, "--dedup-store and --resume"},
+		{*dedupeBy != "", "--dedupe-by"},
+		{*verifyOrder, "--verify-order"},
+		{expireAge > 0, "--expire-older-than"},
+		{expiryLifetime > 0, "--attach-expiry"},
+		{!requeueSince.IsZero(), "--allow-same-queue"},
+		{*transport == "raw", "--transport=raw"},
+		{activeSink != nil, "a sink destination"},
+		{*byteRate > 0 || *batchInterval > 0, "--byte-rate and --batch-interval"},
+		{*rate > maxServerSideRate, fmt.Sprintf("--rate above %d", maxServerSideRate)},
+		{*rampUp > 0, "--ramp-up"},
+		{activeBounces != nil, "--bounce-limit"},
+		{activeArchive != nil, "--archive"},
+		{activeManifest != nil, "--audit-file"},
+	}
+
+	var used []string
+	for _, flag := range flags {
+		if flag.set {
+			used = append(used, flag.name)
+		}
+	}
+
+	if len(used) > 0 {
+		return fmt.Sprintf("%s only work client-side", strings.Join(used, ", ")), nil
+	}
+
+	if queueAccountID(sourceQueueURL) != queueAccountID(destinationQueueURL) || queueRegion(sourceQueueURL) != queueRegion(destinationQueueURL) {
+		return "the queues are in different accounts or regions", nil
+	}
+
+	resp, err := svc.ListDeadLetterSourceQueues(runCtx, &sqs.ListDeadLetterSourceQueuesInput{
+		QueueUrl:   aws.String(sourceQueueURL),
+		MaxResults: aws.Int32(1),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.QueueUrls) == 0 {
+		return fmt.Sprintf("%s isn't the dead-letter queue of any queue", queueNameFromURL(sourceQueueURL)), nil
+	}
+
+	return "", nil
+}
+
+// moveServerSide starts an SQS message move task and follows it until it
+// ends. Interrupting the command cancels the task; messages it already moved
+// stay in the destination.
+func moveServerSide(svc *sqs.Client, sourceQueueURL string, destinationQueueURL string, numberOfMessages int, summary *runSummary) bool {
+	arns := make([]string, 2)
+	for i, queueURL := range []string{sourceQueueURL, destinationQueueURL} {
+		arn, err := queueArn(svc, queueURL)
+		if err != nil {
+			logAwsError("Failed to get queue attributes", err)
+			return false
+		}
+		arns[i] = arn
+	}
+
+	input := &sqs.StartMessageMoveTaskInput{
+		SourceArn:      aws.String(arns[0]),
+		DestinationArn: aws.String(arns[1]),
+	}
+	if *rate > 0 {
+		input.MaxNumberOfMessagesPerSecond = aws.Int32(int32(max(*rate, 1)))
+	}
+
+	task, err := svc.StartMessageMoveTask(runCtx, input)
+	if err != nil {
+		logAwsError("Failed to start the message move task", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Started a server-side message move task, SQS moves the messages..."))
+	fmt.Println()
+
+	display := startProgress(numberOfMessages)
+
+	if activeProgress != nil {
+		activeProgress.start(sourceQueueURL, destinationQueueURL, numberOfMessages)
+		defer activeProgress.finish()
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	current := followMoveTask(ctx, svc, input.SourceArn, task.TaskHandle, func(moved int) {
+		summary.Moved, summary.Sent = moved, moved
+
+		display.update(moved)
+		if activeProgress != nil {
+			activeProgress.update(mover.Result{Moved: moved, Sent: moved})
+		}
+	})
+	display.stop()
+
+	if current == nil {
+		summary.StopReason = errorStopReason(ctx.Err())
+		_, err := svc.CancelMessageMoveTask(context.WithoutCancel(runCtx), &sqs.CancelMessageMoveTaskInput{TaskHandle: task.TaskHandle})
+		if err != nil {
+			logAwsError("Failed to cancel the message move task, it keeps running in SQS", err)
+		} else {
+			log.Warn(color.New(color.FgYellow).Sprintf("Cancelled the message move task. Messages it already moved stay in the destination"))
+		}
+		return false
+	}
+
+	switch aws.ToString(current.Status) {
+	case "COMPLETED":
+		fmt.Println()
+		logDone(summary)
+		return true
+	case "FAILED":
+		summary.StopReason = stopTaskFailed
+		log.Error(color.New(color.FgRed).Sprintf("The message move task failed: %s", aws.ToString(current.FailureReason)))
+	default:
+		summary.StopReason = stopTaskCancelled
+		log.Error(color.New(color.FgRed).Sprintf("The message move task was cancelled outside this run"))
+	}
+
+	return false
+}
+
+// followMoveTask polls the task until it ends, reporting the number of
+// messages moved so far, and returns its last state. It returns nil when ctx
+// is done first.
+func followMoveTask(ctx context.Context, svc *sqs.Client, sourceArn *string, handle *string, progress func(moved int)) *types.ListMessageMoveTasksResultEntry {
+	ticker := time.NewTicker(serverSidePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		resp, err := svc.ListMessageMoveTasks(runCtx, &sqs.ListMessageMoveTasksInput{SourceArn: sourceArn})
+		if err != nil {
+			logAwsError("Failed to check on the message move task", err)
+			continue
+		}
+
+		var current *types.ListMessageMoveTasksResultEntry
+		for i, entry := range resp.Results {
+			if aws.ToString(entry.TaskHandle) == aws.ToString(handle) {
+				current = &resp.Results[i]
+			}
+		}
+
+		// Only running tasks keep their handle; once the task ended, it is
+		// the most recent one.
+		if current == nil && len(resp.Results) > 0 {
+			current = &resp.Results[0]
+		}
+		if current == nil {
+			continue
+		}
+
+		progress(int(current.ApproximateNumberOfMessagesMoved))
+
+		switch aws.ToString(current.Status) {
+		case "COMPLETED", "FAILED", "CANCELLED":
+			return current
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// maxSimulationErrors is how many failed batches a simulation describes.
+const maxSimulationErrors = 5
+
+// simulation tallies what a move would do with the messages of a dump file.
+// It runs the filter, drop, expiry, priority and body rewriting steps of a
+// move without receiving, sending or deleting anything.
+type simulation struct {
+	Read        int            `json:"read"`
+	Skipped     int            `json:"skipped"`
+	Prioritized int            `json:"prioritized,omitempty"`
+	Moved       int            `json:"moved"`
+	Sent        int            `json:"sent"`
+	Duplicates  int            `json:"duplicates,omitempty"`
+	Collapsed   int            `json:"collapsed,omitempty"`
+	Expired     int            `json:"expired,omitempty"`
+	Quarantined int            `json:"quarantined,omitempty"`
+	DropRules   map[string]int `json:"drop_rules,omitempty"`
+	Failed      int            `json:"failed"`
+	Errors      []string       `json:"errors,omitempty"`
+	Rewritten   int            `json:"rewritten,omitempty"`
+	Diffs       []bodyDiff     `json:"diffs,omitempty"`
+
+	// batch holds the messages to move until there are ten of them, as a
+	// receive would hand them over.
+	batch []*types.Message
+}
+
+// runSimulation reads the dump at path and reports what a move with the
+// given flags would do with its messages. Nothing is read from or sent to
+// AWS. It reports whether every message would go through without an error.
+func runSimulation(path string) bool {
+	// Expiry is decided the same way whether or not the quarantine queue
+	// exists, so its name stands in for its URL.
+	expireQueueURL = *expireTo
+
+	if *toCloudEvents {
+		mapping, err := newCloudEventsMapping(*ceType, orDefault(*ceSource, orDefault(*sourceQueue, "sqsmover-simulation")))
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Invalid CloudEvents mapping: %s", err))
+			return false
+		}
+		wrapCloudEvents = mapping
+	}
+
+	// Re-pointing needs no AWS calls, only copying does.
+	if *largePayloadBucket != "" {
+		activeLargePayloads = &largePayloads{bucket: *largePayloadBucket}
+	}
+
+	if *dedupeBy != "" {
+		activeCollapse = newRunCollapse(dedupeAttribute)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Simulating the move with the messages of %s. No AWS calls are made", path))
+
+	// The dump stands in for the source, so --percent takes a share of it.
+	if *limitPercent > 0 {
+		total, err := countMessages(path, "jsonl")
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+			return false
+		}
+		*limit = shareOf(total, *limitPercent)
+	}
+
+	if *sampleCount > 0 {
+		total, err := countMessages(path, "jsonl")
+		if err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+			return false
+		}
+		activeFilter = activeFilter.withSample(sampleCountShare(*sampleCount, total))
+		*limit = *sampleCount
+	}
+
+	if len(transforms) > 0 {
+		activeDiffs = &bodyDiffs{sample: *showDiffs}
+	}
+
+	s := &simulation{DropRules: map[string]int{}}
+
+	passes := []func(*types.Message) bool{nil}
+	if priorityRule != nil {
+		matches := func(message *types.Message) bool { return priorityRule.matches(aws.ToString(message.Body)) }
+		passes = []func(*types.Message) bool{matches, func(message *types.Message) bool { return !matches(message) }}
+	}
+
+	for i, pass := range passes {
+		if err := s.run(path, pass, i == 0); err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to read %s: %s", path, err))
+			return false
+		}
+
+		if priorityRule != nil && i == 0 {
+			s.Prioritized = s.Moved
+		}
+	}
+
+	if activeDiffs != nil {
+		s.Rewritten, s.Diffs = activeDiffs.rewritten, activeDiffs.diffs
+	}
+
+	s.report()
+	emitEvent("simulation", s)
+
+	return s.Failed == 0
+}
+
+// run goes through the file once, taking the messages pass selects, or all of
+// them when pass is nil. Only the first pass counts what it read and skipped.
+func (s *simulation) run(path string, pass func(*types.Message) bool, first bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner, err := newDumpScanner(f)
+	if err != nil {
+		return err
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		messages, err := parseLoadLine("jsonl", text, line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+
+		for _, message := range messages {
+			if first {
+				s.Read++
+			}
+
+			if activeFilter != nil && !activeFilter.matches(message) {
+				if first {
+					s.Skipped++
+				}
+				continue
+			}
+
+			if pass != nil && !pass(message) {
+				continue
+			}
+
+			if *limit > 0 && s.taken()+len(s.batch) >= *limit {
+				continue
+			}
+
+			s.take(message)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.flush()
+	return nil
+}
+
+// taken counts the messages a move would have taken from the source so far.
+func (s *simulation) taken() int {
+	dropped := s.Duplicates + s.Expired + s.Quarantined
+	if *dedupeAction == "delete" {
+		dropped += s.Collapsed
+	}
+	for _, n := range s.DropRules {
+		dropped += n
+	}
+
+	return s.Moved + dropped + s.Failed
+}
+
+// take routes one message the way Transfer would: dropped, quarantined, or
+// batched up to be sent to the destination.
+func (s *simulation) take(message *types.Message) {
+	switch {
+	case activeDedup != nil && activeDedup.seen(message):
+		s.Duplicates++
+		return
+	case isExpired(message):
+		if expireQueueURL != "" {
+			s.Quarantined++
+		} else {
+			s.Expired++
+		}
+		return
+	}
+
+	for _, rule := range dropRules {
+		if rule.matches(aws.ToString(message.Body)) {
+			s.DropRules[rule.expr]++
+			return
+		}
+	}
+
+	// Copies held while the first is on its way are collapsed once it was
+	// sent, which a simulated send always is.
+	if activeCollapse != nil && (activeCollapse.duplicate(message) || activeCollapse.hold(message)) {
+		s.Collapsed++
+		return
+	}
+
+	s.batch = append(s.batch, message)
+	if len(s.batch) == 10 {
+		s.flush()
+	}
+}
+
+// flush builds the destination entries of the batched messages, as they
+// would be sent.
+func (s *simulation) flush() {
+	if len(s.batch) == 0 {
+		return
+	}
+
+	entries, err := prepareEntries(s.batch)
+	if err != nil {
+		s.Failed += len(s.batch)
+		if len(s.Errors) < maxSimulationErrors {
+			s.Errors = append(s.Errors, err.Error())
+		}
+	} else {
+		s.Moved += len(s.batch)
+		s.Sent += len(entries)
+		if activeCollapse != nil {
+			activeCollapse.sent(s.batch)
+		}
+	}
+
+	s.batch = s.batch[:0]
+}
+
+// report prints where the messages would go, one line per destination.
+func (s *simulation) report() {
+	destination := orDefault(strings.Join(destinations(), ", "), "the destination")
+
+	fmt.Println()
+	log.Info(color.New(color.FgCyan).Sprintf("Read %d messages, %d would be left in the source by the filter", s.Read, s.Skipped))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tOUTCOME\tMESSAGES")
+	fmt.Fprintf(w, "\tmoved to %s\t%d\n", destination, s.Moved)
+	if s.Sent != s.Moved {
+		fmt.Fprintf(w, "\t  as destination messages\t%d\n", s.Sent)
+	}
+	if len(transforms) > 0 {
+		fmt.Fprintf(w, "\t  with bodies changed by --transform\t%d\n", s.Rewritten)
+	}
+	if priorityRule != nil {
+		fmt.Fprintf(w, "\t  first, matching %s\t%d\n", priorityRule.expr, s.Prioritized)
+	}
+	if s.Quarantined > 0 {
+		fmt.Fprintf(w, "\tquarantined to %s\t%d\n", *expireTo, s.Quarantined)
+	}
+	if s.Expired > 0 {
+		fmt.Fprintf(w, "\tdropped as expired\t%d\n", s.Expired)
+	}
+	if s.Duplicates > 0 {
+		fmt.Fprintf(w, "\tdropped as already moved\t%d\n", s.Duplicates)
+	}
+	if s.Collapsed > 0 {
+		if *dedupeAction == "leave" {
+			fmt.Fprintf(w, "\tleft in the source as duplicates\t%d\n", s.Collapsed)
+		} else {
+			fmt.Fprintf(w, "\tdropped as duplicates\t%d\n", s.Collapsed)
+		}
+	}
+
+	exprs := make([]string, 0, len(s.DropRules))
+	for expr := range s.DropRules {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		fmt.Fprintf(w, "\tdropped by %s\t%d\n", expr, s.DropRules[expr])
+	}
+
+	if s.Failed > 0 {
+		fmt.Fprintf(w, "\twould stop the move\t%d\n", s.Failed)
+	}
+	w.Flush()
+
+	if len(s.Diffs) > 0 {
+		fmt.Println()
+		log.Info(color.New(color.FgCyan).Sprintf("How --transform rewrites bodies, in the first messages it changes:"))
+		activeDiffs.print()
+	}
+
+	if len(s.Errors) > 0 {
+		fmt.Println()
+		for _, err := range s.Errors {
+			log.Error(color.New(color.FgRed).Sprintf("A batch would fail: %s", err))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// sqsScheme starts a destination that names a queue explicitly, such as
+// sqs://orders, next to the sink URLs.
+const sqsScheme = "sqs://"
+
+// destinationSink is the sink a move sends to instead of a queue.
+type destinationSink struct {
+	url  string
+	sink mover.Sink
+}
+
+// activeSink is opened when the destination is a sink URL.
+var activeSink *destinationSink
+
+// isSinkDestination reports whether a destination is the URL of a sink
+// rather than a queue.
+func isSinkDestination(destination string) bool {
+	return mover.IsSink(destination)
+}
+
+// openDestinationSink opens the sink of a destination URL with the
+// credentials and region of the destination side.
+func openDestinationSink(svc *sqs.Client, destination string) (*destinationSink, error) {
+	sink, err := mover.OpenSink(siblingConfig(svc), destination)
+	if err != nil {
+		return nil, err
+	}
+
+	return &destinationSink{url: destination, sink: sink}, nil
+}
+
+// close closes the sink once the move is over. Sends only return once their
+// entries are stored, so a failure here loses nothing and is only logged.
+func (d *destinationSink) close() {
+	if err := d.sink.Close(); err != nil {
+		log.Warn(color.New(color.FgYellow).Sprintf("Failed to close the destination sink %s: %s", d.url, err))
+	}
+}
+
+// destinationHelp describes --destination with the sink schemes registered
+// when the flags are declared: the built-in ones, and those of packages
+// imported by the command for their sinks.
+func destinationHelp() string {
+	schemes := mover.SinkSchemes()
+	for i, scheme := range schemes {
+		schemes[i] = scheme + "://"
+	}
+
+	return fmt.Sprintf("Destination queue or sqs://QUEUE to move messages to, or a sink URL (%s); repeat it or separate queues with commas to spread the messages over several", strings.Join(schemes, ", "))
+}
+
+// checkSinkDestinations returns an error when a destination has a scheme no
+// sink is registered for, or a sink is combined with what only queues
+// support.
+func checkSinkDestinations(queues []string) error {
+	sinks := 0
+	for _, queue := range queues {
+		scheme, ok := mover.SinkScheme(queue)
+		if !ok || scheme == "http" || scheme == "https" {
+			continue
+		}
+
+		if !mover.IsSink(queue) {
+			return fmt.Errorf("no sink is registered for %s:// destinations; the registered schemes are %s", scheme, strings.Join(mover.SinkSchemes(), ", "))
+		}
+		sinks++
+	}
+
+	switch {
+	case sinks == 0:
+		return nil
+	case len(queues) > 1:
+		return fmt.Errorf("a sink destination can't be combined with other destinations")
+	case *viaStaging:
+		return fmt.Errorf("--via-staging needs a queue destination, not a sink")
+	}
+
+	return nil
+}
+
+// destinationClient returns the client a move sends through: the one of
+// moveClient, wrapped to send to the sink when the destination is one.
+func destinationClient(svc *sqs.Client) mover.SQSAPI {
+	if activeSink != nil {
+		return timedClient{mover.NewSinkClient(transportClient(svc), activeSink.url, activeSink.sink)}
+	}
+
+	return moveClient(svc)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// snapshotAttributes are the queue attributes recorded in the summary: the
+// configuration of a queue, as opposed to its depth, which the depth report
+// covers.
+var snapshotAttributes = []string{
+	string(types.QueueAttributeNameQueueArn),
+	string(types.QueueAttributeNameCreatedTimestamp),
+	string(types.QueueAttributeNameLastModifiedTimestamp),
+	string(types.QueueAttributeNameRedrivePolicy),
+	string(types.QueueAttributeNameRedriveAllowPolicy),
+	string(types.QueueAttributeNameMessageRetentionPeriod),
+	string(types.QueueAttributeNameVisibilityTimeout),
+	string(types.QueueAttributeNameDelaySeconds),
+	string(types.QueueAttributeNameMaximumMessageSize),
+	string(types.QueueAttributeNameReceiveMessageWaitTimeSeconds),
+	string(types.QueueAttributeNameKmsMasterKeyId),
+	string(types.QueueAttributeNameKmsDataKeyReusePeriodSeconds),
+	string(types.QueueAttributeNameSqsManagedSseEnabled),
+	string(types.QueueAttributeNameFifoQueue),
+	string(types.QueueAttributeNameContentBasedDeduplication),
+	string(types.QueueAttributeNameDeduplicationScope),
+	string(types.QueueAttributeNameFifoThroughputLimit),
+	string(types.QueueAttributeNamePolicy),
+}
+
+// queueSnapshot is the configuration of a queue when a move started, for
+// reviews that need to know how the queues were set up at the time.
+type queueSnapshot struct {
+	URL        string            `json:"url"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// queueSnapshots are the snapshots of the source and destination queues of
+// a move.
+type queueSnapshots struct {
+	Source       *queueSnapshot  `json:"source,omitempty"`
+	Destinations []queueSnapshot `json:"destinations,omitempty"`
+}
+
+// snapshotQueue keeps the snapshotAttributes of attributes, as returned for
+// All by GetQueueAttributes.
+func snapshotQueue(queueURL string, attributes map[string]string) queueSnapshot {
+	snapshot := queueSnapshot{URL: queueURL, Attributes: map[string]string{}}
+	for _, name := range snapshotAttributes {
+		if value, ok := attributes[name]; ok {
+			snapshot.Attributes[name] = value
+		}
+	}
+
+	return snapshot
+}
+
+// snapshotQueues records the configuration of the source, from the
+// attributes the move read already, and of every destination queue. A
+// destination that can't be read is warned about and left out, since the
+// move itself doesn't need it.
+func snapshotQueues(svc *sqs.Client, sourceQueueURL string, sourceAttributes map[string]string, destinationURLs []string) *queueSnapshots {
+	source := snapshotQueue(sourceQueueURL, sourceAttributes)
+	snapshots := &queueSnapshots{Source: &source}
+
+	if activeSink != nil {
+		return snapshots
+	}
+
+	for _, queueURL := range destinationURLs {
+		attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+		})
+		if err != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Unable to snapshot the attributes of %s: %s", queueNameFromURL(queueURL), err))
+			continue
+		}
+
+		snapshots.Destinations = append(snapshots.Destinations, snapshotQueue(queueURL, attrs.Attributes))
+	}
+
+	return snapshots
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+)
+
+// patternChars start the part of a --source glob that isn't literal.
+const patternChars = "*?["
+
+// plannedMove is the move of one queue matched by a --source glob.
+type plannedMove struct {
+	Source       string
+	Destinations []string
+}
+
+// isQueuePattern reports whether --source is a glob, such as orders-*-dlq,
+// matching several queues.
+func isQueuePattern(queue string) bool {
+	return strings.ContainsAny(queue, patternChars)
+}
+
+// parseDestinationTemplate parses --destination-template, a Go template
+// naming the destination of each source queue from .Source, its name.
+func parseDestinationTemplate(text string) (*template.Template, error) {
+	return template.New("destination").Option("missingkey=error").Funcs(template.FuncMap{
+		"trimSuffix": strings.TrimSuffix,
+		"trimPrefix": strings.TrimPrefix,
+		"replace":    strings.ReplaceAll,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+	}).Parse(text)
+}
+
+// matchingQueues lists the URLs of the queues whose names match pattern,
+// sorted by name. ListQueues is asked for the literal prefix of the pattern
+// only, so the glob itself is matched here.
+func matchingQueues(svc *sqs.Client, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%s is not a valid glob: %s", pattern, err)
+	}
+
+	input := &sqs.ListQueuesInput{MaxResults: aws.Int32(1000)}
+	if prefix := pattern[:strings.IndexAny(pattern, patternChars)]; prefix != "" {
+		input.QueueNamePrefix = aws.String(prefix)
+	}
+
+	var queues []string
+	pages := sqs.NewListQueuesPaginator(svc, input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(runCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, queueURL := range page.QueueUrls {
+			if ok, _ := path.Match(pattern, queueNameFromURL(queueURL)); ok {
+				queues = append(queues, queueURL)
+			}
+		}
+	}
+
+	sort.Slice(queues, func(i, j int) bool {
+		return queueNameFromURL(queues[i]) < queueNameFromURL(queues[j])
+	})
+
+	return queues, nil
+}
+
+// planMoves pairs every queue matching pattern with its destinations: those
+// --destination-template names when tmpl is set, and the --destination
+// queues otherwise. Queues the template maps to themselves are left out
+// with a warning, since a glob like orders-* also matches the queues the
+// dead-letter queues drain into.
+func planMoves(svc *sqs.Client, pattern string, tmpl *template.Template) ([]plannedMove, error) {
+	queues, err := matchingQueues(svc, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]plannedMove, 0, len(queues))
+	for _, queueURL := range queues {
+		name := queueNameFromURL(queueURL)
+		if tmpl == nil {
+			plan = append(plan, plannedMove{Source: queueURL, Destinations: destinations()})
+			continue
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, struct{ Source string }{name}); err != nil {
+			return nil, fmt.Errorf("--destination-template for %s: %s", name, err)
+		}
+
+		destination := strings.TrimSpace(out.String())
+		switch destination {
+		case "":
+			return nil, fmt.Errorf("--destination-template names no destination for %s", name)
+		case name, queueURL:
+			log.Warn(color.New(color.FgYellow).Sprintf("Skipping %s, which --destination-template maps to itself", name))
+			continue
+		}
+
+		plan = append(plan, plannedMove{Source: queueURL, Destinations: []string{destination}})
+	}
+
+	return plan, nil
+}
+
+// runPatternMoves moves every queue matching the --source glob in turn, and
+// prints a report of the moves once all of them ran. It returns the exit
+// code of the first move that failed.
+func runPatternMoves(sourceSvc *sqs.Client, destinationSvc *sqs.Client, rails []guardrails) int {
+	var tmpl *template.Template
+	if *destinationTemplate != "" {
+		var err error
+		if tmpl, err = parseDestinationTemplate(*destinationTemplate); err != nil {
+			log.Error(color.New(color.FgRed).Sprintf("Unable to parse --destination-template: %s", err))
+			return exitUsage
+		}
+	}
+
+	pattern := *sourceQueue
+	plan, err := planMoves(sourceSvc, pattern, tmpl)
+	if err != nil {
+		logAwsError(fmt.Sprintf("Failed to find the queues matching %s", pattern), err)
+		return failureCode(err, exitQueue)
+	}
+
+	if len(plan) == 0 {
+		log.Error(color.New(color.FgRed).Sprintf("No queue matches %s", pattern))
+		return exitQueue
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("%s matches %d queues, moving them in turn:", pattern, len(plan)))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSOURCE\tDESTINATION")
+	for _, move := range plan {
+		fmt.Fprintf(w, "\t%s\t%s\n", queueNameFromURL(move.Source), strings.Join(move.Destinations, ", "))
+	}
+	w.Flush()
+
+	code := 0
+	summaries := make([]runSummary, 0, len(plan))
+
+	for _, move := range plan {
+		if runCtx.Err() != nil {
+			break
+		}
+
+		fmt.Println()
+		log.Info(color.New(color.FgCyan, color.Bold).Sprintf("Moving %s into %s", queueNameFromURL(move.Source), strings.Join(move.Destinations, ", ")))
+
+		*sourceQueue = move.Source
+		*destinationQueues = move.Destinations
+
+		summary := runMove(sourceSvc, destinationSvc, rails)
+		logFinalSummary(summary)
+
+		if code == 0 {
+			code = summary.exitStatus()
+		}
+
+		if summary.Status == "" {
+			summary.Status = "empty"
+		}
+		if summary.Source == "" {
+			summary.Source = move.Source
+		}
+
+		summaries = append(summaries, summary)
+		notifyWebhooks(summary)
+		notifyEmail(summary)
+		emitSummary(summary)
+	}
+
+	*sourceQueue = pattern
+
+	fmt.Println()
+	log.Info(color.New(color.FgCyan).Sprintf("Report for the %d queues matching %s:", len(summaries), pattern))
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSOURCE\tSTATUS\tMOVED\tDROPPED\tFAILED\tERROR")
+	moved, dropped, failed := 0, 0, 0
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "\t%s\t%s\t%d\t%d\t%d\t%s\n", queueNameFromURL(summary.Source), summary.Status, summary.Moved, summary.Dropped, summary.Failed, summary.Error)
+		moved += summary.Moved
+		dropped += summary.Dropped
+		failed += summary.Failed
+	}
+	fmt.Fprintf(w, "\tTOTAL\t\t%d\t%d\t%d\t\n", moved, dropped, failed)
+	w.Flush()
+
+	if len(summaries) < len(plan) {
+		log.Warn(color.New(color.FgYellow).Sprintf("Stopped before moving %d of the queues", len(plan)-len(summaries)))
+	}
+
+	return code
+}
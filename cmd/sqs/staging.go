@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+// moveViaStaging moves the messages through a temporary staging queue created
+// next to the destination. The first hop applies the rules of the move, and
+// the second carries the staged messages over as they are. Each hop is
+// verified before the next step: the staging queue must hold what the first
+// hop sent, and be empty after the second. It is deleted once the second hop
+// drained it, and kept otherwise, so no message is lost.
+func moveViaStaging(sourceQueueURL string, destinationQueueURL string, sourceSvc *sqs.Client, destinationSvc *sqs.Client, numberOfMessages int, summary *runSummary) bool {
+	stagingURL, err := createTempQueue(destinationSvc, destinationQueueURL, "staging")
+	if err != nil {
+		logAwsError("Failed to create the staging queue", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Staging queue URL: %s", stagingURL))
+
+	keep := func(reason string) bool {
+		log.Warn(color.New(color.FgYellow).Sprintf("%s. The staging queue %s is kept. Move its messages with sqs -s %s -d %s", reason, queueNameFromURL(stagingURL), stagingURL, destinationQueueURL))
+		return false
+	}
+
+	fifo, err := setupFifo(destinationSvc, sourceQueueURL, stagingURL, *messageGroupID)
+	if err != nil {
+		logAwsError("Unable to move into the FIFO staging queue", err)
+		return false
+	}
+	activeFifo = fifo
+
+	log.Info(color.New(color.FgCyan).Sprintf("Hop 1 of 2: %s to %s", queueNameFromURL(sourceQueueURL), queueNameFromURL(stagingURL)))
+
+	if !moveMessages(sourceQueueURL, stagingURL, sourceSvc, destinationSvc, numberOfMessages, *workers, *limit, summary) {
+		return keep("The move stopped before every message was staged")
+	}
+
+	staged, err := totalDepth(destinationSvc, stagingURL)
+	if err != nil {
+		logAwsError("Failed to verify the staging queue", err)
+		summary.StopReason = stopVerification
+		return keep("The staging queue couldn't be verified")
+	}
+
+	if staged < summary.Sent {
+		summary.StopReason = stopVerification
+		return keep(fmt.Sprintf("Sent %d messages to the staging queue but it holds about %d", summary.Sent, staged))
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Verified: the staging queue holds about %d messages", staged))
+
+	fifo, err = setupFifo(destinationSvc, stagingURL, destinationQueueURL, "")
+	if err != nil {
+		logAwsError("Unable to move into the FIFO queue", err)
+		return keep("The staged messages couldn't be moved")
+	}
+	activeFifo = fifo
+
+	log.Info(color.New(color.FgCyan).Sprintf("Hop 2 of 2: %s to %s", queueNameFromURL(stagingURL), queueNameFromURL(destinationQueueURL)))
+
+	result, err := moveStaged(destinationSvc, stagingURL, destinationQueueURL, staged)
+	if err != nil {
+		summary.StopReason = errorStopReason(err)
+		logMoveError(err, destinationSvc, destinationQueueURL)
+		return keep("The move stopped before every staged message reached the destination")
+	}
+
+	left, err := totalDepth(destinationSvc, stagingURL)
+	if err != nil || left > 0 {
+		summary.StopReason = stopVerification
+		return keep(fmt.Sprintf("Moved %d staged messages, but the staging queue may still hold some", result.Moved))
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Verified: moved %d staged messages and the staging queue is empty", result.Moved))
+
+	if _, err := destinationSvc.DeleteQueue(runCtx, &sqs.DeleteQueueInput{QueueUrl: aws.String(stagingURL)}); err != nil {
+		logAwsError("Failed to delete the staging queue", err)
+	}
+
+	return true
+}
+
+// moveStaged carries the messages of the staging queue over to the
+// destination unchanged, with their attributes, trace header and FIFO group.
+// The rules of the move were applied on the way in, so they aren't applied
+// again.
+func moveStaged(svc *sqs.Client, stagingURL string, destinationQueueURL string, total int) (mover.Result, error) {
+	client := moveClient(svc)
+	m := mover.New(client, client)
+
+	opts := mover.Options{
+		SourceQueueURL:        stagingURL,
+		DestinationQueueURL:   destinationQueueURL,
+		AttributeNames:        append([]string{string(types.MessageSystemAttributeNameAWSTraceHeader)}, activeFifo.fifoAttributeNames()...),
+		MessageAttributeNames: []string{"All"},
+		Entries:               stagedEntries,
+		MaxRetries:            *maxRetries,
+		Workers:               *workers,
+		Prefetch:              *prefetch,
+		VisibilityTimeout:     int32(*visibilityTimeout),
+	}
+
+	display := startProgress(total)
+	activeMetrics.begin(m, stagingURL, destinationQueueURL, total)
+
+	opts.Progress = func(total mover.Result) {
+		display.update(total.Moved)
+		activeMetrics.update(total)
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := m.Move(ctx, opts)
+	display.stop()
+
+	return result, err
+}
+
+// stagedEntries builds the destination entries of staged messages, keeping
+// their FIFO group and deduplication ID.
+func stagedEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	entries := make([]*types.SendMessageBatchRequestEntry, len(messages))
+
+	for i, message := range messages {
+		entries[i] = &types.SendMessageBatchRequestEntry{
+			Id:                message.MessageId,
+			MessageBody:       message.Body,
+			MessageAttributes: message.MessageAttributes,
+		}
+
+		if header, ok := message.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)]; ok {
+			entries[i].MessageSystemAttributes = map[string]types.MessageSystemAttributeValue{
+				string(types.MessageSystemAttributeNameForSendsAWSTraceHeader): {
+					DataType:    aws.String("String"),
+					StringValue: aws.String(header),
+				},
+			}
+		}
+
+		activeFifo.apply(entries[i], message)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// tempRetentionPeriod keeps messages in the temporary queue of a swap or a
+// staged move for as long as SQS allows, so a run stopped half way loses
+// nothing.
+const tempRetentionPeriod = "1209600"
+
+// runSwap exchanges the messages of two queues through a temporary queue:
+// a is drained into it, b into a, and the temporary queue into b. Both queues
+// must be of the same kind and have no messages in flight, since consumers
+// receiving from them would race the swap. A swap that stops leaves every
+// message in one of the three queues and tells which.
+func runSwap(svc *sqs.Client, a string, b string, yes bool, rails []guardrails) runSummary {
+	summary := runSummary{RunID: runID, StartedAt: time.Now().UTC()}
+	stampOperator(svc, &summary)
+
+	failAs := func(code int, message string, err error) runSummary {
+		logAwsError(message, err)
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf("%s: %s", message, err)
+		summary.FinishedAt = time.Now().UTC()
+		summary.exitCode = failureCode(err, code)
+		summary.StopReason = orDefault(summary.StopReason, setupStopReason(summary.exitCode))
+		return summary
+	}
+
+	fail := func(message string, err error) runSummary {
+		return failAs(exitFailed, message, err)
+	}
+
+	aURL, err := resolveQueueURL(svc, a)
+	if err != nil {
+		return failAs(exitQueue, "Failed to resolve queue A", err)
+	}
+
+	bURL, err := resolveQueueURL(svc, b)
+	if err != nil {
+		return failAs(exitQueue, "Failed to resolve queue B", err)
+	}
+
+	summary.Source = aURL
+	summary.Destination = bURL
+
+	if sameQueue(aURL, bURL) {
+		return failAs(exitUsage, "Unable to swap", fmt.Errorf("--a and --b are the same queue"))
+	}
+
+	if isFifoQueue(aURL) != isFifoQueue(bURL) {
+		return failAs(exitUsage, "Unable to swap", fmt.Errorf("one queue is FIFO and the other isn't, so their messages can't be exchanged"))
+	}
+
+	for _, pair := range [][2]string{{aURL, bURL}, {bURL, aURL}} {
+		resolved := invocation{command: swapCommand.FullCommand(), source: queueNameFromURL(pair[0]), destination: queueNameFromURL(pair[1])}
+		for _, p := range activePolicies {
+			if err := p.allow(resolved); err != nil {
+				summary.StopReason = stopPolicy
+				return fail("Swap blocked by policy", err)
+			}
+		}
+
+		for _, g := range rails {
+			if err := g.check(pair[0], pair[1]); err != nil {
+				summary.StopReason = stopGuardrail
+				return fail("Swap blocked by guardrail", err)
+			}
+		}
+	}
+
+	aDepth, err := swapDepth(svc, aURL)
+	if err != nil {
+		return fail("Failed to get the attributes of queue A", err)
+	}
+
+	bDepth, err := swapDepth(svc, bURL)
+	if err != nil {
+		return fail("Failed to get the attributes of queue B", err)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("%s holds about %d messages and %s about %d", queueNameFromURL(aURL), aDepth, queueNameFromURL(bURL), bDepth))
+
+	if err := confirmSwap(aURL, bURL, yes); err != nil {
+		return failAs(exitUsage, "Swap not confirmed", err)
+	}
+
+	tempURL, err := createTempQueue(svc, aURL, "swap")
+	if err != nil {
+		return fail("Failed to create the temporary queue", err)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Temporary queue URL: %s", tempURL))
+
+	legs := []struct {
+		from, to string
+		total    int
+		stranded string
+	}{
+		{aURL, tempURL, aDepth, fmt.Sprintf("Messages of %s are split between it and %s, and %s is untouched", queueNameFromURL(aURL), tempURL, queueNameFromURL(bURL))},
+		{bURL, aURL, bDepth, fmt.Sprintf("The messages of %s are in %s, and those of %s are split between it and %s", queueNameFromURL(aURL), tempURL, queueNameFromURL(bURL), queueNameFromURL(aURL))},
+		{tempURL, bURL, aDepth, fmt.Sprintf("The messages of %s are now in %s, and those of %s are split between %s and it", queueNameFromURL(bURL), queueNameFromURL(aURL), queueNameFromURL(aURL), tempURL)},
+	}
+
+	for i, leg := range legs {
+		fifo, err := setupFifo(svc, leg.from, leg.to, "")
+		if err != nil {
+			return fail("Unable to swap the FIFO queues", err)
+		}
+		// Each leg gets fresh deduplication IDs, so a queue doesn't drop
+		// messages it held a moment ago.
+		fifo.requeue = true
+		activeFifo = fifo
+
+		log.Info(color.New(color.FgCyan).Sprintf("Step %d of 3: %s to %s", i+1, queueNameFromURL(leg.from), queueNameFromURL(leg.to)))
+
+		if !moveMessages(leg.from, leg.to, svc, svc, leg.total, 1, 0, &summary) {
+			log.Warn(color.New(color.FgYellow).Sprintf("The swap stopped at step %d. %s. The temporary queue is kept", i+1, leg.stranded))
+			summary.Status = "failed"
+			summary.FinishedAt = time.Now().UTC()
+			return summary
+		}
+	}
+
+	if left, err := swapDepth(svc, tempURL); err != nil || left > 0 {
+		log.Warn(color.New(color.FgYellow).Sprintf("The temporary queue %s may still hold messages and is kept. Move them into %s once it is empty", tempURL, queueNameFromURL(bURL)))
+	} else if _, err := svc.DeleteQueue(runCtx, &sqs.DeleteQueueInput{QueueUrl: aws.String(tempURL)}); err != nil {
+		logAwsError("Failed to delete the temporary queue", err)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Swapped %s and %s", queueNameFromURL(aURL), queueNameFromURL(bURL)))
+
+	summary.Status = "completed"
+	summary.FinishedAt = time.Now().UTC()
+	return summary
+}
+
+// swapDepth returns the visible messages of a queue, and fails when some are
+// in flight, since a consumer is then still receiving from it.
+func swapDepth(svc *sqs.Client, queueURL string) (int, error) {
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if inFlight := intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessagesNotVisible); inFlight > 0 {
+		return 0, fmt.Errorf("%s has about %d messages in flight. Stop its consumers, and try again once the messages are visible or deleted", queueNameFromURL(queueURL), inFlight)
+	}
+
+	return intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessages), nil
+}
+
+// confirmSwap asks before the swap starts, unless --yes was given. Without a
+// terminal --yes is required.
+func confirmSwap(aURL string, bURL string, yes bool) error {
+	if yes {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("--yes is required when not running in a terminal")
+	}
+
+	answer := prompt(fmt.Sprintf("Swap the messages of %s and %s? (yes or no)", queueNameFromURL(aURL), queueNameFromURL(bURL)), "no")
+	if answer != "yes" {
+		return fmt.Errorf("answered %q", answer)
+	}
+
+	return nil
+}
+
+// createTempQueue creates a temporary queue next to the given one, of the
+// same kind and named after it, the purpose and the run.
+func createTempQueue(svc *sqs.Client, queueURL string, purpose string) (string, error) {
+	suffix := "-" + purpose + "-" + runID
+	attributes := map[string]string{
+		string(types.QueueAttributeNameMessageRetentionPeriod): tempRetentionPeriod,
+	}
+
+	if isFifoQueue(queueURL) {
+		suffix += ".fifo"
+		attributes[string(types.QueueAttributeNameFifoQueue)] = "true"
+	}
+
+	// Queue names are at most 80 characters.
+	base := strings.TrimSuffix(queueNameFromURL(queueURL), ".fifo")
+	if len(base)+len(suffix) > 80 {
+		base = base[:80-len(suffix)]
+	}
+
+	created, err := svc.CreateQueue(runCtx, &sqs.CreateQueueInput{
+		QueueName:  aws.String(base + suffix),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(created.QueueUrl), nil
+}
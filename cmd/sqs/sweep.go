@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v2"
+)
+
+// sweepAccount is one entry of the --accounts file.
+type sweepAccount struct {
+	ID         string `yaml:"id"`
+	RoleArn    string `yaml:"role-arn"`
+	ExternalID string `yaml:"external-id"`
+	Region     string `yaml:"region"`
+}
+
+func loadSweepAccounts(path string) ([]sweepAccount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Accounts []sweepAccount `yaml:"accounts"`
+	}
+
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	for i, account := range file.Accounts {
+		if account.RoleArn == "" {
+			return nil, fmt.Errorf("parsing %s: account %d has no role-arn", path, i+1)
+		}
+	}
+
+	return file.Accounts, nil
+}
+
+// configForAccount returns a copy of base that assumes the account's role.
+func configForAccount(base aws.Config, account sweepAccount) aws.Config {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(base), account.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "sqsmover"
+		if account.ExternalID != "" {
+			o.ExternalID = aws.String(account.ExternalID)
+		}
+	})
+
+	cfg := base.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(provider, refreshEarly)
+	if account.Region != "" {
+		cfg.Region = account.Region
+	}
+
+	return keepCredentialsAlive(cfg)
+}
+
+// sweepAccounts runs the configured move in every account of the file and
+// prints a consolidated report once all accounts have been visited. It
+// returns the exit code of the first account that failed.
+func sweepAccounts(base aws.Config, path string, rails []guardrails) int {
+	accounts, err := loadSweepAccounts(path)
+	if err != nil {
+		log.Error(color.New(color.FgRed).Sprintf("Unable to read accounts: %s", err))
+		return exitUsage
+	}
+
+	code := 0
+
+	summaries := make([]runSummary, 0, len(accounts))
+
+	for _, account := range accounts {
+		fmt.Println()
+		log.Info(color.New(color.FgCyan, color.Bold).Sprintf("Account %s (%s)", account.ID, account.RoleArn))
+
+		svc := sqs.NewFromConfig(configForAccount(base, account))
+		summary := runMove(svc, svc, rails)
+		summary.Account = account.ID
+		logFinalSummary(summary)
+
+		if code == 0 {
+			code = summary.exitStatus()
+		}
+
+		if summary.Status == "" {
+			summary.Status = "empty"
+		}
+
+		summaries = append(summaries, summary)
+		notifyWebhooks(summary)
+		notifyEmail(summary)
+		emitSummary(summary)
+	}
+
+	fmt.Println()
+	log.Info(color.New(color.FgCyan).Sprintf("Sweep report for %d accounts:", len(summaries)))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tACCOUNT\tSTATUS\tMOVED\tDROPPED\tFAILED\tERROR")
+	moved, dropped, failed := 0, 0, 0
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "\t%s\t%s\t%d\t%d\t%d\t%s\n", summary.Account, summary.Status, summary.Moved, summary.Dropped, summary.Failed, summary.Error)
+		moved += summary.Moved
+		dropped += summary.Dropped
+		failed += summary.Failed
+	}
+	fmt.Fprintf(w, "\tTOTAL\t\t%d\t%d\t%d\t\n", moved, dropped, failed)
+	w.Flush()
+
+	return code
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+)
+
+// tagDefaultPrefix starts the tags of a source queue that set defaults for
+// the flags of a move, such as sqsmover:default-destination.
+const tagDefaultPrefix = "sqsmover:default-"
+
+// tagDefaultFlags are the flags tags may set: where messages go, which of
+// them and how fast. Anyone allowed to tag the queue can set them, so flags
+// that run commands, write files or reach other services are left out.
+var tagDefaultFlags = map[string]bool{
+	"destination":        true,
+	"rate":               true,
+	"byte-rate":          true,
+	"batch-interval":     true,
+	"workers":            true,
+	"prefetch":           true,
+	"limit":              true,
+	"percent":            true,
+	"sample":             true,
+	"max-retries":        true,
+	"visibility-timeout": true,
+	"wait-time":          true,
+	"filter-body":        true,
+	"filter-attribute":   true,
+	"older-than":         true,
+	"newer-than":         true,
+	"drop-if":            true,
+	"message-group-id":   true,
+	"delay-seconds":      true,
+	"on-error":           true,
+}
+
+// tagFlags are the flags the tags of the source queue set, so operation
+// policies that deny a flag apply to them too.
+var tagFlags []string
+
+// applyTagDefaults reads the sqsmover:default-FLAG tags of the source queue
+// and sets every flag they name that neither the command line nor a named
+// move of the config file set. Tags naming other flags are ignored with a
+// warning.
+func applyTagDefaults(svc *sqs.Client, queue string) error {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		return err
+	}
+
+	resp, err := svc.ListQueueTags(runCtx, &sqs.ListQueueTagsInput{QueueUrl: aws.String(queueURL)})
+	if err != nil {
+		return err
+	}
+
+	given := map[string]bool{}
+	for _, name := range givenFlags() {
+		given[name] = true
+	}
+
+	keys := make([]string, 0, len(resp.Tags))
+	for key := range resp.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	name := queueNameFromURL(queueURL)
+	for _, key := range keys {
+		flag, ok := strings.CutPrefix(key, tagDefaultPrefix)
+		if !ok {
+			continue
+		}
+		value := resp.Tags[key]
+
+		switch {
+		case !tagDefaultFlags[flag]:
+			log.Warn(color.New(color.FgYellow).Sprintf("Ignoring the %s tag of %s, since tags can't set --%s", key, name, flag))
+			continue
+		case given[flag]:
+			log.Debugf("Keeping --%s as given over the %s tag of %s", flag, key, name)
+			continue
+		}
+
+		if err := moveCommand.GetFlag(flag).Model().Value.Set(value); err != nil {
+			return fmt.Errorf("the %s tag of %s: %s", key, name, err)
+		}
+
+		tagFlags = append(tagFlags, flag)
+		log.Info(color.New(color.FgCyan).Sprintf("Using --%s=%s from the tags of %s", flag, value, name))
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// taskInput is the parameter document of the task command, so workflow
+// engines such as Step Functions or AWS Batch can run a move without building
+// a command line. Fields left out take the defaults of the move flags.
+type taskInput struct {
+	Source             string            `json:"source"`
+	Destination        string            `json:"destination"`
+	Profile            string            `json:"profile"`
+	Region             string            `json:"region"`
+	SourceProfile      string            `json:"source_profile"`
+	SourceRegion       string            `json:"source_region"`
+	DestinationProfile string            `json:"destination_profile"`
+	DestinationRegion  string            `json:"destination_region"`
+	Limit              int               `json:"limit"`
+	Percent            float64           `json:"percent"`
+	Workers            int               `json:"workers"`
+	MaxRetries         *int              `json:"max_retries"`
+	Copy               bool              `json:"copy"`
+	FilterBody         string            `json:"filter_body"`
+	FilterAttributes   map[string]string `json:"filter_attributes"`
+	DropIf             []string          `json:"drop_if"`
+	OlderThan          string            `json:"older_than"`
+	NewerThan          string            `json:"newer_than"`
+	KeepReceiveCount   bool              `json:"keep_receive_count"`
+	Preflight          bool              `json:"preflight"`
+}
+
+// readTaskInput reads the document from a file, from stdin when path is "-",
+// or inline when path is a JSON object itself.
+func readTaskInput(path string) (taskInput, error) {
+	var in taskInput
+
+	var data []byte
+	var err error
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(path), "{"):
+		data = []byte(path)
+	case path == "-":
+		data, err = ioutil.ReadAll(os.Stdin)
+	default:
+		data, err = ioutil.ReadFile(path)
+	}
+
+	if err != nil {
+		return in, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&in); err != nil {
+		return in, fmt.Errorf("parsing task input: %s", err)
+	}
+
+	if in.Source == "" || in.Destination == "" {
+		return in, fmt.Errorf("task input needs a source and a destination")
+	}
+
+	return in, nil
+}
+
+// flags lists the move flags the document stands in for, so operation
+// policies that deny a flag apply to tasks too.
+func (in taskInput) flags() []string {
+	var flags []string
+
+	set := map[string]bool{
+		"source-profile":      in.SourceProfile != "",
+		"source-region":       in.SourceRegion != "",
+		"destination-profile": in.DestinationProfile != "",
+		"destination-region":  in.DestinationRegion != "",
+		"limit":               in.Limit != 0,
+		"percent":             in.Percent != 0,
+		"workers":             in.Workers != 0,
+		"max-retries":         in.MaxRetries != nil,
+		"copy":                in.Copy,
+		"filter-body":         in.FilterBody != "",
+		"filter-attribute":    len(in.FilterAttributes) > 0,
+		"drop-if":             len(in.DropIf) > 0,
+		"older-than":          in.OlderThan != "",
+		"newer-than":          in.NewerThan != "",
+		"keep-receive-count":  in.KeepReceiveCount,
+		"preflight":           in.Preflight,
+	}
+
+	for flag, ok := range set {
+		if ok {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// apply sets the move flags from the document. Kingpin only fills in the
+// defaults of the command that was run, so they are set here as well.
+func (in taskInput) apply() {
+	*sourceQueue = in.Source
+	*destinationQueues = []string{in.Destination}
+	*profile = orDefault(in.Profile, *profile)
+	*region = orDefault(in.Region, *region)
+	*sourceProfile = in.SourceProfile
+	*sourceRegion = in.SourceRegion
+	*destinationProfile = in.DestinationProfile
+	*destinationRegion = in.DestinationRegion
+	*limit = in.Limit
+	*limitPercent = in.Percent
+	*copyMessages = in.Copy
+	*keepReceiveCount = in.KeepReceiveCount
+	*preflight = in.Preflight
+
+	*workers = in.Workers
+	if *workers == 0 {
+		*workers = 1
+	}
+
+	*maxRetries = defaultMaxRetries
+	if in.MaxRetries != nil {
+		*maxRetries = *in.MaxRetries
+	}
+
+	*prefetch = defaultPrefetch
+
+	*newestSlice = time.Hour
+	*piiSample = 50
+	*envelopeKey = "records"
+	*ceType = defaultCloudEventsType
+}
+
+// runTask runs the move described by the document and writes the run summary
+// as JSON to output: stdout for "-", an s3:// URL or a file. Logs and progress
+// go to stderr so stdout only carries the result. It returns the exit code of
+// the run.
+func runTask(in taskInput, output string, rails []guardrails) int {
+	result := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = result }()
+
+	summary := runSummary{RunID: runID, Source: in.Source, Destination: in.Destination, StartedAt: time.Now().UTC()}
+
+	fail := func(message string, err error) {
+		logAwsError(message, err)
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf("%s: %s", message, err)
+		summary.FinishedAt = time.Now().UTC()
+		summary.exitCode = failureCode(err, exitFailed)
+		summary.StopReason = orDefault(summary.StopReason, setupStopReason(summary.exitCode))
+	}
+
+	cfg, err := taskMove(in, rails, &summary)
+	if err != nil {
+		fail("Unable to run the task", err)
+	}
+
+	// Queues that failed to resolve are reported as given.
+	summary.Source = orDefault(summary.Source, in.Source)
+	summary.Destination = orDefault(summary.Destination, in.Destination)
+
+	if summary.Status == "" {
+		// Nothing to move still completes the task.
+		summary.Status = "completed"
+		summary.FinishedAt = time.Now().UTC()
+	}
+
+	logFinalSummary(summary)
+	notifyWebhooks(summary)
+	notifyEmail(summary)
+
+	if err := writeTaskResult(cfg, result, output, summary); err != nil {
+		logAwsError("Failed to write the task result", err)
+		return exitFailed
+	}
+
+	return summary.exitStatus()
+}
+
+// taskMove validates the document, applies it and runs the move. It returns
+// the config used for the source, to write the result with.
+func taskMove(in taskInput, rails []guardrails, summary *runSummary) (*aws.Config, error) {
+	inv := invocation{command: taskCommand.FullCommand(), flags: in.flags()}
+	for _, p := range activePolicies {
+		if err := p.allow(inv); err != nil {
+			return nil, err
+		}
+	}
+
+	if in.Limit < 0 {
+		return nil, fmt.Errorf("limit can't be negative")
+	}
+
+	if in.Percent < 0 || in.Percent > 100 {
+		return nil, fmt.Errorf("percent must be between 0 and 100")
+	}
+
+	if in.Percent > 0 && in.Limit > 0 {
+		return nil, fmt.Errorf("percent can't be combined with limit")
+	}
+
+	if in.Workers < 0 {
+		return nil, fmt.Errorf("workers can't be negative")
+	}
+
+	if in.MaxRetries != nil && *in.MaxRetries < 0 {
+		return nil, fmt.Errorf("max_retries can't be negative")
+	}
+
+	in.apply()
+
+	attributes := make([]string, 0, len(in.FilterAttributes))
+	for name, value := range in.FilterAttributes {
+		attributes = append(attributes, name+"="+value)
+	}
+
+	filter, err := parseFilter(in.FilterBody, attributes, in.OlderThan, in.NewerThan)
+	if err != nil {
+		return nil, err
+	}
+	activeFilter = filter
+
+	for _, expr := range in.DropIf {
+		rule, err := parsePredicate(expr)
+		if err != nil {
+			return nil, err
+		}
+		dropRules = append(dropRules, rule)
+	}
+
+	sourceSide := sideConfig{profile: orDefault(*sourceProfile, *profile), region: orDefault(*sourceRegion, *region), endpoint: sideEndpoint("", in.Source), role: sourceRole()}
+	destinationSide := sideConfig{profile: orDefault(*destinationProfile, *profile), region: orDefault(*destinationRegion, *region), endpoint: sideEndpoint("", in.Destination), role: destinationRole()}
+
+	sourceCfg, err := newRoleConfig(sourceSide.profile, sourceSide.region, sourceSide.endpoint, sourceSide.role)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationCfg := sourceCfg
+	if destinationSide != sourceSide {
+		destinationCfg, err = newRoleConfig(destinationSide.profile, destinationSide.region, destinationSide.endpoint, destinationSide.role)
+		if err != nil {
+			return &sourceCfg, err
+		}
+	}
+
+	*summary = runMove(sqs.NewFromConfig(sourceCfg), sqs.NewFromConfig(destinationCfg), rails)
+
+	return &sourceCfg, nil
+}
+
+// writeTaskResult writes the summary to stdout, an S3 object or a file.
+func writeTaskResult(cfg *aws.Config, stdout *os.File, output string, summary runSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	switch {
+	case output == "-":
+		_, err = stdout.Write(data)
+		return err
+	case strings.HasPrefix(output, "s3://"):
+		location, err := url.Parse(output)
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			defaultCfg, err := newConfig(*profile, *region, *endpointURL)
+			if err != nil {
+				return err
+			}
+			cfg = &defaultCfg
+		}
+
+		_, err = s3.NewFromConfig(*cfg).PutObject(runCtx, &s3.PutObjectInput{
+			Bucket:      aws.String(location.Host),
+			Key:         aws.String(strings.TrimPrefix(location.Path, "/")),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		})
+		return err
+	default:
+		return ioutil.WriteFile(output, data, 0644)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// maxListedTasks is the most tasks ListMessageMoveTasks returns for a queue.
+const maxListedTasks = 10
+
+// queueArn reads the ARN of a queue from its attributes.
+func queueArn(svc *sqs.Client, queueURL string) (string, error) {
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return attrs.Attributes[string(types.QueueAttributeNameQueueArn)], nil
+}
+
+// listMoveTasks returns the most recent message move tasks of a dead-letter
+// queue, the newest first.
+func listMoveTasks(svc *sqs.Client, queue string) (string, []types.ListMessageMoveTasksResultEntry, error) {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		return "", nil, err
+	}
+
+	arn, err := queueArn(svc, queueURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, err := svc.ListMessageMoveTasks(runCtx, &sqs.ListMessageMoveTasksInput{
+		SourceArn:  aws.String(arn),
+		MaxResults: aws.Int32(maxListedTasks),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return queueURL, resp.Results, nil
+}
+
+// runTasksList prints the recent message move tasks of a dead-letter queue,
+// whether this tool or the console started them. It returns the exit code.
+func runTasksList(svc *sqs.Client, queue string) int {
+	queueURL, tasks, err := listMoveTasks(svc, queue)
+	if err != nil {
+		logAwsError("Failed to list the message move tasks of "+queue, err)
+		return failureCode(err, exitQueue)
+	}
+
+	name := queueNameFromURL(queueURL)
+	if len(tasks) == 0 {
+		log.Info(color.New(color.FgCyan).Sprintf("%s has no message move tasks", name))
+		return 0
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Message move tasks of %s, the newest first", name))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSTATUS\tSTARTED\tMOVED\tTO MOVE\tRATE\tDESTINATION\tTASK HANDLE")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			aws.ToString(task.Status),
+			time.UnixMilli(task.StartedTimestamp).UTC().Format(time.RFC3339),
+			task.ApproximateNumberOfMessagesMoved,
+			optionalCount(task.ApproximateNumberOfMessagesToMove),
+			optionalCount(task.MaxNumberOfMessagesPerSecond),
+			taskDestination(task),
+			orDefault(aws.ToString(task.TaskHandle), "-"))
+	}
+	w.Flush()
+	fmt.Println()
+
+	for _, task := range tasks {
+		if reason := aws.ToString(task.FailureReason); reason != "" {
+			log.Warn(color.New(color.FgYellow).Sprintf("Task started %s failed: %s",
+				time.UnixMilli(task.StartedTimestamp).UTC().Format(time.RFC3339), reason))
+		}
+	}
+
+	return 0
+}
+
+// runTasksCancel cancels a running message move task, the one with handle
+// or else the one running on queue. Messages it already moved stay in the
+// destination. It returns the exit code.
+func runTasksCancel(svc *sqs.Client, queue string, handle string) int {
+	if handle == "" {
+		_, tasks, err := listMoveTasks(svc, queue)
+		if err != nil {
+			logAwsError("Failed to list the message move tasks of "+queue, err)
+			return failureCode(err, exitQueue)
+		}
+
+		// Only a running task has a handle, and a queue runs one at a time.
+		for _, task := range tasks {
+			if aws.ToString(task.Status) == "RUNNING" {
+				handle = aws.ToString(task.TaskHandle)
+			}
+		}
+
+		if handle == "" {
+			log.Error(color.New(color.FgRed).Sprintf("%s has no running message move task", queue))
+			return exitFailed
+		}
+	}
+
+	resp, err := svc.CancelMessageMoveTask(runCtx, &sqs.CancelMessageMoveTaskInput{TaskHandle: aws.String(handle)})
+	if err != nil {
+		logAwsError("Failed to cancel the message move task", err)
+		return failureCode(err, exitFailed)
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Cancelled the message move task after it moved about %d messages. They stay in the destination",
+		resp.ApproximateNumberOfMessagesMoved))
+
+	return 0
+}
+
+// taskDestination names the queue a task moves messages to: the one it was
+// given, or the source queues of the messages when it was given none.
+func taskDestination(task types.ListMessageMoveTasksResultEntry) string {
+	if task.DestinationArn == nil {
+		return "(original sources)"
+	}
+
+	arn := aws.ToString(task.DestinationArn)
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
+
+// optionalCount formats a count SQS may leave out.
+func optionalCount[N int32 | int64](n *N) string {
+	if n == nil {
+		return "-"
+	}
+
+	return fmt.Sprint(*n)
+}
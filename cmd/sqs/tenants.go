@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v2"
+)
+
+// uiTenant is a team served by the dashboard, with the credentials its moves
+// run with. Without a --tenants file the dashboard has a single tenant with
+// no name, using the global flags.
+type uiTenant struct {
+	Name          string `yaml:"-"`
+	TokenEnv      string `yaml:"token-env"`
+	Profile       string `yaml:"profile"`
+	Region        string `yaml:"region"`
+	RoleArn       string `yaml:"role-arn"`
+	ExternalID    string `yaml:"external-id"`
+	MaxConcurrent int    `yaml:"max-concurrent"`
+
+	token string
+	svc   *sqs.Client
+}
+
+// loadTenants reads the --tenants file of the ui command and loads the AWS
+// config of every tenant. Tokens are read from the environment variables the
+// file names, so the file itself holds no secret.
+func loadTenants(path string) ([]*uiTenant, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tenants map[string]*uiTenant `yaml:"tenants"`
+	}
+
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("parsing %s: no tenants", path)
+	}
+
+	names := make([]string, 0, len(file.Tenants))
+	for name := range file.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tenants := make([]*uiTenant, 0, len(names))
+	tokens := map[string]string{}
+	for _, name := range names {
+		t := file.Tenants[name]
+		if t == nil {
+			t = &uiTenant{}
+		}
+		t.Name = name
+
+		if t.TokenEnv == "" {
+			return nil, fmt.Errorf("parsing %s: tenant %s has no token-env", path, name)
+		}
+		if t.token = os.Getenv(t.TokenEnv); t.token == "" {
+			return nil, fmt.Errorf("the token of tenant %s is missing: %s is not set", name, t.TokenEnv)
+		}
+		if other, ok := tokens[t.token]; ok {
+			return nil, fmt.Errorf("tenants %s and %s have the same token", other, name)
+		}
+		tokens[t.token] = name
+
+		if t.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("parsing %s: max-concurrent of tenant %s must not be negative", path, name)
+		}
+		if t.MaxConcurrent == 0 {
+			t.MaxConcurrent = 1
+		}
+
+		role := assumedRole{arn: t.RoleArn, externalID: t.ExternalID}
+		if err := role.validate("role-arn"); err != nil {
+			return nil, fmt.Errorf("parsing %s: tenant %s: %s", path, name, err)
+		}
+
+		t.Region = orDefault(t.Region, *region)
+		cfg, err := newRoleConfig(orDefault(t.Profile, *profile), t.Region, *endpointURL, role)
+		if err != nil {
+			return nil, fmt.Errorf("creating the AWS session of tenant %s: %s", name, err)
+		}
+		t.svc = sqs.NewFromConfig(cfg)
+
+		tenants = append(tenants, t)
+	}
+
+	return tenants, nil
+}
+
+// tenantOf returns the tenant whose token the request carries as a bearer
+// token, or nil. Tokens are compared in constant time.
+func tenantOf(tenants []*uiTenant, r *http.Request) *uiTenant {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+
+	var found *uiTenant
+	for _, t := range tenants {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) == 1 {
+			found = t
+		}
+	}
+
+	return found
+}
+
+// auditRecord is a line of the --audit-log file of the ui and move commands.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	RunID       string    `json:"run_id,omitempty"`
+	Operator    string    `json:"operator,omitempty"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Action      string    `json:"action"`
+	Remote      string    `json:"remote,omitempty"`
+	Request     string    `json:"request,omitempty"`
+	Run         int       `json:"run,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Limit       int       `json:"limit,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Moved       int       `json:"moved,omitempty"`
+	StopReason  string    `json:"stop_reason,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Actions of the audit records.
+const (
+	auditStart        = "start"
+	auditRefused      = "refused"
+	auditCancel       = "cancel"
+	auditFinish       = "finish"
+	auditUnauthorized = "unauthorized"
+)
+
+// auditLog appends a JSON line for every move the dashboard starts, refuses,
+// cancels or finishes, and for every request without a valid token. A nil
+// auditLog records nothing.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLog{file: file}, nil
+}
+
+// record writes record, stamped with the current time. The dashboard keeps
+// serving when the file can't be written, so failures are only logged.
+func (a *auditLog) record(record auditRecord) {
+	if a == nil {
+		return
+	}
+
+	record.Time = time.Now().UTC()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Warn(color.New(color.FgYellow).Sprintf("Failed to write the audit log: %s", err))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// traceRequests makes the config log every AWS call once it completes, with
+// its request ID, latency, batch size and the retries the SDK made. With
+// --debug every failed attempt is logged as well, before it is retried.
+func traceRequests(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		t := &callTrace{}
+		if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("sqsmover.traceCall", t.traceCall), middleware.After); err != nil {
+			return err
+		}
+
+		if _, ok := stack.Finalize.Get("Retry"); !ok || !*debug {
+			return nil
+		}
+
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("sqsmover.traceAttempt", t.traceAttempt), "Retry", middleware.After)
+	})
+}
+
+// callTrace follows one call, whose stack is built afresh for it.
+type callTrace struct {
+	params   interface{}
+	attempts int
+}
+
+func (t *callTrace) traceCall(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	t.params = in.Parameters
+	start := time.Now()
+
+	out, md, err := next.HandleInitialize(ctx, in)
+
+	fields := requestFields(ctx, in.Parameters, out.Result, err)
+	fields["request_id"], _ = awsmiddleware.GetRequestIDMetadata(md)
+	fields["retries"] = 0
+	if results, ok := retry.GetAttemptResults(md); ok && len(results.Results) > 0 {
+		fields["retries"] = len(results.Results) - 1
+	}
+
+	entry := log.WithFields(fields).WithField("latency", time.Since(start).Round(time.Millisecond).String())
+	if err != nil {
+		entry.WithField("error", errorCode(err)).Debug("AWS call failed")
+	} else {
+		entry.Debug("AWS call")
+	}
+
+	return out, md, err
+}
+
+// traceAttempt runs inside the SDK's retry loop, so it sees every failed
+// attempt, whether or not another one follows.
+func (t *callTrace) traceAttempt(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	start := time.Now()
+	out, md, err := next.HandleFinalize(ctx, in)
+
+	if err != nil {
+		fields := requestFields(ctx, t.params, nil, err)
+		fields["request_id"], _ = awsmiddleware.GetRequestIDMetadata(md)
+		fields["retries"] = t.attempts
+
+		retryable := retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary ||
+			retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+
+		log.WithFields(fields).
+			WithField("latency", time.Since(start).Round(time.Millisecond).String()).
+			WithField("error", errorCode(err)).
+			WithField("retryable", retryable).
+			Debug("AWS call attempt failed")
+	}
+
+	t.attempts++
+	return out, md, err
+}
+
+// requestFields describes a call: the operation, queue, and for batch calls
+// how many entries were sent and failed.
+func requestFields(ctx context.Context, params interface{}, result interface{}, err error) log.Fields {
+	fields := log.Fields{
+		"service":   middleware.GetServiceID(ctx),
+		"operation": middleware.GetOperationName(ctx),
+	}
+
+	switch params := params.(type) {
+	case *sqs.ReceiveMessageInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["requested"] = params.MaxNumberOfMessages
+		if out, ok := result.(*sqs.ReceiveMessageOutput); ok && err == nil {
+			fields["received"] = len(out.Messages)
+		}
+	case *sqs.SendMessageBatchInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["batch"] = len(params.Entries)
+		if out, ok := result.(*sqs.SendMessageBatchOutput); ok && err == nil {
+			fields["failed"] = len(out.Failed)
+		}
+	case *sqs.DeleteMessageBatchInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["batch"] = len(params.Entries)
+		if out, ok := result.(*sqs.DeleteMessageBatchOutput); ok && err == nil {
+			fields["failed"] = len(out.Failed)
+		}
+	case *sqs.ChangeMessageVisibilityBatchInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+		fields["batch"] = len(params.Entries)
+		if out, ok := result.(*sqs.ChangeMessageVisibilityBatchOutput); ok && err == nil {
+			fields["failed"] = len(out.Failed)
+		}
+	case *sqs.GetQueueAttributesInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+	case *sqs.SendMessageInput:
+		fields["queue"] = queueNameFromURL(aws.ToString(params.QueueUrl))
+	}
+
+	return fields
+}
+
+// errorCode returns the AWS error code and message of err, such as
+// ThrottlingException, or the error itself when it isn't an AWS error.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() + ": " + apiErr.ErrorMessage()
+	}
+
+	return err.Error()
+}
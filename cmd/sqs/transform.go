@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// transform rewrites a message body before it is sent. It is written as
+// `set:<path>=<json>` to set a field, `del:<path>` to remove one,
+// `template:<text>` to render a Go template, or `exec:<command>` to pipe the
+// body through a shell command.
+type transform struct {
+	spec string
+	kind string
+
+	path     jsonPath
+	value    interface{}
+	template *template.Template
+	command  string
+}
+
+// templateMessage is what a --transform template is executed with.
+type templateMessage struct {
+	MessageID  string
+	Body       string
+	JSON       interface{}
+	Attributes map[string]string
+}
+
+var transforms []transform
+
+func parseTransform(spec string) (transform, error) {
+	t := transform{spec: spec}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return t, fmt.Errorf("transform %q must look like set:PATH=JSON, del:PATH, template:TEXT or exec:COMMAND", spec)
+	}
+	t.kind = parts[0]
+
+	switch t.kind {
+	case "set":
+		i := indexOutsideQuotes(parts[1], "=")
+		if i == -1 {
+			return t, fmt.Errorf("transform %q must look like set:PATH=JSON", spec)
+		}
+
+		path, err := parseJSONPath(strings.TrimSpace(parts[1][:i]))
+		if err != nil {
+			return t, err
+		}
+		t.path = path
+
+		decoder := json.NewDecoder(strings.NewReader(parts[1][i+1:]))
+		decoder.UseNumber()
+		if err := decoder.Decode(&t.value); err != nil {
+			return t, fmt.Errorf("transform %q: %s is not a JSON value", spec, strings.TrimSpace(parts[1][i+1:]))
+		}
+	case "del":
+		path, err := parseJSONPath(parts[1])
+		if err != nil {
+			return t, err
+		}
+		if len(path) == 0 {
+			return t, fmt.Errorf("transform %q can't delete the whole body", spec)
+		}
+		t.path = path
+	case "template":
+		tmpl, err := template.New("transform").Option("missingkey=error").Funcs(template.FuncMap{"json": encodeJSON}).Parse(parts[1])
+		if err != nil {
+			return t, fmt.Errorf("transform %q: %s", spec, err)
+		}
+		t.template = tmpl
+	case "exec":
+		t.command = parts[1]
+	default:
+		return t, fmt.Errorf("unsupported transform %q, expected set:, del:, template: or exec:", spec)
+	}
+
+	return t, nil
+}
+
+// apply returns the rewritten body of entry. set and del leave bodies that
+// aren't JSON unchanged; a template or command that fails is an error, so
+// the message isn't sent half transformed. So is a body the payload codec
+// can't decode, or a rewritten one that doesn't fit its schema: the caller
+// decides what happens to the message rather than it being sent untouched.
+func (t transform) apply(entry *types.SendMessageBatchRequestEntry) (string, error) {
+	body := aws.ToString(entry.MessageBody)
+
+	document, err := decodeForRewrite(body)
+	if err != nil {
+		return "", err
+	}
+
+	switch t.kind {
+	case "set", "del":
+		doc, ok := decodeJSON(document)
+		if !ok {
+			return body, nil
+		}
+
+		if t.kind == "set" {
+			doc = t.set(doc)
+		} else {
+			doc = t.delete(doc)
+		}
+
+		encoded, err := encodeJSON(doc)
+		if err != nil {
+			return "", err
+		}
+
+		return encodeBody(body, encoded)
+	case "template":
+		data := templateMessage{
+			MessageID:  aws.ToString(entry.Id),
+			Body:       document,
+			Attributes: map[string]string{},
+		}
+
+		if doc, ok := decodeJSON(document); ok {
+			data.JSON = doc
+		}
+
+		for name, value := range entry.MessageAttributes {
+			data.Attributes[name] = aws.ToString(value.StringValue)
+		}
+
+		var out bytes.Buffer
+		if err := t.template.Execute(&out, data); err != nil {
+			return "", err
+		}
+
+		return encodeBody(body, out.String())
+	default:
+		out, err := t.run(aws.ToString(entry.Id), document)
+		if err != nil {
+			return "", err
+		}
+
+		return encodeBody(body, out)
+	}
+}
+
+// set stores the value at every match of the path, adding the last member
+// to objects that don't have it yet.
+func (t transform) set(doc interface{}) interface{} {
+	if len(t.path) == 0 || t.path[len(t.path)-1].wildcard || t.path[len(t.path)-1].isIndex {
+		doc, _ = t.path.replace(doc, func(interface{}) interface{} { return t.value })
+		return doc
+	}
+
+	last := t.path[len(t.path)-1]
+
+	doc, _ = t.path[:len(t.path)-1].replace(doc, func(parent interface{}) interface{} {
+		if object, ok := parent.(map[string]interface{}); ok {
+			object[last.key] = t.value
+		}
+		return parent
+	})
+
+	return doc
+}
+
+// delete removes every object member or array element the path matches.
+func (t transform) delete(doc interface{}) interface{} {
+	last := t.path[len(t.path)-1]
+
+	doc, _ = t.path[:len(t.path)-1].replace(doc, func(parent interface{}) interface{} {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			for key := range node {
+				if last.wildcard || (!last.isIndex && key == last.key) {
+					delete(node, key)
+				}
+			}
+		case []interface{}:
+			kept := node[:0]
+			for i, value := range node {
+				if !last.wildcard && !(last.isIndex && i == last.index) {
+					kept = append(kept, value)
+				}
+			}
+			return kept
+		}
+		return parent
+	})
+
+	return doc
+}
+
+// run pipes body through the command and returns what it printed, without
+// the trailing newline most tools add. The message ID is passed in the
+// SQSMOVER_MESSAGE_ID environment variable.
+func (t transform) run(id string, body string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	cmd := exec.CommandContext(runCtx, shell, flag, t.command)
+	cmd.Env = append(os.Environ(), "SQSMOVER_MESSAGE_ID="+id)
+	cmd.Stdin = strings.NewReader(body)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r"), nil
+}
+
+// transformEntries applies the --transform rules to entries in order.
+func transformEntries(entries []*types.SendMessageBatchRequestEntry) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+
+	originals := make([]string, len(entries))
+	errs := make([]error, len(entries))
+
+	apply := func(i int) {
+		originals[i] = aws.ToString(entries[i].MessageBody)
+		errs[i] = transformEntry(entries[i])
+	}
+
+	if activeTransformPool != nil {
+		activeTransformPool.each(len(entries), apply)
+	} else {
+		for i := range entries {
+			if apply(i); errs[i] != nil {
+				break
+			}
+		}
+	}
+
+	for i, entry := range entries {
+		if errs[i] != nil {
+			return errs[i]
+		}
+
+		if activeDiffs != nil {
+			activeDiffs.record(aws.ToString(entry.Id), originals[i], aws.ToString(entry.MessageBody))
+		}
+	}
+
+	return nil
+}
+
+// transformEntry applies the --transform rules to one entry in order.
+func transformEntry(entry *types.SendMessageBatchRequestEntry) error {
+	for _, t := range transforms {
+		body, err := t.apply(entry)
+		if err != nil {
+			return fmt.Errorf("transform %q failed for message %s: %s", t.spec, aws.ToString(entry.Id), err)
+		}
+
+		if body == "" {
+			return fmt.Errorf("transform %q left message %s with an empty body, which SQS doesn't accept", t.spec, aws.ToString(entry.Id))
+		}
+
+		entry.MessageBody = aws.String(body)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func TestTransformApply(t *testing.T) {
+	card := cardCodec(t)
+
+	cardBody, err := card.fromJSON("", `{"email":"a@example.com","number":"42"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		codec payloadCodec
+		spec  string
+		body  string
+
+		// want is the JSON form of the transformed body.
+		want    string
+		wantErr bool
+	}{
+		{name: "set", spec: `set:$.status="retried"`, body: `{"id":1}`, want: `{"id":1,"status":"retried"}`},
+		{name: "del", spec: `del:$.debug`, body: `{"debug":true,"id":1}`, want: `{"id":1}`},
+		{name: "set on text", spec: `set:$.status="retried"`, body: "plain text", want: "plain text"},
+		{name: "template", spec: `template:{"wrapped":{{json .JSON}}}`, body: `{"id":1}`, want: `{"wrapped":{"id":1}}`},
+		{name: "typed set", codec: card, spec: `set:$.number="7"`, body: cardBody, want: `{"email":"a@example.com","number":"7"}`},
+		{name: "set off schema", codec: card, spec: `set:$.number="seven"`, body: cardBody, wantErr: true},
+		{name: "unknown field", codec: card, spec: `set:$.status="retried"`, body: cardBody, wantErr: true},
+		{name: "template off schema", codec: card, spec: `template:{"card":{{json .JSON}}}`, body: cardBody, wantErr: true},
+		{name: "undecodable body", codec: card, spec: `set:$.number="7"`, body: "not base64!", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withCodec(t, test.codec)
+
+			tr, err := parseTransform(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tr.apply(&types.SendMessageBatchRequestEntry{Id: aws.String("m1"), MessageBody: aws.String(test.body)})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("apply = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.codec != nil {
+				if got, err = test.codec.toJSON(got); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var compact bytes.Buffer
+			if json.Compact(&compact, []byte(got)) == nil {
+				got = compact.String()
+			}
+
+			if got != test.want {
+				t.Errorf("apply = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
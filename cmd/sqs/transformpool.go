@@ -0,0 +1,58 @@
+package main
+
+import "sync"
+
+// transformPool runs the transforms of every batch on a fixed number of
+// goroutines shared by all the workers of a move, so CPU-heavy transforms
+// can use every core without adding SQS connections, and a few workers
+// aren't held up by the transforms of their own batches.
+type transformPool chan func()
+
+// activeTransformPool is set by --transform-workers. Without it every worker
+// transforms its own batches.
+var activeTransformPool transformPool
+
+func newTransformPool(size int) transformPool {
+	pool := make(transformPool)
+	for i := 0; i < size; i++ {
+		go func() {
+			for job := range pool {
+				job()
+			}
+		}()
+	}
+
+	return pool
+}
+
+// each calls fn for every index below n on the pool and waits for all of
+// them. A panic in fn is raised again in the caller, where the mover turns
+// it into an error, rather than ending the program from a pool goroutine.
+func (p transformPool) each(n int, fn func(i int)) {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		recovered interface{}
+	)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		p <- func() {
+			defer wg.Done()
+			defer func() {
+				if v := recover(); v != nil {
+					mu.Lock()
+					recovered = v
+					mu.Unlock()
+				}
+			}()
+
+			fn(i)
+		}
+	}
+	wg.Wait()
+
+	if recovered != nil {
+		panic(recovered)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+//go:embed ui/index.html
+var uiPage []byte
+
+// uiRun is a move started from the web UI. Total is the source depth when the
+// move started, for the progress bar.
+type uiRun struct {
+	runSummary
+	ID     int    `json:"id"`
+	Total  int    `json:"total"`
+	Tenant string `json:"tenant,omitempty"`
+
+	tenant *uiTenant
+	cancel context.CancelFunc
+}
+
+// uiRequest is the body of a request to start a move.
+type uiRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Limit       int    `json:"limit"`
+}
+
+// errTenantBusy refuses a move when its tenant runs as many as it may.
+var errTenantBusy = errors.New("too many moves running")
+
+// uiServer serves the dashboard and runs the moves it starts. Moves copy
+// bodies and message attributes as they are, like a move without options,
+// and the history lasts as long as the process. With a --tenants file every
+// API request must carry the token of a tenant, whose credentials its moves
+// run with, and a tenant only sees its own runs.
+type uiServer struct {
+	tenants       []*uiTenant
+	authenticated bool
+	rails         []guardrails
+	audit         *auditLog
+
+	mu   sync.Mutex
+	runs []*uiRun
+}
+
+// runUI serves the dashboard until it is stopped: on a loopback address for
+// whoever runs it, or, with tenants, on any address over TLS for the teams of
+// the --tenants file.
+func runUI(svc *sqs.Client, region string, listen string, rails []guardrails, tenants []*uiTenant, audit *auditLog) error {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return err
+	}
+
+	tls := *uiTLSCert != "" && *uiTLSKey != ""
+	if !isLoopback(host) && (len(tenants) == 0 || !tls) {
+		return fmt.Errorf("without --tenants and --tls-cert the UI has no authentication, so it only listens on localhost, not %s", listen)
+	}
+
+	s := &uiServer{tenants: tenants, authenticated: len(tenants) > 0, rails: rails, audit: audit}
+	if !s.authenticated {
+		s.tenants = []*uiTenant{{Region: region, svc: svc}}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.page)
+	mux.HandleFunc("GET /api/queues", s.api(s.queues))
+	mux.HandleFunc("GET /api/runs", s.api(s.list))
+	mux.HandleFunc("POST /api/runs", s.api(s.start))
+	mux.HandleFunc("POST /api/runs/{id}/cancel", s.api(s.cancel))
+
+	if tls {
+		log.Info(color.New(color.FgCyan).Sprintf("Serving the UI on https://%s for %d tenants", listen, len(tenants)))
+		return http.ListenAndServeTLS(listen, *uiTLSCert, *uiTLSKey, guardRequests(mux, s.authenticated))
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Serving the UI on http://%s", listen))
+
+	return http.ListenAndServe(listen, guardRequests(mux, s.authenticated))
+}
+
+// api passes the tenant of a request to handle: the one its token belongs to
+// with tenants, and the single tenant of the global flags without. Requests
+// without a valid token are refused and audited.
+func (s *uiServer) api(handle func(w http.ResponseWriter, r *http.Request, t *uiTenant)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticated {
+			handle(w, r, s.tenants[0])
+			return
+		}
+
+		t := tenantOf(s.tenants, r)
+		if t == nil {
+			s.audit.record(auditRecord{Action: auditUnauthorized, Remote: r.RemoteAddr, Request: r.Method + " " + r.URL.Path})
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeUIError(w, http.StatusUnauthorized, errors.New("a valid tenant token is required"))
+			return
+		}
+
+		handle(w, r, t)
+	}
+}
+
+// guardRequests rejects cross-origin posts and, without authentication,
+// requests addressed to anything but a loopback name, which stops DNS
+// rebinding. With authentication a rebound page has no token to send.
+func guardRequests(next http.Handler, authenticated bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if !authenticated && !isLoopback(host) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host && origin != "https://"+r.Host {
+				http.Error(w, "forbidden origin", http.StatusForbidden)
+				return
+			}
+
+			if r.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "expected application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *uiServer) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+func (s *uiServer) queues(w http.ResponseWriter, r *http.Request, t *uiTenant) {
+	queues, err := inventoryRegion(t.svc, "", t.Region)
+	if err != nil {
+		writeUIError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeUIJSON(w, http.StatusOK, queues)
+}
+
+func (s *uiServer) list(w http.ResponseWriter, r *http.Request, t *uiTenant) {
+	s.mu.Lock()
+	runs := make([]uiRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		if run.tenant == t {
+			runs = append(runs, *run)
+		}
+	}
+	s.mu.Unlock()
+
+	writeUIJSON(w, http.StatusOK, runs)
+}
+
+func (s *uiServer) start(w http.ResponseWriter, r *http.Request, t *uiTenant) {
+	var req uiRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeUIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, err := s.startRun(req, t)
+	if err != nil {
+		s.audit.record(auditRecord{Tenant: t.Name, Action: auditRefused, Remote: r.RemoteAddr, Source: req.Source, Destination: req.Destination, Limit: req.Limit, Error: err.Error()})
+
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, errTenantBusy) {
+			status = http.StatusTooManyRequests
+		}
+		writeUIError(w, status, err)
+		return
+	}
+
+	s.mu.Lock()
+	started := *run
+	s.mu.Unlock()
+
+	s.audit.record(auditRecord{Tenant: t.Name, Action: auditStart, Remote: r.RemoteAddr, Run: started.ID, Source: started.Source, Destination: started.Destination, Limit: req.Limit})
+
+	writeUIJSON(w, http.StatusAccepted, started)
+}
+
+func (s *uiServer) cancel(w http.ResponseWriter, r *http.Request, t *uiTenant) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeUIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, run := range s.runs {
+		if run.ID == id && run.tenant == t {
+			run.cancel()
+			s.audit.record(auditRecord{Tenant: t.Name, Action: auditCancel, Remote: r.RemoteAddr, Run: run.ID, Source: run.Source, Destination: run.Destination})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeUIError(w, http.StatusNotFound, fmt.Errorf("no run %d", id))
+}
+
+// startRun runs the same checks as the move command and starts the move in
+// the background with the credentials of tenant t.
+func (s *uiServer) startRun(req uiRequest, t *uiTenant) (*uiRun, error) {
+	if req.Limit < 0 {
+		return nil, errors.New("limit can't be negative")
+	}
+
+	sourceQueueURL, err := resolveQueueURL(t.svc, req.Source)
+	if err != nil {
+		return nil, fmt.Errorf("resolving source queue: %s", err)
+	}
+
+	destinationQueueURL, err := resolveQueueURL(t.svc, req.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("resolving destination queue: %s", err)
+	}
+
+	if sameQueue(sourceQueueURL, destinationQueueURL) {
+		return nil, errors.New("source and destination are the same queue")
+	}
+
+	if err := checkDestinationExists(t.svc, destinationQueueURL); err != nil {
+		return nil, fmt.Errorf("checking destination queue: %s", err)
+	}
+
+	if isFifoQueue(sourceQueueURL) || isFifoQueue(destinationQueueURL) {
+		return nil, errors.New("FIFO queues need the move command, which sets message groups and deduplication")
+	}
+
+	resolved := invocation{command: activeCommand, source: queueNameFromURL(sourceQueueURL), destination: queueNameFromURL(destinationQueueURL)}
+	for _, p := range activePolicies {
+		if err := p.allow(resolved); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, g := range s.rails {
+		if err := g.check(sourceQueueURL, destinationQueueURL); err != nil {
+			return nil, err
+		}
+	}
+
+	attrs, err := t.svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(sourceQueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading source depth: %s", err)
+	}
+
+	total := intAttribute(attrs.Attributes, types.QueueAttributeNameApproximateNumberOfMessages)
+	if req.Limit > 0 && total > req.Limit {
+		total = req.Limit
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := 0
+	for _, other := range s.runs {
+		if other.Status != "running" {
+			continue
+		}
+		if other.Source == sourceQueueURL {
+			return nil, fmt.Errorf("a move out of %s is already running", req.Source)
+		}
+		if other.tenant == t {
+			running++
+		}
+	}
+
+	if t.MaxConcurrent > 0 && running >= t.MaxConcurrent {
+		return nil, fmt.Errorf("%w: tenant %s may run %d at a time", errTenantBusy, t.Name, t.MaxConcurrent)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	run := &uiRun{
+		runSummary: runSummary{RunID: runID, Source: sourceQueueURL, Destination: destinationQueueURL, Status: "running", StartedAt: time.Now().UTC()},
+		ID:         len(s.runs) + 1,
+		Total:      total,
+		Tenant:     t.Name,
+		tenant:     t,
+		cancel:     cancel,
+	}
+	s.runs = append(s.runs, run)
+
+	go s.move(ctx, run, req.Limit)
+
+	return run, nil
+}
+
+func (s *uiServer) move(ctx context.Context, run *uiRun, limit int) {
+	log.Info(color.New(color.FgCyan).Sprintf("Run %d: moving messages from %s to %s", run.ID, run.Source, run.Destination))
+
+	m := mover.New(run.tenant.svc, run.tenant.svc)
+
+	result, err := m.Move(ctx, mover.Options{
+		SourceQueueURL:        run.Source,
+		DestinationQueueURL:   run.Destination,
+		Limit:                 limit,
+		MaxRetries:            defaultMaxRetries,
+		AttributeNames:        []string{string(types.MessageSystemAttributeNameAWSTraceHeader)},
+		MessageAttributeNames: []string{"All"},
+		Progress: func(total mover.Result) {
+			s.mu.Lock()
+			run.Moved, run.Sent, run.Dropped, run.Skipped, run.Failed = total.Moved, total.Sent, total.Dropped, total.Skipped, total.Failed
+			s.mu.Unlock()
+		},
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.Moved, run.Sent, run.Dropped, run.Skipped, run.Failed = result.Moved, result.Sent, result.Dropped, result.Skipped, result.Failed
+	run.FinishedAt = time.Now().UTC()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = "cancelled"
+		log.Warn(color.New(color.FgYellow).Sprintf("Run %d: cancelled after %d messages", run.ID, run.Moved))
+	case err != nil:
+		run.Status = "failed"
+		run.Error = err.Error()
+		logAwsError(fmt.Sprintf("Run %d: failed after %d messages", run.ID, run.Moved), err)
+	default:
+		run.Status = "completed"
+		log.Info(color.New(color.FgCyan).Sprintf("Run %d: moved %d messages", run.ID, run.Moved))
+	}
+
+	s.audit.record(auditRecord{Tenant: run.Tenant, Action: auditFinish, Run: run.ID, Source: run.Source, Destination: run.Destination, Status: run.Status, Moved: run.Moved, Error: run.Error})
+}
+
+func writeUIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeUIError(w http.ResponseWriter, status int, err error) {
+	writeUIJSON(w, status, map[string]string{"error": err.Error()})
+}
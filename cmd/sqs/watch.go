@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
+)
+
+// depthAlert is the webhook payload sent by watch-depth when a queue crosses
+// its threshold in either direction.
+type depthAlert struct {
+	RunID     string    `json:"run_id"`
+	Queue     string    `json:"queue"`
+	Depth     int       `json:"depth"`
+	Threshold int       `json:"threshold"`
+	Status    string    `json:"status"`
+	Time      time.Time `json:"time"`
+}
+
+// watchDepth polls the queue depth every interval, logging each change. With
+// no webhooks it returns false as soon as the depth reaches the threshold;
+// otherwise it alerts on every crossing and keeps watching until a check fails.
+func watchDepth(svc *sqs.Client, queue string, threshold int, interval time.Duration, webhooks []string, secret string) bool {
+	queueURL, err := resolveQueueURL(svc, queue)
+	if err != nil {
+		logAwsError("Failed to resolve queue", err)
+		return false
+	}
+
+	log.Info(color.New(color.FgCyan).Sprintf("Watching %s every %s, alerting at %d messages", queueURL, interval, threshold))
+
+	last := -1
+	above := false
+
+	for {
+		depth, err := queueDepth(svc, queueURL)
+		if err != nil {
+			logAwsError("Failed to get queue depth", err)
+			return false
+		}
+
+		if depth != last {
+			log.Info(color.New(color.FgCyan).Sprintf("Depth: %d", depth))
+			last = depth
+		}
+
+		if (depth >= threshold) != above {
+			above = depth >= threshold
+
+			status := "ok"
+			if above {
+				status = "alarm"
+				log.Warn(color.New(color.FgYellow).Sprintf("Depth %d reached the threshold of %d", depth, threshold))
+			} else {
+				log.Info(color.New(color.FgCyan).Sprintf("Depth %d is back under the threshold of %d", depth, threshold))
+			}
+
+			if len(webhooks) == 0 {
+				if above {
+					return false
+				}
+			} else {
+				notifyDepth(webhooks, secret, depthAlert{RunID: runID, Queue: queueURL, Depth: depth, Threshold: threshold, Status: status, Time: time.Now().UTC()})
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// queueDepth returns the approximate number of visible messages in a queue.
+func queueDepth(svc *sqs.Client, queueURL string) (int, error) {
+	attrs, err := svc.GetQueueAttributes(runCtx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(attrs.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+}
+
+func notifyDepth(webhooks []string, secret string, alert depthAlert) {
+	for _, url := range webhooks {
+		if err := postWebhook(url, secret, alert); err != nil {
+			log.Warn(color.New(color.FgYellow).Sprintf("Failed to notify webhook: %s", err))
+		}
+	}
+}
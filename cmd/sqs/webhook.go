@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Receivers verify a notification by computing
+// HMAC-SHA256(secret, timestamp + "." + body) and comparing it with the
+// signature header, rejecting timestamps that are too old to prevent replays.
+const (
+	signatureHeader = "X-Sqsmover-Signature"
+	timestampHeader = "X-Sqsmover-Timestamp"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// runSummary is the result of a move as reported to notification targets.
+type runSummary struct {
+	RunID       string            `json:"run_id"`
+	Account     string            `json:"account,omitempty"`
+	Operator    *operatorIdentity `json:"operator,omitempty"`
+	Source      string            `json:"source"`
+	Destination string            `json:"destination"`
+	Queues      *queueSnapshots   `json:"queues,omitempty"`
+	Status      string            `json:"status"`
+	StopReason  string            `json:"stop_reason,omitempty"`
+	Moved       int               `json:"moved"`
+	Sent        int               `json:"sent"`
+	Dropped     int               `json:"dropped"`
+	Skipped     int               `json:"skipped"`
+	Failed      int               `json:"failed"`
+	Undeleted   int               `json:"undeleted,omitempty"`
+	Duplicates  int               `json:"duplicates,omitempty"`
+	Bounced     int               `json:"bounced,omitempty"`
+	Bytes       byteReport        `json:"bytes"`
+	Depths      *depthReport      `json:"depths,omitempty"`
+	Rejected    []rejectedMessage `json:"rejected,omitempty"`
+	Latencies   stepLatencies     `json:"latencies,omitempty"`
+	Receives    *receiveReport    `json:"receive_counts,omitempty"`
+	Ordering    *orderReport      `json:"ordering,omitempty"`
+	Resumed     *resumeCheckpoint `json:"resumed,omitempty"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  time.Time         `json:"finished_at"`
+	Error       string            `json:"error,omitempty"`
+
+	// exitCode is why a failed run stopped, as one of the exit codes.
+	exitCode int
+}
+
+// signPayload returns the hex encoded signature sent in signatureHeader.
+func signPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends a run summary or depth alert as JSON, signing it when a
+// secret is set.
+func postWebhook(url string, secret string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sqsmover")
+
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, signPayload(secret, timestamp, payload))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignPayload(t *testing.T) {
+	// The signatures were computed apart from this code, as a receiver would.
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		payload   string
+		want      string
+	}{
+		{"summary", "s3cret", "1700000000", `{"run_id":"abc"}`, "sha256=4ac29dd49bdf70fec1e912e6e5de11abcefd2b19589cc7859c929606746b51a3"},
+		{"later timestamp", "s3cret", "1700000001", `{"run_id":"abc"}`, "sha256=de99043a7a670d0ff2ce6a23a954ab2b24dfd7265d4fdc307a85dda9f1790b3a"},
+		{"other secret", "other", "1700000000", `{"run_id":"abc"}`, "sha256=77f83e19564be8f1fe90057ae65c517a81213352a1a69b63ba518369c0598c42"},
+		{"empty payload", "s3cret", "1700000000", ``, "sha256=21948100f1d7a89f3338f6b1106fc4f7a702fbe1493b833a3382f80193bde3fe"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := signPayload(test.secret, test.timestamp, []byte(test.payload)); got != test.want {
+				t.Errorf("signPayload = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPostWebhookSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		signed bool
+	}{
+		{name: "with a secret", secret: "s3cret", signed: true},
+		{name: "without a secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var header http.Header
+			var body []byte
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer server.Close()
+
+			if err := postWebhook(server.URL, test.secret, runSummary{RunID: "abc"}); err != nil {
+				t.Fatalf("postWebhook failed: %s", err)
+			}
+
+			signature, timestamp := header.Get(signatureHeader), header.Get(timestampHeader)
+			if !test.signed {
+				if signature != "" || timestamp != "" {
+					t.Errorf("unsigned request has %s %q and %s %q", signatureHeader, signature, timestampHeader, timestamp)
+				}
+				return
+			}
+
+			if timestamp == "" {
+				t.Fatalf("signed request has no %s", timestampHeader)
+			}
+
+			want := signPayload(test.secret, timestamp, body)
+			if !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("%s = %q, want %q for the body received", signatureHeader, signature, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,692 @@
+package mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// Steps of a move reported in Error.
+const (
+	OpReceive = "receive"
+	OpEntries = "entries"
+	OpSend    = "send"
+	OpDelete  = "delete"
+	OpRelease = "release"
+	OpHide    = "hide"
+)
+
+// Error reports the step of a move that failed. Err is the AWS error, or
+// describes the entries SQS rejected in a partial batch failure.
+type Error struct {
+	Op  string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// PanicError reports a panic in a step of a move, such as in one of the
+// hooks of Options. The move stops on it as on a failed batch, with the
+// messages of the batch released, instead of crashing the program with them
+// hidden in the source.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value the step panicked with when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+const (
+	// maxBatchBytes is the most SQS accepts across the entries of one
+	// SendMessageBatch call.
+	maxBatchBytes = 262144
+
+	// largeEntryBytes is the size above which an entry is sent on its own
+	// with SendMessage. Such an entry leaves room in a batch only for much
+	// smaller ones, and queues with a raised maximum message size accept
+	// entries that don't fit in a batch at all.
+	largeEntryBytes = maxBatchBytes / 2
+)
+
+// rejection is an entry SQS refused for good: outright, or still once its
+// retries were used up. failure is named after the entry's own ID.
+type rejection struct {
+	entry   *types.SendMessageBatchRequestEntry
+	failure types.BatchResultErrorEntry
+}
+
+// rejectionCodes are the error codes SendMessage fails with when SQS refuses
+// the message itself rather than the call.
+var rejectionCodes = map[string]bool{
+	"InvalidMessageContents": true,
+	"InvalidParameterValue":  true,
+	"InvalidAttributeName":   true,
+	"InvalidAttributeValue":  true,
+}
+
+// send enqueues entries to the destination in batches of up to ten that stay
+// under the batch payload limit, and returns how many were accepted. Large
+// entries are sent one at a time. Transient errors are retried, and so are
+// the entries of a batch that failed on the SQS side, up to maxRetries times
+// per batch. Entries go out in the order they are given, so FIFO groups keep
+// their order.
+func (m *Mover) send(ctx context.Context, queueURL string, entries []*types.SendMessageBatchRequestEntry, maxRetries int) (int, error) {
+	sent, _, err := m.sendAll(ctx, queueURL, entries, maxRetries, false)
+	return sent, err
+}
+
+// sendAll is send, except that with skip the entries SQS refuses for good are
+// returned rather than stopping the sending.
+func (m *Mover) sendAll(ctx context.Context, queueURL string, entries []*types.SendMessageBatchRequestEntry, maxRetries int, skip bool) (int, []rejection, error) {
+	sent := 0
+	var rejected []rejection
+
+	for _, batch := range splitBatches(entries) {
+		var n int
+		var refused []rejection
+		var err error
+		if len(batch) == 1 && entrySize(batch[0]) > largeEntryBytes {
+			n, refused, err = m.sendMessage(ctx, queueURL, batch[0], maxRetries, skip)
+		} else {
+			n, refused, err = m.sendEntries(ctx, queueURL, batch, maxRetries, skip)
+		}
+
+		sent += n
+		rejected = append(rejected, refused...)
+		if err != nil {
+			return sent, rejected, err
+		}
+	}
+
+	return sent, rejected, nil
+}
+
+// splitBatches groups entries, in order, into batches of at most ten whose
+// payload stays under maxBatchBytes. Large entries get a batch of their own.
+func splitBatches(entries []*types.SendMessageBatchRequestEntry) [][]*types.SendMessageBatchRequestEntry {
+	var batches [][]*types.SendMessageBatchRequestEntry
+	var batch []*types.SendMessageBatchRequestEntry
+	var size int64
+
+	for _, entry := range entries {
+		n := entrySize(entry)
+
+		if len(batch) > 0 && (len(batch) == 10 || size+n > maxBatchBytes || n > largeEntryBytes) {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+
+		batch = append(batch, entry)
+		size += n
+
+		if n > largeEntryBytes {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// entrySize counts an entry the way SQS counts it against the payload limit,
+// like messageSize does for a received message.
+func entrySize(entry *types.SendMessageBatchRequestEntry) int64 {
+	size := int64(len(aws.ToString(entry.MessageBody)))
+
+	for name, value := range entry.MessageAttributes {
+		size += int64(len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue)) + len(value.BinaryValue))
+	}
+
+	for name, value := range entry.MessageSystemAttributes {
+		size += int64(len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue)) + len(value.BinaryValue))
+	}
+
+	return size
+}
+
+// sendEntries sends one batch, retrying the entries that failed on the SQS
+// side. SQS wants the entry IDs of a batch to be unique and made of at most 80
+// letters, digits, hyphens and underscores. The entries' own IDs come from
+// message IDs, dump files or --explode-jsonpath and may be none of that, so
+// every call numbers its entries instead, and failures are mapped back to the
+// entries they belong to. With skip the entries that failed for good are
+// returned instead of an error.
+func (m *Mover) sendEntries(ctx context.Context, queueURL string, pending []*types.SendMessageBatchRequestEntry, maxRetries int, skip bool) (int, []rejection, error) {
+	sent := 0
+
+	for attempt := 0; ; attempt++ {
+		resp, err := m.Destination.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  numberEntries(pending),
+		})
+
+		if err != nil {
+			if attempt < maxRetries && isTransient(err) {
+				m.retry(ctx, OpSend, attempt, err)
+				continue
+			}
+			return sent, nil, &Error{Op: OpSend, Err: err}
+		}
+
+		sent += len(resp.Successful)
+		m.sequenced(ctx, queueURL, resp.Successful, pending)
+		accepted, messageIDs := acceptedEntries(resp.Successful, pending)
+		m.run(ctx).sent(queueURL, accepted, messageIDs, batchSize(pending))
+
+		if len(resp.Failed) == 0 {
+			return sent, nil, nil
+		}
+
+		rejected := rejectEntries(resp.Failed, pending)
+		retry := failedEntries(resp.Failed, pending)
+
+		retried := attempt < maxRetries && retryable(resp.Failed)
+		m.run(ctx).emit(&PartialFailure{Op: OpSend, QueueURL: queueURL, Failed: resp.Failed, Retried: retried})
+
+		if !retried {
+			if skip && len(rejected) == len(resp.Failed) {
+				return sent, rejected, nil
+			}
+			return sent, nil, &Error{Op: OpSend, Err: fmt.Errorf("%d messages failed to enqueue: %s", len(resp.Failed), describeFailures(resp.Failed))}
+		}
+
+		pending = retry
+
+		m.retry(ctx, OpSend, attempt, nil)
+	}
+}
+
+// describeFailures lists the failed entries of a batch for an error message.
+func describeFailures(failed []types.BatchResultErrorEntry) string {
+	descriptions := make([]string, len(failed))
+	for i, failure := range failed {
+		descriptions[i] = fmt.Sprintf("%s (%s: %s)", aws.ToString(failure.Id), aws.ToString(failure.Code), aws.ToString(failure.Message))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// sequenced passes the entries of a numbered batch that a FIFO queue accepted
+// to Options.Sequenced, with their sequence numbers.
+func (m *Mover) sequenced(ctx context.Context, queueURL string, successful []types.SendMessageBatchResultEntry, entries []*types.SendMessageBatchRequestEntry) {
+	report := m.run(ctx).sequenced
+	if report == nil {
+		return
+	}
+
+	var accepted []*types.SendMessageBatchRequestEntry
+	var sequenceNumbers []string
+	for _, result := range successful {
+		i, err := strconv.Atoi(aws.ToString(result.Id))
+		if err != nil || i < 0 || i >= len(entries) || result.SequenceNumber == nil {
+			continue
+		}
+
+		accepted = append(accepted, entries[i])
+		sequenceNumbers = append(sequenceNumbers, *result.SequenceNumber)
+	}
+
+	if len(accepted) > 0 {
+		report(queueURL, accepted, sequenceNumbers)
+	}
+}
+
+// acceptedEntries returns the entries of a numbered batch that succeeded,
+// with the message IDs the queue gave them.
+func acceptedEntries(successful []types.SendMessageBatchResultEntry, entries []*types.SendMessageBatchRequestEntry) ([]*types.SendMessageBatchRequestEntry, []string) {
+	accepted := make([]*types.SendMessageBatchRequestEntry, 0, len(successful))
+	messageIDs := make([]string, 0, len(successful))
+	for _, result := range successful {
+		i, err := strconv.Atoi(aws.ToString(result.Id))
+		if err != nil || i < 0 || i >= len(entries) {
+			continue
+		}
+
+		accepted = append(accepted, entries[i])
+		messageIDs = append(messageIDs, aws.ToString(result.MessageId))
+	}
+
+	return accepted, messageIDs
+}
+
+// batchSize is the payload of a batch, the sum of its entrySize.
+func batchSize(entries []*types.SendMessageBatchRequestEntry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += entrySize(entry)
+	}
+
+	return size
+}
+
+// numberEntries copies entries with their position in the batch as their ID.
+func numberEntries(entries []*types.SendMessageBatchRequestEntry) []types.SendMessageBatchRequestEntry {
+	numbered := make([]types.SendMessageBatchRequestEntry, len(entries))
+	for i, entry := range entries {
+		numbered[i] = *entry
+		numbered[i].Id = aws.String(strconv.Itoa(i))
+	}
+
+	return numbered
+}
+
+// rejectEntries pairs the failures of a numbered batch with the entries they
+// belong to.
+func rejectEntries(failed []types.BatchResultErrorEntry, entries []*types.SendMessageBatchRequestEntry) []rejection {
+	rejected := make([]rejection, 0, len(failed))
+	for _, failure := range failed {
+		i, err := strconv.Atoi(aws.ToString(failure.Id))
+		if err != nil || i < 0 || i >= len(entries) {
+			continue
+		}
+
+		rejected = append(rejected, rejection{entry: entries[i], failure: failure})
+	}
+
+	return rejected
+}
+
+// failedEntries returns, in order, the entries of a numbered batch that
+// failed. It renames the failures after the entries' own IDs, so errors name
+// the messages rather than their positions.
+func failedEntries(failed []types.BatchResultErrorEntry, entries []*types.SendMessageBatchRequestEntry) []*types.SendMessageBatchRequestEntry {
+	isFailed := make([]bool, len(entries))
+	for j, failure := range failed {
+		i, err := strconv.Atoi(aws.ToString(failure.Id))
+		if err != nil || i < 0 || i >= len(entries) {
+			continue
+		}
+
+		isFailed[i] = true
+		failed[j].Id = entries[i].Id
+	}
+
+	retry := make([]*types.SendMessageBatchRequestEntry, 0, len(failed))
+	for i, entry := range entries {
+		if isFailed[i] {
+			retry = append(retry, entry)
+		}
+	}
+
+	return retry
+}
+
+// sendMessage sends a single entry with SendMessage, retrying transient
+// errors. With skip an entry SQS refuses is returned instead of an error.
+func (m *Mover) sendMessage(ctx context.Context, queueURL string, entry *types.SendMessageBatchRequestEntry, maxRetries int, skip bool) (int, []rejection, error) {
+	input := &sqs.SendMessageInput{
+		QueueUrl:                aws.String(queueURL),
+		MessageBody:             entry.MessageBody,
+		MessageAttributes:       entry.MessageAttributes,
+		MessageSystemAttributes: entry.MessageSystemAttributes,
+		DelaySeconds:            entry.DelaySeconds,
+		MessageGroupId:          entry.MessageGroupId,
+		MessageDeduplicationId:  entry.MessageDeduplicationId,
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := m.Destination.SendMessage(ctx, input)
+		if err == nil {
+			m.run(ctx).sent(queueURL, []*types.SendMessageBatchRequestEntry{entry}, []string{aws.ToString(resp.MessageId)}, entrySize(entry))
+			if report := m.run(ctx).sequenced; report != nil && resp.SequenceNumber != nil {
+				report(queueURL, []*types.SendMessageBatchRequestEntry{entry}, []string{*resp.SequenceNumber})
+			}
+			return 1, nil, nil
+		}
+
+		if attempt < maxRetries && isTransient(err) {
+			m.retry(ctx, OpSend, attempt, err)
+			continue
+		}
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && skip && rejectionCodes[apiErr.ErrorCode()] {
+			return 0, []rejection{{
+				entry: entry,
+				failure: types.BatchResultErrorEntry{
+					Id:          entry.Id,
+					Code:        aws.String(apiErr.ErrorCode()),
+					Message:     aws.String(apiErr.ErrorMessage()),
+					SenderFault: true,
+				},
+			}}, nil
+		}
+
+		return 0, nil, &Error{Op: OpSend, Err: err}
+	}
+}
+
+// redeleteWaitTime is how long, in seconds, each receive of redelete waits
+// for the messages it looks for.
+const redeleteWaitTime = 1
+
+// delete removes messages from the source in batches of ten, retrying like
+// send. The messages SQS still refuses to delete once the retries are used
+// up have been sent already, so instead of failing the move they are handed
+// to redelete, and those it can't delete either are counted as undeleted.
+// Only a call SQS refuses outright fails.
+func (m *Mover) delete(ctx context.Context, queueURL string, messages []*types.Message, maxRetries int) error {
+	run := m.run(ctx)
+	left := map[string]bool{}
+
+	var stale []*types.Message
+
+	for start := 0; start < len(messages); start += 10 {
+		end := start + 10
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := deleteEntries(messages[start:end])
+
+	retries:
+		for attempt := 0; ; attempt++ {
+			resp, err := m.Source.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+				QueueUrl: aws.String(queueURL),
+				Entries:  entries,
+			})
+
+			if err != nil {
+				if attempt < maxRetries && isTransient(err) {
+					m.retry(ctx, OpDelete, attempt, err)
+					continue
+				}
+
+				for _, entry := range entries {
+					left[aws.ToString(entry.Id)] = true
+				}
+				m.deleted(ctx, queueURL, messages[:end], left)
+
+				return &Error{Op: OpDelete, Err: err}
+			}
+
+			if len(resp.Failed) == 0 {
+				break
+			}
+
+			failed := failedIDs(resp.Failed)
+
+			retried := attempt < maxRetries && retryable(resp.Failed)
+			run.emit(&PartialFailure{Op: OpDelete, QueueURL: queueURL, Failed: resp.Failed, Retried: retried})
+
+			if !retried {
+				for _, message := range messages[start:end] {
+					if failed[aws.ToString(message.MessageId)] {
+						stale = append(stale, message)
+						left[aws.ToString(message.MessageId)] = true
+					}
+				}
+				break retries
+			}
+
+			retry := make([]types.DeleteMessageBatchRequestEntry, 0, len(failed))
+			for _, entry := range entries {
+				if failed[aws.ToString(entry.Id)] {
+					retry = append(retry, entry)
+				}
+			}
+			entries = retry
+
+			m.retry(ctx, OpDelete, attempt, nil)
+		}
+	}
+
+	if len(stale) > 0 {
+		undeleted := m.redelete(ctx, queueURL, stale, maxRetries)
+		run.undeleted.Add(int64(len(undeleted)))
+
+		left = map[string]bool{}
+		for _, message := range undeleted {
+			left[aws.ToString(message.MessageId)] = true
+		}
+	}
+
+	m.deleted(ctx, queueURL, messages, left)
+
+	return nil
+}
+
+// deleted reports the messages a delete removed, all but those left in the
+// source, as a BatchDeleted event.
+func (m *Mover) deleted(ctx context.Context, queueURL string, messages []*types.Message, left map[string]bool) {
+	removed := make([]*types.Message, 0, len(messages))
+	for _, message := range messages {
+		if !left[aws.ToString(message.MessageId)] {
+			removed = append(removed, message)
+		}
+	}
+
+	if len(removed) > 0 {
+		m.run(ctx).emit(&BatchDeleted{QueueURL: queueURL, Messages: removed})
+	}
+}
+
+// redelete deletes messages whose receipt handles SQS refused, most often
+// because their visibility timeout ran out and the handles expired, by
+// receiving them again and deleting them with the fresh handles. Other
+// messages received along the way are released straight away, although the
+// receive still counts towards their maxReceiveCount. It gives up after
+// maxRetries receives, or one when maxRetries is zero, and returns the
+// messages that remain in the source.
+func (m *Mover) redelete(ctx context.Context, queueURL string, messages []*types.Message, maxRetries int) []*types.Message {
+	wanted := make(map[string]bool, len(messages))
+	for _, message := range messages {
+		wanted[aws.ToString(message.MessageId)] = true
+	}
+
+	for attempt := 0; attempt <= maxRetries && len(wanted) > 0 && ctx.Err() == nil; attempt++ {
+		resp, err := m.Source.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     redeleteWaitTime,
+		})
+		if err != nil {
+			if !isTransient(err) {
+				break
+			}
+			m.retry(ctx, OpDelete, attempt, err)
+			continue
+		}
+
+		var found, others []*types.Message
+		for _, message := range messagePointers(resp.Messages) {
+			if wanted[aws.ToString(message.MessageId)] {
+				found = append(found, message)
+			} else {
+				others = append(others, message)
+			}
+		}
+
+		// Best effort: messages that can't be released reappear once their
+		// visibility timeout expires anyway.
+		m.Release(context.WithoutCancel(ctx), queueURL, others)
+
+		if len(found) == 0 {
+			continue
+		}
+
+		deleted, err := m.Source.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  deleteEntries(found),
+		})
+		if err != nil {
+			continue
+		}
+
+		failed := failedIDs(deleted.Failed)
+		for _, message := range found {
+			if !failed[aws.ToString(message.MessageId)] {
+				delete(wanted, aws.ToString(message.MessageId))
+			}
+		}
+	}
+
+	var remaining []*types.Message
+	for _, message := range messages {
+		if wanted[aws.ToString(message.MessageId)] {
+			remaining = append(remaining, message)
+		}
+	}
+
+	return remaining
+}
+
+// deleteEntries returns the entries deleting messages.
+func deleteEntries(messages []*types.Message) []types.DeleteMessageBatchRequestEntry {
+	entries := make([]types.DeleteMessageBatchRequestEntry, 0, len(messages))
+	for _, message := range messages {
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			ReceiptHandle: message.ReceiptHandle,
+			Id:            message.MessageId,
+		})
+	}
+
+	return entries
+}
+
+// Send enqueues entries to the destination queue of opts, or the queues its
+// Route picks, in batches of up to ten, retrying like a transfer, and returns
+// how many were accepted. It is meant for messages that don't come from the
+// source queue.
+func (m *Mover) Send(ctx context.Context, opts Options, entries []*types.SendMessageBatchRequestEntry) (int, error) {
+	sent, _, err := m.sendRouted(ctx, opts, entries, false)
+	return sent, err
+}
+
+// sendRouted sends entries to the destination queue of opts, or with Route to
+// the queues it picks, one queue after the other in the order they were
+// first picked. It stops at the first queue that fails. With skip the
+// entries SQS refuses for good are returned like sendAll does.
+func (m *Mover) sendRouted(ctx context.Context, opts Options, entries []*types.SendMessageBatchRequestEntry, skip bool) (int, []rejection, error) {
+	if opts.Route == nil {
+		return m.sendAll(ctx, opts.DestinationQueueURL, entries, opts.MaxRetries, skip)
+	}
+
+	var queues []string
+	routed := map[string][]*types.SendMessageBatchRequestEntry{}
+
+	for _, entry := range entries {
+		for _, queueURL := range opts.Route(entry) {
+			if _, ok := routed[queueURL]; !ok {
+				queues = append(queues, queueURL)
+			}
+			routed[queueURL] = append(routed[queueURL], entry)
+		}
+	}
+
+	total := 0
+	var rejected []rejection
+	for _, queueURL := range queues {
+		sent, refused, err := m.sendAll(ctx, queueURL, routed[queueURL], opts.MaxRetries, skip)
+		total += sent
+		rejected = append(rejected, refused...)
+		if err != nil {
+			return total, rejected, err
+		}
+	}
+
+	return total, rejected, nil
+}
+
+// Delete removes messages from the source queue of opts, retrying like a
+// transfer. It is meant for a Handle that consumes messages itself.
+func (m *Mover) Delete(ctx context.Context, opts Options, messages []*types.Message) error {
+	return m.delete(ctx, opts.SourceQueueURL, messages, opts.MaxRetries)
+}
+
+// Release makes received messages visible in the source again straight away,
+// instead of once their visibility timeout expires. It goes on with the
+// remaining batches when one fails and returns the first error.
+func (m *Mover) Release(ctx context.Context, queueURL string, messages []*types.Message) error {
+	return m.changeVisibility(ctx, queueURL, messages, 0, OpRelease)
+}
+
+// changeVisibility sets the visibility timeout of received messages in
+// batches of ten, going on when one fails and returning the first error.
+func (m *Mover) changeVisibility(ctx context.Context, queueURL string, messages []*types.Message, timeout int32, op string) error {
+	var firstErr error
+
+	for start := 0; start < len(messages); start += 10 {
+		end := start + 10
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, 0, end-start)
+		for _, message := range messages[start:end] {
+			entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                message.MessageId,
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: timeout,
+			})
+		}
+
+		resp, err := m.Source.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &Error{Op: op, Err: err}
+			}
+			continue
+		}
+
+		if len(resp.Failed) > 0 && firstErr == nil {
+			firstErr = &Error{Op: op, Err: fmt.Errorf("the visibility timeout of %d messages could not be changed", len(resp.Failed))}
+		}
+	}
+
+	return firstErr
+}
+
+// copyEntries sends every message as it is, with its message attributes and
+// X-Ray trace header.
+func copyEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	entries := make([]*types.SendMessageBatchRequestEntry, len(messages))
+
+	for i, message := range messages {
+		entries[i] = &types.SendMessageBatchRequestEntry{
+			Id:                message.MessageId,
+			MessageBody:       message.Body,
+			MessageAttributes: message.MessageAttributes,
+		}
+
+		if header, ok := message.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)]; ok {
+			entries[i].MessageSystemAttributes = map[string]types.MessageSystemAttributeValue{
+				string(types.MessageSystemAttributeNameForSendsAWSTraceHeader): {
+					DataType:    aws.String("String"),
+					StringValue: aws.String(header),
+				},
+			}
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,271 @@
+package mover
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// entriesOfSizes returns entries whose bodies are sizes bytes long, with IDs
+// naming their position.
+func entriesOfSizes(sizes ...int) []*types.SendMessageBatchRequestEntry {
+	entries := make([]*types.SendMessageBatchRequestEntry, len(sizes))
+	for i, size := range sizes {
+		entries[i] = &types.SendMessageBatchRequestEntry{
+			Id:          aws.String(string(rune('a' + i))),
+			MessageBody: aws.String(strings.Repeat("x", size)),
+		}
+	}
+
+	return entries
+}
+
+func repeat(size int, n int) []int {
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = size
+	}
+
+	return sizes
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []int
+		want  []int
+	}{
+		{name: "empty", sizes: nil, want: nil},
+		{name: "one batch", sizes: repeat(10, 3), want: []int{3}},
+		{name: "ten per batch", sizes: repeat(10, 23), want: []int{10, 10, 3}},
+		{name: "payload limit", sizes: repeat(100000, 5), want: []int{2, 2, 1}},
+		{name: "exactly the payload limit", sizes: []int{maxBatchBytes / 2, maxBatchBytes / 2}, want: []int{2}},
+		{name: "large entry alone", sizes: []int{10, largeEntryBytes + 1, 10}, want: []int{1, 1, 1}},
+		{name: "large entries", sizes: []int{largeEntryBytes + 1, largeEntryBytes + 1}, want: []int{1, 1}},
+		{name: "over the payload limit", sizes: []int{maxBatchBytes + 1, 10}, want: []int{1, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := entriesOfSizes(test.sizes...)
+			batches := splitBatches(entries)
+
+			var got []int
+			var order []*types.SendMessageBatchRequestEntry
+			for _, batch := range batches {
+				got = append(got, len(batch))
+				order = append(order, batch...)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("batch lengths = %v, want %v", got, test.want)
+			}
+
+			for i := range entries {
+				if order[i] != entries[i] {
+					t.Fatalf("entry %d moved to another position", i)
+				}
+			}
+		})
+	}
+}
+
+func TestEntrySize(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *types.SendMessageBatchRequestEntry
+		want  int64
+	}{
+		{
+			name:  "body",
+			entry: &types.SendMessageBatchRequestEntry{MessageBody: aws.String("hello")},
+			want:  5,
+		},
+		{
+			name: "message attributes",
+			entry: &types.SendMessageBatchRequestEntry{
+				MessageBody: aws.String("hello"),
+				MessageAttributes: map[string]types.MessageAttributeValue{
+					"tenant": {DataType: aws.String("String"), StringValue: aws.String("acme")},
+					"blob":   {DataType: aws.String("Binary"), BinaryValue: []byte{1, 2, 3}},
+				},
+			},
+			want: int64(5 + len("tenant") + len("String") + len("acme") + len("blob") + len("Binary") + 3),
+		},
+		{
+			name: "system attributes",
+			entry: &types.SendMessageBatchRequestEntry{
+				MessageSystemAttributes: map[string]types.MessageSystemAttributeValue{
+					string(types.MessageSystemAttributeNameForSendsAWSTraceHeader): {DataType: aws.String("String"), StringValue: aws.String("Root=1")},
+				},
+			},
+			want: int64(len(types.MessageSystemAttributeNameForSendsAWSTraceHeader) + len("String") + len("Root=1")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := entrySize(test.entry); got != test.want {
+				t.Errorf("entrySize = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCopyEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *types.Message
+		trace   string
+	}{
+		{
+			name:    "body and attributes",
+			message: &types.Message{MessageId: aws.String("m1"), Body: aws.String("a")},
+		},
+		{
+			name: "trace header",
+			message: &types.Message{
+				MessageId:  aws.String("m2"),
+				Body:       aws.String("b"),
+				Attributes: map[string]string{string(types.MessageSystemAttributeNameAWSTraceHeader): "Root=1-abc"},
+			},
+			trace: "Root=1-abc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.message.MessageAttributes = map[string]types.MessageAttributeValue{
+				"tenant": {DataType: aws.String("String"), StringValue: aws.String("acme")},
+			}
+
+			entries, err := copyEntries([]*types.Message{test.message})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry := entries[0]
+			if aws.ToString(entry.Id) != aws.ToString(test.message.MessageId) {
+				t.Errorf("Id = %q, want the message ID", aws.ToString(entry.Id))
+			}
+			if aws.ToString(entry.MessageBody) != aws.ToString(test.message.Body) {
+				t.Errorf("MessageBody = %q, want %q", aws.ToString(entry.MessageBody), aws.ToString(test.message.Body))
+			}
+			if aws.ToString(entry.MessageAttributes["tenant"].StringValue) != "acme" {
+				t.Error("message attributes weren't copied")
+			}
+
+			header, ok := entry.MessageSystemAttributes[string(types.MessageSystemAttributeNameForSendsAWSTraceHeader)]
+			if test.trace == "" {
+				if ok {
+					t.Errorf("trace header = %q, want none", aws.ToString(header.StringValue))
+				}
+			} else if !ok || aws.ToString(header.StringValue) != test.trace {
+				t.Errorf("trace header = %q, want %q", aws.ToString(header.StringValue), test.trace)
+			}
+		})
+	}
+}
+
+func TestNumberedBatchResults(t *testing.T) {
+	entries := entriesOfSizes(1, 1, 1, 1)
+	numbered := numberEntries(entries)
+
+	for i, entry := range numbered {
+		if got, want := aws.ToString(entry.Id), string(rune('0'+i)); got != want {
+			t.Fatalf("numbered ID %d = %q, want %q", i, got, want)
+		}
+		if aws.ToString(entries[i].Id) != string(rune('a'+i)) {
+			t.Fatalf("numberEntries changed the ID of entry %d", i)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		successful []string
+		failed     []string
+		accepted   string
+		retried    string
+	}{
+		{name: "all accepted", successful: []string{"0", "1", "2", "3"}, accepted: "abcd"},
+		{name: "all failed", failed: []string{"0", "1", "2", "3"}, retried: "abcd"},
+		{name: "partial", successful: []string{"2", "0"}, failed: []string{"3", "1"}, accepted: "ca", retried: "bd"},
+		{name: "unknown IDs", successful: []string{"7", "x"}, failed: []string{"-1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var successful []types.SendMessageBatchResultEntry
+			for _, id := range test.successful {
+				successful = append(successful, types.SendMessageBatchResultEntry{Id: aws.String(id), MessageId: aws.String("id-" + id)})
+			}
+
+			var failed []types.BatchResultErrorEntry
+			for _, id := range test.failed {
+				failed = append(failed, types.BatchResultErrorEntry{Id: aws.String(id), Code: aws.String("InternalError")})
+			}
+
+			accepted, messageIDs := acceptedEntries(successful, entries)
+			if got := entryIDs(accepted); got != test.accepted {
+				t.Errorf("accepted = %q, want %q", got, test.accepted)
+			}
+			for i, entry := range accepted {
+				position := aws.ToString(entry.Id)[0] - 'a'
+				if want := "id-" + string(rune('0'+position)); messageIDs[i] != want {
+					t.Errorf("message ID of %s = %q, want %q", aws.ToString(entry.Id), messageIDs[i], want)
+				}
+			}
+
+			if got := len(rejectEntries(failed, entries)); got != len(test.retried) {
+				t.Errorf("%d rejections, want %d", got, len(test.retried))
+			}
+
+			retry := failedEntries(failed, entries)
+			if got := entryIDs(retry); got != test.retried {
+				t.Errorf("retried = %q, want %q", got, test.retried)
+			}
+
+			// Failures are renamed after the entries they belong to.
+			for _, failure := range failed {
+				if id := aws.ToString(failure.Id); id != "-1" && strings.IndexByte(test.retried, id[0]) < 0 {
+					t.Errorf("failure ID %q names no retried entry", id)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	server := types.BatchResultErrorEntry{Id: aws.String("0"), SenderFault: false}
+	sender := types.BatchResultErrorEntry{Id: aws.String("1"), SenderFault: true}
+
+	tests := []struct {
+		name   string
+		failed []types.BatchResultErrorEntry
+		want   bool
+	}{
+		{name: "server faults", failed: []types.BatchResultErrorEntry{server}, want: true},
+		{name: "sender fault", failed: []types.BatchResultErrorEntry{sender}, want: false},
+		{name: "mixed", failed: []types.BatchResultErrorEntry{server, sender}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryable(test.failed); got != test.want {
+				t.Errorf("retryable = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func entryIDs(entries []*types.SendMessageBatchRequestEntry) string {
+	var ids strings.Builder
+	for _, entry := range entries {
+		ids.WriteString(aws.ToString(entry.Id))
+	}
+
+	return ids.String()
+}
@@ -0,0 +1,209 @@
+package mover
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// ChecksumMismatchCode is the error code of a message whose MD5 digest, as
+// SQS reported it, doesn't match what was sent or received. It is retried
+// like a throttled call.
+const ChecksumMismatchCode = "ChecksumMismatch"
+
+// checksumClient checks the MD5 digests SQS returns for the bodies and
+// attributes of messages against the messages themselves.
+type checksumClient struct {
+	SQSAPI
+}
+
+// NewChecksumClient returns a client that verifies the MD5 digests of every
+// body, message attribute and system attribute SQS reports on a send or a
+// receive through client. Sent entries whose digests don't match fail with
+// ChecksumMismatchCode as a server side failure, so the mover sends them
+// again, and a receive holding such a message fails as a whole. Digests a
+// response leaves out, as sinks do, aren't checked.
+//
+// The SDK checks the digests itself unless the client's options set
+// DisableMessageChecksumValidation, and fails whole batches on a mismatch;
+// set it to have mismatches retried entry by entry.
+func NewChecksumClient(client SQSAPI) SQSAPI {
+	return &checksumClient{SQSAPI: client}
+}
+
+func (c *checksumClient) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	resp, err := c.SQSAPI.ReceiveMessage(ctx, input, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	var corrupt []string
+	for _, message := range resp.Messages {
+		if reason := checksumMismatch(message.Body, message.MD5OfBody, message.MessageAttributes, message.MD5OfMessageAttributes); reason != "" {
+			corrupt = append(corrupt, fmt.Sprintf("%s (%s)", aws.ToString(message.MessageId), reason))
+		}
+	}
+
+	if len(corrupt) > 0 {
+		return nil, &smithy.GenericAPIError{Code: ChecksumMismatchCode, Message: "received messages don't match their MD5 digests: " + strings.Join(corrupt, ", ")}
+	}
+
+	return resp, nil
+}
+
+func (c *checksumClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	resp, err := c.SQSAPI.SendMessageBatch(ctx, input, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	entries := make(map[string]types.SendMessageBatchRequestEntry, len(input.Entries))
+	for _, entry := range input.Entries {
+		entries[aws.ToString(entry.Id)] = entry
+	}
+
+	successful := resp.Successful[:0:0]
+	for _, result := range resp.Successful {
+		entry, ok := entries[aws.ToString(result.Id)]
+		if !ok {
+			successful = append(successful, result)
+			continue
+		}
+
+		reason := checksumMismatch(entry.MessageBody, result.MD5OfMessageBody, entry.MessageAttributes, result.MD5OfMessageAttributes)
+		if reason == "" {
+			reason = systemChecksumMismatch(entry.MessageSystemAttributes, result.MD5OfMessageSystemAttributes)
+		}
+
+		if reason == "" {
+			successful = append(successful, result)
+			continue
+		}
+
+		resp.Failed = append(resp.Failed, types.BatchResultErrorEntry{
+			Id:      result.Id,
+			Code:    aws.String(ChecksumMismatchCode),
+			Message: aws.String(fmt.Sprintf("message %s was stored with a different %s", aws.ToString(result.MessageId), reason)),
+		})
+	}
+	resp.Successful = successful
+
+	return resp, nil
+}
+
+func (c *checksumClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	resp, err := c.SQSAPI.SendMessage(ctx, input, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	reason := checksumMismatch(input.MessageBody, resp.MD5OfMessageBody, input.MessageAttributes, resp.MD5OfMessageAttributes)
+	if reason == "" {
+		reason = systemChecksumMismatch(input.MessageSystemAttributes, resp.MD5OfMessageSystemAttributes)
+	}
+
+	if reason != "" {
+		return nil, &smithy.GenericAPIError{Code: ChecksumMismatchCode, Message: fmt.Sprintf("message %s was stored with a different %s", aws.ToString(resp.MessageId), reason)}
+	}
+
+	return resp, nil
+}
+
+// checksumMismatch names what of a message doesn't match its digests, or
+// returns an empty string when everything does.
+func checksumMismatch(body *string, bodyMD5 *string, attributes map[string]types.MessageAttributeValue, attributesMD5 *string) string {
+	if bodyMD5 != nil && md5Hex([]byte(aws.ToString(body))) != aws.ToString(bodyMD5) {
+		return "body"
+	}
+
+	if attributesMD5 != nil && len(attributes) > 0 {
+		values := make(map[string]attributeValue, len(attributes))
+		for name, value := range attributes {
+			values[name] = attributeValue{value.DataType, value.StringValue, value.BinaryValue}
+		}
+
+		if attributesDigest(values) != aws.ToString(attributesMD5) {
+			return "message attributes"
+		}
+	}
+
+	return ""
+}
+
+// systemChecksumMismatch is checksumMismatch for the system attributes of a
+// send, such as the trace header.
+func systemChecksumMismatch(attributes map[string]types.MessageSystemAttributeValue, digest *string) string {
+	if digest == nil || len(attributes) == 0 {
+		return ""
+	}
+
+	values := make(map[string]attributeValue, len(attributes))
+	for name, value := range attributes {
+		values[name] = attributeValue{value.DataType, value.StringValue, value.BinaryValue}
+	}
+
+	if attributesDigest(values) != aws.ToString(digest) {
+		return "system attributes"
+	}
+
+	return ""
+}
+
+// attributeValue is what attributesDigest needs of a message or system
+// attribute.
+type attributeValue struct {
+	dataType    *string
+	stringValue *string
+	binaryValue []byte
+}
+
+// attributesDigest computes the MD5 digest SQS reports for attributes: over
+// the attributes in order of their names, each as its name, data type,
+// transport type (1 for strings and numbers, 2 for binary) and value, with
+// every name, type and value preceded by its length as 4 bytes big endian.
+func attributesDigest(attributes map[string]attributeValue) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	field := func(value []byte) {
+		binary.Write(&buf, binary.BigEndian, uint32(len(value)))
+		buf.Write(value)
+	}
+
+	for _, name := range names {
+		value := attributes[name]
+		dataType := aws.ToString(value.dataType)
+
+		field([]byte(name))
+		field([]byte(dataType))
+
+		if strings.HasPrefix(dataType, "Binary") {
+			buf.WriteByte(2)
+			field(value.binaryValue)
+		} else {
+			buf.WriteByte(1)
+			field([]byte(aws.ToString(value.stringValue)))
+		}
+	}
+
+	return md5Hex(buf.Bytes())
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,81 @@
+package mover
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestAttributesDigest(t *testing.T) {
+	traceHeader := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+	// The number and trace header digests are the ones SQS returned for
+	// these attributes, the trace header as MD5OfMessageSystemAttributes. The
+	// string and binary digests weren't recorded from SQS but computed apart
+	// from this code with the documented algorithm.
+	tests := []struct {
+		name       string
+		attributes map[string]attributeValue
+		want       string
+	}{
+		{
+			name: "number",
+			attributes: map[string]attributeValue{
+				"timestamp": {dataType: aws.String("Number"), stringValue: aws.String("1493147359900")},
+			},
+			want: "235c5c510d26fb653d073faed50ae77c",
+		},
+		{
+			name: "another number",
+			attributes: map[string]attributeValue{
+				"timestamp": {dataType: aws.String("Number"), stringValue: aws.String("1493147359901")},
+			},
+			want: "994258b45346a2cc3f9cbb611aa7af30",
+		},
+		{
+			name: "number with a custom type",
+			attributes: map[string]attributeValue{
+				"timestamp": {dataType: aws.String("Number.java.lang.Long"), stringValue: aws.String("1493147359900")},
+			},
+			want: "2e2e4876d8e0bd6b8c2c8f556831c349",
+		},
+		{
+			name: "trace header system attribute",
+			attributes: map[string]attributeValue{
+				"AWSTraceHeader": {dataType: aws.String("String"), stringValue: aws.String(traceHeader)},
+			},
+			want: "5ae4d5d7636402d80f4eb6d213245a88",
+		},
+		{
+			name: "string",
+			attributes: map[string]attributeValue{
+				"Key": {dataType: aws.String("String"), stringValue: aws.String("Value")},
+			},
+			want: "076d718c6783c0644f04b060430cc9f3",
+		},
+		{
+			name: "binary",
+			attributes: map[string]attributeValue{
+				"payload": {dataType: aws.String("Binary"), binaryValue: []byte{0x00, 0x01, 0x02, 0xff}},
+			},
+			want: "3bf6c26b0d2ad68743ad36ef0d0f6d96",
+		},
+		{
+			name: "several, in order of their names",
+			attributes: map[string]attributeValue{
+				"timestamp":   {dataType: aws.String("Number"), stringValue: aws.String("1493147359900")},
+				"payload":     {dataType: aws.String("Binary"), binaryValue: []byte{0x00, 0x01, 0x02, 0xff}},
+				"contentType": {dataType: aws.String("String"), stringValue: aws.String("application/json")},
+			},
+			want: "7ba79db49a0f1c7efcec4be58352edff",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := attributesDigest(test.attributes); got != test.want {
+				t.Errorf("attributesDigest() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package mover
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// deleteMargin is how much longer than DeleteAfter moved messages stay
+// hidden, so they are deleted before they could reappear in the source.
+const deleteMargin = time.Minute
+
+// pendingDelete is a batch of moved messages waiting to be deleted from the
+// source.
+type pendingDelete struct {
+	due        time.Time
+	queueURL   string
+	messages   []*types.Message
+	maxRetries int
+}
+
+// deferDelete hides sent messages in the source for DeleteAfter and queues
+// their deletion for when it has passed.
+func (m *Mover) deferDelete(ctx context.Context, opts Options, messages []*types.Message) error {
+	timeout := int32((opts.DeleteAfter + deleteMargin + time.Second - 1) / time.Second)
+	if timeout > maxVisibilityTimeout {
+		timeout = maxVisibilityTimeout
+	}
+
+	if err := m.changeVisibility(ctx, opts.SourceQueueURL, messages, timeout, OpHide); err != nil {
+		return err
+	}
+
+	run := m.run(ctx)
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.pending = append(run.pending, pendingDelete{
+		due:        time.Now().Add(opts.DeleteAfter),
+		queueURL:   opts.SourceQueueURL,
+		messages:   messages,
+		maxRetries: opts.MaxRetries,
+	})
+
+	return nil
+}
+
+// DeletePending waits for the deletions Transfer deferred because of
+// DeleteAfter and makes them as they fall due. Move calls it before
+// returning, for the deletions of that move only. If ctx is done first, it
+// returns ctx's error and the messages still waiting are left to reappear in
+// the source, which rolls the move of those messages back.
+func (m *Mover) DeletePending(ctx context.Context) error {
+	run := m.run(ctx)
+
+	for {
+		run.mu.Lock()
+		if len(run.pending) == 0 {
+			run.mu.Unlock()
+			return nil
+		}
+		next := run.pending[0]
+		run.mu.Unlock()
+
+		if wait := time.Until(next.due); wait > 0 {
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if err := m.delete(context.WithoutCancel(ctx), next.queueURL, next.messages, next.maxRetries); err != nil {
+			return err
+		}
+
+		run.mu.Lock()
+		run.pending = run.pending[1:]
+		run.mu.Unlock()
+	}
+}
@@ -0,0 +1,196 @@
+//go:build integration
+
+package mover_test
+
+// The tests in this file run the mover against ElasticMQ rather than
+// movertest, to catch what the fake gets wrong about the real API. They are
+// left out of go test unless the integration build tag is given:
+//
+//	docker run -d -p 9324:9324 softwaremill/elasticmq-native
+//	go test -tags integration ./pkg/mover/
+//
+// SQSMOVER_ELASTICMQ_ENDPOINT points them at another ElasticMQ than
+// http://localhost:9324.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+const defaultElasticMQEndpoint = "http://localhost:9324"
+
+// elasticMQ returns a client of the ElasticMQ the tests run against, or
+// skips the test when none answers.
+func elasticMQ(t *testing.T) *sqs.Client {
+	t.Helper()
+
+	endpoint := os.Getenv("SQSMOVER_ELASTICMQ_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultElasticMQEndpoint
+	}
+
+	client := sqs.New(sqs.Options{
+		BaseEndpoint:     aws.String(endpoint),
+		Region:           "elasticmq",
+		Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+		RetryMaxAttempts: 1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.ListQueues(ctx, &sqs.ListQueuesInput{}); err != nil {
+		t.Skipf("no ElasticMQ at %s: %s", endpoint, err)
+	}
+
+	return client
+}
+
+// createQueue creates a queue named after the test, deleted when it ends.
+func createQueue(t *testing.T, client *sqs.Client, name string, fifo bool) string {
+	t.Helper()
+
+	input := &sqs.CreateQueueInput{
+		QueueName:  aws.String(fmt.Sprintf("sqsmover-%s-%d", name, time.Now().UnixNano())),
+		Attributes: map[string]string{},
+	}
+	if fifo {
+		*input.QueueName += ".fifo"
+		input.Attributes[string(types.QueueAttributeNameFifoQueue)] = "true"
+	}
+
+	resp, err := client.CreateQueue(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.DeleteQueue(context.Background(), &sqs.DeleteQueueInput{QueueUrl: resp.QueueUrl})
+	})
+
+	return aws.ToString(resp.QueueUrl)
+}
+
+// sendBodies sends bodies to a queue, in one message group on a FIFO queue.
+func sendBodies(t *testing.T, client *sqs.Client, queueURL string, fifo bool, bodies []string) {
+	t.Helper()
+
+	for i, body := range bodies {
+		input := &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(body)}
+		if fifo {
+			input.MessageGroupId = aws.String("group")
+			input.MessageDeduplicationId = aws.String(fmt.Sprint(i))
+		}
+
+		if _, err := client.SendMessage(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receiveBodies drains a queue and returns the bodies it held, in the order
+// they were received.
+func receiveBodies(t *testing.T, client *sqs.Client, queueURL string) []string {
+	t.Helper()
+
+	var bodies []string
+	for {
+		resp, err := client.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     1,
+			VisibilityTimeout:   60,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Messages) == 0 {
+			return bodies
+		}
+
+		var entries []types.DeleteMessageBatchRequestEntry
+		for i, message := range resp.Messages {
+			bodies = append(bodies, aws.ToString(message.Body))
+			entries = append(entries, types.DeleteMessageBatchRequestEntry{Id: aws.String(fmt.Sprint(i)), ReceiptHandle: message.ReceiptHandle})
+		}
+
+		if _, err := client.DeleteMessageBatch(context.Background(), &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestElasticMQMove(t *testing.T) {
+	client := elasticMQ(t)
+
+	tests := []struct {
+		name string
+		fifo bool
+		opts mover.Options
+
+		wantMoved   int
+		wantInQueue int
+		wantLeft    int
+	}{
+		{name: "standard", wantMoved: 25, wantInQueue: 25},
+		{name: "several workers", opts: mover.Options{Workers: 3, Prefetch: 2}, wantMoved: 25, wantInQueue: 25},
+		{name: "limit", opts: mover.Options{Limit: 7}, wantMoved: 7, wantInQueue: 7, wantLeft: 18},
+		{name: "copy", opts: mover.Options{Copy: true}, wantMoved: 25, wantInQueue: 25, wantLeft: 25},
+		{
+			name:        "fifo",
+			fifo:        true,
+			opts:        mover.Options{AttributeNames: []string{string(types.QueueAttributeNameAll)}, Entries: fifoEntries},
+			wantMoved:   25,
+			wantInQueue: 25,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := createQueue(t, client, "source", test.fifo)
+			destination := createQueue(t, client, "destination", test.fifo)
+			sent := bodies("m", 25)
+			sendBodies(t, client, source, test.fifo, sent)
+
+			opts := test.opts
+			opts.SourceQueueURL = source
+			opts.DestinationQueueURL = destination
+			opts.MaxRetries = 3
+			opts.EmptyReceives = 3
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			result, err := mover.New(client, client).Move(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Moved != test.wantMoved || result.Failed != 0 {
+				t.Errorf("result = %+v, want %d moved", result, test.wantMoved)
+			}
+
+			moved := receiveBodies(t, client, destination)
+			if len(moved) != test.wantInQueue {
+				t.Errorf("destination holds %d messages, want %d", len(moved), test.wantInQueue)
+			}
+			if test.fifo && !slices.Equal(moved, sent) {
+				t.Errorf("destination holds %v, want the source order", moved)
+			}
+
+			// Copied messages are released when the move ends.
+			if left := receiveBodies(t, client, source); len(left) != test.wantLeft {
+				t.Errorf("source holds %d messages, want %d", len(left), test.wantLeft)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package mover
+
+import "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+// Event is something that happened during Move, passed to Options.Events:
+// one of BatchReceived, BatchSent, BatchDeleted, Retry, PartialFailure and
+// Completed. Tools embedding the mover switch on its type to drive their own
+// displays, notifications or structured logs.
+type Event interface {
+	event()
+}
+
+// BatchReceived is a receive from the source that returned messages, before
+// Filter and the other checks picked those to move.
+type BatchReceived struct {
+	QueueURL string
+	Messages []*types.Message
+	// Bytes counts the bodies and message attributes of Messages.
+	Bytes int64
+}
+
+// BatchSent is a send call whose Entries a queue accepted. A batch split by
+// size or spread over several queues is sent in several calls.
+type BatchSent struct {
+	QueueURL string
+	Entries  []*types.SendMessageBatchRequestEntry
+	// MessageIDs are the IDs the queue gave Entries, in the same order.
+	MessageIDs []string
+	// Bytes counts the bodies and message attributes of Entries.
+	Bytes int64
+}
+
+// BatchDeleted lists the source messages a delete removed, after its retries.
+type BatchDeleted struct {
+	QueueURL string
+	Messages []*types.Message
+}
+
+// Retry is a call about to be repeated after a backoff. Err is the error the
+// call failed with, or nil when entries of a batch failed on the SQS side,
+// which the PartialFailure before it lists.
+type Retry struct {
+	Op      string
+	Attempt int
+	Err     error
+}
+
+// PartialFailure is a batch call that SQS accepted only some of the entries
+// of. Failed names the entries by the message IDs or entry IDs they came
+// from. Retried tells whether they are tried again.
+type PartialFailure struct {
+	Op       string
+	QueueURL string
+	Failed   []types.BatchResultErrorEntry
+	Retried  bool
+}
+
+// Completed ends every Move, with what it returns.
+type Completed struct {
+	Result Result
+	Err    error
+}
+
+func (*BatchReceived) event()  {}
+func (*BatchSent) event()      {}
+func (*BatchDeleted) event()   {}
+func (*Retry) event()          {}
+func (*PartialFailure) event() {}
+func (*Completed) event()      {}
+
+// emit passes event to Options.Events of the move, if it has one.
+func (r *runState) emit(event Event) {
+	if r.events != nil {
+		r.events(event)
+	}
+}
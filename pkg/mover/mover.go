@@ -0,0 +1,1116 @@
+// Package mover moves messages from one SQS queue to another. It runs the
+// receive, send and delete loop behind the sqs command, so other tools can
+// embed it:
+//
+//	m := mover.New(sqs.NewFromConfig(cfg), sqs.NewFromConfig(cfg))
+//	result, err := m.Move(ctx, mover.Options{
+//		SourceQueueURL:      source,
+//		DestinationQueueURL: destination,
+//	})
+package mover
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DefaultVisibilityTimeout is how long, in seconds, received messages stay
+// hidden in the source while a batch is sent and deleted without retries.
+const DefaultVisibilityTimeout = 10
+
+// maxVisibilityTimeout is the longest visibility timeout SQS accepts: 12
+// hours.
+const maxVisibilityTimeout = 43200
+
+// Options configures a move. Only the queue URLs are required.
+type Options struct {
+	SourceQueueURL      string
+	DestinationQueueURL string
+
+	// Workers is the number of concurrent receive, send and delete loops.
+	// Zero means one.
+	Workers int
+
+	// Limit stops the move once this many messages were taken from the
+	// source. Zero means no limit.
+	Limit int
+
+	// MaxRetries is how many times a batch is retried after throttling,
+	// server errors or entries that failed on the SQS side, with
+	// exponential backoff and jitter between attempts. Zero means no
+	// retries beyond the SDK's own.
+	MaxRetries int
+
+	// Copy leaves messages in the source: they are sent but not deleted, and
+	// made visible again once the move ends. Copied messages are kept hidden
+	// while the move runs, and those received again anyway aren't sent
+	// twice. The move ends once the source only returns messages it already
+	// copied and reports no visible messages left.
+	Copy bool
+
+	// DeleteAfter keeps moved messages hidden in the source instead of
+	// deleting them straight away, and deletes them once this long has
+	// passed since they were sent, giving the destination's consumers time
+	// to process them. Stopping the move before then rolls it back: the
+	// messages reappear in the source. Zero deletes straight away.
+	DeleteAfter time.Duration
+
+	// VisibilityTimeout hides received messages in the source for this many
+	// seconds. Zero means PrefetchVisibilityTimeout(MaxRetries, Prefetch),
+	// so messages don't reappear while their batch is still waiting or
+	// being retried.
+	VisibilityTimeout int32
+
+	// Prefetch pipelines each worker: it receives up to this many batches
+	// ahead of the one being sent, and up to this many sent batches wait to
+	// be deleted, so the round trips of receives, sends and deletes overlap.
+	// With Handle set only receives run ahead. Zero receives, sends and
+	// deletes one batch after the other.
+	Prefetch int
+
+	// Rate is the most source messages received per second, and ByteRate
+	// the most bytes of bodies and message attributes, across all workers.
+	// Zero means no limit.
+	Rate     float64
+	ByteRate float64
+
+	// RampUp starts Rate and ByteRate at a tenth and raises them evenly to
+	// the full rate over this long, so the consumers of the destination can
+	// scale up before the backlog reaches them at full speed. Zero starts at
+	// the full rate.
+	RampUp time.Duration
+
+	// BatchInterval is the least time between the starts of two batches,
+	// across all workers. Zero means no pause.
+	BatchInterval time.Duration
+
+	// Follow keeps receiving once the source is drained, moving messages as
+	// they arrive, until ctx is done or the limit is reached. The move then
+	// ends as if the source was drained rather than on an error. Receives
+	// should long poll with WaitTimeSeconds, or an empty source is polled
+	// in a tight loop.
+	Follow bool
+
+	// WaitTimeSeconds long polls each receive for up to this many seconds,
+	// at most 20, so a source that is momentarily empty isn't taken for a
+	// drained one. Zero returns straight away.
+	WaitTimeSeconds int32
+
+	// EmptyReceives is how many receives in a row, across all workers, must
+	// come back empty before the source is taken for drained, unless it
+	// reports no visible messages first. SQS may return nothing from a
+	// queue that still holds messages, short polling in particular, so the
+	// receives that follow an empty one long poll for at least
+	// EmptyWaitTimeSeconds. Zero or one ends on the first empty receive.
+	EmptyReceives int
+
+	// AttributeNames and MessageAttributeNames are requested with every
+	// receive.
+	AttributeNames        []string
+	MessageAttributeNames []string
+
+	// Filter selects the messages to move. Messages it rejects are left in
+	// the source, and the move ends once the source only returns rejected
+	// messages. Nil moves everything.
+	Filter func(*types.Message) bool
+
+	// Since leaves alone the messages sent to the source at or after this
+	// time, such as those a move into its own source sends back. They stay
+	// hidden until the move ends and are then released, without being
+	// counted. Zero takes messages whatever their age.
+	Since time.Time
+
+	// ReleaseSkipped makes the messages Filter rejected available in the
+	// source again when the move ends, rather than once their visibility
+	// timeout expires, so a following move can take them straight away.
+	ReleaseSkipped bool
+
+	// Drop selects messages that are deleted from the source without being
+	// sent. Nil drops nothing.
+	Drop func(*types.Message) bool
+
+	// Divert selects messages that are sent unchanged to DivertQueueURL,
+	// with the destination client, instead of to the destination, and then
+	// deleted from the source. They are counted as dropped. Nil diverts
+	// nothing.
+	Divert         func(*types.Message) bool
+	DivertQueueURL string
+
+	// Route picks the queues each entry is sent to, with the destination
+	// client, instead of DestinationQueueURL: one of several to spread the
+	// messages over them, or all of them to duplicate the messages. It must
+	// return at least one queue. Sent counts an entry once for every queue
+	// it was sent to. Nil sends every entry to DestinationQueueURL.
+	Route func(*types.SendMessageBatchRequestEntry) []string
+
+	// SkipFailed keeps the move going when SQS refuses entries for good:
+	// outright, or still once MaxRetries were used up. The messages they
+	// came from are left hidden in the source, aren't taken again when they
+	// reappear, and are released when the move ends. With FailedQueueURL
+	// they are sent there unchanged instead, with the destination client,
+	// and deleted from the source. Either way they count as failed and are
+	// reported to Rejected, while the rest of their batch is moved. Without
+	// SkipFailed the first refused entry stops the move.
+	SkipFailed     bool
+	FailedQueueURL string
+
+	// Rejected is called for every message SkipFailed set aside. Calls may
+	// come from several workers at once.
+	Rejected func(Rejection)
+
+	// Entries builds the destination entries for messages. Entry IDs name
+	// the messages in errors; they are numbered when sent, so they needn't
+	// be unique. Nil sends every body with its message
+	// attributes and trace header.
+	Entries func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error)
+
+	// Sent is called with the source messages of every batch once its
+	// entries were sent, before the messages are deleted from the source.
+	// Calls may come from several workers at once.
+	Sent func([]*types.Message)
+
+	// Sequenced is called during Move with the entries a FIFO queue
+	// accepted, in the order of their batch, and the sequence numbers SQS
+	// gave them, so the order of message groups can be checked. Calls may
+	// come from several workers at once.
+	Sequenced func(queueURL string, entries []*types.SendMessageBatchRequestEntry, sequenceNumbers []string)
+
+	// Events is called during Move with every Event, down to the Completed
+	// that ends it, for tools that show or forward the progress of a move
+	// in their own way. Calls may come from several workers at once and
+	// hold up the worker they come from, so slow consumers should hand the
+	// events over to a goroutine of their own.
+	Events func(Event)
+
+	// Handle replaces Transfer for the messages of each receive, for modes
+	// that hold on to messages across receives. It is called with no
+	// messages when a worker finishes, so held messages can be flushed.
+	Handle func(ctx context.Context, messages []*types.Message) (Result, error)
+
+	// Abort is called once when the move stops on an error or because ctx
+	// was cancelled, so a Handle that holds messages can Release them.
+	Abort func(ctx context.Context)
+
+	// Progress is called after every batch with the totals so far. Calls
+	// are serialised.
+	Progress func(Result)
+}
+
+// Rejection is a message SkipFailed set aside, with the error SQS refused
+// its entry with.
+type Rejection struct {
+	Message *types.Message
+	Code    string
+	Reason  string
+}
+
+// Result counts what a move did.
+type Result struct {
+	// Moved counts source messages sent and deleted, or only sent with
+	// Copy.
+	Moved int
+	// Sent counts destination messages, which differ from Moved when
+	// Entries splits or combines messages.
+	Sent int
+	// Dropped counts source messages deleted without being sent to the
+	// destination, including those sent to DivertQueueURL.
+	Dropped int
+	// Skipped counts distinct messages Filter left in the source.
+	Skipped int
+	// Failed counts source messages received but neither moved nor dropped
+	// because their batch couldn't be sent or deleted, or because SkipFailed
+	// set them aside.
+	Failed int
+	// Retries counts the calls the move repeated after throttling, server
+	// errors or entries that failed on the SQS side.
+	Retries int
+	// Undeleted counts messages among Moved and Dropped that were sent but
+	// couldn't be deleted from the source, even after receiving them again
+	// for fresh receipt handles. They are delivered again once their
+	// visibility timeout expires.
+	Undeleted int
+	// ReceivedBytes and SentBytes count the bodies and message attributes
+	// of every message received from the source, including those received
+	// again, and of every entry the destination accepted.
+	ReceivedBytes int64
+	SentBytes     int64
+	// PayloadChunks counts the 64 KB chunks SQS bills the receives that
+	// returned messages and the send calls as, each call at least one. The
+	// empty receives, deletes and other calls are billed on top.
+	PayloadChunks int64
+}
+
+func (r *Result) add(other Result) {
+	r.Moved += other.Moved
+	r.Sent += other.Sent
+	r.Dropped += other.Dropped
+	r.Skipped += other.Skipped
+	r.Failed += other.Failed
+	r.Retries += other.Retries
+	r.Undeleted += other.Undeleted
+	r.ReceivedBytes += other.ReceivedBytes
+	r.SentBytes += other.SentBytes
+	r.PayloadChunks += other.PayloadChunks
+}
+
+// SQSAPI is the part of the SQS client a Mover calls. *sqs.Client
+// implements it, and so do the clients NewChecksumClient and NewSinkClient
+// return.
+type SQSAPI interface {
+	ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	SendMessage(ctx context.Context, input *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	DeleteMessageBatch(ctx context.Context, input *sqs.DeleteMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityBatch(ctx context.Context, input *sqs.ChangeMessageVisibilityBatchInput, opts ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+	GetQueueAttributes(ctx context.Context, input *sqs.GetQueueAttributesInput, opts ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// Mover moves messages between queues reached through the given clients,
+// which may belong to different accounts or regions. It is safe to call Move
+// from several goroutines at once: each move keeps its own state, so one
+// Mover can drive many moves between queues its clients reach.
+type Mover struct {
+	Source      SQSAPI
+	Destination SQSAPI
+
+	// state is used by Transfer, Send and DeletePending when they are
+	// called outside Move.
+	state runState
+
+	retries  atomic.Int64
+	inFlight atomic.Int64
+}
+
+// Retries returns how many calls the mover repeated after throttling, server
+// errors or entries that failed on the SQS side, on top of the SDK's own
+// retries, across all its moves. Result.Retries counts those of one move.
+func (m *Mover) Retries() int {
+	return int(m.retries.Load())
+}
+
+// InFlight returns how many received messages belong to a batch that is
+// still being moved, including batches received ahead with Prefetch, across
+// all its moves.
+func (m *Mover) InFlight() int {
+	return int(m.inFlight.Load())
+}
+
+// New returns a Mover that receives and deletes with source and sends with
+// destination.
+func New(source SQSAPI, destination SQSAPI) *Mover {
+	return &Mover{Source: source, Destination: destination}
+}
+
+// Move runs the receive, send and delete loop until the source is drained,
+// the limit is reached or ctx is cancelled. Each worker stops once the source
+// looks drained, on its first empty receive unless EmptyReceives asks for
+// more; the first error stops the others after their current batch
+// and is returned with the totals moved until then.
+func (m *Mover) Move(ctx context.Context, opts Options) (Result, error) {
+	run := &runState{sequenced: opts.Sequenced, events: opts.Events}
+	ctx = withRunState(ctx, run)
+
+	params := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(opts.SourceQueueURL),
+		VisibilityTimeout:     opts.VisibilityTimeout,
+		WaitTimeSeconds:       opts.WaitTimeSeconds,
+		AttributeNames:        receiveAttributeNames(opts.AttributeNames),
+		MessageAttributeNames: opts.MessageAttributeNames,
+	}
+
+	if opts.VisibilityTimeout == 0 {
+		params.VisibilityTimeout = PrefetchVisibilityTimeout(opts.MaxRetries, opts.Prefetch)
+	}
+
+	if !opts.Since.IsZero() && !slices.Contains(opts.AttributeNames, string(types.MessageSystemAttributeNameSentTimestamp)) {
+		params.AttributeNames = append(params.AttributeNames, types.QueueAttributeName(types.MessageSystemAttributeNameSentTimestamp))
+	}
+
+	handle := opts.Handle
+	if handle == nil {
+		handle = func(ctx context.Context, messages []*types.Message) (Result, error) {
+			return m.Transfer(ctx, opts, messages)
+		}
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		total    Result
+		firstErr error
+		failed   atomic.Bool
+		wg       sync.WaitGroup
+	)
+
+	// record adds a batch to the totals and reports progress.
+	record := func(batch Result, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		total.add(batch)
+		run.totals(&total)
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+			failed.Store(true)
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(total)
+		}
+	}
+
+	quota := newReceiveQuota(opts.Limit)
+	empty := &emptyStreak{needed: int64(opts.EmptyReceives)}
+	limiter := newRateLimiter(opts.Rate, opts.ByteRate, opts.BatchInterval, opts.RampUp)
+	skipped := newSkippedSet()
+	later := newSkippedSet()
+
+	// stopHiding ends the renewals of a copy, before its messages are
+	// released.
+	stopHiding := func() {}
+
+	var copies *copiedSet
+	if opts.Copy {
+		copies = newCopiedSet()
+
+		hideCtx, cancel := context.WithCancel(ctx)
+		hidden := make(chan struct{})
+		go func() {
+			defer close(hidden)
+			copies.hide(hideCtx, m, opts.SourceQueueURL, params.VisibilityTimeout)
+		}()
+
+		stopHiding = func() {
+			cancel()
+			<-hidden
+		}
+	}
+
+	// stop ends the receiving once ctx is done or the limiter fails. A
+	// follow that was stopped ends like a drained source.
+	stop := func(err error) ([]*types.Message, batchState) {
+		if opts.Follow && ctx.Err() != nil {
+			return nil, batchEnd
+		}
+
+		record(Result{}, err)
+		return nil, batchStop
+	}
+
+	// next receives until it has a batch to hand over. It returns
+	// batchEnd once the source has nothing new left, and batchStop when the
+	// move stopped, after recording why.
+	next := func() ([]*types.Message, batchState) {
+		for {
+			if failed.Load() {
+				return nil, batchStop
+			}
+
+			if err := ctx.Err(); err != nil {
+				return stop(err)
+			}
+
+			size := quota.take()
+			if size == 0 {
+				return nil, batchEnd
+			}
+
+			if err := limiter.take(ctx, size); err != nil {
+				quota.giveBack(size)
+				return stop(err)
+			}
+
+			receive := *params
+			receive.MaxNumberOfMessages = int32(size)
+			if empty.started() && opts.WaitTimeSeconds < EmptyWaitTimeSeconds {
+				receive.WaitTimeSeconds = EmptyWaitTimeSeconds
+			}
+
+			var poll []func(*sqs.Options)
+			if receive.WaitTimeSeconds == 0 {
+				poll = append(poll, ShortPoll)
+			}
+
+			resp, err := m.Source.ReceiveMessage(ctx, &receive, poll...)
+			if err != nil {
+				// A receive cut short by ctx reports why ctx ended rather
+				// than the SDK's request canceled error.
+				if ctx.Err() != nil {
+					return stop(ctx.Err())
+				}
+				record(Result{}, &Error{Op: OpReceive, Err: err})
+				return nil, batchStop
+			}
+
+			received := messagePointers(resp.Messages)
+			if len(received) > 0 {
+				empty.reset()
+				run.received(opts.SourceQueueURL, received)
+			}
+
+			messages, rejected := partition(received, opts.Filter)
+
+			var newer []*types.Message
+			if !opts.Since.IsZero() {
+				messages, newer = partition(messages, func(message *types.Message) bool {
+					return sentBefore(message, opts.Since)
+				})
+			}
+
+			var repeated []*types.Message
+			if copies != nil {
+				messages, repeated = copies.split(messages)
+			}
+
+			// Messages set aside earlier count as repeated, so they aren't
+			// sent again.
+			if opts.SkipFailed {
+				var aside []*types.Message
+				messages, aside = run.asideSet().known(messages)
+				repeated = append(repeated, aside...)
+			}
+
+			quota.giveBack(size - int64(len(messages)))
+			limiter.received(size, messages)
+
+			if len(rejected) > 0 || len(repeated) > 0 || len(newer) > 0 {
+				fresh := skipped.add(rejected)
+				freshNewer := later.add(newer)
+				record(Result{Skipped: fresh}, nil)
+
+				if len(messages) == 0 {
+					// Only messages skipped, copied or sent back before
+					// came back, so nothing new is left unless the source
+					// still shows visible messages: those received again
+					// are hidden by this receive, and the rest may be new.
+					if fresh == 0 && freshNewer == 0 && !opts.Follow && !m.visible(ctx, opts.SourceQueueURL) {
+						return nil, batchEnd
+					}
+					continue
+				}
+			}
+
+			if len(messages) == 0 {
+				if opts.Follow || !m.drained(ctx, opts.SourceQueueURL, empty) {
+					continue
+				}
+				return nil, batchEnd
+			}
+
+			m.inFlight.Add(int64(len(messages)))
+			return messages, batchReady
+		}
+	}
+
+	worker := func() {
+		defer wg.Done()
+
+		// A panic outside a batch, such as in Filter, stops the move. The
+		// messages of the receive it happened in reappear once their
+		// visibility timeout expires.
+		defer func() {
+			if v := recover(); v != nil {
+				record(Result{}, &PanicError{Value: v, Stack: debug.Stack()})
+			}
+		}()
+
+		if opts.Prefetch > 0 {
+			m.pipeline(ctx, opts, handle, next, record, failed.Load)
+			return
+		}
+
+		for {
+			messages, state := next()
+			if state == batchEnd {
+				record(m.handleBatch(ctx, opts, handle, nil))
+			}
+			if state != batchReady {
+				return
+			}
+
+			record(m.handleBatch(ctx, opts, handle, messages))
+			m.inFlight.Add(-int64(len(messages)))
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+	wg.Wait()
+	stopHiding()
+
+	if firstErr != nil && opts.Abort != nil {
+		opts.Abort(context.WithoutCancel(ctx))
+	}
+
+	// Best effort: messages that can't be released reappear once their
+	// visibility timeout expires anyway.
+	if copies != nil {
+		m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, copies.messages())
+	}
+
+	if opts.ReleaseSkipped {
+		m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, skipped.messages())
+	}
+
+	m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, later.messages())
+
+	if opts.SkipFailed {
+		m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, run.asideSet().drain())
+	}
+
+	if err := m.DeletePending(ctx); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	run.totals(&total)
+	run.emit(&Completed{Result: total, Err: firstErr})
+	return total, firstErr
+}
+
+// VisibilityTimeoutFor returns the visibility timeout Move uses by default:
+// DefaultVisibilityTimeout plus the longest a batch retried maxRetries times
+// can back off for, both while it is sent and while it is deleted.
+func VisibilityTimeoutFor(maxRetries int) int32 {
+	return PrefetchVisibilityTimeout(maxRetries, 0)
+}
+
+// PrefetchVisibilityTimeout is VisibilityTimeoutFor when Prefetch batches may
+// wait ahead of a batch both before it is sent and before it is deleted.
+func PrefetchVisibilityTimeout(maxRetries int, prefetch int) int32 {
+	window := 2 * retryWindow(maxRetries)
+
+	timeout := (DefaultVisibilityTimeout + int64((window+time.Second-1)/time.Second)) * int64(1+2*prefetch)
+	if timeout > maxVisibilityTimeout {
+		timeout = maxVisibilityTimeout
+	}
+
+	return int32(timeout)
+}
+
+// handleBatch calls handle with a batch, turning a panic in it into a
+// PanicError.
+func (m *Mover) handleBatch(ctx context.Context, opts Options, handle func(context.Context, []*types.Message) (Result, error), messages []*types.Message) (result Result, err error) {
+	defer m.recoverBatch(ctx, opts, messages, &result, &err)
+
+	return handle(ctx, messages)
+}
+
+// recoverBatch is deferred by the steps that run hooks on a batch. It turns
+// a panic into a PanicError and releases the messages of the batch, so they
+// are available in the source again straight away. Messages sent before the
+// panic may then be moved twice.
+func (m *Mover) recoverBatch(ctx context.Context, opts Options, messages []*types.Message, result *Result, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	*err = &PanicError{Value: v, Stack: debug.Stack()}
+	*result = Result{Failed: len(messages)}
+
+	m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, messages)
+}
+
+// Transfer sends messages to the destination and deletes them from the source
+// once every entry was accepted, unless Copy is set. With DeleteAfter the
+// deletion is deferred until DeletePending. Messages selected by Drop are only
+// deleted.
+// If the messages can't be sent they are released, so they are available in
+// the source again straight away. Cancelling ctx doesn't interrupt a transfer,
+// since stopping between the send and the delete would leave the messages in
+// both queues.
+func (m *Mover) Transfer(ctx context.Context, opts Options, messages []*types.Message) (Result, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	result, kept, err := m.sendBatch(ctx, opts, messages)
+	if err != nil {
+		return result, err
+	}
+
+	return m.finishBatch(ctx, opts, without(messages, kept), result)
+}
+
+// sendBatch is the sending half of Transfer. Its result counts the messages
+// as moved and dropped, which only holds once finishBatch deleted them. It
+// returns the messages SkipFailed left in the source, which must not be
+// deleted.
+func (m *Mover) sendBatch(ctx context.Context, opts Options, messages []*types.Message) (result Result, kept []*types.Message, err error) {
+	defer m.recoverBatch(ctx, opts, messages, &result, &err)
+
+	forward, dropped := partition(messages, func(message *types.Message) bool {
+		return opts.Drop == nil || !opts.Drop(message)
+	})
+
+	forward, diverted := partition(forward, func(message *types.Message) bool {
+		return opts.Divert == nil || !opts.Divert(message)
+	})
+
+	if len(diverted) > 0 {
+		entries, _ := copyEntries(diverted)
+
+		if _, err := m.send(ctx, opts.DivertQueueURL, entries, opts.MaxRetries); err != nil {
+			m.Release(ctx, opts.SourceQueueURL, messages)
+			result.Failed = len(messages)
+			return result, nil, err
+		}
+	}
+
+	if len(forward) > 0 {
+		build := opts.Entries
+		if build == nil {
+			build = copyEntries
+		}
+
+		entries, err := build(forward)
+		if err != nil {
+			m.Release(ctx, opts.SourceQueueURL, messages)
+			result.Failed = len(messages)
+			return result, nil, &Error{Op: OpEntries, Err: err}
+		}
+
+		sent, rejected, err := m.sendRouted(ctx, opts, entries, opts.SkipFailed)
+		result.Sent = sent
+
+		if err == nil && len(rejected) > 0 {
+			var failed []*types.Message
+			if failed, err = m.setAside(ctx, opts, forward, rejected); err == nil {
+				forward = without(forward, failed)
+				result.Failed = len(failed)
+				if opts.FailedQueueURL == "" {
+					kept = failed
+				}
+			}
+		}
+
+		if err != nil {
+			m.Release(ctx, opts.SourceQueueURL, messages)
+			result.Failed = len(messages)
+			return result, nil, err
+		}
+
+		if opts.Sent != nil {
+			opts.Sent(forward)
+		}
+	}
+
+	result.Moved = len(forward)
+	result.Dropped = len(dropped) + len(diverted)
+
+	return result, kept, nil
+}
+
+// setAside finds the messages the rejected entries came from, by the entry
+// IDs the Entries of the move give them, and sends them to FailedQueueURL or
+// remembers them to leave them in the source. It reports them to Rejected. A
+// rejected entry whose message can't be told, such as one combining several
+// messages, fails the batch as it would without SkipFailed.
+func (m *Mover) setAside(ctx context.Context, opts Options, messages []*types.Message, rejected []rejection) ([]*types.Message, error) {
+	byID := make(map[string]*types.Message, len(messages))
+	for _, message := range messages {
+		byID[aws.ToString(message.MessageId)] = message
+	}
+
+	var failed []*types.Message
+	reasons := map[*types.Message]types.BatchResultErrorEntry{}
+
+	for _, r := range rejected {
+		message := rejectedMessage(byID, aws.ToString(r.entry.Id))
+		if message == nil {
+			failures := make([]types.BatchResultErrorEntry, len(rejected))
+			for i, r := range rejected {
+				failures[i] = r.failure
+			}
+			return nil, &Error{Op: OpSend, Err: fmt.Errorf("%d messages failed to enqueue: %s", len(failures), describeFailures(failures))}
+		}
+
+		if _, ok := reasons[message]; !ok {
+			failed = append(failed, message)
+			reasons[message] = r.failure
+		}
+	}
+
+	if opts.FailedQueueURL != "" {
+		entries, _ := copyEntries(failed)
+		if _, err := m.send(ctx, opts.FailedQueueURL, entries, opts.MaxRetries); err != nil {
+			return nil, err
+		}
+	} else {
+		m.run(ctx).asideSet().add(failed)
+	}
+
+	if opts.Rejected != nil {
+		for _, message := range failed {
+			failure := reasons[message]
+			opts.Rejected(Rejection{Message: message, Code: aws.ToString(failure.Code), Reason: aws.ToString(failure.Message)})
+		}
+	}
+
+	return failed, nil
+}
+
+// rejectedMessage returns the message an entry ID names: its message ID, or
+// its message ID with the -N suffix of an exploded message. It returns nil
+// when there is none.
+func rejectedMessage(byID map[string]*types.Message, id string) *types.Message {
+	if message, ok := byID[id]; ok {
+		return message
+	}
+
+	if i := strings.LastIndex(id, "-"); i > 0 {
+		if _, err := strconv.Atoi(id[i+1:]); err == nil {
+			return byID[id[:i]]
+		}
+	}
+
+	return nil
+}
+
+// finishBatch is the deleting half of Transfer, for messages sendBatch sent
+// with result.
+func (m *Mover) finishBatch(ctx context.Context, opts Options, messages []*types.Message, result Result) (Result, error) {
+	if opts.Copy {
+		return result, nil
+	}
+
+	var err error
+	if opts.DeleteAfter > 0 {
+		err = m.deferDelete(ctx, opts, messages)
+	} else {
+		err = m.delete(ctx, opts.SourceQueueURL, messages, opts.MaxRetries)
+	}
+
+	if err != nil {
+		return Result{Sent: result.Sent, Failed: result.Failed + len(messages)}, err
+	}
+
+	return result, nil
+}
+
+// without returns messages except those in removed.
+func without(messages []*types.Message, removed []*types.Message) []*types.Message {
+	if len(removed) == 0 {
+		return messages
+	}
+
+	return slices.DeleteFunc(slices.Clone(messages), func(message *types.Message) bool {
+		return slices.Contains(removed, message)
+	})
+}
+
+// messagePointers returns pointers to the messages of a receive, which the
+// mover hands around and compares by address.
+func messagePointers(messages []types.Message) []*types.Message {
+	pointers := make([]*types.Message, len(messages))
+	for i := range messages {
+		pointers[i] = &messages[i]
+	}
+
+	return pointers
+}
+
+// receiveAttributeNames converts the attribute names of Options for a
+// receive. They go in the AttributeNames the SDK deprecated for
+// MessageSystemAttributeNames, which emulators don't all know yet.
+func receiveAttributeNames(names []string) []types.QueueAttributeName {
+	converted := make([]types.QueueAttributeName, len(names))
+	for i, name := range names {
+		converted[i] = types.QueueAttributeName(name)
+	}
+
+	return converted
+}
+
+// partition splits messages into those keep accepts and the rest. A nil keep
+// accepts everything.
+func partition(messages []*types.Message, keep func(*types.Message) bool) ([]*types.Message, []*types.Message) {
+	if keep == nil {
+		return messages, nil
+	}
+
+	var kept, rest []*types.Message
+
+	for _, message := range messages {
+		if keep(message) {
+			kept = append(kept, message)
+		} else {
+			rest = append(rest, message)
+		}
+	}
+
+	return kept, rest
+}
+
+// payloadChunkBytes is the size of the chunks SQS bills payloads by.
+const payloadChunkBytes = 64 * 1024
+
+// payloadChunks returns how many requests SQS bills a call with a payload of
+// size as.
+func payloadChunks(size int64) int64 {
+	if size <= payloadChunkBytes {
+		return 1
+	}
+
+	return (size + payloadChunkBytes - 1) / payloadChunkBytes
+}
+
+// EmptyWaitTimeSeconds is the least the receives that follow an empty one
+// long poll for when Options.EmptyReceives is above one.
+const EmptyWaitTimeSeconds = 2
+
+// emptyStreak counts the receives in a row, across all workers, that came
+// back empty, to tell a drained source from one SQS briefly returned nothing
+// from.
+type emptyStreak struct {
+	needed int64
+	count  atomic.Int64
+}
+
+// started reports whether the latest receive came back empty.
+func (e *emptyStreak) started() bool {
+	return e.needed > 1 && e.count.Load() > 0
+}
+
+func (e *emptyStreak) reset() {
+	e.count.Store(0)
+}
+
+// drained counts an empty receive and reports whether the source can be
+// taken for drained: once the streak is long enough, or once the source
+// reports no visible messages. A source whose attributes can't be read is
+// judged by its receives alone.
+func (m *Mover) drained(ctx context.Context, queueURL string, empty *emptyStreak) bool {
+	if empty.count.Add(1) >= empty.needed {
+		return true
+	}
+
+	visible, err := m.visibleMessages(ctx, queueURL)
+	return err == nil && visible == "0"
+}
+
+// visible reports whether the source has visible messages left. A source
+// whose attributes can't be read is taken to have none, so the move ends as
+// it did before it asked.
+func (m *Mover) visible(ctx context.Context, queueURL string) bool {
+	visible, err := m.visibleMessages(ctx, queueURL)
+	return err == nil && visible != "0"
+}
+
+// visibleMessages reads the approximate number of visible messages in a
+// queue.
+func (m *Mover) visibleMessages(ctx context.Context, queueURL string) (string, error) {
+	resp, err := m.Source.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)], nil
+}
+
+// receiveQuota hands out receive sizes so that no more than limit messages
+// are taken from the source across all workers. A zero limit is unlimited.
+type receiveQuota struct {
+	limited   bool
+	remaining atomic.Int64
+}
+
+func newReceiveQuota(limit int) *receiveQuota {
+	q := &receiveQuota{limited: limit > 0}
+	q.remaining.Store(int64(limit))
+	return q
+}
+
+// take reserves up to ten messages and returns how many may be received. It
+// returns zero once the limit is used up.
+func (q *receiveQuota) take() int64 {
+	if !q.limited {
+		return 10
+	}
+
+	for {
+		remaining := q.remaining.Load()
+		n := remaining
+		if n > 10 {
+			n = 10
+		}
+
+		if n <= 0 || q.remaining.CompareAndSwap(remaining, remaining-n) {
+			return n
+		}
+	}
+}
+
+// giveBack returns the part of a reservation that was not received.
+func (q *receiveQuota) giveBack(n int64) {
+	if q.limited && n > 0 {
+		q.remaining.Add(n)
+	}
+}
+
+// sentBefore reports whether message was sent to its queue before since, to
+// the millisecond SentTimestamp has. Messages without a SentTimestamp are
+// taken as older.
+func sentBefore(message *types.Message, since time.Time) bool {
+	millis, err := strconv.ParseInt(message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+	if err != nil {
+		return true
+	}
+
+	return millis < since.UnixMilli()
+}
+
+// skippedSet remembers which messages the filter rejected, so a move can tell
+// when the source only has rejected messages left, with the receipt handle of
+// their latest receive so they can be released.
+type skippedSet struct {
+	mu       sync.Mutex
+	received map[string]*types.Message
+}
+
+func newSkippedSet() *skippedSet {
+	return &skippedSet{received: map[string]*types.Message{}}
+}
+
+// add records messages and returns how many had not been seen before.
+func (s *skippedSet) add(messages []*types.Message) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh := 0
+	for _, message := range messages {
+		id := aws.ToString(message.MessageId)
+		if _, ok := s.received[id]; !ok {
+			fresh++
+		}
+		s.received[id] = message
+	}
+
+	return fresh
+}
+
+// known separates the messages recorded before from the rest, and keeps the
+// receipt handles of their latest receive.
+func (s *skippedSet) known(messages []*types.Message) ([]*types.Message, []*types.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rest, known []*types.Message
+
+	for _, message := range messages {
+		id := aws.ToString(message.MessageId)
+		if _, ok := s.received[id]; ok {
+			known = append(known, message)
+			s.received[id] = message
+		} else {
+			rest = append(rest, message)
+		}
+	}
+
+	return rest, known
+}
+
+// drain returns the recorded messages and forgets them.
+func (s *skippedSet) drain() []*types.Message {
+	messages := s.messages()
+
+	s.mu.Lock()
+	s.received = map[string]*types.Message{}
+	s.mu.Unlock()
+
+	return messages
+}
+
+func (s *skippedSet) messages() []*types.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]*types.Message, 0, len(s.received))
+	for _, message := range s.received {
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+// copiedSet remembers the messages a copy sent, with the receipt handle of
+// their latest receive so they can be released when the move ends.
+type copiedSet struct {
+	mu       sync.Mutex
+	received map[string]*types.Message
+}
+
+func newCopiedSet() *copiedSet {
+	return &copiedSet{received: map[string]*types.Message{}}
+}
+
+// split records messages and separates those that were copied before.
+func (c *copiedSet) split(messages []*types.Message) ([]*types.Message, []*types.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var fresh, repeated []*types.Message
+
+	for _, message := range messages {
+		id := aws.ToString(message.MessageId)
+		if _, ok := c.received[id]; ok {
+			repeated = append(repeated, message)
+		} else {
+			fresh = append(fresh, message)
+		}
+		c.received[id] = message
+	}
+
+	return fresh, repeated
+}
+
+// hide keeps the copied messages hidden in the source until ctx is done, by
+// renewing their visibility timeout half way through it. A message whose
+// renewal fails, such as one hidden for the 12 hours SQS allows, is received
+// again, but it isn't sent twice and Move doesn't take it for the end of the
+// source.
+func (c *copiedSet) hide(ctx context.Context, m *Mover, queueURL string, timeout int32) {
+	ticker := time.NewTicker(time.Duration(timeout) * time.Second / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.changeVisibility(ctx, queueURL, c.messages(), timeout, OpHide)
+		}
+	}
+}
+
+func (c *copiedSet) messages() []*types.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := make([]*types.Message, 0, len(c.received))
+	for _, message := range c.received {
+		messages = append(messages, message)
+	}
+
+	return messages
+}
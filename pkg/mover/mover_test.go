@@ -0,0 +1,779 @@
+package mover_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+	"github.com/mercury2269/sqsmover/pkg/mover/movertest"
+)
+
+// bodies returns n message bodies named after prefix.
+func bodies(prefix string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s-%02d", prefix, i)
+	}
+
+	return out
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+func TestMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  int
+		opts      mover.Options
+		want      mover.Result
+		remaining int
+	}{
+		{
+			name:     "single batch",
+			messages: 3,
+			want:     mover.Result{Moved: 3, Sent: 3},
+		},
+		{
+			name:     "several batches",
+			messages: 25,
+			want:     mover.Result{Moved: 25, Sent: 25},
+		},
+		{
+			name:     "several workers",
+			messages: 45,
+			opts:     mover.Options{Workers: 3},
+			want:     mover.Result{Moved: 45, Sent: 45},
+		},
+		{
+			name:      "limit",
+			messages:  25,
+			opts:      mover.Options{Limit: 12},
+			want:      mover.Result{Moved: 12, Sent: 12},
+			remaining: 13,
+		},
+		{
+			name:     "drop",
+			messages: 10,
+			opts: mover.Options{Drop: func(message *types.Message) bool {
+				return strings.HasSuffix(aws.ToString(message.Body), "0")
+			}},
+			want: mover.Result{Moved: 9, Sent: 9, Dropped: 1},
+		},
+		{
+			name:     "split entries",
+			messages: 4,
+			opts: mover.Options{Entries: func(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+				var entries []*types.SendMessageBatchRequestEntry
+				for _, message := range messages {
+					for _, part := range []string{"x", "y"} {
+						entries = append(entries, &types.SendMessageBatchRequestEntry{
+							Id:          aws.String(aws.ToString(message.MessageId) + "-" + part),
+							MessageBody: aws.String(aws.ToString(message.Body) + part),
+						})
+					}
+				}
+				return entries, nil
+			}},
+			want: mover.Result{Moved: 4, Sent: 8},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := movertest.New()
+			source := fake.NewQueue("source")
+			destination := fake.NewQueue("destination")
+			fake.Add(source, bodies("m", test.messages)...)
+
+			opts := test.opts
+			opts.SourceQueueURL = source
+			opts.DestinationQueueURL = destination
+
+			result, err := mover.New(fake, fake).Move(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Moved != test.want.Moved || result.Sent != test.want.Sent || result.Dropped != test.want.Dropped || result.Failed != 0 {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+
+			if got := len(fake.Bodies(source)); got != test.remaining {
+				t.Errorf("%d messages left in the source, want %d", got, test.remaining)
+			}
+			if got := len(fake.Bodies(destination)); got != test.want.Sent {
+				t.Errorf("%d messages in the destination, want %d", got, test.want.Sent)
+			}
+		})
+	}
+}
+
+func TestMovePartialFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		// refuse is the error code the destination refuses the body
+		// "m-03" with, attempts times.
+		refuse     string
+		attempts   int
+		skipFailed bool
+		failedTo   bool
+		maxRetries int
+
+		wantErr      bool
+		wantMoved    int
+		wantFailed   int
+		wantRejected int
+		wantRetries  bool
+		wantInSource []string
+		wantInFailed []string
+	}{
+		{
+			name:        "server fault retried",
+			refuse:      "InternalError",
+			attempts:    2,
+			maxRetries:  3,
+			wantMoved:   10,
+			wantRetries: true,
+		},
+		{
+			name:       "server fault out of retries",
+			refuse:     "InternalError",
+			attempts:   5,
+			maxRetries: 1,
+			wantErr:    true,
+			// The whole batch is released when it fails.
+			wantFailed:   10,
+			wantRetries:  true,
+			wantInSource: bodies("m", 10),
+		},
+		{
+			name:         "sender fault stops the move",
+			refuse:       "InvalidParameterValue",
+			attempts:     1,
+			maxRetries:   3,
+			wantErr:      true,
+			wantFailed:   10,
+			wantInSource: bodies("m", 10),
+		},
+		{
+			name:         "sender fault skipped",
+			refuse:       "InvalidParameterValue",
+			attempts:     1,
+			maxRetries:   3,
+			skipFailed:   true,
+			wantMoved:    9,
+			wantFailed:   1,
+			wantRejected: 1,
+			wantInSource: []string{"m-03"},
+		},
+		{
+			name:         "sender fault set aside",
+			refuse:       "InvalidParameterValue",
+			attempts:     1,
+			skipFailed:   true,
+			failedTo:     true,
+			wantMoved:    9,
+			wantFailed:   1,
+			wantRejected: 1,
+			wantInFailed: []string{"m-03"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := movertest.New()
+			source := fake.NewQueue("source")
+			destination := fake.NewQueue("destination")
+			failedQueue := fake.NewQueue("failed")
+			fake.Add(source, bodies("m", 10)...)
+
+			refused := 0
+			fake.Refuse = func(queueURL string, entry *types.SendMessageBatchRequestEntry) string {
+				if queueURL != destination || aws.ToString(entry.MessageBody) != "m-03" || refused == test.attempts {
+					return ""
+				}
+				refused++
+				return test.refuse
+			}
+
+			var mu sync.Mutex
+			var rejected []mover.Rejection
+			var partial int
+
+			opts := mover.Options{
+				SourceQueueURL:      source,
+				DestinationQueueURL: destination,
+				MaxRetries:          test.maxRetries,
+				SkipFailed:          test.skipFailed,
+				Rejected: func(r mover.Rejection) {
+					mu.Lock()
+					defer mu.Unlock()
+					rejected = append(rejected, r)
+				},
+				Events: func(event mover.Event) {
+					if _, ok := event.(*mover.PartialFailure); ok {
+						mu.Lock()
+						defer mu.Unlock()
+						partial++
+					}
+				},
+			}
+			if test.failedTo {
+				opts.FailedQueueURL = failedQueue
+			}
+
+			m := mover.New(fake, fake)
+			result, err := m.Move(context.Background(), opts)
+
+			if test.wantErr {
+				var moveErr *mover.Error
+				if !errors.As(err, &moveErr) || moveErr.Op != mover.OpSend {
+					t.Fatalf("err = %v, want a send error", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Moved != test.wantMoved || result.Failed != test.wantFailed {
+				t.Errorf("result = %+v, want %d moved and %d failed", result, test.wantMoved, test.wantFailed)
+			}
+
+			if got := len(rejected); got != test.wantRejected {
+				t.Errorf("%d rejections, want %d", got, test.wantRejected)
+			} else if got > 0 && (aws.ToString(rejected[0].Message.Body) != "m-03" || rejected[0].Code != test.refuse) {
+				t.Errorf("rejection = %s %s, want m-03 %s", aws.ToString(rejected[0].Message.Body), rejected[0].Code, test.refuse)
+			}
+
+			if partial == 0 {
+				t.Error("no PartialFailure event")
+			}
+
+			if got := result.Retries > 0; got != test.wantRetries {
+				t.Errorf("%d retries, want retries: %v", result.Retries, test.wantRetries)
+			}
+
+			if got := fake.Bodies(source); !slices.Equal(sorted(got), sorted(test.wantInSource)) {
+				t.Errorf("source holds %v, want %v", got, test.wantInSource)
+			}
+			if got := fake.Bodies(failedQueue); !slices.Equal(got, test.wantInFailed) {
+				t.Errorf("failed queue holds %v, want %v", got, test.wantInFailed)
+			}
+		})
+	}
+}
+
+// fifoEntries keeps the message group and deduplication IDs of FIFO
+// messages, as the sqs command does for a FIFO destination.
+func fifoEntries(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+	entries := make([]*types.SendMessageBatchRequestEntry, len(messages))
+	for i, message := range messages {
+		entries[i] = &types.SendMessageBatchRequestEntry{
+			Id:                     message.MessageId,
+			MessageBody:            message.Body,
+			MessageGroupId:         aws.String(message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]),
+			MessageDeduplicationId: aws.String(message.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)]),
+		}
+	}
+
+	return entries, nil
+}
+
+func TestMoveFIFO(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		entries     func([]*types.Message) ([]*types.SendMessageBatchRequestEntry, error)
+		duplicates  bool
+		wantErr     string
+		wantSent    int
+		wantInQueue int
+	}{
+		{
+			name:        "group and deduplication IDs kept",
+			source:      "source.fifo",
+			entries:     fifoEntries,
+			wantSent:    15,
+			wantInQueue: 15,
+		},
+		{
+			name:   "duplicates accepted once",
+			source: "source",
+			entries: func(messages []*types.Message) ([]*types.SendMessageBatchRequestEntry, error) {
+				entries, _ := fifoEntries(messages)
+				for _, entry := range entries {
+					entry.MessageGroupId = aws.String("g")
+					entry.MessageDeduplicationId = aws.String(strings.TrimRight(aws.ToString(entry.MessageBody), "0123456789"))
+				}
+				return entries, nil
+			},
+			duplicates:  true,
+			wantSent:    15,
+			wantInQueue: 1,
+		},
+		{
+			name:    "missing group ID",
+			source:  "source",
+			wantErr: "MissingParameter",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := movertest.New()
+			source := fake.NewQueue(test.source)
+			destination := fake.NewQueue("destination.fifo")
+			fake.Add(source, bodies("m", 15)...)
+
+			var mu sync.Mutex
+			var sequenceNumbers []string
+			var sequenced []string
+
+			result, err := mover.New(fake, fake).Move(context.Background(), mover.Options{
+				SourceQueueURL:      source,
+				DestinationQueueURL: destination,
+				AttributeNames:      []string{string(types.QueueAttributeNameAll)},
+				Entries:             test.entries,
+				Sequenced: func(queueURL string, entries []*types.SendMessageBatchRequestEntry, numbers []string) {
+					mu.Lock()
+					defer mu.Unlock()
+					for _, entry := range entries {
+						sequenced = append(sequenced, aws.ToString(entry.MessageBody))
+					}
+					sequenceNumbers = append(sequenceNumbers, numbers...)
+				},
+			})
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("err = %v, want %s", err, test.wantErr)
+				}
+				if got := len(fake.Bodies(source)); got != 15 {
+					t.Errorf("%d messages left in the source, want 15", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Sent != test.wantSent {
+				t.Errorf("sent %d, want %d", result.Sent, test.wantSent)
+			}
+
+			moved := fake.Messages(destination)
+			if len(moved) != test.wantInQueue {
+				t.Fatalf("destination holds %d messages, want %d", len(moved), test.wantInQueue)
+			}
+
+			if test.duplicates {
+				return
+			}
+
+			// A single worker sends one group in order.
+			if !slices.Equal(sequenced, bodies("m", 15)) {
+				t.Errorf("sequenced %v, want the source order", sequenced)
+			}
+			if !slices.IsSorted(sequenceNumbers) {
+				t.Errorf("sequence numbers %v aren't increasing", sequenceNumbers)
+			}
+
+			// movertest.Add gives FIFO messages the group "movertest" and
+			// the MD5 of their body as deduplication ID.
+			for i, message := range moved {
+				group := message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+				dedup := message.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)]
+				if group != "movertest" {
+					t.Errorf("message %d has group %q, want the source's", i, group)
+				}
+				if sum := md5.Sum([]byte(aws.ToString(message.Body))); dedup != hex.EncodeToString(sum[:]) {
+					t.Errorf("message %d has deduplication ID %q, want the source's", i, dedup)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveRetries(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "RequestThrottled", Message: "Rate exceeded"}
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access denied", Fault: smithy.FaultClient}
+	unavailable := &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+		Err:      errors.New("bad gateway"),
+	}}
+
+	tests := []struct {
+		name       string
+		operation  string
+		err        error
+		failures   int
+		maxRetries int
+
+		wantErr     bool
+		wantRetries int
+	}{
+		// Receives are retried by the SDK alone.
+		{name: "throttled receive", operation: "ReceiveMessage", err: throttled, failures: 1, maxRetries: 3, wantErr: true},
+		{name: "throttled send", operation: "SendMessageBatch", err: throttled, failures: 2, maxRetries: 3, wantRetries: 2},
+		{name: "throttled delete", operation: "DeleteMessageBatch", err: throttled, failures: 1, maxRetries: 3, wantRetries: 1},
+		{name: "server error", operation: "SendMessageBatch", err: unavailable, failures: 1, maxRetries: 3, wantRetries: 1},
+		{name: "out of retries", operation: "SendMessageBatch", err: throttled, failures: 3, maxRetries: 2, wantErr: true, wantRetries: 2},
+		{name: "no retries", operation: "SendMessageBatch", err: throttled, failures: 1, wantErr: true},
+		{name: "not transient", operation: "SendMessageBatch", err: denied, failures: 1, maxRetries: 3, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := movertest.New()
+			source := fake.NewQueue("source")
+			destination := fake.NewQueue("destination")
+			fake.Add(source, bodies("m", 5)...)
+
+			var mu sync.Mutex
+			failed := 0
+			fake.Err = func(operation string, queueURL string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if operation != test.operation || failed == test.failures {
+					return nil
+				}
+				failed++
+				return test.err
+			}
+
+			var retries []*mover.Retry
+			m := mover.New(fake, fake)
+			result, err := m.Move(context.Background(), mover.Options{
+				SourceQueueURL:      source,
+				DestinationQueueURL: destination,
+				MaxRetries:          test.maxRetries,
+				Events: func(event mover.Event) {
+					if retry, ok := event.(*mover.Retry); ok {
+						mu.Lock()
+						defer mu.Unlock()
+						retries = append(retries, retry)
+					}
+				},
+			})
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("the move succeeded, want an error")
+				}
+				if !errors.Is(err, test.err) && !strings.Contains(err.Error(), test.err.Error()) {
+					t.Errorf("err = %v, want %v", err, test.err)
+				}
+				if got := len(fake.Bodies(source)); got != 5 {
+					t.Errorf("%d messages left in the source, want 5", got)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Moved != 5 || len(fake.Bodies(destination)) != 5 {
+					t.Errorf("moved %d, destination holds %d, want 5", result.Moved, len(fake.Bodies(destination)))
+				}
+			}
+
+			if result.Retries != test.wantRetries || m.Retries() != test.wantRetries {
+				t.Errorf("%d retries, Mover.Retries %d, want %d", result.Retries, m.Retries(), test.wantRetries)
+			}
+			if len(retries) != test.wantRetries {
+				t.Errorf("%d Retry events, want %d", len(retries), test.wantRetries)
+			}
+			for i, retry := range retries {
+				if retry.Attempt != i || retry.Err != test.err {
+					t.Errorf("Retry event %d = attempt %d, %v", i, retry.Attempt, retry.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveCopy(t *testing.T) {
+	tests := []struct {
+		name string
+		// expire moves the clock of the fake past the visibility timeout at
+		// every send, so the copied messages reappear in the source.
+		expire bool
+		// sendDelay slows every send down, so the copy outlasts the
+		// visibility timeout unless it is renewed.
+		sendDelay time.Duration
+		// handle copies through Handle instead of sending, as dump does.
+		handle bool
+		// wantReceivedOnce means no message was received twice.
+		wantReceivedOnce bool
+	}{
+		{name: "copied messages reappear", expire: true},
+		{name: "copied messages stay hidden", sendDelay: 1200 * time.Millisecond, wantReceivedOnce: true},
+		{name: "handled messages reappear", expire: true, handle: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := movertest.New()
+			source := fake.NewQueue("source")
+			destination := fake.NewQueue("destination")
+			fake.Add(source, bodies("m", 25)...)
+
+			var mu sync.Mutex
+			now := time.Now()
+			if test.expire {
+				fake.Now = func() time.Time {
+					mu.Lock()
+					defer mu.Unlock()
+					return now
+				}
+			}
+
+			// sending stands for the time a batch takes to be sent.
+			sending := func() {
+				if test.expire {
+					mu.Lock()
+					now = now.Add(3 * time.Second)
+					mu.Unlock()
+				}
+				time.Sleep(test.sendDelay)
+			}
+
+			fake.Err = func(operation string, queueURL string) error {
+				if operation == "SendMessageBatch" {
+					sending()
+				}
+				return nil
+			}
+
+			opts := mover.Options{
+				SourceQueueURL:      source,
+				DestinationQueueURL: destination,
+				Copy:                true,
+				VisibilityTimeout:   2,
+			}
+
+			// A dump writes the messages itself, then its file stands for
+			// the destination.
+			if test.handle {
+				opts.Handle = func(ctx context.Context, messages []*types.Message) (mover.Result, error) {
+					sending()
+					for _, message := range messages {
+						fake.Add(destination, aws.ToString(message.Body))
+					}
+					return mover.Result{Moved: len(messages)}, nil
+				}
+			}
+
+			result, err := mover.New(fake, fake).Move(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Moved != 25 {
+				t.Errorf("copied %d messages, want 25", result.Moved)
+			}
+			if got := sorted(fake.Bodies(destination)); !slices.Equal(got, bodies("m", 25)) {
+				t.Errorf("destination holds %v, want every message once", got)
+			}
+			if got := len(fake.Bodies(source)); got != 25 {
+				t.Errorf("%d messages left in the source, want 25", got)
+			}
+
+			if test.wantReceivedOnce {
+				for _, message := range fake.Messages(source) {
+					if count := message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]; count != "1" {
+						t.Errorf("%s was received %s times, want once", aws.ToString(message.Body), count)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMoveDeleteAfter(t *testing.T) {
+	const deleteAfter = 300 * time.Millisecond
+
+	fake := movertest.New()
+	source := fake.NewQueue("source")
+	destination := fake.NewQueue("destination")
+	fake.Add(source, bodies("m", 25)...)
+
+	var mu sync.Mutex
+	var firstSend, firstDelete time.Time
+	fake.Err = func(operation string, queueURL string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case operation == "SendMessageBatch" && firstSend.IsZero():
+			firstSend = time.Now()
+		case operation == "DeleteMessageBatch" && firstDelete.IsZero():
+			firstDelete = time.Now()
+		}
+		return nil
+	}
+
+	result, err := mover.New(fake, fake).Move(context.Background(), mover.Options{
+		SourceQueueURL:      source,
+		DestinationQueueURL: destination,
+		DeleteAfter:         deleteAfter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Moved != 25 {
+		t.Errorf("moved %d messages, want 25", result.Moved)
+	}
+	if firstDelete.IsZero() {
+		t.Fatal("no message was deleted")
+	}
+	if waited := firstDelete.Sub(firstSend); waited < deleteAfter {
+		t.Errorf("deleted %s after the first send, want at least %s", waited, deleteAfter)
+	}
+	if got := fake.Bodies(source); len(got) != 0 {
+		t.Errorf("source holds %v, want it empty", got)
+	}
+	if got := sorted(fake.Bodies(destination)); !slices.Equal(got, bodies("m", 25)) {
+		t.Errorf("destination holds %v, want every message once", got)
+	}
+}
+
+func TestMoveDeleteAfterCancelled(t *testing.T) {
+	const deleteAfter = time.Hour
+
+	fake := movertest.New()
+	source := fake.NewQueue("source")
+	destination := fake.NewQueue("destination")
+	fake.Add(source, bodies("m", 25)...)
+
+	var mu sync.Mutex
+	now := time.Now()
+	fake.Now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	// The move sends every message long before the deletions fall due, so
+	// the timeout ends it while DeletePending waits.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := mover.New(fake, fake).Move(ctx, mover.Options{
+		SourceQueueURL:      source,
+		DestinationQueueURL: destination,
+		DeleteAfter:         deleteAfter,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Move() = %v, want the context's error", err)
+	}
+
+	if calls := fake.Calls("DeleteMessageBatch"); calls != 0 {
+		t.Errorf("DeleteMessageBatch called %d times, want none", calls)
+	}
+	if got := sorted(fake.Bodies(destination)); !slices.Equal(got, bodies("m", 25)) {
+		t.Errorf("destination holds %v, want every message once", got)
+	}
+
+	// The moved messages stay hidden for DeleteAfter and its margin, then
+	// reappear in the source.
+	out, err := fake.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(source),
+		MaxNumberOfMessages: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Messages) != 0 {
+		t.Errorf("received %d messages before DeleteAfter passed, want none", len(out.Messages))
+	}
+
+	mu.Lock()
+	now = now.Add(deleteAfter + 2*time.Minute)
+	mu.Unlock()
+
+	var reappeared []string
+	for {
+		out, err := fake.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(source),
+			MaxNumberOfMessages: 10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		for _, message := range out.Messages {
+			reappeared = append(reappeared, aws.ToString(message.Body))
+		}
+	}
+
+	if got := sorted(reappeared); !slices.Equal(got, bodies("m", 25)) {
+		t.Errorf("%v reappeared in the source, want every message", got)
+	}
+}
+
+func TestPacer(t *testing.T) {
+	batch := make([]*types.SendMessageBatchRequestEntry, 10)
+	for i := range batch {
+		batch[i] = &types.SendMessageBatchRequestEntry{Id: aws.String(fmt.Sprint(i)), MessageBody: aws.String("x")}
+	}
+
+	tests := []struct {
+		name    string
+		opts    mover.Options
+		batches int
+		atLeast time.Duration
+		atMost  time.Duration
+	}{
+		{name: "no limits", batches: 5, atMost: 100 * time.Millisecond},
+		// A second's worth is sent straight away, the rest at the rate.
+		{name: "rate", opts: mover.Options{Rate: 20}, batches: 3, atLeast: 400 * time.Millisecond, atMost: 2 * time.Second},
+		{name: "batch interval", opts: mover.Options{BatchInterval: 200 * time.Millisecond}, batches: 3, atLeast: 350 * time.Millisecond, atMost: 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pacer := mover.NewPacer(test.opts)
+
+			start := time.Now()
+			for i := 0; i < test.batches; i++ {
+				if err := pacer.Wait(context.Background(), batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if elapsed := time.Since(start); elapsed < test.atLeast || elapsed > test.atMost {
+				t.Errorf("%d batches took %s, want between %s and %s", test.batches, elapsed, test.atLeast, test.atMost)
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		pacer := mover.NewPacer(mover.Options{Rate: 1})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := pacer.Wait(ctx, batch); !errors.Is(err, context.Canceled) {
+			t.Errorf("Wait = %v, want context.Canceled", err)
+		}
+	})
+}
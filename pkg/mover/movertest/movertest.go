@@ -0,0 +1,643 @@
+// Package movertest provides an in-memory SQS for testing code built on the
+// mover, or on any client of the SQS calls it makes, without AWS or an
+// emulator:
+//
+//	fake := movertest.New()
+//	source := fake.NewQueue("orders_dlq")
+//	destination := fake.NewQueue("orders")
+//	fake.Add(source, "a", "b", "c")
+//
+//	m := mover.New(fake, fake)
+//	result, err := m.Move(ctx, mover.Options{SourceQueueURL: source, DestinationQueueURL: destination})
+//
+// It implements the calls the mover makes: receives, sends, deletes,
+// visibility changes and queue attributes. Queues whose name ends in .fifo
+// keep FIFO semantics: a message group is held back while one of its
+// messages is in flight, and deduplication IDs are honoured for five
+// minutes. The Fake implements mover.SQSAPI and nothing else of the SQS
+// client.
+package movertest
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// queueURLPrefix starts the URLs of the fake queues, in the form real
+	// queue URLs take, so code that parses them keeps working.
+	queueURLPrefix = "https://sqs.us-east-1.amazonaws.com/123456789012/"
+
+	// deduplicationInterval is how long a FIFO queue remembers a
+	// deduplication ID.
+	deduplicationInterval = 5 * time.Minute
+
+	// defaultVisibilityTimeout is the visibility timeout of a receive that
+	// sets none, as for a queue created with the default.
+	defaultVisibilityTimeout = 30 * time.Second
+)
+
+// Fake is an in-memory SQS. It is safe for concurrent use, and one Fake can
+// serve as both the source and the destination client of a mover.
+type Fake struct {
+	// Err, when set, is called before every call with its operation name,
+	// such as "SendMessageBatch", and the queue URL. An error it returns
+	// fails the call, which lets tests throttle or break a step.
+	Err func(operation string, queueURL string) error
+
+	// Refuse, when set, is called for every entry sent. An error code it
+	// returns fails that entry alone, as SendMessageBatch reports partial
+	// failures; codes SQS retries on, such as InternalError, are reported
+	// as server side failures. It is called with the Fake locked, so it
+	// mustn't call the Fake.
+	Refuse func(queueURL string, entry *types.SendMessageBatchRequestEntry) string
+
+	// Now returns the current time, time.Now when nil. Tests can move it to
+	// make visibility timeouts, delays and deduplication expire.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	queues map[string]*queue
+	calls  map[string]int
+	next   int
+}
+
+// queue holds the messages of a fake queue in the order they were sent.
+type queue struct {
+	fifo     bool
+	messages []*message
+
+	// dedup holds the last message sent with each deduplication ID.
+	dedup map[string]*message
+}
+
+type message struct {
+	types.Message
+
+	visibleAt time.Time
+	receipt   string
+	received  int
+	sent      time.Time
+	group     string
+}
+
+// New returns a Fake without queues.
+func New() *Fake {
+	return &Fake{queues: map[string]*queue{}, calls: map[string]int{}}
+}
+
+// NewQueue creates an empty queue, FIFO when its name ends in .fifo, and
+// returns its URL. Creating a queue that exists empties it.
+func (f *Fake) NewQueue(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	url := queueURLPrefix + name
+	f.queues[url] = &queue{fifo: strings.HasSuffix(name, ".fifo"), dedup: map[string]*message{}}
+
+	return url
+}
+
+// Add sends messages with the given bodies to a queue. On a FIFO queue they
+// share one message group and get content based deduplication IDs.
+func (f *Fake) Add(queueURL string, bodies ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(queueURL)
+	for _, body := range bodies {
+		entry := &types.SendMessageBatchRequestEntry{MessageBody: aws.String(body)}
+		if q.fifo {
+			entry.MessageGroupId = aws.String("movertest")
+			entry.MessageDeduplicationId = aws.String(md5Hex(body))
+		}
+		f.enqueue(q, entry)
+	}
+}
+
+// Bodies returns the bodies of the messages a queue holds, in the order they
+// were sent, whether they are visible or not.
+func (f *Fake) Bodies(queueURL string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var bodies []string
+	for _, m := range f.queue(queueURL).messages {
+		bodies = append(bodies, aws.ToString(m.Body))
+	}
+
+	return bodies
+}
+
+// Messages returns copies of the messages a queue holds, in the order they
+// were sent, with all their attributes.
+func (f *Fake) Messages(queueURL string) []*types.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []*types.Message
+	for _, m := range f.queue(queueURL).messages {
+		out := f.output(m, []string{string(types.QueueAttributeNameAll)}, []string{"All"})
+		messages = append(messages, &out)
+	}
+
+	return messages
+}
+
+// Calls returns how many calls of an operation, such as "ReceiveMessage",
+// were made, failed ones included.
+func (f *Fake) Calls(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[operation]
+}
+
+func (f *Fake) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if err := f.call("ReceiveMessage", input.QueueUrl); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	now := f.now()
+
+	visibility := defaultVisibilityTimeout
+	if input.VisibilityTimeout != 0 {
+		visibility = time.Duration(input.VisibilityTimeout) * time.Second
+	}
+
+	attributeNames := make([]string, 0, len(input.AttributeNames)+len(input.MessageSystemAttributeNames))
+	for _, name := range input.AttributeNames {
+		attributeNames = append(attributeNames, string(name))
+	}
+	for _, name := range input.MessageSystemAttributeNames {
+		attributeNames = append(attributeNames, string(name))
+	}
+
+	limit := int(input.MaxNumberOfMessages)
+	if limit == 0 {
+		limit = 1
+	}
+
+	// A FIFO group with a message in flight is held back, so its messages
+	// are received in order.
+	held := map[string]bool{}
+	if q.fifo {
+		for _, m := range q.messages {
+			if m.visibleAt.After(now) && m.received > 0 {
+				held[m.group] = true
+			}
+		}
+	}
+
+	output := &sqs.ReceiveMessageOutput{}
+	for _, m := range q.messages {
+		if len(output.Messages) == limit {
+			break
+		}
+		if m.visibleAt.After(now) || held[m.group] {
+			if q.fifo {
+				held[m.group] = true
+			}
+			continue
+		}
+
+		f.next++
+		m.receipt = fmt.Sprintf("receipt-%d", f.next)
+		m.received++
+		m.visibleAt = now.Add(visibility)
+
+		output.Messages = append(output.Messages, f.output(m, attributeNames, input.MessageAttributeNames))
+	}
+
+	return output, nil
+}
+
+func (f *Fake) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	if err := f.call("SendMessageBatch", input.QueueUrl); err != nil {
+		return nil, err
+	}
+	if err := validateBatch(input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	output := &sqs.SendMessageBatchOutput{}
+
+	for i := range input.Entries {
+		entry := &input.Entries[i]
+		if failure := f.refuse(q, aws.ToString(input.QueueUrl), entry); failure != nil {
+			output.Failed = append(output.Failed, *failure)
+			continue
+		}
+
+		m := f.enqueue(q, entry)
+		output.Successful = append(output.Successful, types.SendMessageBatchResultEntry{
+			Id:               entry.Id,
+			MessageId:        m.MessageId,
+			MD5OfMessageBody: m.MD5OfBody,
+			SequenceNumber:   m.sequenceNumber(),
+		})
+	}
+
+	return output, nil
+}
+
+func (f *Fake) SendMessage(ctx context.Context, input *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if err := f.call("SendMessage", input.QueueUrl); err != nil {
+		return nil, err
+	}
+	if input.MessageBody == nil {
+		return nil, invalidParams("SendMessageInput", "MessageBody")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	entry := &types.SendMessageBatchRequestEntry{
+		Id:                      aws.String("0"),
+		MessageBody:             input.MessageBody,
+		MessageAttributes:       input.MessageAttributes,
+		MessageSystemAttributes: input.MessageSystemAttributes,
+		DelaySeconds:            input.DelaySeconds,
+		MessageGroupId:          input.MessageGroupId,
+		MessageDeduplicationId:  input.MessageDeduplicationId,
+	}
+
+	if failure := f.refuse(q, aws.ToString(input.QueueUrl), entry); failure != nil {
+		return nil, &smithy.GenericAPIError{Code: aws.ToString(failure.Code), Message: aws.ToString(failure.Message)}
+	}
+
+	m := f.enqueue(q, entry)
+	return &sqs.SendMessageOutput{MessageId: m.MessageId, MD5OfMessageBody: m.MD5OfBody, SequenceNumber: m.sequenceNumber()}, nil
+}
+
+func (f *Fake) DeleteMessageBatch(ctx context.Context, input *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	if err := f.call("DeleteMessageBatch", input.QueueUrl); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	output := &sqs.DeleteMessageBatchOutput{}
+
+	for _, entry := range input.Entries {
+		i := q.find(aws.ToString(entry.ReceiptHandle))
+		if i < 0 {
+			output.Failed = append(output.Failed, receiptFailure(entry.Id))
+			continue
+		}
+
+		q.messages = append(q.messages[:i], q.messages[i+1:]...)
+		output.Successful = append(output.Successful, types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+
+	return output, nil
+}
+
+func (f *Fake) ChangeMessageVisibilityBatch(ctx context.Context, input *sqs.ChangeMessageVisibilityBatchInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	if err := f.call("ChangeMessageVisibilityBatch", input.QueueUrl); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	now := f.now()
+	output := &sqs.ChangeMessageVisibilityBatchOutput{}
+
+	for _, entry := range input.Entries {
+		i := q.find(aws.ToString(entry.ReceiptHandle))
+		if i < 0 {
+			output.Failed = append(output.Failed, receiptFailure(entry.Id))
+			continue
+		}
+
+		q.messages[i].visibleAt = now.Add(time.Duration(entry.VisibilityTimeout) * time.Second)
+		output.Successful = append(output.Successful, types.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+	}
+
+	return output, nil
+}
+
+func (f *Fake) GetQueueAttributes(ctx context.Context, input *sqs.GetQueueAttributesInput, _ ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	if err := f.call("GetQueueAttributes", input.QueueUrl); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := f.queue(aws.ToString(input.QueueUrl))
+	now := f.now()
+
+	var visible, inFlight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			visible++
+		case m.received > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+
+	attributes := map[types.QueueAttributeName]string{
+		types.QueueAttributeNameApproximateNumberOfMessages:           strconv.Itoa(visible),
+		types.QueueAttributeNameApproximateNumberOfMessagesNotVisible: strconv.Itoa(inFlight),
+		types.QueueAttributeNameApproximateNumberOfMessagesDelayed:    strconv.Itoa(delayed),
+		types.QueueAttributeNameQueueArn:                              "arn:aws:sqs:us-east-1:123456789012:" + strings.TrimPrefix(aws.ToString(input.QueueUrl), queueURLPrefix),
+	}
+	if q.fifo {
+		attributes[types.QueueAttributeNameFifoQueue] = "true"
+	}
+
+	names := make([]string, len(input.AttributeNames))
+	for i, name := range input.AttributeNames {
+		names[i] = string(name)
+	}
+
+	output := &sqs.GetQueueAttributesOutput{Attributes: map[string]string{}}
+	for name, value := range attributes {
+		if wanted(names, string(name)) {
+			output.Attributes[string(name)] = value
+		}
+	}
+
+	return output, nil
+}
+
+// call counts a call and returns the error Err injects for it, or one for a
+// queue that doesn't exist.
+func (f *Fake) call(operation string, queueURL *string) error {
+	f.mu.Lock()
+	f.calls[operation]++
+	_, ok := f.queues[aws.ToString(queueURL)]
+	f.mu.Unlock()
+
+	if f.Err != nil {
+		if err := f.Err(operation, aws.ToString(queueURL)); err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		return &types.QueueDoesNotExist{
+			Message:           aws.String("The specified queue does not exist."),
+			ErrorCodeOverride: aws.String("AWS.SimpleQueueService.NonExistentQueue"),
+		}
+	}
+
+	return nil
+}
+
+// queue returns the queue of a URL, which must exist.
+func (f *Fake) queue(queueURL string) *queue {
+	q, ok := f.queues[queueURL]
+	if !ok {
+		panic("movertest: no queue " + queueURL)
+	}
+
+	return q
+}
+
+func (f *Fake) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+
+	return time.Now()
+}
+
+// refuse returns the failure of an entry Refuse or the FIFO rules refuse.
+func (f *Fake) refuse(q *queue, queueURL string, entry *types.SendMessageBatchRequestEntry) *types.BatchResultErrorEntry {
+	if q.fifo && entry.MessageGroupId == nil {
+		return &types.BatchResultErrorEntry{
+			Id:          entry.Id,
+			Code:        aws.String("MissingParameter"),
+			Message:     aws.String("The request must contain the parameter MessageGroupId."),
+			SenderFault: true,
+		}
+	}
+
+	if f.Refuse == nil {
+		return nil
+	}
+
+	code := f.Refuse(queueURL, entry)
+	if code == "" {
+		return nil
+	}
+
+	return &types.BatchResultErrorEntry{
+		Id:          entry.Id,
+		Code:        aws.String(code),
+		Message:     aws.String("refused by movertest"),
+		SenderFault: !serverFault(code),
+	}
+}
+
+// enqueue adds an entry to q, unless a FIFO queue saw its deduplication ID
+// lately, and returns its message.
+func (f *Fake) enqueue(q *queue, entry *types.SendMessageBatchRequestEntry) *message {
+	now := f.now()
+
+	var dedupID string
+	if q.fifo {
+		dedupID = aws.ToString(entry.MessageDeduplicationId)
+		if dedupID == "" {
+			dedupID = md5Hex(aws.ToString(entry.MessageBody))
+		}
+
+		// A duplicate is accepted and answered with the message it
+		// duplicates, but not stored.
+		if seen, ok := q.dedup[dedupID]; ok && now.Sub(seen.sent) < deduplicationInterval {
+			return seen
+		}
+	}
+
+	f.next++
+	m := &message{
+		Message: types.Message{
+			MessageId:         aws.String(fmt.Sprintf("00000000-0000-4000-8000-%012d", f.next)),
+			Body:              entry.MessageBody,
+			MD5OfBody:         aws.String(md5Hex(aws.ToString(entry.MessageBody))),
+			MessageAttributes: entry.MessageAttributes,
+			Attributes:        map[string]string{},
+		},
+		visibleAt: now.Add(time.Duration(entry.DelaySeconds) * time.Second),
+		sent:      now,
+		group:     aws.ToString(entry.MessageGroupId),
+	}
+
+	m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)] = strconv.FormatInt(now.UnixMilli(), 10)
+	m.Attributes[string(types.MessageSystemAttributeNameSenderId)] = "AIDAMOVERTEST"
+	if header, ok := entry.MessageSystemAttributes[string(types.MessageSystemAttributeNameForSendsAWSTraceHeader)]; ok {
+		m.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)] = aws.ToString(header.StringValue)
+	}
+	if q.fifo {
+		m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)] = aws.ToString(entry.MessageGroupId)
+		m.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)] = dedupID
+		m.Attributes[string(types.MessageSystemAttributeNameSequenceNumber)] = fmt.Sprintf("%020d", f.next)
+	}
+
+	if q.fifo {
+		q.dedup[dedupID] = m
+	}
+
+	q.messages = append(q.messages, m)
+	return m
+}
+
+// output returns a copy of m as a receive returns it, with the attributes
+// asked for.
+func (f *Fake) output(m *message, attributeNames []string, messageAttributeNames []string) types.Message {
+	out := m.Message
+	out.ReceiptHandle = aws.String(m.receipt)
+
+	attributes := map[string]string{
+		string(types.MessageSystemAttributeNameApproximateReceiveCount): strconv.Itoa(m.received),
+	}
+	for name, value := range m.Attributes {
+		attributes[name] = value
+	}
+
+	out.Attributes = nil
+	for name, value := range attributes {
+		if wanted(attributeNames, name) {
+			if out.Attributes == nil {
+				out.Attributes = map[string]string{}
+			}
+			out.Attributes[name] = value
+		}
+	}
+
+	out.MessageAttributes = nil
+	names := make([]string, 0, len(m.MessageAttributes))
+	for name := range m.MessageAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if wanted(messageAttributeNames, name) {
+			if out.MessageAttributes == nil {
+				out.MessageAttributes = map[string]types.MessageAttributeValue{}
+			}
+			out.MessageAttributes[name] = m.MessageAttributes[name]
+		}
+	}
+
+	return out
+}
+
+// sequenceNumber returns the sequence number of a message of a FIFO queue,
+// or nil.
+func (m *message) sequenceNumber() *string {
+	if number, ok := m.Attributes[string(types.MessageSystemAttributeNameSequenceNumber)]; ok {
+		return aws.String(number)
+	}
+
+	return nil
+}
+
+// find returns the index of the message a receipt handle was given for, or
+// -1 when it is unknown or was replaced by a later receive.
+func (q *queue) find(receipt string) int {
+	for i, m := range q.messages {
+		if m.receipt == receipt && m.received > 0 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// wanted reports whether a receive asking for names returns the attribute
+// name, as named, with All or, for message attributes, with a prefix
+// ending in .*.
+func wanted(names []string, name string) bool {
+	for _, n := range names {
+		if n == name || n == string(types.QueueAttributeNameAll) || n == ".*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(n, ".*"); ok && strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func receiptFailure(id *string) types.BatchResultErrorEntry {
+	return types.BatchResultErrorEntry{
+		Id:          id,
+		Code:        aws.String("ReceiptHandleIsInvalid"),
+		Message:     aws.String("The receipt handle is not valid."),
+		SenderFault: true,
+	}
+}
+
+// validateBatch checks what the SDK's own validation checks of a batch
+// before sending it, which a Fake called directly skips.
+func validateBatch(input *sqs.SendMessageBatchInput) error {
+	if len(input.Entries) == 0 {
+		return invalidParams("SendMessageBatchInput", "Entries")
+	}
+
+	for i, entry := range input.Entries {
+		if entry.Id == nil {
+			return invalidParams("SendMessageBatchInput", fmt.Sprintf("Entries[%d].Id", i))
+		}
+		if entry.MessageBody == nil {
+			return invalidParams("SendMessageBatchInput", fmt.Sprintf("Entries[%d].MessageBody", i))
+		}
+	}
+
+	return nil
+}
+
+// invalidParams is the error the SDK fails a call with when input misses the
+// required field.
+func invalidParams(input string, field string) error {
+	err := smithy.InvalidParamsError{Context: input}
+	err.Add(smithy.NewErrParamRequired(field))
+	return err
+}
+
+// serverFault reports whether SQS blames itself for a failure with code.
+func serverFault(code string) bool {
+	switch code {
+	case "InternalError", "ServiceUnavailable", "RequestThrottled", "ThrottlingException":
+		return true
+	}
+
+	return false
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
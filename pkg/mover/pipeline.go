@@ -0,0 +1,110 @@
+package mover
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// batchState says what a worker's receive step came back with.
+type batchState int
+
+const (
+	// batchReady hands over a batch of messages.
+	batchReady batchState = iota
+	// batchEnd means the source has nothing new left.
+	batchEnd
+	// batchStop means the move stopped on an error or because ctx ended.
+	batchStop
+)
+
+// sentBatch is a batch waiting to be deleted once it was sent.
+type sentBatch struct {
+	messages []*types.Message
+	kept     []*types.Message
+	result   Result
+}
+
+// pipeline runs one worker of a move with Prefetch as three stages joined by
+// bounded channels: receiving, sending, and deleting. Batches received or
+// sent before the move stopped are still seen through: received ones are
+// released, and sent ones deleted, so none is left in both queues.
+func (m *Mover) pipeline(ctx context.Context, opts Options, handle func(context.Context, []*types.Message) (Result, error), next func() ([]*types.Message, batchState), record func(Result, error), failed func() bool) {
+	received := make(chan []*types.Message, opts.Prefetch)
+	ended := make(chan bool, 1)
+
+	go func() {
+		defer close(received)
+		defer func() {
+			if v := recover(); v != nil {
+				record(Result{}, &PanicError{Value: v, Stack: debug.Stack()})
+				ended <- false
+			}
+		}()
+
+		for {
+			messages, state := next()
+			if state != batchReady {
+				ended <- state == batchEnd
+				return
+			}
+
+			received <- messages
+		}
+	}()
+
+	// Only the default Transfer is split into a send and a delete stage; a
+	// Handle gets the batches in order as they were received.
+	split := opts.Handle == nil
+
+	var sent chan sentBatch
+	var deleting sync.WaitGroup
+
+	if split {
+		sent = make(chan sentBatch, opts.Prefetch)
+
+		deleting.Add(1)
+		go func() {
+			defer deleting.Done()
+
+			for batch := range sent {
+				record(m.finishBatch(context.WithoutCancel(ctx), opts, without(batch.messages, batch.kept), batch.result))
+				m.inFlight.Add(-int64(len(batch.messages)))
+			}
+		}()
+	}
+
+	for messages := range received {
+		if failed() || ctx.Err() != nil {
+			m.Release(context.WithoutCancel(ctx), opts.SourceQueueURL, messages)
+			m.inFlight.Add(-int64(len(messages)))
+			continue
+		}
+
+		if !split {
+			record(m.handleBatch(ctx, opts, handle, messages))
+			m.inFlight.Add(-int64(len(messages)))
+			continue
+		}
+
+		result, kept, err := m.sendBatch(context.WithoutCancel(ctx), opts, messages)
+		if err != nil {
+			record(result, err)
+			m.inFlight.Add(-int64(len(messages)))
+			continue
+		}
+
+		sent <- sentBatch{messages: messages, kept: kept, result: result}
+	}
+
+	if split {
+		close(sent)
+		deleting.Wait()
+	}
+
+	if <-ended && !failed() {
+		record(m.handleBatch(ctx, opts, handle, nil))
+	}
+}
@@ -0,0 +1,248 @@
+package mover
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// rateLimiter paces receives across all workers of a move, so the configured
+// ceilings hold for the move as a whole whatever the number of workers.
+// Messages are reserved before a receive; bytes are only known afterwards and
+// are charged then, so the next receive waits until they are paid off.
+// Batches also start at least interval apart. A nil limiter never waits.
+// Both rates are ramped up from a tenth to the full rate over rampUp.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	messages  *tokenBucket
+	bytes     *tokenBucket
+	nextBatch time.Time
+}
+
+func newRateLimiter(rate float64, byteRate float64, interval time.Duration, rampUp time.Duration) *rateLimiter {
+	if rate <= 0 && byteRate <= 0 && interval <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &rateLimiter{
+		interval: interval,
+		messages: newTokenBucket(rate, rampUp, now),
+		bytes:    newTokenBucket(byteRate, rampUp, now),
+	}
+}
+
+// take reserves n messages for the next batch and waits until the batch may
+// start, or ctx is done.
+func (l *rateLimiter) take(ctx context.Context, n int64) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+
+	now := time.Now()
+	start := now
+
+	for _, ready := range []time.Time{l.messages.reserve(now, n), l.bytes.reserve(now, 0)} {
+		if ready.After(start) {
+			start = ready
+		}
+	}
+
+	if l.interval > 0 {
+		if l.nextBatch.After(start) {
+			start = l.nextBatch
+		}
+		l.nextBatch = start.Add(l.interval)
+	}
+
+	l.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// received settles a reservation of size messages once the receive returned
+// messages: the part that wasn't received is given back and the bytes that
+// were are charged.
+func (l *rateLimiter) received(size int64, messages []*types.Message) {
+	if l == nil {
+		return
+	}
+
+	var bytes int64
+	for _, message := range messages {
+		bytes += messageSize(message)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.messages.reserve(now, int64(len(messages))-size)
+	l.bytes.reserve(now, bytes)
+}
+
+// tokenBucket refills at rate tokens per second and holds at most a second's
+// worth. Reservations may overdraw it; the debt is paid off before the next
+// one is ready. A bucket with no rate is always ready. While ramping up, the
+// rate it refills at grows from a tenth of rate to all of it.
+type tokenBucket struct {
+	rate     float64
+	tokens   float64
+	refilled time.Time
+
+	started time.Time
+	rampUp  time.Duration
+}
+
+// minRampShare is the share of the full rate a ramp up starts at.
+const minRampShare = 0.1
+
+func newTokenBucket(rate float64, rampUp time.Duration, now time.Time) *tokenBucket {
+	b := &tokenBucket{rate: rate, refilled: now, started: now, rampUp: rampUp}
+	b.tokens = b.rateAt(now)
+
+	return b
+}
+
+// rateAt is the rate the bucket refills at by now.
+func (b *tokenBucket) rateAt(now time.Time) float64 {
+	if b.rampUp <= 0 {
+		return b.rate
+	}
+
+	share := float64(now.Sub(b.started)) / float64(b.rampUp)
+	return b.rate * min(max(share, minRampShare), 1)
+}
+
+// issued counts the tokens the bucket refilled with in the first elapsed
+// seconds: at a tenth of the rate until the ramp catches up with it, then
+// rising evenly to the full rate, and at the full rate after that.
+func (b *tokenBucket) issued(elapsed float64) float64 {
+	ramp := b.rampUp.Seconds()
+	if ramp <= 0 {
+		return b.rate * elapsed
+	}
+
+	floor := minRampShare * ramp
+	switch {
+	case elapsed <= floor:
+		return minRampShare * b.rate * elapsed
+	case elapsed <= ramp:
+		return minRampShare*b.rate*floor + b.rate/(2*ramp)*(elapsed*elapsed-floor*floor)
+	default:
+		return b.issued(ramp) + b.rate*(elapsed-ramp)
+	}
+}
+
+// issuedBy is the inverse of issued: the seconds the bucket takes to refill
+// with tokens.
+func (b *tokenBucket) issuedBy(tokens float64) float64 {
+	ramp := b.rampUp.Seconds()
+	if ramp <= 0 {
+		return tokens / b.rate
+	}
+
+	floor := minRampShare * ramp
+	switch {
+	case tokens <= b.issued(floor):
+		return tokens / (minRampShare * b.rate)
+	case tokens <= b.issued(ramp):
+		return math.Sqrt(floor*floor + 2*ramp*(tokens-b.issued(floor))/b.rate)
+	default:
+		return ramp + (tokens-b.issued(ramp))/b.rate
+	}
+}
+
+// reserve takes n tokens, or gives them back when n is negative, and returns
+// when the bucket is out of debt again.
+func (b *tokenBucket) reserve(now time.Time, n int64) time.Time {
+	if b.rate <= 0 {
+		return now
+	}
+
+	elapsed := now.Sub(b.started).Seconds()
+
+	b.tokens += b.issued(elapsed) - b.issued(b.refilled.Sub(b.started).Seconds()) - float64(n)
+	if rate := b.rateAt(now); b.tokens > rate {
+		b.tokens = rate
+	}
+	b.refilled = now
+
+	if b.tokens >= 0 {
+		return now
+	}
+
+	ready := b.issuedBy(b.issued(elapsed) - b.tokens)
+	return b.started.Add(time.Duration(ready * float64(time.Second)))
+}
+
+// messageSize counts a message the way SQS counts it against the payload
+// limit: the body and the name, type and value of every message attribute.
+func messageSize(message *types.Message) int64 {
+	size := int64(len(aws.ToString(message.Body)))
+
+	for name, value := range message.MessageAttributes {
+		size += int64(len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue)) + len(value.BinaryValue))
+	}
+
+	return size
+}
+
+// Pacer paces batches sent with Send, which doesn't look at the rate limits
+// of its options, the way Move paces its receives: by the Rate, ByteRate,
+// RampUp and BatchInterval of the options it was made with. A Pacer without
+// limits never waits.
+type Pacer struct {
+	limiter *rateLimiter
+}
+
+// NewPacer returns a Pacer for the rate limits of opts. A ramp up starts
+// when it is made.
+func NewPacer(opts Options) *Pacer {
+	return &Pacer{limiter: newRateLimiter(opts.Rate, opts.ByteRate, opts.BatchInterval, opts.RampUp)}
+}
+
+// Wait waits until entries may be sent, or ctx is done, and charges their
+// bytes to the batches after them.
+func (p *Pacer) Wait(ctx context.Context, entries []*types.SendMessageBatchRequestEntry) error {
+	if p.limiter == nil {
+		return ctx.Err()
+	}
+
+	if err := p.limiter.take(ctx, int64(len(entries))); err != nil {
+		return err
+	}
+
+	var bytes int64
+	for _, entry := range entries {
+		bytes += entrySize(entry)
+	}
+
+	p.limiter.mu.Lock()
+	defer p.limiter.mu.Unlock()
+
+	p.limiter.bytes.reserve(time.Now(), bytes)
+	return nil
+}
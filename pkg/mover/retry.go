@@ -0,0 +1,112 @@
+package mover
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry; it doubles with
+	// every further attempt up to retryMaxDelay.
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 20 * time.Second
+)
+
+// throttlingCodes are the error codes SQS and the SDK use when requests are
+// being throttled.
+var throttlingCodes = map[string]bool{
+	"RequestThrottled":                        true,
+	"AWS.SimpleQueueService.RequestThrottled": true,
+	"ThrottlingException":                     true,
+	"Throttling":                              true,
+	"RequestLimitExceeded":                    true,
+	"RequestTimeout":                          true,
+	"ServiceUnavailable":                      true,
+	"InternalError":                           true,
+}
+
+// isTransient reports whether a failed request is worth retrying: throttling,
+// server side errors and messages stored with the wrong digest are, anything
+// the caller got wrong isn't.
+func isTransient(err error) bool {
+	var failure *awshttp.ResponseError
+	if errors.As(err, &failure) && failure.HTTPStatusCode() >= 500 {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return throttlingCodes[apiErr.ErrorCode()] || apiErr.ErrorCode() == ChecksumMismatchCode
+	}
+
+	return false
+}
+
+// retryable reports whether every failed entry of a batch was a server side
+// failure, so sending the entries again can succeed.
+func retryable(failed []types.BatchResultErrorEntry) bool {
+	for _, entry := range failed {
+		if entry.SenderFault {
+			return false
+		}
+	}
+
+	return true
+}
+
+// failedIDs returns the IDs of the failed entries of a batch.
+func failedIDs(failed []types.BatchResultErrorEntry) map[string]bool {
+	ids := make(map[string]bool, len(failed))
+	for _, entry := range failed {
+		ids[aws.ToString(entry.Id)] = true
+	}
+
+	return ids
+}
+
+// retry counts a retry of op for Retries and the move it belongs to, reports
+// it as a Retry event, and waits before it like backoff. err is nil when
+// entries of a batch failed.
+func (m *Mover) retry(ctx context.Context, op string, attempt int, err error) {
+	m.retries.Add(1)
+
+	run := m.run(ctx)
+	run.retries.Add(1)
+	run.emit(&Retry{Op: op, Attempt: attempt, Err: err})
+
+	backoff(attempt)
+}
+
+// backoff waits before retry number attempt, counted from zero, using
+// exponential backoff with full jitter.
+func backoff(attempt int) {
+	time.Sleep(time.Duration(rand.Int63n(int64(backoffLimit(attempt)))))
+}
+
+// backoffLimit is the longest backoff waits before retry number attempt.
+func backoffLimit(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	return delay
+}
+
+// retryWindow is the longest a request retried maxRetries times can spend
+// backing off.
+func retryWindow(maxRetries int) time.Duration {
+	var window time.Duration
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		window += backoffLimit(attempt)
+	}
+
+	return window
+}
@@ -0,0 +1,98 @@
+package mover
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// runState is what one move keeps to itself, so several moves can share a
+// Mover: the deletions DeleteAfter deferred, the messages SkipFailed set
+// aside, the retries made, the bytes carried and where to report sequence
+// numbers and events.
+type runState struct {
+	mu      sync.Mutex
+	pending []pendingDelete
+	aside   *skippedSet
+
+	retries   atomic.Int64
+	undeleted atomic.Int64
+
+	receivedBytes atomic.Int64
+	sentBytes     atomic.Int64
+	chunks        atomic.Int64
+
+	// sequenced and events are Options.Sequenced and Options.Events of the
+	// move.
+	sequenced func(queueURL string, entries []*types.SendMessageBatchRequestEntry, sequenceNumbers []string)
+	events    func(Event)
+}
+
+// runStateKey is the context key Move stores its runState under, so the
+// Transfer calls of its workers and of Handle find it.
+type runStateKey struct{}
+
+func withRunState(ctx context.Context, run *runState) context.Context {
+	return context.WithValue(ctx, runStateKey{}, run)
+}
+
+// run returns the state of the move ctx belongs to, or the Mover's own for
+// calls made outside Move.
+func (m *Mover) run(ctx context.Context) *runState {
+	if run, ok := ctx.Value(runStateKey{}).(*runState); ok {
+		return run
+	}
+
+	return &m.state
+}
+
+// received counts the bytes and billed chunks of a receive.
+func (r *runState) received(queueURL string, messages []*types.Message) {
+	var size int64
+	for _, message := range messages {
+		size += messageSize(message)
+	}
+
+	r.receivedBytes.Add(size)
+	r.chunks.Add(payloadChunks(size))
+	r.emit(&BatchReceived{QueueURL: queueURL, Messages: messages, Bytes: size})
+}
+
+// sent counts the bytes of the entries a send delivered, which the queue gave
+// messageIDs, and the billed chunks of the call, whose payload is size.
+func (r *runState) sent(queueURL string, entries []*types.SendMessageBatchRequestEntry, messageIDs []string, size int64) {
+	var accepted int64
+	for _, entry := range entries {
+		accepted += entrySize(entry)
+	}
+
+	r.sentBytes.Add(accepted)
+	r.chunks.Add(payloadChunks(size))
+
+	if len(entries) > 0 {
+		r.emit(&BatchSent{QueueURL: queueURL, Entries: entries, MessageIDs: messageIDs, Bytes: accepted})
+	}
+}
+
+// totals copies the counts kept for the whole move into total.
+func (r *runState) totals(total *Result) {
+	total.Retries = int(r.retries.Load())
+	total.Undeleted = int(r.undeleted.Load())
+	total.ReceivedBytes = r.receivedBytes.Load()
+	total.SentBytes = r.sentBytes.Load()
+	total.PayloadChunks = r.chunks.Load()
+}
+
+// asideSet returns the messages SkipFailed left in the source.
+func (r *runState) asideSet() *skippedSet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.aside == nil {
+		r.aside = newSkippedSet()
+	}
+
+	return r.aside
+}
@@ -0,0 +1,124 @@
+package mover
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func init() {
+	RegisterSink("s3", openS3Sink)
+}
+
+// s3Sink writes every batch to an object of its own under a prefix, as JSON
+// lines with the field names of the dump files of the sqs command, so the
+// objects can be loaded back into a queue with sqs load.
+type s3Sink struct {
+	s3     s3API
+	bucket string
+	prefix string
+}
+
+// s3API is the part of the S3 client s3Sink calls.
+type s3API interface {
+	PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// s3Record is one line of an object written by s3Sink.
+type s3Record struct {
+	Body                   string                       `json:"body"`
+	MessageGroupID         string                       `json:"message_group_id,omitempty"`
+	MessageDeduplicationID string                       `json:"message_deduplication_id,omitempty"`
+	TraceHeader            string                       `json:"aws_trace_header,omitempty"`
+	MessageAttributes      map[string]s3RecordAttribute `json:"message_attributes,omitempty"`
+}
+
+type s3RecordAttribute struct {
+	DataType    string `json:"data_type"`
+	StringValue string `json:"string_value,omitempty"`
+	BinaryValue []byte `json:"binary_value,omitempty"`
+}
+
+// openS3Sink opens s3://bucket/prefix. Objects are named
+// prefix/YYYY/MM/DD/HHMMSS.NNNNNNNNN-RANDOM.jsonl after the time they were
+// written.
+func openS3Sink(cfg aws.Config, destination *url.URL) (Sink, error) {
+	if destination.Host == "" {
+		return nil, fmt.Errorf("%s names no bucket, use s3://bucket/prefix", destination)
+	}
+
+	return &s3Sink{
+		s3:     s3.NewFromConfig(cfg),
+		bucket: destination.Host,
+		prefix: strings.Trim(destination.Path, "/"),
+	}, nil
+}
+
+func (s *s3Sink) Send(ctx context.Context, entries []*types.SendMessageBatchRequestEntry) ([]types.BatchResultErrorEntry, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+
+	for _, entry := range entries {
+		record := s3Record{
+			Body:                   aws.ToString(entry.MessageBody),
+			MessageGroupID:         aws.ToString(entry.MessageGroupId),
+			MessageDeduplicationID: aws.ToString(entry.MessageDeduplicationId),
+		}
+
+		if header, ok := entry.MessageSystemAttributes[string(types.MessageSystemAttributeNameForSendsAWSTraceHeader)]; ok {
+			record.TraceHeader = aws.ToString(header.StringValue)
+		}
+
+		if len(entry.MessageAttributes) > 0 {
+			record.MessageAttributes = make(map[string]s3RecordAttribute, len(entry.MessageAttributes))
+			for name, value := range entry.MessageAttributes {
+				record.MessageAttributes[name] = s3RecordAttribute{
+					DataType:    aws.ToString(value.DataType),
+					StringValue: aws.ToString(value.StringValue),
+					BinaryValue: value.BinaryValue,
+				}
+			}
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := s.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key(time.Now())),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+
+	return nil, err
+}
+
+func (s *s3Sink) Close() error {
+	return nil
+}
+
+// key names the object of a batch written at t. The random part keeps the
+// batches of concurrent workers apart.
+func (s *s3Sink) key(t time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	name := t.UTC().Format("2006/01/02/150405.000000000") + "-" + hex.EncodeToString(suffix) + ".jsonl"
+	if s.prefix == "" {
+		return name
+	}
+
+	return s.prefix + "/" + name
+}
@@ -0,0 +1,59 @@
+package mover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ShortPoll makes a ReceiveMessage call return straight away, whatever the
+// ReceiveMessageWaitTimeSeconds of the queue. The SDK leaves out a
+// WaitTimeSeconds of zero, which lets the queue's default long poll apply,
+// so ShortPoll writes it into the request.
+func ShortPoll(o *sqs.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Serialize.Insert(shortPoll{}, "OperationSerializer", middleware.After)
+	})
+}
+
+type shortPoll struct{}
+
+func (shortPoll) ID() string {
+	return "ShortPoll"
+}
+
+func (shortPoll) HandleSerialize(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (middleware.SerializeOutput, middleware.Metadata, error) {
+	req, ok := in.Request.(*smithyhttp.Request)
+	if !ok || req.GetStream() == nil {
+		return next.HandleSerialize(ctx, in)
+	}
+
+	body, err := io.ReadAll(req.GetStream())
+	if err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, fmt.Errorf("short poll: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, fmt.Errorf("short poll: %w", err)
+	}
+
+	if _, ok := fields["WaitTimeSeconds"]; !ok {
+		fields["WaitTimeSeconds"] = json.RawMessage("0")
+		if body, err = json.Marshal(fields); err != nil {
+			return middleware.SerializeOutput{}, middleware.Metadata{}, fmt.Errorf("short poll: %w", err)
+		}
+	}
+
+	if in.Request, err = req.SetStream(bytes.NewReader(body)); err != nil {
+		return middleware.SerializeOutput{}, middleware.Metadata{}, fmt.Errorf("short poll: %w", err)
+	}
+
+	return next.HandleSerialize(ctx, in)
+}
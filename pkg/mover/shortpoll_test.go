@@ -0,0 +1,62 @@
+package mover_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/mercury2269/sqsmover/pkg/mover"
+)
+
+func TestShortPoll(t *testing.T) {
+	tests := []struct {
+		name  string
+		input sqs.ReceiveMessageInput
+		opts  []func(*sqs.Options)
+		want  string
+	}{
+		{name: "queue default", want: ""},
+		{name: "short poll", opts: []func(*sqs.Options){mover.ShortPoll}, want: "0"},
+		{name: "long poll", input: sqs.ReceiveMessageInput{WaitTimeSeconds: 5}, opts: []func(*sqs.Options){mover.ShortPoll}, want: "5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got json.RawMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(body, &fields); err != nil {
+					t.Errorf("request body %s: %s", body, err)
+				}
+				got = fields["WaitTimeSeconds"]
+
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			client := sqs.New(sqs.Options{
+				Region:       "us-east-1",
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  aws.AnonymousCredentials{},
+			})
+
+			input := test.input
+			input.QueueUrl = aws.String(server.URL + "/123456789012/orders")
+			if _, err := client.ReceiveMessage(context.Background(), &input, test.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != test.want {
+				t.Errorf("WaitTimeSeconds = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package mover
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// Sink is a destination other than an SQS queue, such as a Kafka topic or an
+// S3 prefix, named by a URL like kafka://broker/topic.
+type Sink interface {
+	// Send delivers a batch of entries. It returns once they are stored for
+	// good, since their source messages are deleted next. Entries it
+	// refused are returned as failures naming their IDs, like
+	// SendMessageBatch reports them; an error fails the whole batch, and is
+	// retried when it is a smithy.APIError with a throttling code or a
+	// server side status.
+	Send(ctx context.Context, entries []*types.SendMessageBatchRequestEntry) ([]types.BatchResultErrorEntry, error)
+
+	// Close releases the sink once the move is over.
+	Close() error
+}
+
+// SinkFactory opens the sink a destination URL names. cfg carries the
+// credentials and region of the destination side, for sinks that call AWS.
+type SinkFactory func(cfg aws.Config, destination *url.URL) (Sink, error)
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]SinkFactory{}
+)
+
+// RegisterSink makes destinations of the form scheme://... open sinks with
+// factory. It is meant to be called from the init function of a package
+// providing a sink, so that importing it adds the scheme to the sqs command,
+// and panics when the scheme is already registered.
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	if factory == nil {
+		panic("mover: RegisterSink factory is nil")
+	}
+	if _, ok := sinks[scheme]; ok {
+		panic("mover: RegisterSink called twice for scheme " + scheme)
+	}
+
+	sinks[scheme] = factory
+}
+
+// SinkSchemes returns the registered schemes in order.
+func SinkSchemes() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	schemes := make([]string, 0, len(sinks))
+	for scheme := range sinks {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// SinkScheme returns the scheme of a destination of the form scheme://...,
+// whether or not a sink is registered for it.
+func SinkScheme(destination string) (string, bool) {
+	scheme, _, ok := strings.Cut(destination, "://")
+	if !ok || scheme == "" {
+		return "", false
+	}
+
+	return scheme, true
+}
+
+// IsSink reports whether destination names a sink of a registered scheme.
+func IsSink(destination string) bool {
+	scheme, ok := SinkScheme(destination)
+	if !ok {
+		return false
+	}
+
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	_, ok = sinks[scheme]
+	return ok
+}
+
+// OpenSink opens the sink destination names with the factory registered for
+// its scheme.
+func OpenSink(cfg aws.Config, destination string) (Sink, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	sinksMu.RLock()
+	factory, ok := sinks[u.Scheme]
+	sinksMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no sink is registered for %s:// destinations", u.Scheme)
+	}
+
+	return factory(cfg, u)
+}
+
+// sinkClient sends the entries addressed to the sink's URL to the sink, and
+// every other call to the SQS client it wraps, such as sends to
+// DivertQueueURL or FailedQueueURL.
+type sinkClient struct {
+	SQSAPI
+
+	url  string
+	sink Sink
+}
+
+// NewSinkClient returns a destination client for New that sends to sink
+// what is addressed to url, and the rest through destination. Pass url as
+// DestinationQueueURL.
+func NewSinkClient(destination SQSAPI, url string, sink Sink) SQSAPI {
+	return &sinkClient{SQSAPI: destination, url: url, sink: sink}
+}
+
+func (c *sinkClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, opts ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	if aws.ToString(input.QueueUrl) != c.url {
+		return c.SQSAPI.SendMessageBatch(ctx, input, opts...)
+	}
+
+	entries := make([]*types.SendMessageBatchRequestEntry, len(input.Entries))
+	for i := range input.Entries {
+		entries[i] = &input.Entries[i]
+	}
+
+	failed, err := c.sink.Send(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := failedIDs(failed)
+	output := &sqs.SendMessageBatchOutput{Failed: failed}
+	for _, entry := range input.Entries {
+		if !ids[aws.ToString(entry.Id)] {
+			output.Successful = append(output.Successful, types.SendMessageBatchResultEntry{Id: entry.Id})
+		}
+	}
+
+	return output, nil
+}
+
+func (c *sinkClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if aws.ToString(input.QueueUrl) != c.url {
+		return c.SQSAPI.SendMessage(ctx, input, opts...)
+	}
+
+	failed, err := c.sink.Send(ctx, []*types.SendMessageBatchRequestEntry{{
+		Id:                      aws.String("0"),
+		MessageBody:             input.MessageBody,
+		MessageAttributes:       input.MessageAttributes,
+		MessageSystemAttributes: input.MessageSystemAttributes,
+		DelaySeconds:            input.DelaySeconds,
+		MessageGroupId:          input.MessageGroupId,
+		MessageDeduplicationId:  input.MessageDeduplicationId,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(failed) > 0 {
+		return nil, &smithy.GenericAPIError{Code: aws.ToString(failed[0].Code), Message: aws.ToString(failed[0].Message)}
+	}
+
+	return &sqs.SendMessageOutput{}, nil
+}
@@ -0,0 +1,180 @@
+package mover
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func init() {
+	RegisterSink("sns", openSNSSink)
+}
+
+// snsSink publishes every batch to an SNS topic, so all of its subscribers
+// get the messages again. Bodies that are SNS notifications, as a queue
+// subscribed without raw message delivery receives them, are unwrapped to
+// the message they carry, with its subject and message attributes.
+type snsSink struct {
+	sns   snsAPI
+	topic string
+}
+
+// snsAPI is the part of the SNS client snsSink calls.
+type snsAPI interface {
+	PublishBatch(ctx context.Context, input *sns.PublishBatchInput, opts ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// snsEnvelope is the JSON document SNS delivers to a queue subscribed
+// without raw message delivery.
+type snsEnvelope struct {
+	Type              string                          `json:"Type"`
+	TopicArn          string                          `json:"TopicArn"`
+	Subject           string                          `json:"Subject"`
+	Message           *string                         `json:"Message"`
+	MessageAttributes map[string]snsEnvelopeAttribute `json:"MessageAttributes"`
+}
+
+type snsEnvelopeAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// SNSSinkURL returns the destination URL of the sink publishing to the topic
+// topicARN.
+func SNSSinkURL(topicARN string) string {
+	return "sns:///" + topicARN
+}
+
+// openSNSSink opens sns:///TOPIC-ARN. The topic is reached in the region of
+// its ARN, with the credentials of the destination side.
+func openSNSSink(cfg aws.Config, destination *url.URL) (Sink, error) {
+	topic := strings.TrimPrefix(destination.Path, "/")
+
+	parsed, err := arn.Parse(topic)
+	if err != nil || parsed.Service != "sns" || destination.Host != "" {
+		return nil, fmt.Errorf("%s names no topic, use sns:///arn:aws:sns:REGION:ACCOUNT:TOPIC", destination)
+	}
+
+	return &snsSink{
+		sns: sns.NewFromConfig(cfg, func(o *sns.Options) {
+			o.Region = parsed.Region
+		}),
+		topic: topic,
+	}, nil
+}
+
+func (s *snsSink) Send(ctx context.Context, entries []*types.SendMessageBatchRequestEntry) ([]types.BatchResultErrorEntry, error) {
+	input := &sns.PublishBatchInput{TopicArn: aws.String(s.topic)}
+
+	var failed []types.BatchResultErrorEntry
+	for _, entry := range entries {
+		publish, err := snsEntry(entry)
+		if err != nil {
+			failed = append(failed, types.BatchResultErrorEntry{
+				Id:          entry.Id,
+				Code:        aws.String("ParameterValueInvalid"),
+				Message:     aws.String(err.Error()),
+				SenderFault: true,
+			})
+			continue
+		}
+
+		input.PublishBatchRequestEntries = append(input.PublishBatchRequestEntries, publish)
+	}
+
+	if len(input.PublishBatchRequestEntries) == 0 {
+		return failed, nil
+	}
+
+	output, err := s.sns.PublishBatch(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range output.Failed {
+		failed = append(failed, types.BatchResultErrorEntry{
+			Id:          entry.Id,
+			Code:        entry.Code,
+			Message:     entry.Message,
+			SenderFault: entry.SenderFault,
+		})
+	}
+
+	return failed, nil
+}
+
+func (s *snsSink) Close() error {
+	return nil
+}
+
+// snsEntry turns a send entry into the entry publishing it. The message
+// attributes of the entry win over those of an SNS envelope of the same
+// name. Delays and trace headers have no SNS counterpart and are dropped.
+func snsEntry(entry *types.SendMessageBatchRequestEntry) (snstypes.PublishBatchRequestEntry, error) {
+	publish := snstypes.PublishBatchRequestEntry{
+		Id:                     entry.Id,
+		Message:                entry.MessageBody,
+		MessageGroupId:         entry.MessageGroupId,
+		MessageDeduplicationId: entry.MessageDeduplicationId,
+	}
+
+	attributes := map[string]snstypes.MessageAttributeValue{}
+
+	if envelope, ok := unwrapSNSEnvelope(aws.ToString(entry.MessageBody)); ok {
+		publish.Message = envelope.Message
+		if envelope.Subject != "" {
+			publish.Subject = aws.String(envelope.Subject)
+		}
+
+		for name, attribute := range envelope.MessageAttributes {
+			value := snstypes.MessageAttributeValue{DataType: aws.String(attribute.Type)}
+			if attribute.Type == "Binary" {
+				decoded, err := base64.StdEncoding.DecodeString(attribute.Value)
+				if err != nil {
+					return snstypes.PublishBatchRequestEntry{}, fmt.Errorf("binary message attribute %s of the SNS envelope is not base64: %s", name, err)
+				}
+				value.BinaryValue = decoded
+			} else {
+				value.StringValue = aws.String(attribute.Value)
+			}
+			attributes[name] = value
+		}
+	}
+
+	for name, attribute := range entry.MessageAttributes {
+		attributes[name] = snstypes.MessageAttributeValue{
+			DataType:    attribute.DataType,
+			StringValue: attribute.StringValue,
+			BinaryValue: attribute.BinaryValue,
+		}
+	}
+
+	if len(attributes) > 0 {
+		publish.MessageAttributes = attributes
+	}
+
+	return publish, nil
+}
+
+// unwrapSNSEnvelope returns the SNS notification body holds, when it is one.
+func unwrapSNSEnvelope(body string) (snsEnvelope, bool) {
+	var envelope snsEnvelope
+	if !strings.HasPrefix(strings.TrimSpace(body), "{") || json.Unmarshal([]byte(body), &envelope) != nil {
+		return snsEnvelope{}, false
+	}
+
+	if envelope.Type != "Notification" || envelope.TopicArn == "" || envelope.Message == nil {
+		return snsEnvelope{}, false
+	}
+
+	return envelope, true
+}